@@ -0,0 +1,83 @@
+package endpoints
+
+import (
+	"net/http"
+	"time"
+)
+
+// AccessLogEntry is a record of a served request, see Server.AccessLogger.
+type AccessLogEntry struct {
+	// Time is when the request arrived.
+	Time time.Time
+	// Method is the requested method, e.g. "MyService.Get", even if there's
+	// no such method. It's empty if the request path names none.
+	Method string
+	// ClientID is the client ID of the token validated while serving the
+	// request, if any. It's empty for anonymous requests, requests which
+	// failed authentication and methods which never asked for the user.
+	ClientID string
+	// Operator and ImpersonatedUser are emails of the caller and the user
+	// it acted as, if the request was impersonated.
+	Operator, ImpersonatedUser string
+	// Status is HTTP status of the response.
+	Status int
+	// Latency is how long it took to serve the request.
+	Latency time.Duration
+	// BytesOut is the size of the response body.
+	BytesOut int64
+	// RequestID is the ID App Engine assigned to the request, see
+	// AppEngineRequestID.
+	RequestID string
+}
+
+// AccessLogger records served requests, e.g. for auditing or billing.
+type AccessLogger interface {
+	// LogAccess is called once request r has been served.
+	// It must be safe for concurrent use.
+	LogAccess(r *http.Request, e *AccessLogEntry)
+}
+
+// accessLog collects an AccessLogEntry while a request is being served.
+type accessLog struct {
+	w     *statusWriter
+	start time.Time
+	entry AccessLogEntry
+	token *tokenState
+	imp   *impersonation
+}
+
+// newAccessLog starts an access log of a request responded to through w.
+func newAccessLog(w http.ResponseWriter) *accessLog {
+	return &accessLog{
+		w:     &statusWriter{ResponseWriter: w},
+		start: time.Now(),
+		entry: AccessLogEntry{Time: currentUTC()},
+	}
+}
+
+// setToken makes the access log pick the client ID of a token validated
+// in c, which must be the request context, once the request is served.
+func (a *accessLog) setToken(c Context) {
+	if h, ok := c.(tokenHolder); ok {
+		a.token = h.validatedToken()
+	}
+}
+
+// logAccess passes the access log of request r to s.AccessLogger.
+func (s *Server) logAccess(r *http.Request, a *accessLog) {
+	e := a.entry
+	e.Status = a.w.status
+	if e.Status == 0 {
+		e.Status = http.StatusOK
+	}
+	e.Latency = time.Since(a.start)
+	e.BytesOut = a.w.bytes
+	e.RequestID = appEngineRequestID(r)
+	if a.token != nil {
+		e.ClientID = a.token.issuedTo()
+	}
+	if a.imp != nil {
+		e.Operator, e.ImpersonatedUser = a.imp.operator.Email, a.imp.email
+	}
+	s.AccessLogger.LogAccess(r, &e)
+}
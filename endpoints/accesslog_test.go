@@ -0,0 +1,90 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+type recordingAccessLogger struct {
+	entries []*AccessLogEntry
+}
+
+func (l *recordingAccessLogger) LogAccess(r *http.Request, e *AccessLogEntry) {
+	l.entries = append(l.entries, e)
+}
+
+func TestServerAccessLogger(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	origParser, origCurrentUTC := jwtParser, currentUTC
+	defer func() {
+		jwtParser, currentUTC = origParser, origCurrentUTC
+	}()
+	jwtParser = func(Context, string, int64) (*signedJWT, error) {
+		token := jwtValidTokenObject
+		return &token, nil
+	}
+	currentUTC = func() time.Time { return jwtValidTokenTime }
+
+	logger := &recordingAccessLogger{}
+	server := NewServer("")
+	server.AccessLogger = logger
+	server.DefaultAuth = AuthRequired
+	svc, err := server.RegisterService(&PolicyService{}, "policy", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := svc.MethodByName("Lazy").Info()
+	info.Audiences = []string{"my-client-id"}
+
+	tts := []struct {
+		path     string
+		clientID string
+		token    bool
+		method   string
+		status   int
+		wantID   string
+	}{
+		{"/PolicyService.Lazy", "hello-android", true, "PolicyService.Lazy", http.StatusOK, "hello-android"},
+		{"/PolicyService.Lazy", "hello-android", false, "PolicyService.Lazy", http.StatusUnauthorized, ""},
+		{"/PolicyService.Lazy", "other-client", true, "PolicyService.Lazy", http.StatusForbidden, ""},
+		{"/PolicyService.DoesNotExist", "", true, "PolicyService.DoesNotExist", http.StatusNotFound, ""},
+	}
+	for i, tt := range tts {
+		info.ClientIds = []string{tt.clientID}
+		r, err := inst.NewRequest("POST", tt.path, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.token {
+			r.Header.Set("Authorization", "Bearer "+jwtValidTokenString)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if len(logger.entries) != i+1 {
+			t.Fatalf("%d: %d access log entries; want %d", i, len(logger.entries), i+1)
+		}
+		e := logger.entries[i]
+		if e.Method != tt.method || e.Status != tt.status || e.ClientID != tt.wantID {
+			t.Errorf("%d: entry = %+v; want method %s, status %d, client ID %q",
+				i, e, tt.method, tt.status, tt.wantID)
+		}
+		if e.BytesOut != int64(w.Body.Len()) {
+			t.Errorf("%d: BytesOut = %d; want %d", i, e.BytesOut, w.Body.Len())
+		}
+		if !e.Time.Equal(jwtValidTokenTime) || e.Latency < 0 {
+			t.Errorf("%d: Time, Latency = %v, %v; want %v and non-negative latency",
+				i, e.Time, e.Latency, jwtValidTokenTime)
+		}
+	}
+}
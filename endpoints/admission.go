@@ -0,0 +1,66 @@
+package endpoints
+
+import (
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// defaultAdmissionRetryAfter is used when Server.AdmissionRetryAfter is zero.
+const defaultAdmissionRetryAfter = 5 * time.Second
+
+// RuntimeStats are runtime stats of an instance used for admission control.
+type RuntimeStats struct {
+	// Goroutines is the number of existing goroutines.
+	Goroutines int
+	// HeapAlloc is the number of bytes of allocated heap objects.
+	HeapAlloc uint64
+}
+
+// readRuntimeStats returns current RuntimeStats. Reading heap stats briefly
+// stops the world, so they are read only if withHeap is true.
+// This is a variable on purpose to be able to stub during testing.
+var readRuntimeStats = func(withHeap bool) *RuntimeStats {
+	stats := &RuntimeStats{Goroutines: runtime.NumGoroutine()}
+	if withHeap {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		stats.HeapAlloc = ms.HeapAlloc
+	}
+	return stats
+}
+
+// admissionEnabled returns true if any admission control is configured.
+func (s *Server) admissionEnabled() bool {
+	return s.MaxGoroutines > 0 || s.MaxHeapBytes > 0 || s.AdmissionCheck != nil
+}
+
+// admit returns 503 APIError, and sets Retry-After header, if the instance
+// is too busy to serve another request according to s.MaxGoroutines,
+// s.MaxHeapBytes and s.AdmissionCheck.
+func (s *Server) admit(w http.ResponseWriter) error {
+	if !s.admissionEnabled() {
+		return nil
+	}
+	stats := readRuntimeStats(s.MaxHeapBytes > 0 || s.AdmissionCheck != nil)
+	admitted := (s.MaxGoroutines <= 0 || stats.Goroutines <= s.MaxGoroutines) &&
+		(s.MaxHeapBytes == 0 || stats.HeapAlloc <= s.MaxHeapBytes) &&
+		(s.AdmissionCheck == nil || s.AdmissionCheck(stats))
+	if admitted {
+		return nil
+	}
+	s.setRetryAfter(w)
+	return errorf(http.StatusServiceUnavailable, "Server is overloaded, try again later")
+}
+
+// setRetryAfter sets Retry-After header of a response rejected because
+// the instance or a method is too busy to s.AdmissionRetryAfter.
+func (s *Server) setRetryAfter(w http.ResponseWriter) {
+	retry := s.AdmissionRetryAfter
+	if retry <= 0 {
+		retry = defaultAdmissionRetryAfter
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+}
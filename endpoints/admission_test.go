@@ -0,0 +1,72 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+func TestServerAdmission(t *testing.T) {
+	origReadStats := readRuntimeStats
+	defer func() { readRuntimeStats = origReadStats }()
+	stats := &RuntimeStats{Goroutines: 100, HeapAlloc: 64 << 20}
+	var withHeap bool
+	readRuntimeStats = func(heap bool) *RuntimeStats {
+		withHeap = heap
+		return stats
+	}
+
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		maxGoroutines int
+		maxHeap       uint64
+		check         func(*RuntimeStats) bool
+		retryAfter    time.Duration
+		code          int
+		wantRetry     string
+		wantHeap      bool
+	}{
+		{0, 0, nil, 0, http.StatusOK, "", false},
+		{100, 0, nil, 0, http.StatusOK, "", false},
+		{99, 0, nil, 0, http.StatusServiceUnavailable, "5", false},
+		{0, 64 << 20, nil, 0, http.StatusOK, "", true},
+		{0, 32 << 20, nil, 1500 * time.Millisecond, http.StatusServiceUnavailable, "2", true},
+		{0, 0, func(*RuntimeStats) bool { return true }, 0, http.StatusOK, "", true},
+		{0, 0, func(s *RuntimeStats) bool { return s.Goroutines < 50 }, 0,
+			http.StatusServiceUnavailable, "5", true},
+	}
+	for i, tt := range tts {
+		server := createAPIServer()
+		server.MaxGoroutines = tt.maxGoroutines
+		server.MaxHeapBytes = tt.maxHeap
+		server.AdmissionCheck = tt.check
+		server.AdmissionRetryAfter = tt.retryAfter
+		withHeap = false
+
+		r, err := inst.NewRequest("POST", "/ServerTestService.Void", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		if ra := w.Header().Get("Retry-After"); ra != tt.wantRetry {
+			t.Errorf("%d: Retry-After = %q; want %q", i, ra, tt.wantRetry)
+		}
+		if withHeap != tt.wantHeap {
+			t.Errorf("%d: heap stats read = %v; want %v", i, withHeap, tt.wantHeap)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// hasAliases returns true if values of type t can contain fields tagged
+// with "alias".
+func hasAliases(t reflect.Type) bool {
+	return hasTaggedFields(t, isAliasedField)
+}
+
+// isAliasedField is a fieldPredicate matching fields tagged with "alias".
+func isAliasedField(field *reflect.StructField, tag *endpointsTag) bool {
+	return len(tag.aliases) > 0
+}
+
+// resolveAliases returns JSON body of a request of type t with fields named
+// by their aliases renamed to their canonical names. If both names of
+// a field are present, the canonical one wins, unless strict is true, in
+// which case it returns 400 APIError.
+//
+// Bodies of types without aliases are returned as is.
+func resolveAliases(t reflect.Type, body []byte, strict bool) ([]byte, error) {
+	if len(body) == 0 || !hasAliases(t) {
+		return body, nil
+	}
+	data, err := unmarshalGeneric(body)
+	if err != nil {
+		// Leave it to the decoder to report.
+		return body, nil
+	}
+	err = walkJSONObjects(t, data, func(t reflect.Type, m map[string]interface{}) error {
+		return renameStructAliases(t, m, strict)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(data)
+}
+
+// renameStructAliases renames fields of m, a JSON object of struct type t,
+// named by their aliases, see resolveAliases.
+func renameStructAliases(t reflect.Type, m map[string]interface{}, strict bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if et, ok := flattenedStruct(&field); ok {
+			if err := renameStructAliases(et, m, strict); err != nil {
+				return err
+			}
+			continue
+		}
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		name := jsonFieldName(&field)
+		if name == "-" {
+			continue
+		}
+		if tag, err := parseTag(field.Tag); err == nil {
+			for _, alias := range tag.aliases {
+				val, ok := m[alias]
+				if !ok {
+					continue
+				}
+				delete(m, alias)
+				if _, ok := m[name]; ok {
+					if strict {
+						return NewBadRequestError("Fields %q and %q are the same, only one is allowed", name, alias)
+					}
+					continue
+				}
+				m[name] = val
+			}
+		}
+	}
+	return nil
+}
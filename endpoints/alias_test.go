@@ -0,0 +1,105 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+type AliasInner struct {
+	Username string `json:"username" endpoints:"alias=userName"`
+}
+
+type AliasMsg struct {
+	Username string        `json:"username" endpoints:"alias=userName|user_name"`
+	Inner    *AliasInner   `json:"inner"`
+	Items    []*AliasInner `json:"items"`
+}
+
+type AliasService struct{}
+
+func (s *AliasService) Echo(c Context, req *AliasMsg) (*AliasMsg, error) {
+	return req, nil
+}
+
+func TestResolveAliases(t *testing.T) {
+	typ := reflect.TypeOf(AliasMsg{})
+	tts := []struct {
+		body   string
+		strict bool
+		want   *AliasMsg
+		code   int
+	}{
+		{`{"username":"a"}`, false, &AliasMsg{Username: "a"}, 0},
+		{`{"userName":"a"}`, false, &AliasMsg{Username: "a"}, 0},
+		{`{"user_name":"a"}`, false, &AliasMsg{Username: "a"}, 0},
+		{`{"username":"a","userName":"b"}`, false, &AliasMsg{Username: "a"}, 0},
+		{`{"username":"a","userName":"b"}`, true, nil, http.StatusBadRequest},
+		{`{"inner":{"userName":"a"},"items":[{"userName":"b"},{"username":"c"}]}`, false,
+			&AliasMsg{Inner: &AliasInner{"a"}, Items: []*AliasInner{{"b"}, {"c"}}}, 0},
+	}
+	for i, tt := range tts {
+		body, err := resolveAliases(typ, []byte(tt.body), tt.strict)
+		if tt.code != 0 {
+			if apiErr, ok := err.(*APIError); !ok || apiErr.Code != tt.code {
+				t.Errorf("%d: resolveAliases(%s) = %v; want %d APIError", i, tt.body, err, tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: resolveAliases(%s) = %v", i, tt.body, err)
+			continue
+		}
+		got := &AliasMsg{}
+		if err := decodeJSON(body, reflect.ValueOf(got), false); err != nil {
+			t.Errorf("%d: decodeJSON(%s) = %v", i, body, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%d: decoded %s into %+v; want %+v", i, tt.body, got, tt.want)
+		}
+	}
+
+	// Types without aliases are left alone.
+	body := []byte(`{"name":"a"}`)
+	if out, err := resolveAliases(reflect.TypeOf(TestMsg{}), body, true); err != nil || &out[0] != &body[0] {
+		t.Errorf("resolveAliases(TestMsg) = %s, %v; want the body as is", out, err)
+	}
+}
+
+func TestServerAliases(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	svc, err := server.RegisterService(&AliasService{}, "alias", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+
+	r, err := inst.NewRequest("POST", "/AliasService.Echo", strings.NewReader(`{"userName":"old"}`))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if out := strings.TrimSpace(w.Body.String()); !strings.Contains(out, `"username":"old"`) {
+		t.Errorf("response = %s; want username from its alias", out)
+	}
+
+	d := &APIDescriptor{}
+	if err := svc.APIDescriptor(d, "localhost"); err != nil {
+		t.Fatalf("APIDescriptor: %v", err)
+	}
+	props := d.Descriptor.Schemas["AliasMsg"].Properties
+	if _, ok := props["userName"]; ok || props["username"] == nil {
+		t.Errorf("AliasMsg properties = %v; want username only", props)
+	}
+}
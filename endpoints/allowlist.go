@@ -0,0 +1,136 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/user"
+)
+
+// defaultAllowlistTTL is used when Server.AllowlistTTL is zero.
+const defaultAllowlistTTL = time.Minute
+
+// Allowlist is a set of scopes, audiences and client IDs accepted by
+// a method.
+type Allowlist struct {
+	Scopes    []string
+	Audiences []string
+	ClientIds []string
+}
+
+// AllowlistProvider provides allowlists of methods which can change without
+// redeploying the app, e.g. when they are stored in datastore.
+type AllowlistProvider interface {
+	// Allowlist returns the currently valid allowlist of a method, given
+	// its name in "Service.Method" format, or nil if the method has
+	// no dynamic allowlist, in which case the one of its MethodInfo is
+	// used.
+	Allowlist(c Context, method string) (*Allowlist, error)
+}
+
+// allowlistCache keeps allowlists returned by an AllowlistProvider
+// for a while. It is safe to use concurrently.
+type allowlistCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedAllowlist
+}
+
+type cachedAllowlist struct {
+	allowlist *Allowlist
+	expires   time.Time
+}
+
+// get returns an unexpired allowlist of method.
+func (ac *allowlistCache) get(method string, now time.Time) (*Allowlist, bool) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	e, ok := ac.entries[method]
+	if !ok || !now.Before(e.expires) {
+		return nil, false
+	}
+	return e.allowlist, true
+}
+
+// set caches allowlist al of method until expires.
+func (ac *allowlistCache) set(method string, al *Allowlist, expires time.Time) {
+	ac.mu.Lock()
+	defer ac.mu.Unlock()
+	if ac.entries == nil {
+		ac.entries = make(map[string]cachedAllowlist)
+	}
+	ac.entries[method] = cachedAllowlist{al, expires}
+}
+
+// allowlist returns the allowlist of method m named name. It comes from
+// s.Allowlists, if set and it has one for m, and from MethodInfo of m
+// otherwise.
+//
+// Errors of s.Allowlists are returned as 503 APIError since they mean
+// the allowlist couldn't be fetched, not that a client isn't allowed.
+func (s *Server) allowlist(c Context, name string, m *ServiceMethod) (*Allowlist, error) {
+	if s.Allowlists == nil {
+		return m.allowlist(), nil
+	}
+	now := currentUTC()
+	if al, ok := s.allowlists.get(name, now); ok {
+		return al, nil
+	}
+	al, err := s.Allowlists.Allowlist(c, name)
+	if err != nil {
+		log.Errorf(c, "Error fetching allowlist of %s: %v", name, err)
+		return nil, errorf(http.StatusServiceUnavailable, "Allowlist of %s is unavailable", name)
+	}
+	if al == nil {
+		al = m.allowlist()
+	}
+	ttl := s.AllowlistTTL
+	if ttl <= 0 {
+		ttl = defaultAllowlistTTL
+	}
+	s.allowlists.set(name, al, now.Add(ttl))
+	return al, nil
+}
+
+// allowlist returns the allowlist of m declared in its MethodInfo.
+func (m *ServiceMethod) allowlist() *Allowlist {
+	if m.info == nil {
+		return &Allowlist{}
+	}
+	return &Allowlist{m.info.Scopes, m.info.Audiences, m.info.ClientIds}
+}
+
+// methodCall describes a method being served by a Server.
+type methodCall struct {
+	server *Server
+	name   string
+	method *ServiceMethod
+}
+
+// methodCallKey is a context key of the *methodCall being served.
+type methodCallKey struct{}
+
+// withMethodCall returns a Context derived from c which knows that mc
+// is being served.
+func withMethodCall(c Context, mc *methodCall) Context {
+	return deriveContext(c, context.WithValue(c, methodCallKey{}, mc))
+}
+
+// CurrentMethodUser is the same as CurrentUser but checks scopes, audiences
+// and client IDs accepted by the method being served, as returned by
+// Server.Allowlists or set in the method's MethodInfo.
+func CurrentMethodUser(c Context) (*user.User, error) {
+	mc, ok := c.Value(methodCallKey{}).(*methodCall)
+	if !ok {
+		return nil, errors.New("No method is being served in the current context.")
+	}
+	al, err := mc.server.allowlist(c, mc.name, mc.method)
+	if err != nil {
+		return nil, err
+	}
+	return CurrentUser(c, al.Scopes, al.Audiences, al.ClientIds)
+}
@@ -0,0 +1,116 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+type stubAllowlistProvider struct {
+	calls     int
+	allowlist *Allowlist
+	err       error
+}
+
+func (p *stubAllowlistProvider) Allowlist(c Context, method string) (*Allowlist, error) {
+	p.calls++
+	return p.allowlist, p.err
+}
+
+type AllowlistService struct{}
+
+func (s *AllowlistService) Whoami(c Context) (*TestMsg, error) {
+	u, err := CurrentMethodUser(c)
+	if err != nil {
+		return nil, err
+	}
+	return &TestMsg{Name: u.Email}, nil
+}
+
+func TestServerAllowlist(t *testing.T) {
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	currentUTC = func() time.Time { return now }
+
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := NewContext(r)
+
+	m := &ServiceMethod{info: &MethodInfo{
+		Scopes:    []string{"static.scope"},
+		ClientIds: []string{"static-client"},
+	}}
+	server := NewServer("")
+	al, err := server.allowlist(c, "Service.Method", m)
+	want := &Allowlist{Scopes: m.info.Scopes, ClientIds: m.info.ClientIds}
+	if err != nil || !reflect.DeepEqual(al, want) {
+		t.Errorf("allowlist() = %+v, %v; want %+v", al, err, want)
+	}
+
+	dynamic := &Allowlist{Scopes: []string{"dynamic.scope"}, ClientIds: []string{"dynamic-client"}}
+	provider := &stubAllowlistProvider{allowlist: dynamic}
+	server.Allowlists = provider
+	server.AllowlistTTL = 10 * time.Second
+	for _, d := range []time.Duration{0, 5 * time.Second, 10 * time.Second} {
+		now = now.Add(d)
+		al, err := server.allowlist(c, "Service.Method", m)
+		if err != nil || al != dynamic {
+			t.Errorf("allowlist() = %+v, %v; want %+v", al, err, dynamic)
+		}
+	}
+	if provider.calls != 2 {
+		t.Errorf("provider.calls = %d; want 2", provider.calls)
+	}
+
+	server = NewServer("")
+	server.Allowlists = &stubAllowlistProvider{err: errors.New("datastore is down")}
+	_, err = server.allowlist(c, "Service.Method", m)
+	if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusServiceUnavailable {
+		t.Errorf("allowlist() = %v; want 503 APIError", err)
+	}
+
+	server = NewServer("")
+	server.Allowlists = &stubAllowlistProvider{}
+	al, err = server.allowlist(c, "Service.Method", m)
+	if err != nil || !reflect.DeepEqual(al, want) {
+		t.Errorf("allowlist() = %+v, %v; want %+v", al, err, want)
+	}
+}
+
+func TestCurrentMethodUser(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	c := NewContext(r)
+	if u, err := CurrentMethodUser(c); err == nil {
+		t.Errorf("CurrentMethodUser() = %v; want error outside of a method", u)
+	}
+	closer()
+
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	if _, err := server.RegisterService(&AllowlistService{}, "allowlist", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	server.Allowlists = &stubAllowlistProvider{err: errors.New("datastore is down")}
+
+	r, err = inst.NewRequest("POST", "/AllowlistService.Whoami", strings.NewReader("{}"))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("w.Code = %d; want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
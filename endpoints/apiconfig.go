@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// curlyBrackets is used for generating the key for dups map in APIDescriptor().
+// curlyBrackets is used for generating the key for dups map in
+// checkDuplicatePaths().
 var curlyBrackets = regexp.MustCompile("{.+?}")
 
 // APIDescriptor is the top-level struct for a single Endpoints API config.
@@ -75,12 +77,12 @@ type APIRequestParamSpec struct {
 	Repeated bool                         `json:"repeated,omitempty"`
 	Enum     map[string]*APIEnumParamSpec `json:"enum,omitempty"`
 	// only for int32/int64/uint32/uint64
-	Min interface{} `json:"minValue,omitempty"`
-	Max interface{} `json:"maxValue,omitempty"`
+	Min  interface{} `json:"minValue,omitempty"`
+	Max  interface{} `json:"maxValue,omitempty"`
+	Desc string      `json:"description,omitempty"`
 }
 
 // APIEnumParamSpec is the enum type of request/response param spec.
-// Not used currently.
 type APIEnumParamSpec struct {
 	BackendVal string `json:"backendValue"`
 	Desc       string `json:"description,omitempty"`
@@ -106,6 +108,8 @@ type APISchemaDescriptor struct {
 	Type       string                        `json:"type"`
 	Properties map[string]*APISchemaProperty `json:"properties"`
 	Desc       string                        `json:"description,omitempty"`
+	OneOf      []*APISchemaRef               `json:"oneOf,omitempty"`
+	Items      *APISchemaProperty            `json:"items,omitempty"`
 }
 
 // APISchemaProperty is an item of APISchemaDescriptor.Properties map
@@ -116,11 +120,91 @@ type APISchemaProperty struct {
 
 	Required bool        `json:"required,omitempty"`
 	Default  interface{} `json:"default,omitempty"`
+	Pattern  string      `json:"pattern,omitempty"`
 
-	Ref  string `json:"$ref,omitempty"`
-	Desc string `json:"description,omitempty"`
+	Ref   string          `json:"$ref,omitempty"`
+	Desc  string          `json:"description,omitempty"`
+	OneOf []*APISchemaRef `json:"oneOf,omitempty"`
+
+	// Bounds and allowed values from the field tag. They're not part of
+	// the API descriptor, but are exported by JSONSchema.
+	min, max           interface{}
+	enum               []string
+	minItems, maxItems int
+}
+
+// checkDuplicatePaths returns an error identifying both methods if two
+// methods of services would match the same HTTP method and path template.
+// Templates which differ only in names of parameters match the same paths,
+// while a wildcard, as in "proxy/{rest=**}", doesn't conflict with
+// a single segment parameter.
+func checkDuplicatePaths(services []*RPCService) error {
+	dups := make(map[string]string)
+	for _, s := range services {
+		methods := s.Methods()
+		sort.Sort(byMethodName(methods))
+		for _, m := range methods {
+			info := m.Info()
+			dupName := info.HTTPMethod + " " + pathKey(info.Path)
+			mname := fmt.Sprintf(`%s.%s ("%s %s")`, s.Name(), m.method.Name, info.HTTPMethod, info.Path)
+			if other, ok := dups[dupName]; ok {
+				return fmt.Errorf("%s conflicts with %s", mname, other)
+			}
+			dups[dupName] = mname
+		}
+	}
+	return nil
+}
+
+// checkPathParams returns an error identifying the method and the parameter
+// if a path template of a method of services refers to a parameter which has
+// no bindable field in the method's request struct. Request fields missing
+// from the path are fine since they're read from the body or query.
+func checkPathParams(services []*RPCService) error {
+	for _, s := range services {
+		methods := s.Methods()
+		sort.Sort(byMethodName(methods))
+		for _, m := range methods {
+			info := m.Info()
+			mname := fmt.Sprintf(`%s.%s ("%s %s")`, s.Name(), m.method.Name, info.HTTPMethod, info.Path)
+			params, err := parsePath(info.Path)
+			if err != nil {
+				return fmt.Errorf("%s: %v", mname, err)
+			}
+			if len(params) == 0 {
+				continue
+			}
+			wildcard, err := wildcardParam(info.Path)
+			if err != nil {
+				return fmt.Errorf("%s: %v", mname, err)
+			}
+			if m.ReqType.Kind() != reflect.Struct {
+				return fmt.Errorf("%s: path parameters require a struct request, got %v", mname, m.ReqType)
+			}
+			fields := fieldNames(m.ReqType, true)
+			for _, p := range params {
+				field, ok := fields[p]
+				if !ok {
+					return fmt.Errorf("%s: path parameter %q has no field in %v", mname, p, m.ReqType)
+				}
+				if _, err := fieldToParamSpec(field); err != nil {
+					return fmt.Errorf("%s: path parameter %q: %v", mname, p, err)
+				}
+				if p == wildcard && (field.Type.Kind() != reflect.String || strings.Contains(p, ".")) {
+					return fmt.Errorf("%s: wildcard path parameter %q must be a top-level string field", mname, p)
+				}
+			}
+		}
+	}
+	return nil
 }
 
+type byMethodName []*ServiceMethod
+
+func (a byMethodName) Len() int           { return len(a) }
+func (a byMethodName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byMethodName) Less(i, j int) bool { return a[i].method.Name < a[j].method.Name }
+
 // APIDescriptor populates provided APIDescriptor with all info needed to
 // generate a discovery doc from its receiver.
 //
@@ -155,26 +239,25 @@ func (s *RPCService) APIDescriptor(dst *APIDescriptor, host string) error {
 	dst.Methods = make(map[string]*APIMethod, numMethods)
 	dst.Descriptor.Methods = make(map[string]*APIMethodDescriptor, numMethods)
 	// Sanity check for duplicate HTTP method + path
-	dups := make(map[string]string, numMethods)
+	if err := checkDuplicatePaths([]*RPCService{s}); err != nil {
+		return err
+	}
 
 	for _, m := range methods {
 		info := m.Info()
-		dupName := info.HTTPMethod + curlyBrackets.ReplaceAllLiteralString(info.Path, "{}")
-		if mname, ok := dups[dupName]; ok {
-			return fmt.Errorf(`"%s %s" is already registered with %s`,
-				info.HTTPMethod, info.Path, mname)
-		}
-		dups[dupName] = dst.Name + "." + info.Name
 
 		// Methods of $SCHEMA_DESCRIPTOR
 		mdescr := &APIMethodDescriptor{serviceMethod: m}
 		dst.Descriptor.Methods[s.Name()+"."+m.method.Name] = mdescr
-		if !info.isBodiless() && !isEmptyStruct(m.ReqType) {
+		if isRawBody(m.ReqType) {
+			mdescr.Request = &APISchemaRef{Ref: rawBodySchemaName}
+			schemasToCreate[rawBodySchemaName] = m.ReqType
+		} else if !info.isBodiless() && !isEmptyStruct(m.ReqType) {
 			refID := schemaNameForType(m.ReqType)
 			mdescr.Request = &APISchemaRef{Ref: refID}
 			schemasToCreate[refID] = m.ReqType
 		}
-		if !isEmptyStruct(m.RespType) {
+		if !isEmptyStruct(m.RespType) && !reflect.PtrTo(m.RespType).Implements(typeOfResponder) {
 			refID := schemaNameForType(m.RespType)
 			mdescr.Response = &APISchemaRef{Ref: refID}
 			schemasToCreate[refID] = m.RespType
@@ -221,9 +304,16 @@ func (md *APIMethodDescriptor) toAPIMethod(rosySrv string) (*APIMethod, error) {
 	}
 
 	var err error
-	if md.serviceMethod.Info().isBodiless() {
+	switch {
+	case isRawBody(md.serviceMethod.ReqType):
+		// Raw bodies are handed to the method as is, so there are no params.
+	case md.serviceMethod.ReqType.Kind() == reflect.Interface:
+		// OneOf requests are always in the body.
+	case md.serviceMethod.ReqType.Kind() == reflect.Slice:
+		// So are arrays.
+	case md.serviceMethod.Info().isBodiless():
 		apim.Request.Params, err = typeToParamsSpec(md.serviceMethod.ReqType)
-	} else {
+	default:
 		apim.Request.Params, err = typeToParamsSpecFromPath(
 			md.serviceMethod.ReqType, apim.Path)
 	}
@@ -251,13 +341,40 @@ func addSchemaFromType(dst map[string]*APISchemaDescriptor, ref string, t reflec
 		return nil
 	}
 
+	if isRawBody(t) {
+		// A raw body can be any JSON object.
+		dst[ref] = &APISchemaDescriptor{
+			ID:         ref,
+			Type:       "object",
+			Properties: map[string]*APISchemaProperty{},
+		}
+		return nil
+	}
+
 	ensureSchemas := make(map[string]reflect.Type)
 	sd := &APISchemaDescriptor{ID: ref}
 
 	switch t.Kind() {
-	// case reflect.Array:
-	// 	sd.Type = "array"
-	// 	sd.Items... ?
+	case reflect.Interface:
+		o := oneOfFor(t)
+		if o == nil {
+			return fmt.Errorf("Unsupported interface type %v, see RegisterOneOf", t)
+		}
+		sd.Type = "object"
+		sd.Properties = map[string]*APISchemaProperty{}
+		sd.OneOf = o.schemaRefs(ensureSchemas)
+	case reflect.Slice:
+		el := indirectType(t)
+		if el.Kind() == reflect.Ptr {
+			el = el.Elem()
+		}
+		if el.Kind() != reflect.Struct {
+			return fmt.Errorf("Unsupported element type %v of array schema %s", el, ref)
+		}
+		sd.Type = "array"
+		sd.Properties = map[string]*APISchemaProperty{}
+		sd.Items = &APISchemaProperty{Ref: schemaNameForType(el)}
+		ensureSchemas[sd.Items.Ref] = el
 	case reflect.Struct:
 		fieldsMap := fieldNames(t, false)
 		sd.Properties = make(map[string]*APISchemaProperty, len(fieldsMap))
@@ -271,9 +388,17 @@ func addSchemaFromType(dst map[string]*APISchemaDescriptor, ref string, t reflec
 			default:
 				prop.Type, prop.Format = typeToPropFormat(field.Type)
 
+			case field.Type == typeOfRawMessage:
+				// Raw JSON can be any value.
+				prop.Type = "any"
+
 			case implements(field.Type, typeOfJSONMarshaler):
 				prop.Type = "string"
 
+			case oneOfFor(field.Type) != nil:
+				prop.Type = "object"
+				prop.OneOf = oneOfFor(field.Type).schemaRefs(ensureSchemas)
+
 			case fkind == reflect.Ptr, fkind == reflect.Struct:
 				typ := indirectType(field.Type)
 				if stype, format := typeToPropFormat(typ); stype != "" {
@@ -325,9 +450,29 @@ func addSchemaFromType(dst map[string]*APISchemaDescriptor, ref string, t reflec
 			if err != nil {
 				return err
 			}
+			prop.enum = tag.enum
+			prop.Pattern = tag.pattern
+			prop.minItems, prop.maxItems = tag.minItems, tag.maxItems
+			if tag.format != "" && prop.Type == "string" && prop.Format == "" {
+				prop.Format = tag.format
+			}
+			if tag.timeFormat != "" && isTimeField(field) {
+				prop.Type, prop.Format = timeFormatProp(tag.timeFormat)
+			}
+			if k := indirectKind(field.Type); reflect.Int <= k && k <= reflect.Float64 {
+				if prop.min, err = parseValue(tag.minVal, k); err != nil {
+					return err
+				}
+				if prop.max, err = parseValue(tag.maxVal, k); err != nil {
+					return err
+				}
+			}
 
 			sd.Properties[name] = prop
 		}
+		if kind := kindOf(t); kind != "" && sd.Properties[kindField] == nil {
+			sd.Properties[kindField] = &APISchemaProperty{Type: "string", Default: kind}
+		}
 	}
 
 	dst[ref] = sd
@@ -379,6 +524,7 @@ var (
 	typeOfTime          = reflect.TypeOf(time.Time{})
 	typeOfBytes         = reflect.TypeOf([]byte(nil))
 	typeOfJSONMarshaler = reflect.TypeOf((*jsonMarshaler)(nil)).Elem()
+	typeOfRawMessage    = reflect.TypeOf(json.RawMessage(nil))
 
 	// SchemaNameForType returns a name for the given schema type,
 	// used to reference schema definitions in the API descriptor.
@@ -398,6 +544,16 @@ var (
 	reSchemaName = regexp.MustCompile("[^a-zA-Z0-9]")
 )
 
+// rawBodySchemaName is a name of the schema describing requests of methods
+// which take raw bodies.
+const rawBodySchemaName = "JsonValue"
+
+// isRawBody returns true if t is a request type which is not decoded,
+// i.e. json.RawMessage or []byte.
+func isRawBody(t reflect.Type) bool {
+	return t == typeOfRawMessage || t == typeOfBytes
+}
+
 // indirectType returns a type the t is pointing to or a type of the element
 // of t if t is either Array, Chan, Map or Slice.
 func indirectType(t reflect.Type) reflect.Type {
@@ -557,6 +713,13 @@ func fieldToParamSpec(field *reflect.StructField) (p *APIRequestParamSpec, err e
 	}
 
 	p.Required = tag.required
+	p.Desc = tag.desc
+	if len(tag.enum) > 0 {
+		p.Enum = make(map[string]*APIEnumParamSpec, len(tag.enum))
+		for _, val := range tag.enum {
+			p.Enum[val] = &APIEnumParamSpec{BackendVal: val}
+		}
+	}
 	if p.Default, err = parseValue(tag.defaultVal, kind); err != nil {
 		return
 	}
@@ -565,7 +728,11 @@ func fieldToParamSpec(field *reflect.StructField) (p *APIRequestParamSpec, err e
 		if err != nil {
 			return
 		}
-		p.Max, err = parseValue(tag.maxVal, kind)
+		// Page size is clamped by the backend, so don't let the API server
+		// reject requests exceeding the max.
+		if !tag.pageSize {
+			p.Max, err = parseValue(tag.maxVal, kind)
+		}
 	}
 
 	return
@@ -622,7 +789,17 @@ func fieldNames(t reflect.Type, flatten bool) map[string]*reflect.StructField {
 
 // schemaNameForType always returns a title version of the public method
 // SchemaNameForType.
+//
+// Unnamed slices, e.g. []*Item, are named after their element type with
+// "Array" suffix, e.g. "ItemArray".
 func schemaNameForType(t reflect.Type) string {
+	if t.Kind() == reflect.Slice && t.Name() == "" {
+		el := t.Elem()
+		if el.Kind() == reflect.Ptr {
+			el = el.Elem()
+		}
+		return schemaNameForType(el) + "Array"
+	}
 	name := strings.Title(SchemaNameForType(t))
 	return reSchemaName.ReplaceAllLiteralString(name, "")
 }
@@ -634,6 +811,19 @@ type endpointsTag struct {
 	required                   bool
 	defaultVal, minVal, maxVal string
 	desc                       string
+	pageSize                   bool
+	secret                     bool
+	urlSafe                    bool
+	immutable                  bool
+	pattern                    string
+	enum                       []string
+	enumFold                   bool
+	minItems, maxItems         int
+	aliases                    []string
+	timeFormats                []string
+	timeFormat                 string
+	format                     string
+	requiredIf, requiredIfVal  string
 }
 
 const endpointsTagName = "endpoints"
@@ -649,17 +839,58 @@ const endpointsTagName = "endpoints"
 //   - d=val, default value
 //   - min=val, min value
 //   - max=val, max value
-//   - desc=val, description
+//   - desc=val, description; commas are kept unless what follows them is
+//     another option
+//   - pagesize, page size field, clamped to max instead of being rejected
+//   - secret, sensitive field which value is never logged
+//   - urlsafe, []byte field encoded with URL-safe base64 alphabet
+//   - enum=a|b|c, allowed values
+//   - enumfold, enum values are matched case-insensitively
+//   - minItems=n and maxItems=n, bounds of slice lengths
+//   - immutable, field which can't be changed once set, see CheckImmutable
+//   - alias=a|b, former names of the field accepted in request bodies,
+//     see Server.StrictAliases
+//   - timeformats=a|b, formats of a time.Time field accepted in requests,
+//     tried in order: rfc3339 (the default), date, unix or unixmillis
+//   - timeformat=f, format of a time.Time field in responses, rfc3339
+//     by default
+//   - format=f, format string values must be in: email or uri
+//   - requiredif=field=val, field which is required when another field,
+//     named as in JSON, has value val
+//   - pattern=re, regexp string values must match; it must come last
+//     since it takes the rest of the tag, commas included
 //
 // It is an error to specify both default and required.
 func parseTag(t reflect.StructTag) (*endpointsTag, error) {
 	eTag := &endpointsTag{}
 	if tag := t.Get("endpoints"); tag != "" {
 		parts := strings.Split(tag, ",")
-		for _, k := range parts {
+		inDesc := false
+		for i, k := range parts {
+			if strings.HasPrefix(k, "pattern=") {
+				// Patterns can contain commas, so they take the rest of the tag.
+				eTag.pattern = strings.TrimPrefix(strings.Join(parts[i:], ","), "pattern=")
+				break
+			}
+			if inDesc && !isTagOption(k) {
+				// A comma of the description.
+				eTag.desc += "," + k
+				continue
+			}
+			inDesc = false
 			switch k {
 			case "req":
 				eTag.required = true
+			case "pagesize":
+				eTag.pageSize = true
+			case "secret":
+				eTag.secret = true
+			case "urlsafe":
+				eTag.urlSafe = true
+			case "immutable":
+				eTag.immutable = true
+			case "enumfold":
+				eTag.enumFold = true
 			default:
 				// key=value format
 				kv := strings.SplitN(k, "=", 2)
@@ -675,6 +906,44 @@ func parseTag(t reflect.StructTag) (*endpointsTag, error) {
 					eTag.maxVal = kv[1]
 				case "desc":
 					eTag.desc = kv[1]
+					inDesc = true
+				case "enum":
+					eTag.enum = strings.Split(kv[1], "|")
+				case "alias":
+					eTag.aliases = strings.Split(kv[1], "|")
+				case "timeformats":
+					eTag.timeFormats = strings.Split(kv[1], "|")
+					for _, f := range eTag.timeFormats {
+						if err := checkTimeFormat(f); err != nil {
+							return nil, err
+						}
+					}
+				case "format":
+					if err := checkFormatName(kv[1]); err != nil {
+						return nil, err
+					}
+					eTag.format = kv[1]
+				case "timeformat":
+					if err := checkTimeFormat(kv[1]); err != nil {
+						return nil, err
+					}
+					eTag.timeFormat = kv[1]
+				case "requiredif":
+					ref := strings.SplitN(kv[1], "=", 2)
+					if len(ref) < 2 || ref[0] == "" {
+						return nil, fmt.Errorf("Invalid requiredif: %q", kv[1])
+					}
+					eTag.requiredIf, eTag.requiredIfVal = ref[0], ref[1]
+				case "minItems", "maxItems":
+					n, err := strconv.Atoi(kv[1])
+					if err != nil || n < 0 {
+						return nil, fmt.Errorf("Invalid %s: %q", kv[0], kv[1])
+					}
+					if kv[0] == "minItems" {
+						eTag.minItems = n
+					} else {
+						eTag.maxItems = n
+					}
 				}
 			}
 		}
@@ -687,10 +956,25 @@ func parseTag(t reflect.StructTag) (*endpointsTag, error) {
 	return eTag, nil
 }
 
+// isTagOption returns true if part k of an "endpoints" tag is one of the
+// options parseTag knows, rather than a part of a description.
+func isTagOption(k string) bool {
+	switch strings.SplitN(k, "=", 2)[0] {
+	case "req", "pagesize", "secret", "urlsafe", "immutable", "enumfold",
+		"d", "min", "max", "desc", "enum", "alias", "timeformats",
+		"timeformat", "format", "requiredif", "minItems", "maxItems",
+		"pattern":
+		return true
+	}
+	return false
+}
+
 // parsePath parses a path template and returns found placeholders.
 // It returns error if the template is malformed.
 //
 // For instance, parsePath("one/{a}/two/{b}") will return []string{"a","b"}.
+// A wildcard capturing the rest of the path, as in "proxy/{rest=**}", is
+// named "rest".
 func parsePath(path string) ([]string, error) {
 	var params []string
 	for {
@@ -702,7 +986,14 @@ func parsePath(path string) ([]string, error) {
 		if x < i+1 {
 			return nil, fmt.Errorf("parsePath: Invalid path template: %q", path)
 		}
-		params = append(params, path[i+1:x])
+		name := path[i+1 : x]
+		if j := strings.IndexRune(name, '='); j >= 0 {
+			if name[j+1:] != pathWildcard {
+				return nil, fmt.Errorf("parsePath: Invalid path template: %q", path)
+			}
+			name = name[:j]
+		}
+		params = append(params, name)
 		path = path[x+1:]
 	}
 	return params, nil
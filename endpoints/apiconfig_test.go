@@ -2,6 +2,7 @@ package endpoints
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
@@ -399,6 +400,28 @@ func TestNotDuplicateHTTPMethodPathWhenMultipleBrackets(t *testing.T) {
 	}
 }
 
+func TestNotDuplicateHTTPMethodPathWhenWildcard(t *testing.T) {
+	dummy := &DummyService{}
+	server := NewServer("")
+	s, err := server.RegisterService(dummy, "Dummy", "v1", "A service", true)
+	if err != nil {
+		t.Fatalf("error registering service: %s", err)
+	}
+
+	info := s.MethodByName("GetList").Info()
+	info.HTTPMethod, info.Path = "GET", "some/{limit}"
+	info = s.MethodByName("GetSub").Info()
+	info.HTTPMethod, info.Path = "GET", "some/{simple=**}"
+
+	d := &APIDescriptor{}
+	if err := s.APIDescriptor(d, "testhost:1234"); err != nil {
+		t.Fatalf("APIDescriptor() = %v; want no duplicate HTTP method + path error", err)
+	}
+	if p := d.Methods["dummy."+info.Name].Path; p != "some/{simple=**}" {
+		t.Errorf("path = %q; want some/{simple=**}", p)
+	}
+}
+
 func TestPrefixedSchemaName(t *testing.T) {
 	const prefix = "SomePrefix"
 
@@ -431,6 +454,114 @@ func TestPrefixedSchemaName(t *testing.T) {
 	}
 }
 
+type RawService struct{}
+
+func (s *RawService) Process(c Context, req *json.RawMessage) (*DummyMsg, error) {
+	return nil, nil
+}
+
+func (s *RawService) Upload(c Context, req *[]byte) error {
+	return nil
+}
+
+func TestAPIRawBodyMethods(t *testing.T) {
+	server := NewServer("")
+	s, err := server.RegisterService(&RawService{}, "Raw", "v1", "", true)
+	if err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+	d := &APIDescriptor{}
+	if err := s.APIDescriptor(d, "testhost:1234"); err != nil {
+		t.Fatalf("APIDescriptor() = %v", err)
+	}
+
+	for _, name := range []string{"process", "upload"} {
+		meth := d.Methods["raw."+name]
+		if meth == nil {
+			t.Errorf("want APIMethod %q", "raw."+name)
+			continue
+		}
+		verifyPairs(t,
+			meth.HTTPMethod, "POST",
+			meth.Request.Body, "autoTemplate(backendRequest)",
+			len(meth.Request.Params), 0,
+		)
+	}
+	for _, name := range []string{"RawService.Process", "RawService.Upload"} {
+		meth := d.Descriptor.Methods[name]
+		if meth == nil {
+			t.Errorf("want %q method descriptor", name)
+			continue
+		}
+		if meth.Request == nil || meth.Request.Ref != rawBodySchemaName {
+			t.Errorf("%s: have req %#v; want ref %q", name, meth.Request, rawBodySchemaName)
+		}
+	}
+	schema := d.Descriptor.Schemas[rawBodySchemaName]
+	if schema == nil || schema.Type != "object" || len(schema.Properties) != 0 {
+		t.Errorf("schema %q = %#v; want an object without properties", rawBodySchemaName, schema)
+	}
+}
+
+type BulkItem struct {
+	Name string `json:"name" endpoints:"req,pattern=^[a-z]+$"`
+}
+
+type BulkItems []BulkItem
+
+type BulkService struct{}
+
+func (s *BulkService) Create(c Context, req *[]*BulkItem) (*TestMsg, error) {
+	return &TestMsg{Name: fmt.Sprintf("created %d", len(*req))}, nil
+}
+
+func (s *BulkService) Import(c Context, req *BulkItems) error {
+	return nil
+}
+
+func TestAPIArrayBodyMethods(t *testing.T) {
+	server := NewServer("")
+	s, err := server.RegisterService(&BulkService{}, "Bulk", "v1", "", true)
+	if err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+	d := &APIDescriptor{}
+	if err := s.APIDescriptor(d, "testhost:1234"); err != nil {
+		t.Fatalf("APIDescriptor() = %v", err)
+	}
+
+	tts := []struct {
+		name, method, schema string
+	}{
+		{"create", "BulkService.Create", "BulkItemArray"},
+		{"import", "BulkService.Import", "BulkItems"},
+	}
+	for _, tt := range tts {
+		meth := d.Methods["bulk."+tt.name]
+		if meth == nil {
+			t.Errorf("want APIMethod %q", "bulk."+tt.name)
+			continue
+		}
+		verifyPairs(t,
+			meth.HTTPMethod, "POST",
+			meth.Path, tt.name,
+			meth.Request.Body, "autoTemplate(backendRequest)",
+			len(meth.Request.Params), 0,
+		)
+		mdescr := d.Descriptor.Methods[tt.method]
+		if mdescr == nil || mdescr.Request == nil || mdescr.Request.Ref != tt.schema {
+			t.Errorf("%s: have req %#v; want ref %q", tt.method, mdescr, tt.schema)
+		}
+		schema := d.Descriptor.Schemas[tt.schema]
+		if schema == nil || schema.Type != "array" || schema.Items == nil || schema.Items.Ref != "BulkItem" {
+			t.Errorf("schema %q = %#v; want an array of BulkItem", tt.schema, schema)
+		}
+	}
+	if d.Descriptor.Schemas["BulkItem"] == nil {
+		t.Errorf("want BulkItem schema")
+	}
+}
+
 // ---------------------------------------------------------------------------
 // $SCHEMA_DESCRIPTOR (SCHEMAS)
 
@@ -677,6 +808,15 @@ func TestParsePath(t *testing.T) {
 	}
 }
 
+func TestParsePathCatchAll(t *testing.T) {
+	const in = "one/{a}/files/{rest=**}"
+	out, _ := parsePath(in)
+	want := []string{"a", "rest"}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("parsePath(%v) = %v; want %v", in, out, want)
+	}
+}
+
 func TestParseValue(t *testing.T) {
 	tts := []struct {
 		kind        reflect.Kind
@@ -718,22 +858,71 @@ func TestParseValue(t *testing.T) {
 	}
 }
 
+func TestFieldToParamSpecEnum(t *testing.T) {
+	field, _ := reflect.TypeOf(SortMsg{}).FieldByName("Order")
+	p, err := fieldToParamSpec(&field)
+	if err != nil {
+		t.Fatalf("fieldToParamSpec() = %v", err)
+	}
+	want := map[string]*APIEnumParamSpec{
+		"asc":  {BackendVal: "asc"},
+		"desc": {BackendVal: "desc"},
+	}
+	if !reflect.DeepEqual(p.Enum, want) {
+		t.Errorf("Enum = %#v; want %#v", p.Enum, want)
+	}
+}
+
 func TestParseTag(t *testing.T) {
 	type s struct {
 		Empty   string
 		Ignored string `endpoints:"req,ignored_part,desc=Some field"`
 		Opt     int    `endpoints:"d=123,min=1,max=200,desc=Int field"`
 		Invalid uint   `endpoints:"req,d=100"`
+		Page    int    `endpoints:"pagesize,max=100"`
+		Bytes   []byte `endpoints:"bytes,urlsafe"`
+		Enum    string `endpoints:"req,enum=a|b"`
+		Fold    string `endpoints:"enum=asc|desc,enumfold"`
+		Owner   string `endpoints:"immutable"`
+		Slug    string `endpoints:"req,pattern=^[a-z]{1,3}$"`
+		Items   []int  `endpoints:"minItems=1,maxItems=10"`
+		BadMax  []int  `endpoints:"maxItems=many"`
+		Renamed string `endpoints:"alias=userName|user_name"`
+		Stamp   string `endpoints:"timeformats=rfc3339|unixmillis,timeformat=unix"`
+		BadTime string `endpoints:"timeformats=rfc3339|ticks"`
+		Email   string `endpoints:"req,format=email"`
+		BadFmt  string `endpoints:"format=phone"`
+		Sorted  string `endpoints:"desc=Sort order, newest first,enum=asc|desc,req"`
+		Comma   string `endpoints:"req,desc=Code, e.g. a,b,pattern=^[a-z],[a-z]$"`
+		Card    string `endpoints:"requiredif=paymentMethod=card,desc=Card token"`
+		BadIf   string `endpoints:"requiredif=paymentMethod"`
 	}
 
 	testFields := []struct {
 		name string
 		tag  *endpointsTag
 	}{
-		{"Empty", &endpointsTag{false, "", "", "", ""}},
-		{"Ignored", &endpointsTag{true, "", "", "", "Some field"}},
-		{"Opt", &endpointsTag{false, "123", "1", "200", "Int field"}},
+		{"Empty", &endpointsTag{}},
+		{"Ignored", &endpointsTag{required: true, desc: "Some field"}},
+		{"Opt", &endpointsTag{defaultVal: "123", minVal: "1", maxVal: "200", desc: "Int field"}},
 		{"Invalid", nil},
+		{"Page", &endpointsTag{maxVal: "100", pageSize: true}},
+		{"Bytes", &endpointsTag{urlSafe: true}},
+		{"Enum", &endpointsTag{required: true, enum: []string{"a", "b"}}},
+		{"Fold", &endpointsTag{enum: []string{"asc", "desc"}, enumFold: true}},
+		{"Owner", &endpointsTag{immutable: true}},
+		{"Slug", &endpointsTag{required: true, pattern: "^[a-z]{1,3}$"}},
+		{"Items", &endpointsTag{minItems: 1, maxItems: 10}},
+		{"Renamed", &endpointsTag{aliases: []string{"userName", "user_name"}}},
+		{"Sorted", &endpointsTag{desc: "Sort order, newest first", enum: []string{"asc", "desc"}, required: true}},
+		{"Comma", &endpointsTag{required: true, desc: "Code, e.g. a,b", pattern: "^[a-z],[a-z]$"}},
+		{"Stamp", &endpointsTag{timeFormats: []string{"rfc3339", "unixmillis"}, timeFormat: "unix"}},
+		{"BadMax", nil},
+		{"BadTime", nil},
+		{"Email", &endpointsTag{required: true, format: "email"}},
+		{"BadFmt", nil},
+		{"Card", &endpointsTag{requiredIf: "paymentMethod", requiredIfVal: "card", desc: "Card token"}},
+		{"BadIf", nil},
 	}
 
 	typ := reflect.TypeOf(s{})
@@ -11,10 +11,12 @@ import (
 	"math/big"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 
 	"golang.org/x/net/context"
 	"google.golang.org/appengine"
@@ -63,6 +65,33 @@ var (
 	// It is a variable on purpose. You can set it to a stub implementation
 	// in tests.
 	ContextFactory func(*http.Request) Context
+
+	// NonceValidator, if set, is called with the nonce claim of ID tokens
+	// which have one, after all other checks pass. It can be used to reject
+	// replayed tokens, e.g. by checking and consuming the nonce in memcache.
+	// A non-nil error fails authentication with 401 Unauthorized.
+	NonceValidator func(c Context, nonce string) error
+
+	// TokenHeader is the name of the request header bearer tokens are read
+	// from, for deployments behind an auth proxy which forwards the token
+	// in a different header, e.g. X-Forwarded-Authorization.
+	// Empty means the standard Authorization header.
+	//
+	// On production App Engine, OAuth 2.0 access tokens are verified by
+	// the platform, which always uses the Authorization header.
+	TokenHeader string
+
+	// StrictTokens rejects bearer tokens which are otherwise cleaned up
+	// before they're verified, e.g. "Bearer Bearer <token>" or a token
+	// followed by control characters, as malformed.
+	StrictTokens bool
+
+	// NamespaceValidator, if set, is consulted by Namespace method of
+	// contexts created by this package, and for Server.NamespaceHeader,
+	// before the namespace is applied. It returns the name to use instead,
+	// e.g. with a required prefix, or an error rejecting the name, which
+	// Namespace returns as is.
+	NamespaceValidator func(name string) (string, error)
 )
 
 // Context represents the context of an in-flight API request.
@@ -89,12 +118,18 @@ type Context interface {
 
 // NewContext returns a new context for an in-flight API (HTTP) request.
 func NewContext(req *http.Request) Context {
+	return newContext(req, ContextFactory)
+}
+
+// newContext is the same as NewContext but uses the given factory to create
+// a new context if there's none associated with req yet.
+func newContext(req *http.Request, factory func(*http.Request) Context) Context {
 	ctxsMu.Lock()
 	defer ctxsMu.Unlock()
 	c, ok := ctxs[req]
 
 	if !ok {
-		c = ContextFactory(req)
+		c = factory(req)
 		ctxs[req] = c
 	}
 
@@ -109,24 +144,203 @@ func destroyContext(c Context) {
 	delete(ctxs, c.HTTPRequest())
 }
 
-// getToken looks for Authorization header and returns a token.
+// tokenState keeps info about the most recently validated token
+// of a request. It is safe to use concurrently.
+type tokenState struct {
+	mu           sync.Mutex
+	validated    bool
+	email        string
+	hostedDomain string
+	clientID     string
+	scopes       []string
+}
+
+// set records a successfully validated token.
+func (t *tokenState) set(email, hostedDomain, clientID string, scopes []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.validated = true
+	t.email, t.hostedDomain, t.clientID, t.scopes = email, hostedDomain, clientID, scopes
+}
+
+// issuedTo returns the client ID the token was issued to, if known.
+func (t *tokenState) issuedTo() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.clientID
+}
+
+// grantedScopes returns a copy of granted scopes, never nil.
+func (t *tokenState) grantedScopes() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]string{}, t.scopes...)
+}
+
+// isDomainUser reports whether the token was issued to a user of domain.
+// The hosted domain ("hd" claim of JWT) is preferred over the email domain.
+func (t *tokenState) isDomainUser(domain string) (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.validated {
+		return false, errors.New("No validated user")
+	}
+	if t.hostedDomain != "" {
+		return strings.EqualFold(t.hostedDomain, domain), nil
+	}
+	i := strings.LastIndex(t.email, "@")
+	if i < 0 {
+		return false, fmt.Errorf("Invalid email %q", t.email)
+	}
+	return strings.EqualFold(t.email[i+1:], domain), nil
+}
+
+// hostedDomainClaim returns the hosted domain of the token, if any.
+func (t *tokenState) hostedDomainClaim() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.hostedDomain
+}
+
+// tokenHolder is implemented by contexts which keep track of validated
+// tokens.
+type tokenHolder interface {
+	validatedToken() *tokenState
+}
+
+// GrantedScopes returns all scopes granted to the token of the most recent
+// successful validation in c (see CurrentOAuthUser), or an empty slice if
+// no token was validated or c doesn't keep track of validated tokens.
+func GrantedScopes(c Context) []string {
+	if t := validatedToken(c); t != nil {
+		return t.grantedScopes()
+	}
+	return []string{}
+}
+
+// IsDomainUser reports whether the user of the most recently validated
+// token in c belongs to domain, e.g. a G Suite domain. Hosted domain of
+// an ID token is preferred over the user email domain.
+//
+// Returns an error if no token was validated.
+func IsDomainUser(c Context, domain string) (bool, error) {
+	if t := validatedToken(c); t != nil {
+		return t.isDomainUser(domain)
+	}
+	return false, errors.New("No validated user")
+}
+
+// HostedDomain returns hosted domain ("hd" claim) of the most recently
+// validated ID token in c, or an empty string if there's none.
+func HostedDomain(c Context) string {
+	if t := validatedToken(c); t != nil {
+		return t.hostedDomainClaim()
+	}
+	return ""
+}
+
+// validatedToken returns the tokenState of c, or nil if c doesn't keep
+// track of validated tokens.
+func validatedToken(c Context) *tokenState {
+	if h, ok := c.(tokenHolder); ok {
+		return h.validatedToken()
+	}
+	return nil
+}
+
+// recordToken records a validated token in c, if c keeps track of them.
+func recordToken(c Context, email, hostedDomain, clientID string, scopes []string) {
+	if t := validatedToken(c); t != nil {
+		t.set(email, hostedDomain, clientID, scopes)
+	}
+}
+
+// getToken looks for Authorization header, or TokenHeader if set,
+// and returns a token.
 //
-// Returns empty string if req does not contain authorization header
-// or its value is not prefixed with allowedAuthSchemesUpper.
+// Returns empty string if req does not contain authorization header,
+// its value is not prefixed with allowedAuthSchemesUpper or the token is
+// malformed.
 func getToken(req *http.Request) string {
-	// TODO(dhermes): Allow a struct with access_token and bearer_token
-	//                fields here as well.
-	pieces := strings.Fields(req.Header.Get("Authorization"))
-	if len(pieces) != 2 {
+	token, _, err := parseToken(req)
+	if err != nil {
 		return ""
 	}
-	authHeaderSchemeUpper := strings.ToUpper(pieces[0])
+	return token
+}
+
+// currentToken is getToken of the request of c which tells malformed
+// tokens apart from missing ones. Cleaning up a token is logged.
+func currentToken(c Context) (string, error) {
+	token, cleaned, err := parseToken(c.HTTPRequest())
+	if err != nil {
+		log.Debugf(c, "Rejected bearer token: %v", err)
+		return "", err
+	}
+	if cleaned {
+		log.Debugf(c, "Cleaned up bearer token: removed a duplicated scheme or trailing characters")
+	}
+	return token, nil
+}
+
+// parseToken does the work of getToken, telling whether the token was
+// cleaned up: a scheme repeated before it and trailing control characters
+// are removed. A token which needs cleaning up when StrictTokens is set, or
+// which is not a b64token of RFC 6750 after it, results in bearerError.
+func parseToken(req *http.Request) (token string, cleaned bool, err error) {
+	// TODO(dhermes): Allow a struct with access_token and bearer_token
+	//                fields here as well.
+	header := TokenHeader
+	if header == "" {
+		header = "Authorization"
+	}
+	value := req.Header.Get(header)
+	trimmed := strings.TrimRightFunc(value, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	})
+	cleaned = strings.TrimRightFunc(value, unicode.IsSpace) != trimmed
+	pieces := strings.Fields(trimmed)
+	if len(pieces) < 2 || !isAuthScheme(pieces[0]) {
+		return "", false, nil
+	}
+	for len(pieces) > 2 && isAuthScheme(pieces[1]) {
+		pieces = append(pieces[:1], pieces[2:]...)
+		cleaned = true
+	}
+	if len(pieces) != 2 || !isB64Token(pieces[1]) || cleaned && StrictTokens {
+		return "", false, &bearerError{code: bearerInvalidToken, msg: "Malformed bearer token"}
+	}
+	return pieces[1], cleaned, nil
+}
+
+// isAuthScheme returns true if s is one of allowedAuthSchemesUpper,
+// ignoring case.
+func isAuthScheme(s string) bool {
+	s = strings.ToUpper(s)
 	for _, authScheme := range allowedAuthSchemesUpper {
-		if authHeaderSchemeUpper == authScheme {
-			return pieces[1]
+		if s == authScheme {
+			return true
 		}
 	}
-	return ""
+	return false
+}
+
+// isB64Token returns true if s is a b64token of RFC 6750, the syntax of
+// bearer tokens: 1*( ALPHA / DIGIT / "-" / "." / "_" / "~" / "+" / "/" ) *"="
+func isB64Token(s string) bool {
+	s = strings.TrimRight(s, "=")
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case strings.ContainsRune("-._~+/", r):
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 type certInfo struct {
@@ -211,9 +425,12 @@ func getCachedCerts(c Context) (*certsList, error) {
 	log.Debugf(c, "Fetching provider certs from: %s", DefaultCertURI)
 	resp, err := newHTTPClient(c).Get(DefaultCertURI)
 	if err != nil {
-		return nil, err
+		return nil, newAuthBackendError(err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, newAuthBackendError(fmt.Errorf("Cert URI replied with %s", resp.Status))
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, errors.New("Could not reach Cert URI or bad response.")
 	}
@@ -249,12 +466,151 @@ type signedJWTHeader struct {
 }
 
 type signedJWT struct {
-	Audience string `json:"aud"`
-	ClientID string `json:"azp"`
-	Email    string `json:"email"`
-	Expires  int64  `json:"exp"`
-	IssuedAt int64  `json:"iat"`
-	Issuer   string `json:"iss"`
+	Audience     string `json:"aud"`
+	ClientID     string `json:"azp"`
+	Email        string `json:"email"`
+	Expires      int64  `json:"exp"`
+	IssuedAt     int64  `json:"iat"`
+	Issuer       string `json:"iss"`
+	HostedDomain string `json:"hd,omitempty"`
+	Nonce        string `json:"nonce,omitempty"`
+	// Audiences is set instead of Audience when "aud" claim is an array.
+	Audiences []string `json:"-"`
+}
+
+// UnmarshalJSON decodes a JWT payload, whose "aud" claim is either
+// a string or an array of strings.
+func (t *signedJWT) UnmarshalJSON(b []byte) error {
+	type plainJWT signedJWT
+	v := struct {
+		*plainJWT
+		Audience json.RawMessage `json:"aud"`
+	}{plainJWT: (*plainJWT)(t)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch {
+	case len(v.Audience) == 0:
+		return nil
+	case v.Audience[0] == '[':
+		return json.Unmarshal(v.Audience, &t.Audiences)
+	}
+	return json.Unmarshal(v.Audience, &t.Audience)
+}
+
+// audiences returns all audiences of the token.
+func (t *signedJWT) audiences() []string {
+	if len(t.Audiences) > 0 {
+		return t.Audiences
+	}
+	if t.Audience != "" {
+		return []string{t.Audience}
+	}
+	return nil
+}
+
+// audienceAllowed returns true if any audience of the token is one of
+// audiences or clientIDs. Audiences are matched exactly, except that an
+// audience equal to the client ID of the token, as in ID tokens of web
+// clients, may also match a wildcard pattern of clientIDs.
+func (t *signedJWT) audienceAllowed(audiences, clientIDs []string) bool {
+	for _, aud := range t.audiences() {
+		if contains(audiences, aud) || contains(clientIDs, aud) ||
+			(aud == t.ClientID && clientIDAllowed(clientIDs, aud)) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIDAllowed returns true if id matches any of clientIDs, either
+// exactly or as a wildcard pattern (see matchClientID).
+func clientIDAllowed(clientIDs []string, id string) bool {
+	for _, pattern := range clientIDs {
+		if matchClientID(pattern, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchClientID returns true if id matches client ID pattern.
+//
+// Besides exact IDs, a pattern may end its first dot-separated label with
+// a wildcard following a project number, e.g.
+// "123456789-*.apps.googleusercontent.com", to match the clients of that
+// project. The wildcard stands for a non-empty string without dots, and
+// the rest of the pattern must have at least two labels. Patterns without
+// a project number, like "*.apps.googleusercontent.com", would match
+// clients of any project, so they match nothing but themselves and
+// Server.Validate rejects them.
+func matchClientID(pattern, id string) bool {
+	if pattern == id {
+		return true
+	}
+	prefix, suffix, ok := splitClientIDPattern(pattern)
+	if !ok {
+		return false
+	}
+	if len(id) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(id, prefix) || !strings.HasSuffix(id, suffix) {
+		return false
+	}
+	return !strings.Contains(id[len(prefix):len(id)-len(suffix)], ".")
+}
+
+// splitClientIDPattern returns the parts of a wildcard client ID pattern
+// before and after the wildcard, or false if pattern isn't a valid one
+// (see matchClientID).
+func splitClientIDPattern(pattern string) (prefix, suffix string, ok bool) {
+	i := strings.IndexByte(pattern, '*')
+	if i < 0 || i > strings.IndexByte(pattern, '.') {
+		return "", "", false
+	}
+	prefix, suffix = pattern[:i], pattern[i+1:]
+	if !isProjectNumberPrefix(prefix) || !strings.HasPrefix(suffix, ".") || strings.Count(suffix, ".") < 2 ||
+		strings.Contains(suffix, "*") {
+		return "", "", false
+	}
+	return prefix, suffix, true
+}
+
+// checkClientIDPatterns returns an error if a client ID of a method
+// contains a wildcard but isn't a valid pattern, e.g.
+// "*.apps.googleusercontent.com", which would silently match no client.
+func checkClientIDPatterns(services []*RPCService) error {
+	for _, s := range services {
+		methods := s.Methods()
+		sort.Sort(byMethodName(methods))
+		for _, m := range methods {
+			for _, id := range m.Info().ClientIds {
+				if !strings.Contains(id, "*") {
+					continue
+				}
+				if _, _, ok := splitClientIDPattern(id); !ok {
+					return fmt.Errorf("%s.%s: invalid client ID pattern %q, "+
+						"a wildcard must follow a project number, e.g. \"123456789-*.apps.googleusercontent.com\"",
+						s.Name(), m.method.Name, id)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isProjectNumberPrefix returns true if prefix of a client ID pattern is
+// a project number, optionally followed by "-".
+func isProjectNumberPrefix(prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "-")
+	if prefix == "" {
+		return false
+	}
+	for _, r := range prefix {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 // addBase64Pad pads s to be a valid base64-encoded string.
@@ -426,7 +782,7 @@ func verifyParsedToken(c Context, token signedJWT, audiences []string, clientIDs
 	}
 
 	// Check audiences.
-	if token.Audience == "" {
+	if len(token.audiences()) == 0 {
 		log.Warningf(c, "Invalid aud value in token")
 		return false
 	}
@@ -436,11 +792,12 @@ func verifyParsedToken(c Context, token signedJWT, audiences []string, clientIDs
 		return false
 	}
 
-	// This is only needed if Audience and ClientID differ, which (currently) only
-	// happens on Android. In the case they are equal, we only need the ClientID to
-	// be in the listed of accepted Client IDs.
-	if token.ClientID != token.Audience && !contains(audiences, token.Audience) {
-		log.Warningf(c, "Audience not allowed: %s", token.Audience)
+	// Audiences and ClientID differ (currently) only on Android. When they
+	// are equal, the ClientID being in the list of accepted Client IDs is
+	// enough. A token may have several audiences, e.g. web and mobile
+	// client IDs, any of which has to be accepted.
+	if !token.audienceAllowed(audiences, clientIDs) {
+		log.Warningf(c, "Audience not allowed: %v", token.audiences())
 		return false
 	}
 
@@ -448,7 +805,7 @@ func verifyParsedToken(c Context, token signedJWT, audiences []string, clientIDs
 	if len(clientIDs) == 0 {
 		log.Warningf(c, "No allowed client IDs specified. ID token cannot be verified.")
 		return false
-	} else if !contains(clientIDs, token.ClientID) {
+	} else if !clientIDAllowed(clientIDs, token.ClientID) {
 		log.Warningf(c, "Client ID is not allowed: %s", token.ClientID)
 		return false
 	}
@@ -470,8 +827,20 @@ func currentIDTokenUser(c Context, jwt string, audiences []string, clientIDs []s
 	if err != nil {
 		return nil, err
 	}
+	if len(parsedToken.audiences()) > 0 && !parsedToken.audienceAllowed(audiences, clientIDs) {
+		log.Warningf(c, "Audience not allowed: %v", parsedToken.audiences())
+		return nil, NewForbiddenError("Token audience is not allowed")
+	}
+	if parsedToken.ClientID != "" && len(clientIDs) > 0 && !clientIDAllowed(clientIDs, parsedToken.ClientID) {
+		log.Warningf(c, "Client ID is not allowed: %s", parsedToken.ClientID)
+		return nil, NewForbiddenError("Client ID is not allowed")
+	}
 
 	if verifyParsedToken(c, *parsedToken, audiences, clientIDs) {
+		if err := validateNonce(c, parsedToken.Nonce); err != nil {
+			return nil, err
+		}
+		recordToken(c, parsedToken.Email, parsedToken.HostedDomain, parsedToken.ClientID, []string{EmailScope})
 		return &user.User{
 			Email: parsedToken.Email,
 		}, nil
@@ -480,6 +849,52 @@ func currentIDTokenUser(c Context, jwt string, audiences []string, clientIDs []s
 	return nil, errors.New("No ID token user found.")
 }
 
+// validateNonce calls NonceValidator, if set, for a non-empty nonce.
+// It returns 401 APIError if the nonce is rejected.
+func validateNonce(c Context, nonce string) error {
+	if NonceValidator == nil || nonce == "" {
+		return nil
+	}
+	if err := NonceValidator(c, nonce); err != nil {
+		log.Warningf(c, "Nonce %q was rejected: %v", nonce, err)
+		return NewUnauthorizedError("Invalid nonce")
+	}
+	return nil
+}
+
+// authBackendReason is the Reason of errors returned when a token couldn't
+// be validated because a validation backend, e.g. tokeninfo API, failed.
+const authBackendReason = "authBackendUnavailable"
+
+// newAuthBackendError returns 503 APIError for a failure err of a token
+// validation backend, as opposed to the token being rejected, so that
+// clients retry instead of re-authenticating.
+func newAuthBackendError(err error) error {
+	return &APIError{
+		Name:   http.StatusText(http.StatusServiceUnavailable),
+		Msg:    fmt.Sprintf("Token validation is unavailable: %v", err),
+		Code:   http.StatusServiceUnavailable,
+		Reason: authBackendReason,
+	}
+}
+
+// isAuthBackendError returns true if err was returned by
+// newAuthBackendError.
+func isAuthBackendError(err error) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.Reason == authBackendReason
+}
+
+// failOpenKey is a context key of a value which is true if CurrentUser may
+// fail open, see Server.AuthFailOpen.
+type failOpenKey struct{}
+
+// withAuthFailOpen returns a Context derived from c in which CurrentUser
+// fails open.
+func withAuthFailOpen(c Context) Context {
+	return deriveContext(c, context.WithValue(c, failOpenKey{}, true))
+}
+
 // CurrentBearerTokenScope compares given scopes and clientIDs with those in c.
 //
 // Both scopes and clientIDs args must have at least one element.
@@ -487,25 +902,31 @@ func currentIDTokenUser(c Context, jwt string, audiences []string, clientIDs []s
 // Returns a single scope (one of provided scopes) if the two conditions are met:
 //   - it is found in Context c
 //   - client ID on that scope matches one of clientIDs in the args
+//
+// clientIDs may contain wildcard patterns following a project number, e.g.
+// "123456789-*.apps.googleusercontent.com".
+// A client ID matching none of them results in 403 APIError.
 func CurrentBearerTokenScope(c Context, scopes []string, clientIDs []string) (string, error) {
+	var lastErr error
 	for _, scope := range scopes {
 		currentClientID, err := c.CurrentOAuthClientID(scope)
-		if err != nil {
+		if isAuthBackendError(err) {
+			return "", err
+		} else if err != nil {
+			lastErr = err
 			continue
 		}
 
-		for _, id := range clientIDs {
-			if id == currentClientID {
-				return scope, nil
-			}
+		if clientIDAllowed(clientIDs, currentClientID) {
+			return scope, nil
 		}
 
 		// If none of the client IDs matches, return nil
 		log.Debugf(c, "Couldn't find current client ID %q in %v", currentClientID, clientIDs)
-		return "", errors.New("Mismatched Client ID")
+		return "", NewForbiddenError("Mismatched Client ID")
 	}
 	// No client ID found for any of the scopes
-	return "", errors.New("No valid scope")
+	return "", noValidScope(lastErr)
 }
 
 // CurrentBearerTokenUser returns a user associated with the request which is
@@ -530,17 +951,47 @@ func CurrentBearerTokenUser(c Context, scopes []string, clientIDs []string) (*us
 // It first tries to decode and verify JWT token (if conditions are met)
 // and falls back to Bearer token.
 //
+// If the token can't be validated because a validation backend is
+// unavailable, it returns 503 APIError, or an anonymous user with empty
+// Email if the request fails open (see Server.AuthFailOpen).
+//
+// If an operator impersonates a user (see Server.ImpersonationHeader), it
+// returns the impersonated user once the operator's token is validated.
+//
 // NOTE: Currently, returned user will have only Email field set when JWT is used.
 func CurrentUser(c Context, scopes []string, audiences []string, clientIDs []string) (*user.User, error) {
+	defer trackServerTiming(c, "auth", time.Now())
+	u, err := currentUser(c, scopes, audiences, clientIDs)
+	if imp := impersonationOf(c); err == nil && imp != nil {
+		return imp.user(), nil
+	}
+	if isAuthBackendError(err) {
+		if failOpen, _ := c.Value(failOpenKey{}).(bool); failOpen {
+			log.Warningf(c, "Failing open: %v", err)
+			return &user.User{}, nil
+		}
+	}
+	return u, err
+}
+
+// currentUser is the same as CurrentUser but never fails open.
+func currentUser(c Context, scopes []string, audiences []string, clientIDs []string) (*user.User, error) {
+	if err := checkLazyAuth(c); err != nil {
+		return nil, err
+	}
+
 	// The user hasn't provided any information to allow us to parse either
 	// an ID token or a Bearer token.
 	if len(scopes) == 0 && len(audiences) == 0 && len(clientIDs) == 0 {
 		return nil, errors.New("No client ID or scope info provided.")
 	}
 
-	token := getToken(c.HTTPRequest())
+	token, err := currentToken(c)
+	if err != nil {
+		return nil, err
+	}
 	if token == "" {
-		return nil, errors.New("No token in the current context.")
+		return nil, &bearerError{msg: "No token in the current context."}
 	}
 
 	// If the only scope is the email scope, check an ID token. Alternatively,
@@ -550,9 +1001,9 @@ func CurrentUser(c Context, scopes []string, audiences []string, clientIDs []str
 		log.Debugf(c, "Checking for ID token.")
 		now := currentUTC().Unix()
 		u, err := currentIDTokenUser(c, token, audiences, clientIDs, now)
-		// Only return in case of success, else pass along and try
-		// parsing Bearer token.
-		if err == nil {
+		// Only return in case of success or an APIError, e.g. a rejected
+		// nonce or audience, else pass along and try parsing Bearer token.
+		if _, rejected := err.(*APIError); err == nil || rejected {
 			return u, err
 		}
 	}
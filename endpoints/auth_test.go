@@ -33,6 +33,9 @@ func TestGetToken(t *testing.T) {
 		{"Authorization", "", ""},
 		{"X-Other-Header", "Bearer token", ""},
 		{"x-header", "Bearer token", ""},
+		{"Authorization", "Bearer Bearer token", "token"},
+		{"Authorization", "Bearer token\r\n", "token"},
+		{"Authorization", "Bearer tok en", ""},
 		{"", "", ""},
 	}
 	for i, tt := range tts {
@@ -49,6 +52,72 @@ func TestGetToken(t *testing.T) {
 	}
 }
 
+func TestParseToken(t *testing.T) {
+	origStrict := StrictTokens
+	defer func() { StrictTokens = origStrict }()
+
+	tts := []struct {
+		value   string
+		strict  bool
+		want    string
+		cleaned bool
+		err     bool
+	}{
+		{"Bearer ya29.a-b_c~d+e/f==", false, "ya29.a-b_c~d+e/f==", false, false},
+		{"Bearer token \n", false, "token", false, false},
+		{"Bearer token\x00\x1b", false, "token", true, false},
+		{"Bearer Bearer token", false, "token", true, false},
+		{"OAuth bearer BEARER token", false, "token", true, false},
+		{"Bearer token\n", true, "token", false, false},
+		{"Bearer Bearer token", true, "", false, true},
+		{"Bearer token\x00", true, "", false, true},
+		{"Bearer tok\x00en", false, "", false, true},
+		{"Bearer tok en", false, "", false, true},
+		{"Bearer tok=en", false, "", false, true},
+		{"Bearer ===", false, "", false, true},
+		{"Bearer \"token\"", false, "", false, true},
+		{"Basic dXNlcjpwYXNz", false, "", false, false},
+		{"Bearer", false, "", false, false},
+	}
+	for i, tt := range tts {
+		StrictTokens = tt.strict
+		r := &http.Request{Header: http.Header{"Authorization": {tt.value}}}
+		token, cleaned, err := parseToken(r)
+		if token != tt.want || cleaned != tt.cleaned || (err != nil) != tt.err {
+			t.Errorf("%d: parseToken(%q) = %q, %t, %v; want %q, %t, error %t",
+				i, tt.value, token, cleaned, err, tt.want, tt.cleaned, tt.err)
+		}
+		if be, ok := err.(*bearerError); err != nil && (!ok || be.code != bearerInvalidToken || be.msg != "Malformed bearer token") {
+			t.Errorf("%d: parseToken(%q) = %#v; want malformed bearerError", i, tt.value, err)
+		}
+	}
+}
+
+func TestGetTokenCustomHeader(t *testing.T) {
+	origHeader := TokenHeader
+	defer func() { TokenHeader = origHeader }()
+	TokenHeader = "X-Forwarded-Authorization"
+
+	tts := []struct {
+		header, value, want string
+	}{
+		{"X-Forwarded-Authorization", "Bearer token", "token"},
+		{"x-forwarded-authorization", "oauth foo", "foo"},
+		{"X-Forwarded-Authorization", "token", ""},
+		{"Authorization", "Bearer token", ""},
+	}
+	for i, tt := range tts {
+		h := make(http.Header)
+		h.Set(tt.header, tt.value)
+		r := &http.Request{Header: h}
+
+		out := getToken(r)
+		if out != tt.want {
+			t.Errorf("%d: getToken(%v) = %q; want %q", i, h, out, tt.want)
+		}
+	}
+}
+
 func TestGetMaxAge(t *testing.T) {
 	verifyPairs(t,
 		getMaxAge("max-age=86400"), 86400,
@@ -153,6 +222,57 @@ func TestContains(t *testing.T) {
 	}
 }
 
+func TestMatchClientID(t *testing.T) {
+	const suffix = ".apps.googleusercontent.com"
+	tts := []struct {
+		pattern, id string
+		want        bool
+	}{
+		{"123-abc" + suffix, "123-abc" + suffix, true},
+		{"123-abc" + suffix, "123-xyz" + suffix, false},
+		{"*" + suffix, "123-abc" + suffix, false},
+		{"*" + suffix, "*" + suffix, true},
+		{"abc-*" + suffix, "abc-def" + suffix, false},
+		{"123*" + suffix, "123456" + suffix, true},
+		{"*" + suffix, suffix, false},
+		{"*" + suffix, "a.b" + suffix, false},
+		{"*" + suffix, "123-abc.apps.example.com", false},
+		{"123-*" + suffix, "123-abc" + suffix, true},
+		{"123-*" + suffix, "123-" + suffix, false},
+		{"123-*" + suffix, "456-abc" + suffix, false},
+		{"*", "anything", false},
+		{"*", "*", true},
+		{"*.com", "evil.com", false},
+		{"abc*def.example.com", "abcxdef.example.com", false},
+		{"abc.*.example.com", "abc.x.example.com", false},
+		{"*.*.example.com", "x.y.example.com", false},
+	}
+	for i, tt := range tts {
+		if got := matchClientID(tt.pattern, tt.id); got != tt.want {
+			t.Errorf("%d: matchClientID(%q, %q) = %v; want %v", i, tt.pattern, tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestAudienceAllowedExact(t *testing.T) {
+	const id = "123456789-abc.apps.googleusercontent.com"
+	clientIDs := []string{"123456789-*.apps.googleusercontent.com"}
+	token := &signedJWT{Audience: id, ClientID: "123456789-xyz.apps.googleusercontent.com"}
+	if token.audienceAllowed(nil, clientIDs) {
+		t.Errorf("audienceAllowed(nil, %v) = true; want wildcards not applied to audiences", clientIDs)
+	}
+	token.ClientID = id
+	if !token.audienceAllowed(nil, []string{id}) {
+		t.Errorf("audienceAllowed(nil, [%s]) = false; want true", id)
+	}
+	if !token.audienceAllowed(nil, clientIDs) {
+		t.Errorf("audienceAllowed(nil, %v) = false; want true for an audience equal to the client ID", clientIDs)
+	}
+	if !clientIDAllowed(clientIDs, token.ClientID) {
+		t.Errorf("clientIDAllowed(%v, %s) = false; want true", clientIDs, id)
+	}
+}
+
 func TestGetCachedCertsCacheHit(t *testing.T) {
 	origTransport := httpTransportFactory
 	defer func() { httpTransportFactory = origTransport }()
@@ -297,6 +417,9 @@ func TestCurrentBearerTokenUser(t *testing.T) {
 		{[]string{validScope}, empty, false},
 		{[]string{validScope}, []string{validClientID}, true},
 		{[]string{"a", validScope, "b"}, []string{"c", validClientID, "d"}, true},
+		{[]string{validScope}, []string{"*.apps.googleusercontent.com"}, false},
+		{[]string{validScope}, []string{"1234*.apps.googleusercontent.com"}, true},
+		{[]string{validScope}, []string{"987654321*.apps.googleusercontent.com"}, false},
 	}
 	for i, tt := range tts {
 		r, err := inst.NewRequest("GET", "/", nil)
@@ -315,6 +438,15 @@ func TestCurrentBearerTokenUser(t *testing.T) {
 		}
 	}
 
+	req, err := inst.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	_, err = CurrentBearerTokenUser(cachingContextFactory(req), []string{validScope}, []string{"other-*.apps.googleusercontent.com"})
+	if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusForbidden {
+		t.Errorf("CurrentBearerTokenUser with mismatched client ID = %v; want 403 APIError", err)
+	}
+
 	r, err := inst.NewRequest("GET", "/", nil)
 	if err != nil {
 		t.Fatalf("failed to create req: %v", err)
@@ -425,3 +557,102 @@ func TestCurrentUser(t *testing.T) {
 		}
 	}
 }
+
+func TestCurrentUserAuthBackendError(t *testing.T) {
+	origTransport := httpTransportFactory
+	defer func() { httpTransportFactory = origTransport }()
+	// No responses, i.e. tokeninfo API is unreachable.
+	httpTransportFactory = func(c context.Context) http.RoundTripper {
+		return newTestRoundTripper()
+	}
+
+	scopes, clientIDs := []string{"scope.one"}, []string{"my-client-id"}
+	for _, failOpen := range []bool{false, true} {
+		r, _, closer := newTestRequest(t, "GET", "/", nil)
+		r.Header.Set("Authorization", "Bearer some_token")
+		c := tokeninfoContextFactory(r)
+		if failOpen {
+			c = withAuthFailOpen(c)
+		}
+
+		u, err := CurrentUser(c, scopes, nil, clientIDs)
+		closer()
+		switch {
+		case !failOpen && !isAuthBackendError(err):
+			t.Errorf("CurrentUser() = %v, %v; want 503 APIError", u, err)
+		case failOpen && (err != nil || u == nil || u.Email != ""):
+			t.Errorf("CurrentUser() = %v, %v; want anonymous user", u, err)
+		}
+	}
+}
+
+func TestTokenStateIsDomainUser(t *testing.T) {
+	tts := []struct {
+		validated         bool
+		email, hd, domain string
+		want, shouldError bool
+	}{
+		{false, "", "", "example.org", false, true},
+		{true, "user@example.org", "", "example.org", true, false},
+		{true, "user@EXAMPLE.org", "", "example.org", true, false},
+		{true, "user@example.org", "", "other.org", false, false},
+		{true, "user@evil.org", "example.org", "example.org", true, false},
+		{true, "user@example.org", "evil.org", "example.org", false, false},
+		{true, "invalid", "", "example.org", false, true},
+	}
+	for i, tt := range tts {
+		ts := &tokenState{}
+		if tt.validated {
+			ts.set(tt.email, tt.hd, "", nil)
+		}
+		out, err := ts.isDomainUser(tt.domain)
+		switch {
+		case err != nil && !tt.shouldError:
+			t.Errorf("%d: isDomainUser(%q) = %v; want %v", i, tt.domain, err, tt.want)
+		case err == nil && tt.shouldError:
+			t.Errorf("%d: isDomainUser(%q) = %v; want error", i, tt.domain, out)
+		case out != tt.want:
+			t.Errorf("%d: isDomainUser(%q) = %v; want %v", i, tt.domain, out, tt.want)
+		}
+	}
+}
+
+func TestRecordToken(t *testing.T) {
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	recordToken(c, "user@gmail.com", "example.org", "", []string{EmailScope})
+	if hd := HostedDomain(c); hd != "example.org" {
+		t.Errorf("HostedDomain(c) = %q; want %q", hd, "example.org")
+	}
+	if ok, err := IsDomainUser(c, "example.org"); !ok || err != nil {
+		t.Errorf("IsDomainUser(c, %q) = %v, %v; want true", "example.org", ok, err)
+	}
+	if scopes := GrantedScopes(c); !reflect.DeepEqual(scopes, []string{EmailScope}) {
+		t.Errorf("GrantedScopes(c) = %v; want %v", scopes, []string{EmailScope})
+	}
+}
+
+// untrackedContext is a Context which doesn't keep track of validated
+// tokens, like those of a custom ContextFactory.
+type untrackedContext struct {
+	Context
+}
+
+func TestRecordTokenUntrackedContext(t *testing.T) {
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	c := &untrackedContext{cachingContextFactory(r)}
+
+	recordToken(c, "user@gmail.com", "example.org", "", []string{EmailScope})
+	if hd := HostedDomain(c); hd != "" {
+		t.Errorf("HostedDomain(c) = %q; want empty", hd)
+	}
+	if ok, err := IsDomainUser(c, "example.org"); err == nil {
+		t.Errorf("IsDomainUser(c, %q) = %v; want error", "example.org", ok)
+	}
+	if scopes := GrantedScopes(c); scopes == nil || len(scopes) != 0 {
+		t.Errorf("GrantedScopes(c) = %#v; want empty slice", scopes)
+	}
+}
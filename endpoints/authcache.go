@@ -0,0 +1,67 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"golang.org/x/net/context"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/memcache"
+	"google.golang.org/appengine/user"
+)
+
+// isAdmin reports whether the user signed in to the app is an admin.
+// This is a variable on purpose to be able to stub during testing.
+var isAdmin = func(c context.Context) bool {
+	return user.IsAdmin(c)
+}
+
+// ClearAuthCaches removes cached public certificates used to verify
+// ID tokens, so that they are fetched from DefaultCertURI again, e.g. after
+// Google rotated them unexpectedly, along with tokeninfo of bearer tokens
+// cached on the dev server. Since both are cached in memcache, this
+// affects all instances of the app.
+func ClearAuthCaches(c context.Context) error {
+	nc, err := appengine.Namespace(c, certNamespace)
+	if err != nil {
+		return err
+	}
+	if err := memcache.Delete(nc, DefaultCertURI); err != nil && err != memcache.ErrCacheMiss {
+		return err
+	}
+	// Bumping the generation orphans all cached tokeninfo.
+	tc, err := appengine.Namespace(c, tokeninfoNamespace)
+	if err != nil {
+		return err
+	}
+	_, err = memcache.Increment(tc, tokeninfoGenKey, 1, 0)
+	return err
+}
+
+// HandleClearAuthCaches is an http.HandlerFunc which calls ClearAuthCaches
+// on POST requests of app admins and responds with 204 No Content.
+// Other requests are rejected, so that it can't be used to trigger
+// fetching certificates by anyone. For instance:
+//
+//	http.HandleFunc("/admin/clear-auth-caches", endpoints.HandleClearAuthCaches)
+func HandleClearAuthCaches(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "POST" {
+		writeError(w, errorf(http.StatusMethodNotAllowed, "POST method required, got %q", r.Method))
+		return
+	}
+	c := appengine.NewContext(r)
+	if !isAdmin(c) {
+		writeError(w, NewForbiddenError("Admin required"))
+		return
+	}
+	if err := ClearAuthCaches(c); err != nil {
+		log.Errorf(c, "Error clearing auth caches: %v", err)
+		writeError(w, NewInternalServerError("Error clearing auth caches"))
+		return
+	}
+	log.Infof(c, "Auth caches cleared")
+	w.Header().Del("Content-Type")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,71 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"appengine/aetest"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/memcache"
+)
+
+func TestHandleClearAuthCaches(t *testing.T) {
+	origIsAdmin := isAdmin
+	defer func() { isAdmin = origIsAdmin }()
+
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		method  string
+		admin   bool
+		code    int
+		cleared bool
+	}{
+		{"GET", true, http.StatusMethodNotAllowed, false},
+		{"POST", false, http.StatusForbidden, false},
+		{"POST", true, http.StatusNoContent, true},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest(tt.method, "/admin/clear-auth-caches", nil)
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		nc, err := appengine.Namespace(appengine.NewContext(r), certNamespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item := &memcache.Item{Key: DefaultCertURI, Value: []byte(googCerts)}
+		if err := memcache.Set(nc, item); err != nil {
+			t.Fatal(err)
+		}
+		isAdmin = func(context.Context) bool { return tt.admin }
+
+		w := httptest.NewRecorder()
+		HandleClearAuthCaches(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		_, err = memcache.Get(nc, DefaultCertURI)
+		if cleared := err == memcache.ErrCacheMiss; cleared != tt.cleared {
+			t.Errorf("%d: certs cleared = %v; want %v", i, cleared, tt.cleared)
+		}
+	}
+
+	// Clearing empty caches is not an error.
+	r, err := inst.NewRequest("POST", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ClearAuthCaches(appengine.NewContext(r)); err != nil {
+		t.Errorf("ClearAuthCaches() = %v; want nil", err)
+	}
+}
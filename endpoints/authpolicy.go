@@ -0,0 +1,136 @@
+package endpoints
+
+import (
+	"sync"
+
+	"google.golang.org/appengine/user"
+)
+
+// AuthPolicy tells whether methods which don't declare scopes require
+// authenticated users, see Server.DefaultAuth.
+type AuthPolicy int
+
+const (
+	// AuthOpen leaves authentication to service methods.
+	AuthOpen AuthPolicy = iota
+	// AuthRequired rejects requests to methods without scopes with 401
+	// Unauthorized unless they carry a valid token of the email scope,
+	// issued to one of the method's client IDs or audiences.
+	AuthRequired
+)
+
+// checkAuthPolicy enforces s.DefaultAuth on a request of method m called
+// name. Methods which have scopes, as returned by s.allowlist, or are
+// marked as MethodInfo.Public are not affected.
+func (s *Server) checkAuthPolicy(c Context, name string, m *ServiceMethod) error {
+	if s.DefaultAuth != AuthRequired || m.info == nil || m.info.Public {
+		return nil
+	}
+	al, err := s.allowlist(c, name, m)
+	if err != nil {
+		return err
+	}
+	if len(al.Scopes) > 0 {
+		return nil
+	}
+	_, err = CurrentUser(c, []string{EmailScope}, al.Audiences, al.ClientIds)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*APIError); ok {
+		return err
+	}
+	return newAuthError("Authentication required", err)
+}
+
+// authorize is checkAuthPolicy traced as a span called "auth".
+func (s *Server) authorize(c Context, name string, m *ServiceMethod) error {
+	span := startSpan(c, "auth")
+	defer span.End()
+	return s.checkAuthPolicy(c, name, m)
+}
+
+// lazyAuth is an auth check deferred until a method asks for the user,
+// see MethodInfo.LazyAuth.
+type lazyAuth struct {
+	once  sync.Once
+	check func() error
+	err   error
+}
+
+// run runs the check once and returns its result.
+func (a *lazyAuth) run() error {
+	a.once.Do(func() { a.err = a.check() })
+	return a.err
+}
+
+// lazyAuthKey is a context key of the *lazyAuth of a request.
+type lazyAuthKey struct{}
+
+// lazyAuthContext is a Context which runs a deferred auth check before
+// the first OAuth lookup.
+type lazyAuthContext struct {
+	Context
+	auth *lazyAuth
+}
+
+// withLazyAuth returns a Context derived from c which runs check with c
+// when the user is first asked for.
+func withLazyAuth(c Context, check func(Context) error) Context {
+	lc := &lazyAuthContext{c, &lazyAuth{check: func() error { return check(c) }}}
+	replaceContext(c, lc)
+	return lc
+}
+
+// checkLazyAuth runs the deferred auth check of c, if any.
+func checkLazyAuth(c Context) error {
+	if a, ok := c.Value(lazyAuthKey{}).(*lazyAuth); ok {
+		return a.run()
+	}
+	return nil
+}
+
+// Value is a part of context.Context interface.
+func (c *lazyAuthContext) Value(key interface{}) interface{} {
+	if key == (lazyAuthKey{}) {
+		return c.auth
+	}
+	return c.Context.Value(key)
+}
+
+// CurrentOAuthClientID returns a clientID associated with the scope.
+func (c *lazyAuthContext) CurrentOAuthClientID(scope string) (string, error) {
+	if err := c.auth.run(); err != nil {
+		return "", err
+	}
+	return c.Context.CurrentOAuthClientID(scope)
+}
+
+// CurrentOAuthUser returns a user of this request for the given scope.
+func (c *lazyAuthContext) CurrentOAuthUser(scope string) (*user.User, error) {
+	if err := c.auth.run(); err != nil {
+		return nil, err
+	}
+	return c.Context.CurrentOAuthUser(scope)
+}
+
+// Namespace returns a replacement context that operates within the given namespace.
+func (c *lazyAuthContext) Namespace(name string) (Context, error) {
+	return validatedNamespace(c, name)
+}
+
+// namespace is Namespace without NamespaceValidator.
+func (c *lazyAuthContext) namespace(name string) (Context, error) {
+	nc, err := uncheckedNamespace(c.Context, name)
+	if err != nil {
+		return nil, err
+	}
+	return &lazyAuthContext{nc, c.auth}, nil
+}
+
+func (c *lazyAuthContext) validatedToken() *tokenState {
+	if h, ok := c.Context.(tokenHolder); ok {
+		return h.validatedToken()
+	}
+	return nil
+}
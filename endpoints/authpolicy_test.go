@@ -0,0 +1,166 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+type PolicyService struct{}
+
+func (s *PolicyService) Ping(c Context) error {
+	return nil
+}
+
+type LazyAuthReq struct {
+	User  bool `json:"user"`
+	OAuth bool `json:"oauth"`
+}
+
+func (s *PolicyService) Lazy(c Context, req *LazyAuthReq) (*TestMsg, error) {
+	switch {
+	case req.User:
+		u, err := CurrentUser(c, []string{EmailScope}, []string{"my-client-id"}, []string{"hello-android"})
+		if err != nil {
+			return nil, err
+		}
+		return &TestMsg{Name: u.Email}, nil
+	case req.OAuth:
+		if _, err := c.CurrentOAuthUser(EmailScope); err != nil {
+			return nil, err
+		}
+	}
+	return &TestMsg{Name: "cached"}, nil
+}
+
+func TestServerDefaultAuth(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	origParser, origCurrentUTC := jwtParser, currentUTC
+	defer func() {
+		jwtParser, currentUTC = origParser, origCurrentUTC
+	}()
+	jwtParser = func(Context, string, int64) (*signedJWT, error) {
+		token := jwtValidTokenObject
+		return &token, nil
+	}
+	currentUTC = func() time.Time { return jwtValidTokenTime }
+
+	server := NewServer("")
+	svc, err := server.RegisterService(&PolicyService{}, "policy", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+
+	tts := []struct {
+		policy AuthPolicy
+		info   MethodInfo
+		token  bool
+		code   int
+	}{
+		{AuthOpen, MethodInfo{}, false, http.StatusNoContent},
+		{AuthRequired, MethodInfo{}, false, http.StatusUnauthorized},
+		{AuthRequired, MethodInfo{ClientIds: []string{"hello-android"}}, false, http.StatusUnauthorized},
+		{AuthRequired, MethodInfo{ClientIds: []string{"hello-android"}, Audiences: []string{"my-client-id"}}, true, http.StatusNoContent},
+		{AuthRequired, MethodInfo{ClientIds: []string{"other-client"}}, true, http.StatusForbidden},
+		{AuthRequired, MethodInfo{Public: true}, false, http.StatusNoContent},
+		{AuthRequired, MethodInfo{Scopes: []string{EmailScope}}, false, http.StatusNoContent},
+	}
+	for i, tt := range tts {
+		server.DefaultAuth = tt.policy
+		info := svc.MethodByName("Ping").Info()
+		info.Public, info.Scopes = tt.info.Public, tt.info.Scopes
+		info.Audiences, info.ClientIds = tt.info.Audiences, tt.info.ClientIds
+
+		r, err := inst.NewRequest("POST", "/PolicyService.Ping", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.token {
+			r.Header.Set("Authorization", "Bearer "+jwtValidTokenString)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+		}
+	}
+}
+
+func TestServerLazyAuth(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	origParser, origCurrentUTC := jwtParser, currentUTC
+	defer func() {
+		jwtParser, currentUTC = origParser, origCurrentUTC
+	}()
+	parsed := 0
+	jwtParser = func(Context, string, int64) (*signedJWT, error) {
+		parsed++
+		token := jwtValidTokenObject
+		return &token, nil
+	}
+	currentUTC = func() time.Time { return jwtValidTokenTime }
+
+	server := NewServer("")
+	server.DefaultAuth = AuthRequired
+	svc, err := server.RegisterService(&PolicyService{}, "policy", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := svc.MethodByName("Lazy").Info()
+	info.Audiences = []string{"my-client-id"}
+
+	tts := []struct {
+		lazy      bool
+		clientID  string
+		token     bool
+		body      string
+		code      int
+		minParsed int
+	}{
+		{true, "hello-android", false, `{}`, http.StatusOK, 0},
+		{true, "hello-android", false, `{"user":true}`, http.StatusUnauthorized, 0},
+		{true, "hello-android", false, `{"oauth":true}`, http.StatusUnauthorized, 0},
+		{true, "hello-android", true, `{}`, http.StatusOK, 0},
+		{true, "hello-android", true, `{"user":true}`, http.StatusOK, 1},
+		{true, "other-client", true, `{"user":true}`, http.StatusForbidden, 1},
+		{false, "hello-android", false, `{}`, http.StatusUnauthorized, 0},
+		{false, "hello-android", true, `{}`, http.StatusOK, 1},
+	}
+	for i, tt := range tts {
+		info.LazyAuth = tt.lazy
+		info.ClientIds = []string{tt.clientID}
+		parsed = 0
+
+		r, err := inst.NewRequest("POST", "/PolicyService.Lazy", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.token {
+			r.Header.Set("Authorization", "Bearer "+jwtValidTokenString)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+		}
+		if tt.minParsed == 0 && parsed != 0 {
+			t.Errorf("%d: token parsed %d times; want it not validated", i, parsed)
+		} else if parsed < tt.minParsed {
+			t.Errorf("%d: token parsed %d times; want at least %d", i, parsed, tt.minParsed)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package endpoints
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// errCircuitOpen is returned by calls a CircuitBreaker doesn't let through.
+var errCircuitOpen = errors.New("circuit breaker is open")
+
+// TokeninfoBreaker guards calls to tokeninfo API, so that an outage fails
+// token validation fast with 503 instead of piling up requests waiting on
+// the API. It's disabled until its Threshold is set.
+var TokeninfoBreaker = &CircuitBreaker{}
+
+// CircuitBreaker stops calls to a failing backend.
+//
+// After Threshold consecutive failures within Window, the circuit opens
+// and calls fail immediately for Cooldown. Then a single call is let
+// through to probe the backend: its success closes the circuit, while
+// a failure opens it again.
+type CircuitBreaker struct {
+	// Threshold is the number of failures which open the circuit.
+	// Zero value disables the breaker.
+	Threshold int
+	// Window is the period failures are counted over. Zero value means
+	// failures are counted until a success.
+	Window time.Duration
+	// Cooldown is how long the circuit stays open. Defaults to 30 seconds.
+	Cooldown time.Duration
+
+	mu           sync.Mutex
+	failures     int
+	firstFailure time.Time
+	openedAt     time.Time
+	probing      bool
+}
+
+// cooldown returns b.Cooldown or its default value.
+func (b *CircuitBreaker) cooldown() time.Duration {
+	if b.Cooldown > 0 {
+		return b.Cooldown
+	}
+	return 30 * time.Second
+}
+
+// breakerCall identifies a call let through by CircuitBreaker.allow.
+type breakerCall struct {
+	// probe is true for the single call probing a half-open circuit.
+	probe bool
+	// openedAt is when the circuit was opened as of the call, if it was.
+	openedAt time.Time
+}
+
+// allow returns errCircuitOpen if a call to the backend should fail fast.
+// Otherwise the result of the call must be reported with done.
+func (b *CircuitBreaker) allow() (breakerCall, error) {
+	if b == nil || b.Threshold <= 0 {
+		return breakerCall{}, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return breakerCall{}, nil
+	}
+	if b.probing || currentUTC().Sub(b.openedAt) < b.cooldown() {
+		return breakerCall{}, errCircuitOpen
+	}
+	// Half-open: let this call probe the backend.
+	b.probing = true
+	return breakerCall{probe: true, openedAt: b.openedAt}, nil
+}
+
+// done records the result of call let through by allow. Only the probe
+// decides whether an open circuit closes, and calls let through before
+// the circuit was last opened are ignored.
+func (b *CircuitBreaker) done(call breakerCall, failed bool) {
+	if b == nil || b.Threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := currentUTC()
+	if call.probe {
+		b.probing = false
+		if failed {
+			b.openedAt = now
+		} else {
+			b.failures = 0
+			b.openedAt = time.Time{}
+		}
+		return
+	}
+	if !call.openedAt.Equal(b.openedAt) {
+		return
+	}
+	if !failed {
+		b.failures = 0
+		return
+	}
+	if b.failures == 0 || (b.Window > 0 && now.Sub(b.firstFailure) > b.Window) {
+		b.failures = 0
+		b.firstFailure = now
+	}
+	b.failures++
+	if b.failures >= b.Threshold {
+		b.openedAt = now
+	}
+}
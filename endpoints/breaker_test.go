@@ -0,0 +1,202 @@
+package endpoints
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	currentUTC = func() time.Time { return now }
+
+	b := &CircuitBreaker{Threshold: 3, Window: time.Minute, Cooldown: 10 * time.Second}
+	call := func(failed bool) error {
+		call, err := b.allow()
+		if err != nil {
+			return err
+		}
+		b.done(call, failed)
+		return nil
+	}
+
+	steps := []struct {
+		advance time.Duration
+		failed  bool
+		open    bool // whether the call is rejected
+	}{
+		{0, true, false},
+		{0, true, false},
+		// a success resets failures
+		{0, false, false},
+		{0, true, false},
+		{0, true, false},
+		// failures outside of the window aren't counted
+		{2 * time.Minute, true, false},
+		{0, true, false},
+		{0, true, false},
+		// open
+		{0, false, true},
+		{9 * time.Second, false, true},
+		// half-open, the probe fails
+		{time.Second, true, false},
+		{0, false, true},
+		{9 * time.Second, false, true},
+		// half-open, the probe succeeds
+		{time.Second, false, false},
+		{0, true, false},
+		{0, false, false},
+	}
+	for i, s := range steps {
+		now = now.Add(s.advance)
+		err := call(s.failed)
+		if open := err == errCircuitOpen; open != s.open {
+			t.Errorf("%d: call() = %v; want open = %v", i, err, s.open)
+		}
+	}
+}
+
+func TestCircuitBreakerHalfOpenSingleProbe(t *testing.T) {
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	now := time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)
+	currentUTC = func() time.Time { return now }
+
+	b := &CircuitBreaker{Threshold: 1}
+	late, _ := b.allow()
+	b.done(breakerCall{}, true)
+	now = now.Add(b.cooldown())
+	probe, err := b.allow()
+	if err != nil {
+		t.Fatalf("allow() = %v; want nil for the probe", err)
+	}
+	if _, err := b.allow(); err != errCircuitOpen {
+		t.Errorf("allow() = %v while probing; want %v", err, errCircuitOpen)
+	}
+
+	// A call let through before the circuit opened neither ends probing
+	// nor reopens the circuit.
+	openedAt := b.openedAt
+	b.done(late, true)
+	if _, err := b.allow(); err != errCircuitOpen {
+		t.Errorf("allow() = %v after a late call; want %v", err, errCircuitOpen)
+	}
+	if !b.openedAt.Equal(openedAt) {
+		t.Errorf("openedAt = %v after a late call; want %v", b.openedAt, openedAt)
+	}
+
+	b.done(probe, false)
+	if _, err := b.allow(); err != nil {
+		t.Errorf("allow() = %v after the probe succeeded; want nil", err)
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	b := &CircuitBreaker{}
+	for i := 0; i < 10; i++ {
+		b.done(breakerCall{}, true)
+	}
+	if _, err := b.allow(); err != nil {
+		t.Errorf("allow() = %v; want nil", err)
+	}
+}
+
+func TestFetchTokeninfoCircuitBreaker(t *testing.T) {
+	origTransport := httpTransportFactory
+	origBreaker := TokeninfoBreaker
+	defer func() {
+		httpTransportFactory = origTransport
+		TokeninfoBreaker = origBreaker
+	}()
+	TokeninfoBreaker = &CircuitBreaker{Threshold: 2, Cooldown: time.Hour}
+
+	calls := 0
+	httpTransportFactory = func(c context.Context) http.RoundTripper {
+		calls++
+		return newTestRoundTripper(&http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: 503,
+			Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+		})
+	}
+
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	c := tokeninfoContextFactory(r)
+
+	for i := 0; i < 4; i++ {
+		_, err := fetchTokeninfo(c, "some_token")
+		if !isAuthBackendError(err) {
+			t.Errorf("%d: fetchTokeninfo() = %v; want backend error", i, err)
+		}
+		if open := strings.Contains(err.Error(), errCircuitOpen.Error()); open != (i >= 2) {
+			t.Errorf("%d: fetchTokeninfo() = %v; want circuit open = %v", i, err, i >= 2)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("tokeninfo calls = %d; want 2", calls)
+	}
+}
+
+func TestFetchTokeninfoCached(t *testing.T) {
+	origTransport := httpTransportFactory
+	origBreaker := TokeninfoBreaker
+	defer func() {
+		httpTransportFactory = origTransport
+		TokeninfoBreaker = origBreaker
+	}()
+	TokeninfoBreaker = &CircuitBreaker{Threshold: 1, Cooldown: time.Hour}
+
+	calls := 0
+	httpTransportFactory = func(c context.Context) http.RoundTripper {
+		calls++
+		if calls > 1 {
+			return newTestRoundTripper(&http.Response{
+				Status:     "503 Service Unavailable",
+				StatusCode: 503,
+				Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+			})
+		}
+		return newTestRoundTripper(&http.Response{
+			Status:     "200 OK",
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(tokeninfoValid)),
+		})
+	}
+
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	c := tokeninfoContextFactory(r)
+
+	if _, err := fetchTokeninfo(c, "valid_token"); err != nil {
+		t.Fatalf("fetchTokeninfo(valid_token) = %v; want nil", err)
+	}
+	// Open the circuit.
+	if _, err := fetchTokeninfo(c, "other_token"); !isAuthBackendError(err) {
+		t.Fatalf("fetchTokeninfo(other_token) = %v; want backend error", err)
+	}
+	if _, err := fetchTokeninfo(c, "other_token"); err == nil || !strings.Contains(err.Error(), errCircuitOpen.Error()) {
+		t.Fatalf("fetchTokeninfo(other_token) = %v; want circuit open", err)
+	}
+
+	ti, err := fetchTokeninfo(c, "valid_token")
+	if err != nil || ti.Email != tokeninfoEmail {
+		t.Errorf("fetchTokeninfo(valid_token) = %#v, %v; want cached tokeninfo", ti, err)
+	}
+	if calls != 2 {
+		t.Errorf("tokeninfo calls = %d; want 2", calls)
+	}
+
+	if err := ClearAuthCaches(c); err != nil {
+		t.Fatalf("ClearAuthCaches() = %v", err)
+	}
+	if _, err := fetchTokeninfo(c, "valid_token"); err == nil {
+		t.Errorf("fetchTokeninfo(valid_token) = nil after ClearAuthCaches; want circuit open")
+	}
+}
@@ -0,0 +1,94 @@
+package endpoints
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const (
+	// CacheKeyHeader is the request header clients set to tell which
+	// requests are equivalent, see MethodInfo.CacheByKey.
+	CacheKeyHeader = "X-Cache-Key"
+	// maxCachedResponses caps the number of responses in responseCache.
+	maxCachedResponses = 1000
+)
+
+// cachedResponse is a response in responseCache.
+type cachedResponse struct {
+	resp    reflect.Value
+	expires time.Time
+}
+
+// responseCache keeps responses of requests with CacheKeyHeader until they
+// expire, see MethodInfo.CacheByKey.
+type responseCache struct {
+	mu        sync.Mutex
+	responses map[string]*cachedResponse
+}
+
+// get returns a fresh response of key, if any.
+func (rc *responseCache) get(key string) (reflect.Value, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	cached, ok := rc.responses[key]
+	if !ok {
+		return reflect.Value{}, false
+	}
+	if !currentUTC().Before(cached.expires) {
+		delete(rc.responses, key)
+		return reflect.Value{}, false
+	}
+	return cached.resp, true
+}
+
+// put keeps resp as the response of key for ttl. Expired responses are
+// dropped once the cache is full, and resp isn't kept if it's still full.
+func (rc *responseCache) put(key string, resp reflect.Value, ttl time.Duration) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := currentUTC()
+	if rc.responses == nil {
+		rc.responses = make(map[string]*cachedResponse)
+	}
+	if len(rc.responses) >= maxCachedResponses {
+		for k, cached := range rc.responses {
+			if !now.Before(cached.expires) {
+				delete(rc.responses, k)
+			}
+		}
+		if len(rc.responses) >= maxCachedResponses {
+			return
+		}
+	}
+	rc.responses[key] = &cachedResponse{resp, now.Add(ttl)}
+}
+
+// cacheKey returns a key of request r of method m called name, if m caches
+// responses by CacheKeyHeader and r has it. Like coalesceKey, the key
+// covers the caller of r.
+func (s *Server) cacheKey(r *http.Request, name string, m *ServiceMethod) (string, bool) {
+	if m.info == nil || !m.info.CacheByKey || !m.readOnly() || reflect.PtrTo(m.RespType).Implements(typeOfResponder) {
+		return "", false
+	}
+	hdr := r.Header.Get(CacheKeyHeader)
+	if hdr == "" {
+		return "", false
+	}
+	return CacheKeyHeader + "\x00" + name + "\x00" + s.callerKey(r) + "\x00" + hdr, true
+}
+
+// callCached returns a fresh cached response of key, or the response of
+// run, shared by concurrent requests of key, and caches it for ttl.
+// Errors are not cached.
+func (s *Server) callCached(key string, ttl time.Duration, run func() (reflect.Value, error)) (reflect.Value, error) {
+	if resp, ok := s.respCache.get(key); ok {
+		return resp, nil
+	}
+	resp, err := s.coalescer.do(key, run)
+	if err == nil && ttl > 0 {
+		s.respCache.put(key, resp, ttl)
+	}
+	return resp, err
+}
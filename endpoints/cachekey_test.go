@@ -0,0 +1,153 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+func TestServerCacheByKey(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	now := time.Date(2016, 1, 31, 12, 0, 0, 0, time.UTC)
+	currentUTC = func() time.Time { return now }
+
+	svc := &CoalesceService{release: make(chan struct{})}
+	close(svc.release)
+	server := NewServer("")
+	rpc, err := server.RegisterService(svc, "things", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := rpc.MethodByName("Get").Info()
+	info.HTTPMethod, info.CacheByKey, info.CacheTTL = "GET", true, time.Minute
+	mwCalls := 0
+	server.Use(func(c Context, name string, next func(Context) error) error {
+		mwCalls++
+		return next(c)
+	})
+
+	tts := []struct {
+		advance time.Duration
+		key, id string
+		calls   int
+		code    int
+		out     string
+	}{
+		{0, "k1", "a", 1, http.StatusOK, `{"name":"a"}`},
+		{0, "k1", "b", 1, http.StatusOK, `{"name":"a"}`},
+		{0, "k2", "b", 2, http.StatusOK, `{"name":"b"}`},
+		{0, "", "c", 3, http.StatusOK, `{"name":"c"}`},
+		{0, "", "c", 4, http.StatusOK, `{"name":"c"}`},
+		{0, "k3", "missing", 5, http.StatusNotFound, ""},
+		{0, "k3", "missing", 6, http.StatusNotFound, ""},
+		{59 * time.Second, "k1", "b", 6, http.StatusOK, `{"name":"a"}`},
+		{time.Second, "k1", "b", 7, http.StatusOK, `{"name":"b"}`},
+	}
+	for i, tt := range tts {
+		now = now.Add(tt.advance)
+		r, err := inst.NewRequest("POST", "/CoalesceService.Get", strings.NewReader(`{"id":"`+tt.id+`"}`))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.key != "" {
+			r.Header.Set(CacheKeyHeader, tt.key)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if svc.calls != tt.calls {
+			t.Errorf("%d: method called %d times; want %d", i, svc.calls, tt.calls)
+		}
+		if mwCalls != i+1 {
+			t.Errorf("%d: middleware ran %d times; want %d", i, mwCalls, i+1)
+		}
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		if out := strings.TrimSpace(w.Body.String()); tt.out != "" && out != tt.out {
+			t.Errorf("%d: response = %s; want %s", i, out, tt.out)
+		}
+	}
+}
+
+func TestServerCacheByKeyBusy(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	svc := &CoalesceService{release: make(chan struct{})}
+	close(svc.release)
+	server := NewServer("")
+	rpc, err := server.RegisterService(svc, "things", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	m := rpc.MethodByName("Get")
+	info := m.Info()
+	info.HTTPMethod, info.CacheByKey, info.CacheTTL = "GET", true, time.Minute
+	info.MaxConcurrent = 1
+
+	get := func(key string) *httptest.ResponseRecorder {
+		r, err := inst.NewRequest("POST", "/CoalesceService.Get", strings.NewReader(`{"id":"a"}`))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		r.Header.Set(CacheKeyHeader, key)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	if w := get("k1"); w.Code != http.StatusOK {
+		t.Fatalf("w.Code = %d; want %d", w.Code, http.StatusOK)
+	}
+
+	// Take the only slot of the method.
+	release, err := server.limiter.acquire(nil, m)
+	if err != nil {
+		t.Fatalf("acquire() = %v", err)
+	}
+	defer release()
+
+	if w := get("k1"); w.Code != http.StatusOK {
+		t.Errorf("cached: w.Code = %d; want %d", w.Code, http.StatusOK)
+	}
+	if w := get("k2"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("not cached: w.Code = %d; want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if svc.calls != 1 {
+		t.Errorf("method called %d times; want 1", svc.calls)
+	}
+}
+
+func TestServiceMethodCacheTTL(t *testing.T) {
+	tts := []struct {
+		info *MethodInfo
+		want time.Duration
+	}{
+		{nil, 0},
+		{&MethodInfo{HTTPMethod: "GET"}, 0},
+		{&MethodInfo{HTTPMethod: "GET", CacheTTL: time.Minute}, time.Minute},
+		{&MethodInfo{HTTPMethod: "GET", CacheTTL: time.Minute, CacheControl: "private, max-age=10"}, 10 * time.Second},
+		{&MethodInfo{HTTPMethod: "GET", CacheTTL: time.Minute, CacheControl: "no-store"}, 0},
+		{&MethodInfo{HTTPMethod: "POST", CacheTTL: time.Minute}, 0},
+	}
+	for i, tt := range tts {
+		m := &ServiceMethod{info: tt.info}
+		if ttl := m.cacheTTL(); ttl != tt.want {
+			t.Errorf("%d: cacheTTL() = %v; want %v", i, ttl, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package endpoints
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Error codes of Bearer token challenges, see RFC 6750.
+const (
+	bearerInvalidToken      = "invalid_token"
+	bearerInsufficientScope = "insufficient_scope"
+)
+
+// bearerError is an auth failure with RFC 6750 error code, which is empty
+// if the request has no token.
+type bearerError struct {
+	code string
+	msg  string
+	// desc, if set, describes the failure to clients instead of msg.
+	desc string
+}
+
+func (e *bearerError) Error() string {
+	return e.msg
+}
+
+// description returns error_description of e.
+func (e *bearerError) description() string {
+	if e.desc != "" {
+		return e.desc
+	}
+	return e.msg
+}
+
+// noValidScope returns the error of a token which is valid for none of
+// the requested scopes, the last of which failed with err, if any.
+// The error code and description are those of err.
+func noValidScope(err error) error {
+	e := &bearerError{code: bearerInvalidToken, msg: "No valid scope"}
+	if be, ok := err.(*bearerError); ok {
+		e.code, e.desc = be.code, be.description()
+	} else if err != nil {
+		e.desc = err.Error()
+	}
+	return e
+}
+
+// bearerChallenge is the error of WWW-Authenticate header of a 401
+// response.
+type bearerChallenge struct {
+	code, desc string
+}
+
+// newAuthError returns 401 APIError of a request which failed
+// authentication with err, prefixed with msg if it's not empty.
+// Its WWW-Authenticate header tells the RFC 6750 error code of err, which
+// is invalid_token unless err is a bearerError.
+func newAuthError(msg string, err error) error {
+	if msg != "" {
+		msg += ": "
+	}
+	apiErr := errorf(http.StatusUnauthorized, "%s%v", msg, err).(*APIError)
+	code, desc := bearerInvalidToken, err.Error()
+	if be, ok := err.(*bearerError); ok {
+		code, desc = be.code, be.description()
+	}
+	if code != "" {
+		apiErr.challenge = &bearerChallenge{code, desc}
+	}
+	return apiErr
+}
+
+// setChallenge sets WWW-Authenticate header of a response with err if it
+// is a 401 APIError, with s.AuthRealm and the error of err, if known.
+func (s *Server) setChallenge(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.Code != http.StatusUnauthorized {
+		return
+	}
+	var params []string
+	if s.AuthRealm != "" {
+		params = append(params, "realm="+quoteAuthParam(s.AuthRealm))
+	}
+	if ch := apiErr.challenge; ch != nil {
+		params = append(params, "error="+strconv.Quote(ch.code),
+			"error_description="+quoteAuthParam(ch.desc))
+	}
+	h := "Bearer"
+	if len(params) > 0 {
+		h += " " + strings.Join(params, ", ")
+	}
+	w.Header().Set("WWW-Authenticate", h)
+}
+
+// quoteAuthParam quotes s as a value of WWW-Authenticate parameter,
+// replacing characters RFC 6750 doesn't allow there, i.e. quotes,
+// backslashes and non-printable ASCII, with spaces.
+func quoteAuthParam(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c < 0x20 || c > 0x7e || c == '"' || c == '\\' {
+			b[i] = ' '
+		}
+	}
+	return `"` + string(b) + `"`
+}
@@ -0,0 +1,114 @@
+package endpoints
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+	"golang.org/x/net/context"
+)
+
+func TestServerSetChallenge(t *testing.T) {
+	tts := []struct {
+		realm string
+		err   error
+		want  string
+	}{
+		{"", NewBadRequestError("Bad"), ""},
+		{"", NewForbiddenError("Nope"), ""},
+		{"", NewUnauthorizedError("Invalid webhook signature"), "Bearer"},
+		{"example", NewUnauthorizedError("Invalid nonce"), `Bearer realm="example"`},
+		{"", newAuthError("Authentication required", &bearerError{msg: "No token found"}), "Bearer"},
+		{"example", newAuthError("Authentication required", errors.New("Token is expired")),
+			`Bearer realm="example", error="invalid_token", error_description="Token is expired"`},
+		{"", newAuthError("", &bearerError{code: bearerInsufficientScope, msg: `No scope matches: expected one of "a", got "b"`}),
+			`Bearer error="insufficient_scope", error_description="No scope matches: expected one of  a , got  b "`},
+		{"", newAuthError("", noValidScope(&bearerError{code: bearerInsufficientScope, msg: "No scope matches"})),
+			`Bearer error="insufficient_scope", error_description="No scope matches"`},
+		{"", newAuthError("", noValidScope(&bearerError{msg: "No token found"})), "Bearer"},
+	}
+	for i, tt := range tts {
+		s := &Server{AuthRealm: tt.realm}
+		w := httptest.NewRecorder()
+		s.setChallenge(w, tt.err)
+		if h := w.Header().Get("WWW-Authenticate"); h != tt.want {
+			t.Errorf("%d: WWW-Authenticate = %q; want %q", i, h, tt.want)
+		}
+	}
+}
+
+func TestServerAuthChallenge(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	origParser, origCurrentUTC := jwtParser, currentUTC
+	defer func() {
+		jwtParser, currentUTC = origParser, origCurrentUTC
+	}()
+	currentUTC = func() time.Time { return jwtValidTokenTime }
+	origTransport := httpTransportFactory
+	defer func() { httpTransportFactory = origTransport }()
+	// Tokens which aren't valid ID tokens are checked with tokeninfo API.
+	httpTransportFactory = func(c context.Context) http.RoundTripper {
+		return newTestRoundTripper(&http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader(`{"expires_in":0}`)),
+		})
+	}
+
+	server := NewServer("")
+	server.DefaultAuth = AuthRequired
+	server.AuthRealm = "example"
+	svc, err := server.RegisterService(&PolicyService{}, "policy", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := svc.MethodByName("Ping").Info()
+	info.Audiences = []string{"my-client-id"}
+	info.ClientIds = []string{"hello-android"}
+
+	tts := []struct {
+		token    bool
+		parseErr error
+		code     int
+		want     string
+	}{
+		{true, nil, http.StatusNoContent, ""},
+		{false, nil, http.StatusUnauthorized, `Bearer realm="example"`},
+		{true, errors.New("Token used too late"), http.StatusUnauthorized,
+			`Bearer realm="example", error="invalid_token", error_description="Token is expired"`},
+	}
+	for i, tt := range tts {
+		jwtParser = func(Context, string, int64) (*signedJWT, error) {
+			if tt.parseErr != nil {
+				return nil, tt.parseErr
+			}
+			token := jwtValidTokenObject
+			return &token, nil
+		}
+		r, err := inst.NewRequest("POST", "/PolicyService.Ping", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.token {
+			r.Header.Set("Authorization", "Bearer "+jwtValidTokenString)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+		}
+		h := w.Header().Get("WWW-Authenticate")
+		if tt.want == "" && h != "" || !strings.HasPrefix(h, tt.want) {
+			t.Errorf("%d: WWW-Authenticate = %q; want %q...", i, h, tt.want)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package endpoints
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustProxy makes ClientIP trust X-Forwarded-For header of
+// requests. Enable it only when requests reach the app through a proxy
+// which sets the header, e.g. App Engine front end, since otherwise
+// clients can spoof their IP.
+var TrustProxy = false
+
+// privateNetworks are IP ranges which can't be the address of a client
+// on the internet.
+var privateNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"10.0.0.0/8",
+		"172.16.0.0/12",
+		"192.168.0.0/16",
+		"100.64.0.0/10",
+		"fc00::/7",
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// isPrivateIP returns true if ip is a loopback, link-local or private
+// network address.
+func isPrivateIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, n := range privateNetworks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns IP address of the client which made the request of c,
+// taking X-Forwarded-For header into account if TrustProxy is true.
+func ClientIP(c Context) string {
+	return clientIP(c.HTTPRequest())
+}
+
+// clientIP returns IP address of the client which made request r.
+//
+// If TrustProxy is true, it is the last non-private address in
+// X-Forwarded-For header. Proxies append the address they got a request
+// from, so entries are read from the right, skipping private addresses
+// of trusted proxies; entries left of the first untrusted hop are whatever
+// the client sent. Otherwise, or if there's no such address or an entry
+// isn't a valid address, it is the host of r.RemoteAddr.
+func clientIP(r *http.Request) string {
+	if TrustProxy {
+		var hops []string
+		for _, h := range r.Header["X-Forwarded-For"] {
+			hops = append(hops, strings.Split(h, ",")...)
+		}
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if !isPrivateIP(ip) {
+				return ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,55 @@
+package endpoints
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	origTrust := TrustProxy
+	defer func() { TrustProxy = origTrust }()
+
+	tts := []struct {
+		trust      bool
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{false, "1.2.3.4:1234", nil, "1.2.3.4"},
+		{false, "1.2.3.4", nil, "1.2.3.4"},
+		{false, "[2001:db8::1]:443", nil, "2001:db8::1"},
+		{false, "10.0.0.1:1234", []string{"5.6.7.8"}, "10.0.0.1"},
+		{true, "10.0.0.1:1234", nil, "10.0.0.1"},
+		{true, "10.0.0.1:1234", []string{"5.6.7.8"}, "5.6.7.8"},
+		{true, "10.0.0.1:1234", []string{"192.168.1.1, 127.0.0.1, 5.6.7.8, 9.9.9.9"}, "9.9.9.9"},
+		{true, "10.0.0.1:1234", []string{"5.6.7.8, 9.9.9.9, 10.1.2.3, 172.16.0.1"}, "9.9.9.9"},
+		{true, "10.0.0.1:1234", []string{"5.6.7.8, garbage, 10.1.2.3"}, "10.0.0.1"},
+		{true, "10.0.0.1:1234", []string{"unknown, 172.16.5.4", " 2001:db8::2 "}, "2001:db8::2"},
+		{true, "10.0.0.1:1234", []string{"fd00::1, ::1, 169.254.0.1"}, "10.0.0.1"},
+	}
+	for i, tt := range tts {
+		TrustProxy = tt.trust
+		r := &http.Request{RemoteAddr: tt.remoteAddr, Header: http.Header{}}
+		if tt.xff != nil {
+			r.Header["X-Forwarded-For"] = tt.xff
+		}
+		if ip := clientIP(r); ip != tt.want {
+			t.Errorf("%d: clientIP() = %q; want %q", i, ip, tt.want)
+		}
+	}
+}
+
+func TestClientIPSpoofed(t *testing.T) {
+	origTrust := TrustProxy
+	defer func() { TrustProxy = origTrust }()
+	TrustProxy = true
+
+	// The front end appends the real address to whatever the client sent.
+	for _, spoofed := range []string{"1.1.1.1", "2.2.2.2, 3.3.3.3", "::1, 8.8.8.8"} {
+		r := &http.Request{RemoteAddr: "10.0.0.1:1234", Header: http.Header{}}
+		r.Header.Set("X-Forwarded-For", spoofed+", 203.0.113.7, 10.1.2.3")
+		if ip := clientIP(r); ip != "203.0.113.7" {
+			t.Errorf("clientIP() with X-Forwarded-For %q = %q; want 203.0.113.7", r.Header.Get("X-Forwarded-For"), ip)
+		}
+	}
+}
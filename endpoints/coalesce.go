@@ -0,0 +1,85 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// coalescedCall is a method call shared by concurrent identical requests.
+type coalescedCall struct {
+	done chan struct{}
+	resp reflect.Value
+	err  error
+	// dups is the number of requests waiting for the call.
+	dups int
+}
+
+// coalescer runs at most one call per key at a time, see
+// MethodInfo.Coalesce.
+type coalescer struct {
+	mu    sync.Mutex
+	calls map[string]*coalescedCall
+}
+
+// do runs fn and returns its results, unless a call of the same key is in
+// flight, in which case it waits for that call and returns its results.
+func (g *coalescer) do(key string, fn func() (reflect.Value, error)) (reflect.Value, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[key]; ok {
+		call.dups++
+		g.mu.Unlock()
+		<-call.done
+		return call.resp, call.err
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*coalescedCall)
+	}
+	call := &coalescedCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mu.Unlock()
+
+	// Waiters get an error if fn panics.
+	call.err = errors.New("Coalesced call did not complete")
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(call.done)
+	}()
+	call.resp, call.err = fn()
+	return call.resp, call.err
+}
+
+// coalesceKey returns a key of request r of method m called name, decoded
+// into reqValue, which identical requests share. It returns false if
+// requests of m are not coalesced.
+//
+// The key covers the caller of r, see callerKey, so that users never get
+// responses meant for others.
+func (s *Server) coalesceKey(r *http.Request, name string, m *ServiceMethod, reqValue reflect.Value) (string, bool) {
+	if m.info == nil || !m.info.Coalesce || !m.readOnly() || reflect.PtrTo(m.RespType).Implements(typeOfResponder) {
+		return "", false
+	}
+	params, err := json.Marshal(reqValue.Interface())
+	if err != nil {
+		return "", false
+	}
+	return name + "\x00" + s.callerKey(r) + "\x00" + string(params), true
+}
+
+// callerKey returns the part of keys of shared responses which identifies
+// who request r is made by and for: its token, namespace and impersonated
+// user, if any.
+func (s *Server) callerKey(r *http.Request) string {
+	var ns, imp string
+	if s.NamespaceHeader != "" {
+		ns = r.Header.Get(s.NamespaceHeader)
+	}
+	if s.ImpersonationHeader != "" {
+		imp = r.Header.Get(s.ImpersonationHeader)
+	}
+	return getToken(r) + "\x00" + ns + "\x00" + imp
+}
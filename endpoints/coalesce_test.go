@@ -0,0 +1,200 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+type CoalesceReq struct {
+	ID string `json:"id"`
+}
+
+type CoalesceService struct {
+	mu      sync.Mutex
+	calls   int
+	release chan struct{}
+}
+
+func (s *CoalesceService) Get(c Context, req *CoalesceReq) (*TestMsg, error) {
+	s.mu.Lock()
+	s.calls++
+	s.mu.Unlock()
+	<-s.release
+	if req.ID == "missing" {
+		return nil, NewNotFoundError("No such thing")
+	}
+	return &TestMsg{Name: req.ID}, nil
+}
+
+// waitForDups waits until n requests wait for a coalesced call.
+func waitForDups(t *testing.T, g *coalescer, n int) {
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(time.Millisecond) {
+		g.mu.Lock()
+		dups := 0
+		for _, call := range g.calls {
+			dups += call.dups
+		}
+		g.mu.Unlock()
+		if dups >= n {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %d coalesced requests", n)
+}
+
+func TestServerCoalesce(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	svc := &CoalesceService{}
+	server := NewServer("")
+	rpc, err := server.RegisterService(svc, "things", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := rpc.MethodByName("Get").Info()
+	info.HTTPMethod = "GET"
+	var mwMu sync.Mutex
+	mwCalls := 0
+	server.Use(func(c Context, name string, next func(Context) error) error {
+		mwMu.Lock()
+		mwCalls++
+		mwMu.Unlock()
+		return next(c)
+	})
+
+	tts := []struct {
+		coalesce bool
+		id       string
+		calls    int
+		code     int
+		out      string
+	}{
+		{true, "a", 1, http.StatusOK, `{"name":"a"}`},
+		{true, "missing", 1, http.StatusNotFound, ""},
+		{false, "a", 4, http.StatusOK, `{"name":"a"}`},
+	}
+	for i, tt := range tts {
+		info.Coalesce = tt.coalesce
+		svc.calls, svc.release = 0, make(chan struct{})
+		mwCalls = 0
+
+		const n = 4
+		reqs := make([]*http.Request, n)
+		for j := range reqs {
+			r, err := inst.NewRequest("POST", "/CoalesceService.Get", strings.NewReader(`{"id":"`+tt.id+`"}`))
+			if err != nil {
+				t.Fatalf("%d: failed to create req: %v", i, err)
+			}
+			reqs[j] = r
+		}
+		ws := make([]*httptest.ResponseRecorder, n)
+		var wg sync.WaitGroup
+		for j := range reqs {
+			ws[j] = httptest.NewRecorder()
+			wg.Add(1)
+			go func(w http.ResponseWriter, r *http.Request) {
+				defer wg.Done()
+				server.ServeHTTP(w, r)
+			}(ws[j], reqs[j])
+		}
+		if tt.coalesce {
+			waitForDups(t, &server.coalescer, n-1)
+		}
+		close(svc.release)
+		wg.Wait()
+
+		if svc.calls != tt.calls {
+			t.Errorf("%d: method called %d times; want %d", i, svc.calls, tt.calls)
+		}
+		if mwCalls != n {
+			t.Errorf("%d: middleware ran %d times; want %d", i, mwCalls, n)
+		}
+		for j, w := range ws {
+			if w.Code != tt.code {
+				t.Errorf("%d/%d: w.Code = %d; want %d", i, j, w.Code, tt.code)
+			}
+			if out := strings.TrimSpace(w.Body.String()); tt.out != "" && out != tt.out {
+				t.Errorf("%d/%d: response = %s; want %s", i, j, out, tt.out)
+			}
+		}
+	}
+}
+
+func TestCoalescerDistinctKeys(t *testing.T) {
+	var g coalescer
+	release := make(chan struct{})
+	results := make(chan string, 2)
+	for _, key := range []string{"a", "b"} {
+		go func(key string) {
+			_, err := g.do(key, func() (reflect.Value, error) {
+				<-release
+				return reflect.Value{}, errors.New(key)
+			})
+			results <- err.Error()
+		}(key)
+	}
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		g.mu.Lock()
+		running := len(g.calls)
+		g.mu.Unlock()
+		if running == 2 {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatal("timed out waiting for calls of distinct keys to run")
+		}
+	}
+	close(release)
+	got := map[string]bool{<-results: true, <-results: true}
+	if !got["a"] || !got["b"] {
+		t.Errorf("results = %v; want a and b", got)
+	}
+}
+
+func TestCoalesceKeyCaller(t *testing.T) {
+	server := NewServer("")
+	server.NamespaceHeader, server.ImpersonationHeader = "X-Namespace", "X-Impersonate"
+	m := &ServiceMethod{
+		ReqType:  reflect.TypeOf(CoalesceReq{}),
+		RespType: reflect.TypeOf(TestMsg{}),
+		info:     &MethodInfo{HTTPMethod: "GET", Coalesce: true},
+	}
+	reqValue := reflect.ValueOf(&CoalesceReq{ID: "a"})
+
+	tts := []struct {
+		header, value string
+	}{
+		{"", ""},
+		{"Authorization", "Bearer token"},
+		{"X-Namespace", "ns"},
+		{"X-Impersonate", "alice@example.org"},
+		{"X-Impersonate", "bob@example.org"},
+	}
+	keys := make(map[string]int)
+	for i, tt := range tts {
+		r, _ := http.NewRequest("GET", "/CoalesceService.Get", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		key, ok := server.coalesceKey(r, "CoalesceService.Get", m, reqValue)
+		if !ok {
+			t.Fatalf("%d: coalesceKey() = false; want true", i)
+		}
+		if j, dup := keys[key]; dup {
+			t.Errorf("%d: coalesceKey() = %q, same as %d", i, key, j)
+		}
+		keys[key] = i
+	}
+}
@@ -0,0 +1,508 @@
+package endpoints
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+)
+
+var (
+	// stdToURLSafe and urlSafeToStd translate between standard and URL-safe
+	// base64 alphabets.
+	stdToURLSafe = strings.NewReplacer("+", "-", "/", "_")
+	urlSafeToStd = strings.NewReplacer("-", "+", "_", "/")
+
+	// taggedTypes caches results of hasTaggedFields.
+	taggedTypesMu sync.Mutex
+	taggedTypes   = make(map[taggedTypesKey]bool)
+)
+
+// Codec encodes responses and decodes requests of a media type other than
+// JSON, e.g. msgpack. See Server.RegisterCodec.
+type Codec interface {
+	// Encode returns encoded v, a response value.
+	Encode(v interface{}) ([]byte, error)
+	// Decode decodes body into v, a pointer to a request value.
+	// An APIError is sent to the client as is, while any other error
+	// results in 400 Bad Request.
+	Decode(body []byte, v interface{}) error
+}
+
+// jsonCodec is the codec of "application/json", registered by default.
+// It encodes and decodes the way requests and responses are without
+// codecs, honoring "endpoints" field tags.
+type jsonCodec struct{}
+
+func (jsonCodec) Encode(v interface{}) ([]byte, error) {
+	return encodeJSON(reflect.ValueOf(v))
+}
+
+func (jsonCodec) Decode(body []byte, v interface{}) error {
+	return decodeJSON(body, reflect.ValueOf(v), false)
+}
+
+// defaultCodecs are codecs available without RegisterCodec.
+var defaultCodecs = map[string]Codec{
+	"application/json": jsonCodec{},
+}
+
+// RegisterCodec makes s use codec for requests with Content-Type of
+// mediaType, e.g. "application/msgpack", and for responses to requests
+// which accept it. JSON is registered by default. Registering a codec for
+// an existing media type replaces the previous one, including the default
+// JSON and protobuf encoding.
+//
+// Responses are encoded with the codec of the media type Accept request
+// header lists with the highest quality, ties going to the one listed
+// first. If there's none, or a wildcard such as "*/*" wins, they're JSON,
+// or protobuf for protobuf messages and clients which accept it. Errors
+// are always JSON.
+func (s *Server) RegisterCodec(mediaType string, codec Codec) {
+	s.codecsMu.Lock()
+	defer s.codecsMu.Unlock()
+	if s.codecs == nil {
+		s.codecs = make(map[string]Codec)
+	}
+	s.codecs[strings.ToLower(mediaType)] = codec
+}
+
+// codec returns a codec registered for mediaType, including default ones,
+// or nil.
+func (s *Server) codec(mediaType string) Codec {
+	s.codecsMu.RLock()
+	codec := s.codecs[mediaType]
+	s.codecsMu.RUnlock()
+	if codec != nil {
+		return codec
+	}
+	return defaultCodecs[mediaType]
+}
+
+// requestCodec returns a codec registered for Content-Type of request r,
+// or nil if the default decoding applies, including the default JSON
+// codec.
+func (s *Server) requestCodec(r *http.Request) Codec {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil
+	}
+	if codec := s.codec(mt); codec != (jsonCodec{}) {
+		return codec
+	}
+	return nil
+}
+
+// responseCodec returns the codec, along with its media type, of the media
+// type Accept header of request r lists with the highest quality, ties
+// going to the one listed first. It returns nil if the default encoding
+// applies: r accepts no registered media type, or a wildcard wins.
+func (s *Server) responseCodec(r *http.Request) (string, Codec) {
+	var (
+		best  string
+		bestQ float64
+		codec Codec
+	)
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				q = 0
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+		if strings.HasSuffix(mt, "/*") {
+			best, bestQ, codec = "", q, nil
+			continue
+		}
+		if c := s.codec(mt); c != nil {
+			best, bestQ, codec = mt, q, c
+		}
+	}
+	return best, codec
+}
+
+// decodeBody decodes body of request r into v, a pointer to a request
+// value, with a registered codec or decodeRequest.
+func (s *Server) decodeBody(r *http.Request, body []byte, v reflect.Value) error {
+	if codec := s.requestCodec(r); codec != nil {
+		return codec.Decode(body, v.Interface())
+	}
+	return decodeRequest(r, body, v, s.UseNumber)
+}
+
+// encodeBody encodes v, a response value, for request r with a registered
+// codec or encodeResponse. It returns an encoded body and its Content-Type.
+func (s *Server) encodeBody(r *http.Request, v reflect.Value) ([]byte, string, error) {
+	if mt, codec := s.responseCodec(r); codec != nil {
+		body, err := codec.Encode(v.Interface())
+		return body, mt, err
+	}
+	return encodeResponse(r, v)
+}
+
+// decodeRequest unmarshals body of request r into v, a pointer to a request
+// struct. Protobuf bodies are decoded if v is a protobuf message, JSON
+// otherwise. If useNumber is true, JSON numbers are decoded into
+// interface{} values as json.Number.
+func decodeRequest(r *http.Request, body []byte, v reflect.Value, useNumber bool) error {
+	if hasProtobufBody(r) && isProtoMessage(v.Type()) {
+		return proto.Unmarshal(body, v.Interface().(proto.Message))
+	}
+	return decodeJSON(body, v, useNumber)
+}
+
+// encodeResponse encodes v, a response value, for request r. It returns
+// an encoded body and its Content-Type.
+//
+// Protobuf messages are encoded as protobuf if r accepts it, everything
+// else is encoded as JSON.
+func encodeResponse(r *http.Request, v reflect.Value) ([]byte, string, error) {
+	if acceptsProtobuf(r) && isProtoMessage(v.Type()) {
+		body, err := proto.Marshal(v.Interface().(proto.Message))
+		return body, protobufContentType, err
+	}
+	body, err := encodeJSON(v)
+	return body, "application/json", err
+}
+
+// decodeJSON unmarshals body into v, a pointer to a request struct.
+//
+// Values of []byte fields tagged with "urlsafe" are expected in URL-safe
+// base64, with or without padding, and values of time fields tagged with
+// "timeformats" in one of their formats. If v points to a raw body type
+// (json.RawMessage or []byte) the body is stored as is. Registered OneOf
+// interfaces are decoded into their concrete types.
+//
+// If useNumber is true, numbers are decoded into interface{} values, e.g.
+// of map[string]interface{} fields, as json.Number instead of float64.
+func decodeJSON(body []byte, v reflect.Value, useNumber bool) error {
+	if isRawBody(v.Type().Elem()) {
+		v.Elem().SetBytes(body)
+		return nil
+	}
+	if ok, err := decodeOneOf(body, v, useNumber); ok {
+		return err
+	}
+	return decodeTypedJSON(body, v, useNumber)
+}
+
+// decodeTypedJSON does the work of decodeJSON for types which have no
+// polymorphic fields.
+func decodeTypedJSON(body []byte, v reflect.Value, useNumber bool) error {
+	urlSafe, timeFormats := hasURLSafeBytes(v.Type()), hasTimeFormats(v.Type())
+	if !urlSafe && !timeFormats {
+		return unmarshalJSON(body, v.Interface(), useNumber)
+	}
+	data, err := unmarshalGeneric(body)
+	if err != nil {
+		return err
+	}
+	if urlSafe {
+		data = walkJSON(v.Type(), data, urlSafeToStdField)
+	}
+	if timeFormats {
+		if data, err = normalizeTimes(v.Type(), data); err != nil {
+			return err
+		}
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return unmarshalJSON(b, v.Interface(), useNumber)
+}
+
+// unmarshalJSON is the same as json.Unmarshal but, if useNumber is true,
+// it decodes numbers into interface{} values as json.Number.
+func unmarshalJSON(b []byte, v interface{}, useNumber bool) error {
+	if !useNumber {
+		return json.Unmarshal(b, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	// Decoder, unlike json.Unmarshal, ignores anything past the value.
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid data after top-level JSON value")
+	}
+	return nil
+}
+
+// encodeJSON marshals v, a response value, into JSON.
+//
+// Values of []byte fields tagged with "urlsafe" are encoded in URL-safe
+// base64, and values of time fields tagged with "timeformat" in their
+// format. Objects of types registered with RegisterKind get "kind" field.
+func encodeJSON(v reflect.Value) ([]byte, error) {
+	b, err := json.Marshal(v.Interface())
+	urlSafe, withKinds := hasURLSafeBytes(v.Type()), hasKinds(v.Type())
+	timeFormats := hasTimeFormats(v.Type())
+	if err != nil || !urlSafe && !withKinds && !timeFormats {
+		return b, err
+	}
+	data, err := unmarshalGeneric(b)
+	if err != nil {
+		return nil, err
+	}
+	if urlSafe {
+		data = walkJSON(v.Type(), data, stdToURLSafeField)
+	}
+	if timeFormats {
+		data = walkJSON(v.Type(), data, formatTimesField)
+	}
+	if withKinds {
+		addKinds(v.Type(), data)
+	}
+	return json.Marshal(data)
+}
+
+// unmarshalGeneric unmarshals JSON b into generic maps and slices.
+// Numbers are kept as json.Number so that they survive marshaling back.
+func unmarshalGeneric(b []byte) (interface{}, error) {
+	var data interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// urlSafeToStdField is a jsonFieldFunc translating values of URL-safe
+// []byte fields into standard, padded base64.
+func urlSafeToStdField(field *reflect.StructField, tag *endpointsTag, val interface{}) (interface{}, bool) {
+	s, ok := val.(string)
+	if !ok || !tag.urlSafe || field.Type != typeOfBytes {
+		return val, true
+	}
+	s = strings.TrimRight(urlSafeToStd.Replace(s), "=")
+	if n := len(s) % 4; n > 0 {
+		s += strings.Repeat("=", 4-n)
+	}
+	return s, false
+}
+
+// stdToURLSafeField is a jsonFieldFunc translating values of URL-safe
+// []byte fields from standard base64.
+func stdToURLSafeField(field *reflect.StructField, tag *endpointsTag, val interface{}) (interface{}, bool) {
+	s, ok := val.(string)
+	if !ok || !tag.urlSafe || field.Type != typeOfBytes {
+		return val, true
+	}
+	return stdToURLSafe.Replace(s), false
+}
+
+// hasURLSafeBytes returns true if values of type t can contain []byte
+// fields tagged with "urlsafe".
+func hasURLSafeBytes(t reflect.Type) bool {
+	return hasTaggedFields(t, isURLSafeBytesField)
+}
+
+// isURLSafeBytesField is a fieldPredicate matching []byte fields tagged
+// with "urlsafe".
+func isURLSafeBytesField(field *reflect.StructField, tag *endpointsTag) bool {
+	return tag.urlSafe && field.Type == typeOfBytes
+}
+
+// fieldPredicate tells hasTaggedFields whether a struct field with tag
+// is one it looks for.
+type fieldPredicate func(field *reflect.StructField, tag *endpointsTag) bool
+
+// taggedTypesKey is a key of taggedTypes. Predicates are top-level
+// functions, told apart by their address.
+type taggedTypesKey struct {
+	t    reflect.Type
+	pred uintptr
+}
+
+// hasTaggedFields returns true if values of type t can contain struct
+// fields matching pred, which must be a top-level function. Results are
+// cached.
+func hasTaggedFields(t reflect.Type, pred fieldPredicate) bool {
+	key := taggedTypesKey{t, reflect.ValueOf(pred).Pointer()}
+	taggedTypesMu.Lock()
+	defer taggedTypesMu.Unlock()
+	if found, ok := taggedTypes[key]; ok {
+		return found
+	}
+	found := findTaggedFields(t, pred, make(map[reflect.Type]bool))
+	taggedTypes[key] = found
+	return found
+}
+
+// findTaggedFields does the work of hasTaggedFields. seen guards against
+// recursive types.
+func findTaggedFields(t reflect.Type, pred fieldPredicate, seen map[reflect.Type]bool) bool {
+	if seen[t] || implements(t, typeOfJSONMarshaler) {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return findTaggedFields(t.Elem(), pred, seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			tag, err := parseTag(field.Tag)
+			if err != nil {
+				tag = &endpointsTag{}
+			}
+			if pred(&field, tag) || findTaggedFields(field.Type, pred, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonFieldFunc is called by walkJSON for each struct field value found.
+// It returns a replacement value and whether walkJSON should descend into
+// the returned value.
+type jsonFieldFunc func(field *reflect.StructField, tag *endpointsTag, val interface{}) (interface{}, bool)
+
+// walkJSON calls fn for struct fields in data, which is a generic
+// unmarshaled JSON of a value of type t, replacing their values with
+// results of fn.
+func walkJSON(t reflect.Type, data interface{}, fn jsonFieldFunc) interface{} {
+	if data == nil || implements(t, typeOfJSONMarshaler) {
+		return data
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return walkJSON(t.Elem(), data, fn)
+	case reflect.Slice, reflect.Array:
+		if items, ok := data.([]interface{}); ok {
+			for i, item := range items {
+				items[i] = walkJSON(t.Elem(), item, fn)
+			}
+		}
+	case reflect.Map:
+		if m, ok := data.(map[string]interface{}); ok {
+			for k, item := range m {
+				m[k] = walkJSON(t.Elem(), item, fn)
+			}
+		}
+	case reflect.Struct:
+		if m, ok := data.(map[string]interface{}); ok {
+			walkJSONStruct(t, m, fn)
+		}
+	}
+	return data
+}
+
+// walkJSONStruct is walkJSON for struct type t.
+func walkJSONStruct(t reflect.Type, m map[string]interface{}, fn jsonFieldFunc) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if et, ok := flattenedStruct(&field); ok {
+			walkJSONStruct(et, m, fn)
+			continue
+		}
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		name := jsonFieldName(&field)
+		val, ok := m[name]
+		if !ok {
+			continue
+		}
+		tag, err := parseTag(field.Tag)
+		if err != nil {
+			tag = &endpointsTag{}
+		}
+		val, descend := fn(&field, tag, val)
+		if descend {
+			val = walkJSON(field.Type, val, fn)
+		}
+		m[name] = val
+	}
+}
+
+// flattenedStruct returns the struct type of field and true if field is
+// an embedded struct, or pointer to struct, without a JSON name, whose
+// fields encoding/json puts in the JSON object of the outer struct.
+func flattenedStruct(field *reflect.StructField) (reflect.Type, bool) {
+	if !field.Anonymous || strings.Split(field.Tag.Get("json"), ",")[0] != "" {
+		return nil, false
+	}
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t, t.Kind() == reflect.Struct
+}
+
+// jsonObjectFunc is called by walkJSONObjects for each JSON object of
+// struct type t found.
+type jsonObjectFunc func(t reflect.Type, m map[string]interface{}) error
+
+// walkJSONObjects calls fn for JSON objects of structs in data, which is
+// a generic unmarshaled JSON of a value of type t, including data itself.
+// Objects are visited before their fields, so fn may rename them. It stops
+// at the first error of fn.
+func walkJSONObjects(t reflect.Type, data interface{}, fn jsonObjectFunc) error {
+	if err := visitJSONObjects(t, data, fn); err != nil {
+		return err
+	}
+	var err error
+	walkJSON(t, data, func(field *reflect.StructField, tag *endpointsTag, val interface{}) (interface{}, bool) {
+		if err == nil {
+			err = visitJSONObjects(field.Type, val, fn)
+		}
+		return val, err == nil
+	})
+	return err
+}
+
+// visitJSONObjects calls fn for data of type t if it is an object of
+// a struct, or for its items if t is a pointer, slice, array or map of
+// them. It doesn't descend into fields of the objects.
+func visitJSONObjects(t reflect.Type, data interface{}, fn jsonObjectFunc) error {
+	if data == nil || implements(t, typeOfJSONMarshaler) {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return visitJSONObjects(t.Elem(), data, fn)
+	case reflect.Slice, reflect.Array:
+		items, _ := data.([]interface{})
+		for _, item := range items {
+			if err := visitJSONObjects(t.Elem(), item, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		m, _ := data.(map[string]interface{})
+		for _, item := range m {
+			if err := visitJSONObjects(t.Elem(), item, fn); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		if m, ok := data.(map[string]interface{}); ok {
+			return fn(t, m)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+type BytesInner struct {
+	Safe []byte `json:"safe" endpoints:"urlsafe"`
+}
+
+type BytesMsg struct {
+	Std   []byte        `json:"std"`
+	Safe  []byte        `json:"safe" endpoints:"urlsafe"`
+	Inner *BytesInner   `json:"inner"`
+	Items []*BytesInner `json:"items"`
+	ID    int64         `json:"id"`
+}
+
+func TestHasURLSafeBytes(t *testing.T) {
+	tts := []struct {
+		v    interface{}
+		want bool
+	}{
+		{&BytesMsg{}, true},
+		{[]BytesInner{}, true},
+		{&TestMsg{}, false},
+		{&QueryMsg{}, false},
+	}
+	for i, tt := range tts {
+		typ := reflect.TypeOf(tt.v)
+		if out := hasURLSafeBytes(typ); out != tt.want {
+			t.Errorf("%d: hasURLSafeBytes(%v) = %v; want %v", i, typ, out, tt.want)
+		}
+	}
+}
+
+func TestHasTaggedFieldsPredicates(t *testing.T) {
+	typ := reflect.TypeOf(&BytesMsg{})
+	if !hasTaggedFields(typ, isURLSafeBytesField) {
+		t.Errorf("hasTaggedFields(%v, isURLSafeBytesField) = false; want true", typ)
+	}
+	// The cached result of one predicate must not leak to another.
+	if hasTaggedFields(typ, isSecretTag) {
+		t.Errorf("hasTaggedFields(%v, isSecretTag) = true; want false", typ)
+	}
+}
+
+func TestEncodeJSONURLSafe(t *testing.T) {
+	data := []byte{0xfb, 0xff, 0xbf}
+	msg := &BytesMsg{
+		Std:   data,
+		Safe:  data,
+		Inner: &BytesInner{data},
+		Items: []*BytesInner{{data}},
+		ID:    1<<62 + 1,
+	}
+	out, err := encodeJSON(reflect.ValueOf(msg))
+	if err != nil {
+		t.Fatalf("encodeJSON(%#v) = %v", msg, err)
+	}
+	const want = `{"id":4611686018427387905,"inner":{"safe":"-_-_"},` +
+		`"items":[{"safe":"-_-_"}],"safe":"-_-_","std":"+/+/"}`
+	if string(out) != want {
+		t.Errorf("encodeJSON(%#v) = %s; want %s", msg, out, want)
+	}
+}
+
+func TestDecodeJSONURLSafe(t *testing.T) {
+	tts := []struct {
+		in   string
+		want []byte
+	}{
+		{`{"safe":"-_-_"}`, []byte{0xfb, 0xff, 0xbf}},
+		{`{"safe":"-_8"}`, []byte{0xfb, 0xff}},
+		{`{"safe":"-_8="}`, []byte{0xfb, 0xff}},
+		{`{"safe":"-w"}`, []byte{0xfb}},
+		{`{"safe":"-w=="}`, []byte{0xfb}},
+	}
+	for i, tt := range tts {
+		msg := &BytesMsg{}
+		if err := decodeJSON([]byte(tt.in), reflect.ValueOf(msg), false); err != nil {
+			t.Errorf("%d: decodeJSON(%s) = %v", i, tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(msg.Safe, tt.want) {
+			t.Errorf("%d: decodeJSON(%s) = %v; want %v", i, tt.in, msg.Safe, tt.want)
+		}
+	}
+
+	in := `{"std":"+/+/","inner":{"safe":"-_8"},"id":4611686018427387905}`
+	msg := &BytesMsg{}
+	if err := decodeJSON([]byte(in), reflect.ValueOf(msg), false); err != nil {
+		t.Fatalf("decodeJSON(%s) = %v", in, err)
+	}
+	want := &BytesMsg{
+		Std:   []byte{0xfb, 0xff, 0xbf},
+		Inner: &BytesInner{[]byte{0xfb, 0xff}},
+		ID:    1<<62 + 1,
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("decodeJSON(%s) = %#v; want %#v", in, msg, want)
+	}
+}
+
+type PassthroughMsg struct {
+	ID    int64                  `json:"id"`
+	Attrs map[string]interface{} `json:"attrs"`
+}
+
+func TestDecodeJSONUseNumber(t *testing.T) {
+	const in = `{"id": 9007199254740993, "attrs": {"ref": 9007199254740993, "ratio": 1.50}}`
+
+	msg := &PassthroughMsg{}
+	if err := decodeJSON([]byte(in), reflect.ValueOf(msg), false); err != nil {
+		t.Fatalf("decodeJSON(%s, false) = %v", in, err)
+	}
+	if _, ok := msg.Attrs["ref"].(float64); !ok || msg.ID != 9007199254740993 {
+		t.Errorf("decodeJSON(%s, false) = %#v; want float64 ref", in, msg)
+	}
+
+	msg = &PassthroughMsg{}
+	if err := decodeJSON([]byte(in), reflect.ValueOf(msg), true); err != nil {
+		t.Fatalf("decodeJSON(%s, true) = %v", in, err)
+	}
+	if ref := msg.Attrs["ref"]; ref != json.Number("9007199254740993") {
+		t.Errorf("decodeJSON(%s, true): ref = %#v; want json.Number", in, ref)
+	}
+	if msg.ID != 9007199254740993 {
+		t.Errorf("decodeJSON(%s, true): id = %d; want 9007199254740993", in, msg.ID)
+	}
+
+	// json.Number is encoded as is.
+	out, err := encodeJSON(reflect.ValueOf(msg))
+	if err != nil {
+		t.Fatalf("encodeJSON(%#v) = %v", msg, err)
+	}
+	const want = `{"id":9007199254740993,"attrs":{"ratio":1.50,"ref":9007199254740993}}`
+	if string(out) != want {
+		t.Errorf("encodeJSON(%#v) = %s; want %s", msg, out, want)
+	}
+
+	for _, in := range []string{`{"id": 1} x`, `{"id": 1}}`} {
+		err := decodeJSON([]byte(in), reflect.ValueOf(&PassthroughMsg{}), true)
+		if err == nil {
+			t.Errorf("decodeJSON(%s, true) = nil; want error", in)
+		}
+	}
+}
+
+// nameCodec encodes TestMsg as its name in plain text.
+type nameCodec struct{}
+
+func (nameCodec) Encode(v interface{}) ([]byte, error) {
+	msg, ok := v.(*TestMsg)
+	if !ok {
+		return nil, errors.New("nameCodec: not a TestMsg")
+	}
+	return []byte("name=" + msg.Name), nil
+}
+
+func (nameCodec) Decode(body []byte, v interface{}) error {
+	msg, ok := v.(*TestMsg)
+	if !ok || !strings.HasPrefix(string(body), "name=") {
+		return errors.New("nameCodec: bad input")
+	}
+	msg.Name = strings.TrimPrefix(string(body), "name=")
+	return nil
+}
+
+func TestServerRegisterCodec(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	if _, err := server.RegisterService(&ServerTestService{}, "ServerTestService", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	server.RegisterCodec("text/x-name", nameCodec{})
+
+	tts := []struct {
+		ctype, accept, body string
+		code                int
+		respType, resp      string
+	}{
+		{"text/x-name", "text/x-name", "name=alice", 200, "text/x-name", "name=alice"},
+		{"text/x-name; charset=utf-8", "", "name=bob", 200, "application/json", `{"name":"bob"}`},
+		{"application/json", "application/json;q=0.5, text/x-name", `{"name":"carol"}`, 200, "text/x-name", "name=carol"},
+		{"application/json", "text/x-name;q=0, */*", `{"name":"dave"}`, 200, "application/json", `{"name":"dave"}`},
+		{"application/json", "application/json, text/x-name", `{"name":"erin"}`, 200, "application/json", `{"name":"erin"}`},
+		{"application/json", "text/x-name;q=0.1, application/json", `{"name":"frank"}`, 200, "application/json", `{"name":"frank"}`},
+		{"application/json", "*/*, text/x-name", `{"name":"grace"}`, 200, "application/json", `{"name":"grace"}`},
+		{"application/json", "text/x-name, */*", `{"name":"heidi"}`, 200, "text/x-name", "name=heidi"},
+		{"application/json", "text/x-name;q=0.5, */*;q=0.8", `{"name":"ivan"}`, 200, "application/json", `{"name":"ivan"}`},
+		{"text/x-name", "", "alice", 400, "application/json", ""},
+		{"text/x-other", "", "name=alice", 400, "application/json", ""},
+		{"text/plain", "", `{"name":"judy"}`, 200, "application/json", `{"name":"judy"}`},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/ServerTestService.MsgWithReturn", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		r.Header.Set("Content-Type", tt.ctype)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+			continue
+		}
+		if ct := w.Header().Get("Content-Type"); ct != tt.respType {
+			t.Errorf("%d: Content-Type = %q; want %q", i, ct, tt.respType)
+		}
+		if tt.resp != "" && strings.TrimSpace(w.Body.String()) != tt.resp {
+			t.Errorf("%d: response = %q; want %q", i, w.Body, tt.resp)
+		}
+	}
+}
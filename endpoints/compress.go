@@ -0,0 +1,137 @@
+package endpoints
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// defaultCompressMinBytes is used when Server.CompressMinBytes is zero.
+const defaultCompressMinBytes = 1024
+
+// Encoder returns a writer compressing what's written to w in a content
+// coding, e.g. Brotli. See Server.RegisterEncoding.
+type Encoder func(w io.Writer) io.WriteCloser
+
+// builtinEncoders are content codings available without RegisterEncoding.
+// Note that "deflate" is the zlib format, see RFC 7230.
+var builtinEncoders = map[string]Encoder{
+	"gzip": func(w io.Writer) io.WriteCloser {
+		return gzip.NewWriter(w)
+	},
+	"deflate": func(w io.Writer) io.WriteCloser {
+		return zlib.NewWriter(w)
+	},
+}
+
+// RegisterEncoding makes enc available to s for content coding name,
+// e.g. "br", so that it can be enabled with s.Compression. Registering
+// "gzip" or "deflate" replaces the built-in encoder.
+func (s *Server) RegisterEncoding(name string, enc Encoder) {
+	s.encodersMu.Lock()
+	defer s.encodersMu.Unlock()
+	if s.encoders == nil {
+		s.encoders = make(map[string]Encoder)
+	}
+	s.encoders[strings.ToLower(name)] = enc
+}
+
+// encoder returns an encoder of content coding name, or nil.
+func (s *Server) encoder(name string) Encoder {
+	s.encodersMu.RLock()
+	enc := s.encoders[name]
+	s.encodersMu.RUnlock()
+	if enc != nil {
+		return enc
+	}
+	return builtinEncoders[name]
+}
+
+// responseEncoding returns the content coding of s.Compression which
+// Accept-Encoding header of request r accepts with the highest quality,
+// along with its encoder. Ties go to the coding listed first in
+// s.Compression. It returns nil if r accepts none.
+func (s *Server) responseEncoding(r *http.Request) (string, Encoder) {
+	accepted := acceptedEncodings(r.Header.Get("Accept-Encoding"))
+	var (
+		best  string
+		bestQ float64
+		enc   Encoder
+	)
+	for _, name := range s.Compression {
+		name = strings.ToLower(name)
+		q, ok := accepted[name]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q <= bestQ {
+			continue
+		}
+		if e := s.encoder(name); e != nil {
+			best, bestQ, enc = name, q, e
+		}
+	}
+	return best, enc
+}
+
+// acceptedEncodings parses Accept-Encoding header value h into qualities
+// of content codings, lowercased.
+func acceptedEncodings(h string) map[string]float64 {
+	accepted := make(map[string]float64)
+	for _, part := range strings.Split(h, ",") {
+		params := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if !strings.HasPrefix(p, "q=") {
+				continue
+			}
+			var err error
+			if q, err = strconv.ParseFloat(p[2:], 64); err != nil {
+				q = 0
+			}
+		}
+		accepted[name] = q
+	}
+	return accepted
+}
+
+// compress returns body of a response to r compressed in the content
+// coding negotiated with r, setting Content-Encoding header, if
+// s.Compression is set, body has at least s.CompressMinBytes and the
+// response isn't encoded already. Otherwise body is returned as is.
+func (s *Server) compress(w http.ResponseWriter, r *http.Request, body []byte) []byte {
+	if len(s.Compression) == 0 {
+		return body
+	}
+	w.Header().Add("Vary", "Accept-Encoding")
+	min := s.CompressMinBytes
+	if min <= 0 {
+		min = defaultCompressMinBytes
+	}
+	if len(body) < min || w.Header().Get("Content-Encoding") != "" {
+		return body
+	}
+	name, enc := s.responseEncoding(r)
+	if enc == nil {
+		return body
+	}
+	var buf bytes.Buffer
+	zw := enc(&buf)
+	if _, err := zw.Write(body); err != nil {
+		return body
+	}
+	if err := zw.Close(); err != nil {
+		return body
+	}
+	w.Header().Set("Content-Encoding", name)
+	return buf.Bytes()
+}
@@ -0,0 +1,168 @@
+package endpoints
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+// fakeBrotli is an Encoder prefixing bodies with "br:" instead of
+// compressing them.
+func fakeBrotli(w io.Writer) io.WriteCloser {
+	io.WriteString(w, "br:")
+	return nopWriteCloser{w}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestResponseEncoding(t *testing.T) {
+	tts := []struct {
+		compression []string
+		accept      string
+		want        string
+	}{
+		{nil, "gzip", ""},
+		{[]string{"br", "gzip", "deflate"}, "", ""},
+		{[]string{"br", "gzip", "deflate"}, "gzip, deflate", "gzip"},
+		{[]string{"br", "gzip", "deflate"}, "deflate, gzip", "gzip"},
+		{[]string{"br", "gzip", "deflate"}, "gzip;q=0.5, deflate", "deflate"},
+		{[]string{"br", "gzip", "deflate"}, "gzip, deflate, br", "br"},
+		{[]string{"br", "gzip", "deflate"}, "GZIP;q=0.5, BR;q=0.4", "gzip"},
+		{[]string{"br", "gzip", "deflate"}, "*", "br"},
+		{[]string{"br", "gzip", "deflate"}, "*;q=0.5, br;q=0", "gzip"},
+		{[]string{"br", "gzip", "deflate"}, "identity", ""},
+		{[]string{"gzip"}, "br, deflate", ""},
+		{[]string{"zstd", "gzip"}, "zstd, gzip", "gzip"},
+	}
+	for i, tt := range tts {
+		s := NewServer("")
+		s.RegisterEncoding("br", fakeBrotli)
+		s.Compression = tt.compression
+		r := &http.Request{Header: http.Header{"Accept-Encoding": {tt.accept}}}
+		if name, _ := s.responseEncoding(r); name != tt.want {
+			t.Errorf("%d: responseEncoding(%v, %q) = %q; want %q", i, tt.compression, tt.accept, name, tt.want)
+		}
+	}
+}
+
+func TestServerCompression(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := createAPIServer()
+	server.RegisterEncoding("br", fakeBrotli)
+	server.Compression = []string{"br", "gzip", "deflate"}
+	server.CompressMinBytes = 64
+
+	long := strings.Repeat("a", 100)
+	tts := []struct {
+		name, accept, encoding string
+	}{
+		{long, "gzip", "gzip"},
+		{long, "deflate", "deflate"},
+		{long, "gzip, br", "br"},
+		{long, "", ""},
+		{"short", "gzip", ""},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/ServerTestService.Msg", strings.NewReader(`{"name":"`+tt.name+`"}`))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		r.Header.Set("Accept-Encoding", tt.accept)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%d: w.Code = %d; want 200 (%s)", i, w.Code, w.Body)
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != tt.encoding {
+			t.Errorf("%d: Content-Encoding = %q; want %q", i, enc, tt.encoding)
+		}
+		if v := w.Header().Get("Vary"); v != "Accept-Encoding" {
+			t.Errorf("%d: Vary = %q; want Accept-Encoding", i, v)
+		}
+
+		var body io.Reader = w.Body
+		switch tt.encoding {
+		case "gzip":
+			if body, err = gzip.NewReader(w.Body); err != nil {
+				t.Fatalf("%d: gzip.NewReader() = %v", i, err)
+			}
+		case "deflate":
+			if body, err = zlib.NewReader(w.Body); err != nil {
+				t.Fatalf("%d: zlib.NewReader() = %v", i, err)
+			}
+		case "br":
+			body = bytes.NewReader(bytes.TrimPrefix(w.Body.Bytes(), []byte("br:")))
+		}
+		out, err := ioutil.ReadAll(body)
+		if err != nil {
+			t.Fatalf("%d: reading body: %v", i, err)
+		}
+		if want := `{"name":"` + tt.name + `"}`; strings.TrimSpace(string(out)) != want {
+			t.Errorf("%d: body = %s; want %s", i, out, want)
+		}
+	}
+}
+
+func TestServerCompressionETag(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := createAPIServer()
+	server.Compression = []string{"gzip"}
+	server.CompressMinBytes = 64
+	server.ETags = true
+
+	long := strings.Repeat("a", 100)
+	tag, err := ETagOf(&TestMsg{Name: long})
+	if err != nil {
+		t.Fatalf("ETagOf() = %v", err)
+	}
+	tts := []struct {
+		accept, etag string
+	}{
+		{"gzip", encodedETag(tag, "gzip")},
+		{"", tag},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/ServerTestService.Msg", strings.NewReader(`{"name":"`+long+`"}`))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		r.Header.Set("Accept-Encoding", tt.accept)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%d: w.Code = %d; want 200 (%s)", i, w.Code, w.Body)
+		}
+		etag := w.Header().Get("ETag")
+		if etag != tt.etag {
+			t.Errorf("%d: ETag = %q; want %q", i, etag, tt.etag)
+		}
+		p := &Precondition{IfMatch: []string{etag}}
+		if err := p.Check(tag); err != nil {
+			t.Errorf("%d: Check(%q) with If-Match %q = %v; want nil", i, tag, etag, err)
+		}
+	}
+}
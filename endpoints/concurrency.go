@@ -0,0 +1,77 @@
+package endpoints
+
+import (
+	"net/http"
+	"sync"
+)
+
+// concurrencyLimiter caps simultaneous calls of methods with
+// MethodInfo.MaxConcurrent set. Its zero value is ready to use.
+type concurrencyLimiter struct {
+	mu    sync.Mutex
+	slots map[*ServiceMethod]*methodSlots
+}
+
+// methodSlots are execution slots of a single method.
+type methodSlots struct {
+	// sem holds a token for each running call.
+	sem chan struct{}
+	// queued is the number of calls waiting for a slot, guarded by
+	// concurrencyLimiter.mu.
+	queued int
+}
+
+// slotsOf returns execution slots of method m allowing max calls at once.
+func (l *concurrencyLimiter) slotsOf(m *ServiceMethod, max int) *methodSlots {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.slots == nil {
+		l.slots = make(map[*ServiceMethod]*methodSlots)
+	}
+	ms, ok := l.slots[m]
+	if !ok || cap(ms.sem) != max {
+		// The limit changed, calls holding old slots release them there.
+		ms = &methodSlots{sem: make(chan struct{}, max)}
+		l.slots[m] = ms
+	}
+	return ms
+}
+
+// acquire waits for an execution slot of method m, as limited by
+// MethodInfo.MaxConcurrent, and returns a function releasing it.
+// A call waits only if fewer than MethodInfo.MaxQueued calls already do,
+// and only until c is done. Otherwise, it gets 503 APIError.
+func (l *concurrencyLimiter) acquire(c Context, m *ServiceMethod) (func(), error) {
+	if m.info == nil || m.info.MaxConcurrent <= 0 {
+		return func() {}, nil
+	}
+	ms := l.slotsOf(m, m.info.MaxConcurrent)
+	release := func() { <-ms.sem }
+	select {
+	case ms.sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	l.mu.Lock()
+	if ms.queued >= m.info.MaxQueued {
+		l.mu.Unlock()
+		return nil, errorf(http.StatusServiceUnavailable,
+			"Method %s is too busy, try again later", m.info.Name)
+	}
+	ms.queued++
+	l.mu.Unlock()
+	defer func() {
+		l.mu.Lock()
+		ms.queued--
+		l.mu.Unlock()
+	}()
+
+	select {
+	case ms.sem <- struct{}{}:
+		return release, nil
+	case <-c.Done():
+		return nil, errorf(http.StatusServiceUnavailable,
+			"Method %s is too busy, try again later", m.info.Name)
+	}
+}
@@ -0,0 +1,134 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+func TestConcurrencyLimiterAcquire(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	l := &concurrencyLimiter{}
+	m := &ServiceMethod{info: &MethodInfo{Name: "images.resize", MaxConcurrent: 1, MaxQueued: 1}}
+
+	release, err := l.acquire(c, m)
+	if err != nil {
+		t.Fatalf("acquire() = %v; want nil", err)
+	}
+	queued := make(chan error, 1)
+	go func() {
+		release, err := l.acquire(c, m)
+		if err == nil {
+			release()
+		}
+		queued <- err
+	}()
+	for i := 0; i < 100 && l.queued(m) == 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := l.queued(m); n != 1 {
+		t.Fatalf("queued = %d; want 1", n)
+	}
+	if _, err := l.acquire(c, m); !isStatus(err, http.StatusServiceUnavailable) {
+		t.Errorf("acquire() with full queue = %v; want 503 APIError", err)
+	}
+
+	release()
+	if err := <-queued; err != nil {
+		t.Errorf("queued acquire() = %v; want nil", err)
+	}
+
+	release, err = l.acquire(c, m)
+	if err != nil {
+		t.Fatalf("acquire() = %v; want nil", err)
+	}
+	defer release()
+	tc, cancel := withTimeout(c, 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.acquire(tc, m); !isStatus(err, http.StatusServiceUnavailable) {
+		t.Errorf("acquire() past deadline = %v; want 503 APIError", err)
+	}
+	if n := l.queued(m); n != 0 {
+		t.Errorf("queued = %d; want 0", n)
+	}
+
+	if _, err := l.acquire(c, &ServiceMethod{info: &MethodInfo{}}); err != nil {
+		t.Errorf("acquire() of unlimited method = %v; want nil", err)
+	}
+}
+
+// queued returns the number of calls of m waiting for a slot.
+func (l *concurrencyLimiter) queued(m *ServiceMethod) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ms, ok := l.slots[m]; ok {
+		return ms.queued
+	}
+	return 0
+}
+
+func isStatus(err error, code int) bool {
+	apiErr, ok := err.(*APIError)
+	return ok && apiErr.Code == code
+}
+
+type ResizeService struct {
+	started, done chan struct{}
+}
+
+func (s *ResizeService) Resize(c Context) error {
+	s.started <- struct{}{}
+	<-s.done
+	return nil
+}
+
+func TestServerMaxConcurrent(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	service := &ResizeService{started: make(chan struct{}), done: make(chan struct{})}
+	svc, err := server.RegisterService(service, "images", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	svc.MethodByName("Resize").Info().MaxConcurrent = 1
+
+	serve := func() *httptest.ResponseRecorder {
+		r, err := inst.NewRequest("POST", "/ResizeService.Resize", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- serve() }()
+	<-service.started
+
+	w := serve()
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "5" {
+		t.Errorf("w.Code = %d, Retry-After = %q; want 503, 5 (%s)",
+			w.Code, w.Header().Get("Retry-After"), w.Body)
+	}
+
+	close(service.done)
+	if w := <-first; w.Code != http.StatusNoContent {
+		t.Errorf("first w.Code = %d; want %d", w.Code, http.StatusNoContent)
+	}
+	go func() { <-service.started }()
+	if w := serve(); w.Code != http.StatusNoContent {
+		t.Errorf("w.Code after release = %d; want %d (%s)", w.Code, http.StatusNoContent, w.Body)
+	}
+}
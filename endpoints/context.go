@@ -23,6 +23,7 @@ package endpoints
 import (
 	"net/http"
 	"sync"
+	"time"
 
 	"golang.org/x/net/context"
 
@@ -40,6 +41,8 @@ type cachingContext struct {
 	oauthResponseCache map[string]*pb.GetOAuthUserResponse
 	// mutex for oauthResponseCache
 	sync.Mutex
+	// the most recently validated token
+	token *tokenState
 }
 
 // populateOAuthResponse updates (overwrites) OAuth user data associated with
@@ -58,6 +61,11 @@ func populateOAuthResponse(c *cachingContext, scope string) error {
 	}
 
 	c.oauthResponseCache[scope] = res
+	scopes := res.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{scope}
+	}
+	c.token.set(res.GetEmail(), "", res.GetClientId(), scopes)
 	return nil
 }
 
@@ -83,11 +91,18 @@ func (c *cachingContext) HTTPRequest() *http.Request {
 
 // Namespace returns a replacement context that operates within the given namespace.
 func (c *cachingContext) Namespace(name string) (Context, error) {
+	return validatedNamespace(c, name)
+}
+
+// namespace is Namespace without NamespaceValidator.
+func (c *cachingContext) namespace(name string) (Context, error) {
 	nc, err := appengine.Namespace(c, name)
 	if err != nil {
 		return nil, err
 	}
-	return newCachingContext(nc, c.r), nil
+	ncc := newCachingContext(nc, c.r).(*cachingContext)
+	ncc.token = c.token
+	return ncc, nil
 }
 
 // CurrentOAuthClientID returns a clientID associated with the scope.
@@ -117,8 +132,85 @@ func (c *cachingContext) CurrentOAuthUser(scope string) (*user.User, error) {
 	}, nil
 }
 
+func (c *cachingContext) validatedToken() *tokenState {
+	return c.token
+}
+
+// derivedContext is a Context which replaces embedded context.Context of
+// its parent, e.g. to set a deadline, while keeping the rest of the parent
+// behaviour.
+type derivedContext struct {
+	Context
+	ctx context.Context
+}
+
+// Deadline is a part of context.Context interface.
+func (c *derivedContext) Deadline() (time.Time, bool) {
+	return c.ctx.Deadline()
+}
+
+// Done is a part of context.Context interface.
+func (c *derivedContext) Done() <-chan struct{} {
+	return c.ctx.Done()
+}
+
+// Err is a part of context.Context interface.
+func (c *derivedContext) Err() error {
+	return c.ctx.Err()
+}
+
+// Value is a part of context.Context interface.
+func (c *derivedContext) Value(key interface{}) interface{} {
+	return c.ctx.Value(key)
+}
+
+// Namespace returns a replacement context that operates within the given namespace.
+func (c *derivedContext) Namespace(name string) (Context, error) {
+	return validatedNamespace(c, name)
+}
+
+// namespace is Namespace without NamespaceValidator.
+func (c *derivedContext) namespace(name string) (Context, error) {
+	pc, err := uncheckedNamespace(c.Context, name)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := appengine.Namespace(c.ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return &derivedContext{pc, nc}, nil
+}
+
+func (c *derivedContext) validatedToken() *tokenState {
+	if h, ok := c.Context.(tokenHolder); ok {
+		return h.validatedToken()
+	}
+	return nil
+}
+
+// deriveContext returns a Context which is the same as c but uses ctx
+// as embedded context.Context. ctx should be derived from c.
+//
+// The returned Context replaces c as the context of c.HTTPRequest(),
+// so that NewContext returns it from now on.
+func deriveContext(c Context, ctx context.Context) Context {
+	dc := &derivedContext{c, ctx}
+	replaceContext(c, dc)
+	return dc
+}
+
+// replaceContext makes nc the context of c.HTTPRequest() if c is.
+func replaceContext(c, nc Context) {
+	ctxsMu.Lock()
+	defer ctxsMu.Unlock()
+	if ctxs[c.HTTPRequest()] == c {
+		ctxs[c.HTTPRequest()] = nc
+	}
+}
+
 func newCachingContext(c context.Context, r *http.Request) Context {
-	return &cachingContext{c, r, map[string]*pb.GetOAuthUserResponse{}, sync.Mutex{}}
+	return &cachingContext{c, r, map[string]*pb.GetOAuthUserResponse{}, sync.Mutex{}, &tokenState{}}
 }
 
 // Default implentation of endpoints.ContextFactory.
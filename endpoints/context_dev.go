@@ -6,22 +6,33 @@
 package endpoints
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"golang.org/x/net/context"
 
 	"google.golang.org/appengine"
 	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/memcache"
 	"google.golang.org/appengine/user"
 )
 
-const tokeninfoEndpointURL = "https://www.googleapis.com/oauth2/v2/tokeninfo"
+const (
+	tokeninfoEndpointURL = "https://www.googleapis.com/oauth2/v2/tokeninfo"
+	// tokeninfoNamespace is the memcache namespace of cached tokeninfo.
+	tokeninfoNamespace = "__tokeninfo"
+	// tokeninfoGenKey is the memcache key of the generation of cached
+	// tokeninfo, which is part of its keys. ClearAuthCaches bumps it.
+	tokeninfoGenKey = "generation"
+)
 
-type tokeninfo struct {
+// Tokeninfo is a response of tokeninfo API, describing a bearer token.
+type Tokeninfo struct {
 	IssuedTo      string `json:"issued_to"`
 	Audience      string `json:"audience"`
 	UserID        string `json:"user_id"`
@@ -36,21 +47,74 @@ type tokeninfo struct {
 }
 
 // fetchTokeninfo retrieves token info from tokeninfoEndpointURL  (tokeninfo API)
-func fetchTokeninfo(c Context, token string) (*tokeninfo, error) {
+//
+// Valid tokens are cached in memcache until they expire, so they are still
+// accepted while TokeninfoBreaker, which guards calls to the API, is open.
+// The breaker counts backend errors only, not rejected tokens.
+func fetchTokeninfo(c Context, token string) (*Tokeninfo, error) {
+	nc, key, err := tokeninfoCacheKey(c, token)
+	if err != nil {
+		log.Debugf(c, "Tokeninfo cache is unavailable: %v", err)
+	} else {
+		ti := &Tokeninfo{}
+		if _, err := memcache.JSON.Get(nc, key, ti); err == nil {
+			return ti, nil
+		}
+	}
+	call, err := TokeninfoBreaker.allow()
+	if err != nil {
+		return nil, newAuthBackendError(err)
+	}
+	ti, err := doFetchTokeninfo(c, token)
+	TokeninfoBreaker.done(call, isAuthBackendError(err))
+	if err == nil && key != "" {
+		item := &memcache.Item{
+			Key:        key,
+			Object:     ti,
+			Expiration: time.Duration(ti.ExpiresIn) * time.Second,
+		}
+		if err := memcache.JSON.Set(nc, item); err != nil {
+			log.Errorf(c, "Error adding tokeninfo to memcache: %v", err)
+		}
+	}
+	return ti, err
+}
+
+// tokeninfoCacheKey returns the namespaced context and the memcache key of
+// cached tokeninfo of token. Tokens are hashed to keep them out of keys.
+func tokeninfoCacheKey(c Context, token string) (context.Context, string, error) {
+	nc, err := appengine.Namespace(c, tokeninfoNamespace)
+	if err != nil {
+		return nil, "", err
+	}
+	gen, err := memcache.Increment(nc, tokeninfoGenKey, 0, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	return nc, fmt.Sprintf("%d:%x", gen, sha256.Sum256([]byte(token))), nil
+}
+
+// doFetchTokeninfo does the actual work of fetchTokeninfo.
+func doFetchTokeninfo(c Context, token string) (*Tokeninfo, error) {
 	url := tokeninfoEndpointURL + "?access_token=" + token
 	log.Debugf(c, "Fetching token info from %q", url)
 	resp, err := newHTTPClient(c).Get(url)
 	if err != nil {
-		return nil, err
+		return nil, newAuthBackendError(err)
 	}
 	defer resp.Body.Close()
 	log.Debugf(c, "Tokeninfo replied with %s", resp.Status)
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, newAuthBackendError(fmt.Errorf("tokeninfo replied with %s", resp.Status))
+	}
 
-	ti := &tokeninfo{}
+	ti := &Tokeninfo{}
 	if err = json.NewDecoder(resp.Body).Decode(ti); err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
+	// Tokeninfo API may respond with an error description
+	// even when the status is 200 OK.
+	if resp.StatusCode != http.StatusOK || ti.ErrorDescription != "" {
 		errMsg := fmt.Sprintf("Error fetching tokeninfo (status %d)", resp.StatusCode)
 		if ti.ErrorDescription != "" {
 			errMsg += ": " + ti.ErrorDescription
@@ -72,10 +136,13 @@ func fetchTokeninfo(c Context, token string) (*tokeninfo, error) {
 
 // getScopedTokeninfo validates fetched token by matching tokeinfo.Scope
 // with scope arg.
-func getScopedTokeninfo(c Context, scope string) (*tokeninfo, error) {
-	token := getToken(c.HTTPRequest())
+func getScopedTokeninfo(c Context, scope string) (*Tokeninfo, error) {
+	token, err := currentToken(c)
+	if err != nil {
+		return nil, err
+	}
 	if token == "" {
-		return nil, errors.New("No token found")
+		return nil, &bearerError{msg: "No token found"}
 	}
 	ti, err := fetchTokeninfo(c, token)
 	if err != nil {
@@ -86,14 +153,24 @@ func getScopedTokeninfo(c Context, scope string) (*tokeninfo, error) {
 			return ti, nil
 		}
 	}
-	return nil, fmt.Errorf("No scope matches: expected one of %q, got %q",
-		ti.Scope, scope)
+	return nil, &bearerError{code: bearerInsufficientScope, msg: fmt.Sprintf(
+		"No scope matches: expected one of %q, got %q", ti.Scope, scope)}
 }
 
 // A context that uses tokeninfo API to validate bearer token
 type tokeninfoContext struct {
 	context.Context
 	h *http.Request
+	// mapUser, if not nil, maps validated token info to a user.
+	mapUser func(*Tokeninfo) (*user.User, error)
+	// the most recently validated token
+	token *tokenState
+}
+
+// newTokeninfoContext creates a new tokeninfoContext which keeps track
+// of its own validated tokens.
+func newTokeninfoContext(c context.Context, r *http.Request, mapUser func(*Tokeninfo) (*user.User, error)) *tokeninfoContext {
+	return &tokeninfoContext{c, r, mapUser, &tokenState{}}
 }
 
 func (c *tokeninfoContext) HTTPRequest() *http.Request {
@@ -102,11 +179,16 @@ func (c *tokeninfoContext) HTTPRequest() *http.Request {
 
 // Namespace returns a replacement context that operates within the given namespace.
 func (c *tokeninfoContext) Namespace(name string) (Context, error) {
+	return validatedNamespace(c, name)
+}
+
+// namespace is Namespace without NamespaceValidator.
+func (c *tokeninfoContext) namespace(name string) (Context, error) {
 	nc, err := appengine.Namespace(c, name)
 	if err != nil {
 		return nil, err
 	}
-	return &tokeninfoContext{nc, c.h}, nil
+	return &tokeninfoContext{nc, c.h, c.mapUser, c.token}, nil
 }
 
 // CurrentOAuthClientID returns a clientID associated with the scope.
@@ -115,7 +197,14 @@ func (c *tokeninfoContext) CurrentOAuthClientID(scope string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	return ti.IssuedTo, nil
+	u, err := c.validUser(ti)
+	if err != nil {
+		return "", err
+	}
+	if c.mapUser == nil {
+		return ti.IssuedTo, nil
+	}
+	return u.ClientID, nil
 }
 
 // CurrentOAuthUser returns a user associated with the request in context.
@@ -124,12 +213,57 @@ func (c *tokeninfoContext) CurrentOAuthUser(scope string) (*user.User, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &user.User{Email: ti.Email}, nil
+	return c.validUser(ti)
+}
+
+// validUser returns the user of validated token info ti, as mapped by
+// c.mapUser if set, and records the token as validated for that user.
+func (c *tokeninfoContext) validUser(ti *Tokeninfo) (*user.User, error) {
+	if c.mapUser == nil {
+		recordToken(c, ti.Email, "", ti.IssuedTo, strings.Fields(ti.Scope))
+		return &user.User{Email: ti.Email}, nil
+	}
+	u, err := c.mappedUser(ti)
+	if err != nil {
+		return nil, err
+	}
+	recordToken(c, u.Email, "", u.ClientID, strings.Fields(ti.Scope))
+	return u, nil
+}
+
+// mappedUser returns the user c.mapUser maps ti to. A token which maps to
+// no user doesn't authenticate anyone.
+func (c *tokeninfoContext) mappedUser(ti *Tokeninfo) (*user.User, error) {
+	u, err := c.mapUser(ti)
+	if err != nil {
+		return nil, err
+	}
+	if u == nil {
+		return nil, &bearerError{code: bearerInvalidToken, msg: "Token maps to no user"}
+	}
+	return u, nil
+}
+
+func (c *tokeninfoContext) validatedToken() *tokenState {
+	return c.token
 }
 
 // tokeninfoContextFactory creates a new tokeninfoContext from r.
 // To be used as auth.go/ContextFactory.
 func tokeninfoContextFactory(r *http.Request) Context {
 	ac := appengine.NewContext(r)
-	return &tokeninfoContext{ac, r}
+	return newTokeninfoContext(ac, r, nil)
+}
+
+// TokeninfoContextFactory returns a ContextFactory which validates bearer
+// tokens with tokeninfo API, same as the default one on dev server.
+//
+// If mapUser is not nil, it overrides how token info maps to a user and
+// client ID, e.g. to map service accounts to test users in staging.
+// mapUser is called only for tokens which passed validation
+// so it can't be used to bypass authentication.
+func TokeninfoContextFactory(mapUser func(*Tokeninfo) (*user.User, error)) func(*http.Request) Context {
+	return func(r *http.Request) Context {
+		return newTokeninfoContext(appengine.NewContext(r), r, mapUser)
+	}
 }
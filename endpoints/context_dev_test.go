@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -12,6 +13,7 @@ import (
 	"appengine/aetest"
 
 	"google.golang.org/appengine/internal"
+	"google.golang.org/appengine/user"
 
 	basepb "appengine_internal/base"
 )
@@ -78,6 +80,7 @@ func TestTokeninfoContextCurrentOAuthClientID(t *testing.T) {
 		{"some_token7", "scope.one", "", 200, ""},
 		{"", "scope.one", "", 200, tokeninfoValid},
 		{"some_token9", "scope.one", "", -1, ""},
+		{"some_token10", "scope.one", "", 200, tokeninfoError},
 	}
 
 	for i, tt := range tts {
@@ -157,3 +160,232 @@ func TestTokeinfoContextNamespace(t *testing.T) {
 		t.Errorf("GetNamespace() = %q; want %q", ns.GetValue(), namespace)
 	}
 }
+
+func TestTokeninfoContextFactoryMapUser(t *testing.T) {
+	origTransport := httpTransportFactory
+	defer func() {
+		httpTransportFactory = origTransport
+	}()
+	httpTransportFactory = func(c context.Context) http.RoundTripper {
+		return newTestRoundTripper(
+			&http.Response{
+				Status:     "200 OK",
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(tokeninfoValid)),
+			},
+			&http.Response{
+				Status:     "200 OK",
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(tokeninfoValid)),
+			},
+		)
+	}
+
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	r.Header.Set("authorization", "bearer some_token")
+
+	const scope = "scope.one"
+	factory := TokeninfoContextFactory(func(ti *Tokeninfo) (*user.User, error) {
+		return &user.User{Email: "test-" + ti.Email, ClientID: "test-" + ti.IssuedTo}, nil
+	})
+	c := factory(r)
+
+	u, err := c.CurrentOAuthUser(scope)
+	if err != nil {
+		t.Fatalf("CurrentOAuthUser(%q) = %v", scope, err)
+	}
+	if want := "test-" + tokeninfoEmail; u.Email != want {
+		t.Errorf("CurrentOAuthUser(%q) = %#v; want email = %q", scope, u, want)
+	}
+	id, err := c.CurrentOAuthClientID(scope)
+	if err != nil {
+		t.Fatalf("CurrentOAuthClientID(%q) = %v", scope, err)
+	}
+	if id != "test-my-client-id" {
+		t.Errorf("CurrentOAuthClientID(%q) = %q; want %q", scope, id, "test-my-client-id")
+	}
+	if tok := validatedToken(c); tok.email != u.Email || tok.issuedTo() != id {
+		t.Errorf("validated token of %q, %q; want the mapped user", tok.email, tok.issuedTo())
+	}
+}
+
+func TestTokeninfoContextFactoryMapUserInvalidToken(t *testing.T) {
+	origTransport := httpTransportFactory
+	defer func() {
+		httpTransportFactory = origTransport
+	}()
+	httpTransportFactory = func(c context.Context) http.RoundTripper {
+		return newTestRoundTripper(&http.Response{
+			Status:     "401",
+			StatusCode: 401,
+			Body:       ioutil.NopCloser(strings.NewReader(tokeninfoError)),
+		})
+	}
+
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	r.Header.Set("authorization", "bearer some_token")
+
+	called := false
+	c := TokeninfoContextFactory(func(ti *Tokeninfo) (*user.User, error) {
+		called = true
+		return &user.User{Email: "test@example.org"}, nil
+	})(r)
+
+	if u, err := c.CurrentOAuthUser("scope.one"); err == nil {
+		t.Errorf("CurrentOAuthUser() = %#v; want error", u)
+	}
+	if called {
+		t.Errorf("mapUser called for an invalid token")
+	}
+}
+
+func TestTokeninfoContextFactoryMapUserNil(t *testing.T) {
+	origTransport := httpTransportFactory
+	defer func() {
+		httpTransportFactory = origTransport
+	}()
+	httpTransportFactory = func(c context.Context) http.RoundTripper {
+		return newTestRoundTripper(
+			&http.Response{
+				Status:     "200 OK",
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(tokeninfoValid)),
+			},
+			&http.Response{
+				Status:     "200 OK",
+				StatusCode: 200,
+				Body:       ioutil.NopCloser(strings.NewReader(tokeninfoValid)),
+			},
+		)
+	}
+
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	r.Header.Set("authorization", "bearer some_token")
+
+	const scope = "scope.one"
+	c := TokeninfoContextFactory(func(ti *Tokeninfo) (*user.User, error) {
+		return nil, nil
+	})(r)
+
+	if u, err := c.CurrentOAuthUser(scope); err == nil {
+		t.Errorf("CurrentOAuthUser(%q) = %#v; want error", scope, u)
+	}
+	if id, err := c.CurrentOAuthClientID(scope); err == nil {
+		t.Errorf("CurrentOAuthClientID(%q) = %q; want error", scope, id)
+	}
+	if scopes := GrantedScopes(c); len(scopes) != 0 {
+		t.Errorf("GrantedScopes(c) = %v; want none for a token mapping to no user", scopes)
+	}
+	if ok, err := IsDomainUser(c, "gmail.com"); err == nil {
+		t.Errorf("IsDomainUser(c) = %v; want error for a token mapping to no user", ok)
+	}
+}
+
+func TestFetchTokeninfoErrorDescription(t *testing.T) {
+	origTransport := httpTransportFactory
+	defer func() { httpTransportFactory = origTransport }()
+	httpTransportFactory = func(c context.Context) http.RoundTripper {
+		return newTestRoundTripper(&http.Response{
+			Status:     "200 OK",
+			StatusCode: 200,
+			Body: ioutil.NopCloser(strings.NewReader(`{
+				"expires_in": 3600,
+				"verified_email": true,
+				"email": "user@example.org",
+				"error_description": "Invalid value"
+			}`)),
+		})
+	}
+
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	c := tokeninfoContextFactory(r)
+
+	ti, err := fetchTokeninfo(c, "some_token")
+	if err == nil {
+		t.Fatalf("fetchTokeninfo() = %#v; want error", ti)
+	}
+	if !strings.Contains(err.Error(), "Invalid value") {
+		t.Errorf("fetchTokeninfo() = %v; want error description", err)
+	}
+}
+
+func TestFetchTokeninfoBackendError(t *testing.T) {
+	origTransport := httpTransportFactory
+	defer func() { httpTransportFactory = origTransport }()
+
+	tts := []struct {
+		resp    *http.Response
+		backend bool
+	}{
+		{nil, true},
+		{&http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: 503,
+			Body:       ioutil.NopCloser(strings.NewReader("unavailable")),
+		}, true},
+		{&http.Response{
+			Status:     "400 Bad Request",
+			StatusCode: 400,
+			Body:       ioutil.NopCloser(strings.NewReader(tokeninfoError)),
+		}, false},
+	}
+	for i, tt := range tts {
+		rt := newTestRoundTripper()
+		if tt.resp != nil {
+			rt.Add(tt.resp)
+		}
+		httpTransportFactory = func(c context.Context) http.RoundTripper {
+			return rt
+		}
+
+		r, _, closer := newTestRequest(t, "GET", "/", nil)
+		c := tokeninfoContextFactory(r)
+		_, err := fetchTokeninfo(c, "some_token")
+		closer()
+		if err == nil {
+			t.Errorf("%d: fetchTokeninfo() = nil; want error", i)
+			continue
+		}
+		if isAuthBackendError(err) != tt.backend {
+			t.Errorf("%d: isAuthBackendError(%v) = %v; want %v",
+				i, err, !tt.backend, tt.backend)
+		}
+		if apiErr, ok := err.(*APIError); tt.backend && (!ok || apiErr.Code != 503) {
+			t.Errorf("%d: fetchTokeninfo() = %#v; want 503 APIError", i, err)
+		}
+	}
+}
+
+func TestTokeninfoContextGrantedScopes(t *testing.T) {
+	origTransport := httpTransportFactory
+	defer func() {
+		httpTransportFactory = origTransport
+	}()
+	httpTransportFactory = func(c context.Context) http.RoundTripper {
+		return newTestRoundTripper(&http.Response{
+			Status:     "200 OK",
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(strings.NewReader(tokeninfoValid)),
+		})
+	}
+
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	r.Header.Set("authorization", "bearer some_token")
+
+	c := tokeninfoContextFactory(r)
+	if scopes := GrantedScopes(c); scopes == nil || len(scopes) != 0 {
+		t.Errorf("GrantedScopes(c) = %#v; want empty slice", scopes)
+	}
+	if _, err := c.CurrentOAuthUser("scope.one"); err != nil {
+		t.Fatalf("CurrentOAuthUser() = %v", err)
+	}
+	want := []string{"scope.one", "scope.two"}
+	if scopes := GrantedScopes(c); !reflect.DeepEqual(scopes, want) {
+		t.Errorf("GrantedScopes(c) = %#v; want %#v", scopes, want)
+	}
+}
@@ -1,8 +1,11 @@
 package endpoints
 
 import (
+	"errors"
 	"testing"
 
+	"golang.org/x/net/context"
+
 	"google.golang.org/appengine/internal"
 
 	basepb "appengine_internal/base"
@@ -26,3 +29,53 @@ func TestCachingContextNamespace(t *testing.T) {
 		t.Errorf("expected ns %q, got %q", namespace, ns.GetValue())
 	}
 }
+
+func TestNamespaceValidator(t *testing.T) {
+	defer func() { NamespaceValidator = nil }()
+	errForbidden := errors.New("forbidden namespace")
+	NamespaceValidator = func(name string) (string, error) {
+		if name == "admin" {
+			return "", errForbidden
+		}
+		return "tenant-" + name, nil
+	}
+
+	r, _, cleanup := newTestRequest(t, "GET", "/", nil)
+	defer cleanup()
+	c := cachingContextFactory(r)
+	derived := deriveContext(c, context.WithValue(c, "key", "value"))
+
+	for _, c := range []Context{c, derived} {
+		nc, err := c.Namespace("acme")
+		if err != nil {
+			t.Fatalf("%T: Namespace() = %v", c, err)
+		}
+		ns := &basepb.StringProto{}
+		if err := internal.Call(nc, "__go__", "GetNamespace", &basepb.VoidProto{}, ns); err != nil {
+			t.Fatalf("Error calling __go__.GetNamespace: %v", err)
+		}
+		if ns.GetValue() != "tenant-acme" {
+			t.Errorf("%T: namespace = %q; want %q", c, ns.GetValue(), "tenant-acme")
+		}
+		if _, err := c.Namespace("admin"); err != errForbidden {
+			t.Errorf("%T: Namespace(admin) = %v; want %v", c, err, errForbidden)
+		}
+	}
+}
+
+func TestCachingContextGrantedScopes(t *testing.T) {
+	const scope = "valid.scope"
+
+	r, _, cleanup := newTestRequest(t, "GET", "/", nil)
+	defer cleanup()
+	c := cachingContextFactory(r)
+	if scopes := GrantedScopes(c); scopes == nil || len(scopes) != 0 {
+		t.Errorf("GrantedScopes(c) = %#v; want empty slice", scopes)
+	}
+	if _, err := c.CurrentOAuthUser(scope); err != nil {
+		t.Fatalf("CurrentOAuthUser(%q) = %v", scope, err)
+	}
+	if scopes := GrantedScopes(c); !contains(scopes, scope) {
+		t.Errorf("GrantedScopes(c) = %#v; want it to contain %q", scopes, scope)
+	}
+}
@@ -0,0 +1,174 @@
+package endpoints
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS configures Cross-Origin Resource Sharing of a Server or a method.
+type CORS struct {
+	// AllowedOrigins are origins allowed to make requests, e.g.
+	// "https://example.com", or "*" for any origin.
+	AllowedOrigins []string
+	// AllowedMethods are HTTP methods allowed in requests. Defaults to POST.
+	AllowedMethods []string
+	// AllowedHeaders are request headers allowed in addition to
+	// CORS-safelisted ones, e.g. "Authorization".
+	AllowedHeaders []string
+	// MaxAge is how long results of a preflight request can be cached.
+	// Zero value omits Access-Control-Max-Age header.
+	MaxAge time.Duration
+
+	// Disabled turns CORS off, e.g. for a method of a Server which has
+	// CORS enabled.
+	Disabled bool
+}
+
+// allowsOrigin returns true if requests from origin are allowed.
+func (cors *CORS) allowsOrigin(origin string) bool {
+	for _, o := range cors.AllowedOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsMethod returns true if requests with HTTP method are allowed.
+func (cors *CORS) allowsMethod(method string) bool {
+	if len(cors.AllowedMethods) == 0 {
+		return method == "POST"
+	}
+	for _, m := range cors.AllowedMethods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// corsConfig returns CORS config of method m, which is MethodInfo.CORS if
+// set, and s.CORS otherwise. It returns nil if CORS is disabled.
+func (s *Server) corsConfig(m *ServiceMethod) *CORS {
+	cors := s.CORS
+	if m.info != nil && m.info.CORS != nil {
+		cors = m.info.CORS
+	}
+	if cors == nil || cors.Disabled {
+		return nil
+	}
+	return cors
+}
+
+// setCORSHeaders adds CORS headers to the response to request r of method
+// m, if r comes from an allowed origin.
+func (s *Server) setCORSHeaders(w http.ResponseWriter, r *http.Request, m *ServiceMethod) {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return
+	}
+	cors := s.corsConfig(m)
+	if cors == nil || !cors.allowsOrigin(origin) {
+		return
+	}
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Add("Vary", "Origin")
+}
+
+// isPreflight returns true if r is a CORS preflight request.
+func isPreflight(r *http.Request) bool {
+	return r.Method == "OPTIONS" && r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// servePreflight responds to CORS preflight request r of a method at path,
+// according to the method's CORS config. Disallowed requests are rejected
+// with 403 Forbidden.
+func (s *Server) servePreflight(w http.ResponseWriter, r *http.Request, path string) {
+	_, m, err := s.services.get(path[strings.LastIndex(path, "/")+1:])
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	origin := r.Header.Get("Origin")
+	method := r.Header.Get("Access-Control-Request-Method")
+	cors := s.corsConfig(m)
+	if cors == nil || !cors.allowsOrigin(origin) || !cors.allowsMethod(method) {
+		s.writeError(w, r, NewForbiddenError("CORS request from %s not allowed", origin))
+		return
+	}
+
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Add("Vary", "Origin")
+	methods := cors.AllowedMethods
+	if len(methods) == 0 {
+		methods = []string{"POST"}
+	}
+	h.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	if len(cors.AllowedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
+	}
+	if cors.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(cors.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setPublicCORSHeaders allows responses of discovery endpoints, such as
+// DirectoryHandler, to be read from any origin, whatever the CORS config
+// of the Server is. Discovery documents aren't sensitive and are meant to
+// be fetched by browser-based tools, e.g. API explorers.
+func setPublicCORSHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+}
+
+// servePublicPreflight responds to CORS preflight request r of a discovery
+// endpoint, allowing GET requests from any origin with any headers.
+func servePublicPreflight(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Set("Access-Control-Allow-Origin", "*")
+	h.Set("Access-Control-Allow-Methods", "GET")
+	if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// serveOptions responds to a non-preflight OPTIONS request r of a method
+// at path with 204 No Content and Allow header listing methods the path
+// accepts. Like preflight requests, it doesn't require authentication.
+func (s *Server) serveOptions(w http.ResponseWriter, r *http.Request, path string) {
+	_, m, err := s.services.get(path[strings.LastIndex(path, "/")+1:])
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	s.setCORSHeaders(w, r, m)
+	w.Header().Del("Content-Type")
+	w.Header().Set("Allow", allowedHTTPMethods)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// allowedHTTPMethods is Allow header value of method paths. Backend
+// methods are always called with POST, whatever their HTTP method in
+// the API config is.
+const allowedHTTPMethods = "OPTIONS, POST"
+
+// serveMethodNotAllowed responds to request r of a method at path with
+// an HTTP method other than POST and OPTIONS. It's 405 Method Not Allowed
+// with Allow header if the method exists, or the usual error of unknown
+// methods otherwise.
+func (s *Server) serveMethodNotAllowed(w http.ResponseWriter, r *http.Request, path string) {
+	if _, _, err := s.services.get(path[strings.LastIndex(path, "/")+1:]); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Allow", allowedHTTPMethods)
+	s.writeError(w, r, errorf(http.StatusMethodNotAllowed, "rpc: POST method required, got %q", r.Method))
+}
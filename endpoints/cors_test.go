@@ -0,0 +1,150 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+func TestServerCORS(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := createAPIServer()
+	server.CORS = &CORS{AllowedOrigins: []string{"https://app.example.com"}}
+	methods := server.services.services["ServerTestService"].methods
+	methods["Msg"].info = &MethodInfo{CORS: &CORS{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Authorization"},
+		MaxAge:         10 * time.Minute,
+	}}
+	methods["Void"].info = &MethodInfo{CORS: &CORS{Disabled: true}}
+
+	const (
+		appOrigin    = "https://app.example.com"
+		widgetOrigin = "https://widget.example.org"
+	)
+	tts := []struct {
+		method, origin, reqMethod string
+		code                      int
+		allowOrigin, allowMethods string
+		allowHeaders, maxAge      string
+	}{
+		// server-wide config
+		{"Error", appOrigin, "POST", http.StatusNoContent, appOrigin, "POST", "", ""},
+		{"Error", appOrigin, "PUT", http.StatusForbidden, "", "", "", ""},
+		{"Error", widgetOrigin, "POST", http.StatusForbidden, "", "", "", ""},
+		// per-method override
+		{"Msg", widgetOrigin, "GET", http.StatusNoContent, widgetOrigin, "GET, POST", "Authorization", "600"},
+		{"Msg", appOrigin, "DELETE", http.StatusForbidden, "", "", "", ""},
+		// disabled for the method
+		{"Void", appOrigin, "POST", http.StatusForbidden, "", "", "", ""},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("OPTIONS", "/ServerTestService."+tt.method, nil)
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		r.Header.Set("Origin", tt.origin)
+		r.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: %s preflight: w.Code = %d; want %d", i, tt.method, w.Code, tt.code)
+		}
+		for h, want := range map[string]string{
+			"Access-Control-Allow-Origin":  tt.allowOrigin,
+			"Access-Control-Allow-Methods": tt.allowMethods,
+			"Access-Control-Allow-Headers": tt.allowHeaders,
+			"Access-Control-Max-Age":       tt.maxAge,
+		} {
+			if v := w.Header().Get(h); v != want {
+				t.Errorf("%d: %s preflight: %s = %q; want %q", i, tt.method, h, v, want)
+			}
+		}
+	}
+
+	// Actual requests
+	for i, tt := range []struct {
+		method, origin, allowOrigin string
+	}{
+		{"Msg", widgetOrigin, widgetOrigin},
+		{"Error", appOrigin, appOrigin},
+		{"Error", widgetOrigin, ""},
+		{"Void", appOrigin, ""},
+		{"Msg", "", ""},
+	} {
+		r, err := inst.NewRequest("POST", "/ServerTestService."+tt.method, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if v := w.Header().Get("Access-Control-Allow-Origin"); v != tt.allowOrigin {
+			t.Errorf("%d: %s: Access-Control-Allow-Origin = %q; want %q", i, tt.method, v, tt.allowOrigin)
+		}
+	}
+}
+
+func TestServerOptionsWithoutAuth(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	server.DefaultAuth = AuthRequired
+	server.CORS = &CORS{AllowedOrigins: []string{"*"}}
+	if _, err := server.RegisterService(&PolicyService{}, "policy", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+
+	tts := []struct {
+		method, path, origin, reqMethod string
+		code                            int
+		allow                           string
+	}{
+		{"POST", "/PolicyService.Ping", "", "", http.StatusUnauthorized, ""},
+		{"OPTIONS", "/PolicyService.Ping", "", "", http.StatusNoContent, "OPTIONS, POST"},
+		{"OPTIONS", "/PolicyService.Ping", "https://app.example.com", "", http.StatusNoContent, "OPTIONS, POST"},
+		{"OPTIONS", "/PolicyService.Ping", "https://app.example.com", "POST", http.StatusNoContent, ""},
+		{"OPTIONS", "/PolicyService.Unknown", "", "", http.StatusNotFound, ""},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest(tt.method, tt.path, nil)
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if tt.reqMethod != "" {
+			r.Header.Set("Access-Control-Request-Method", tt.reqMethod)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s: w.Code = %d; want %d", i, tt.method, tt.path, w.Code, tt.code)
+		}
+		if allow := w.Header().Get("Allow"); allow != tt.allow {
+			t.Errorf("%d: Allow = %q; want %q", i, allow, tt.allow)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Origin"); tt.origin != "" && tt.code == http.StatusNoContent && got != tt.origin {
+			t.Errorf("%d: Access-Control-Allow-Origin = %q; want %q", i, got, tt.origin)
+		}
+	}
+}
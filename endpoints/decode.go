@@ -0,0 +1,298 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dateOnlyLayout is accepted for time.Time query parameters in addition
+// to RFC 3339.
+const dateOnlyLayout = "2006-01-02"
+
+// defaultMaxQueryBytes is the query string length limit if
+// Server.MaxQueryBytes is zero.
+const defaultMaxQueryBytes = 8 << 10
+
+// checkQueryLength returns 414 APIError if the query string of request r
+// is longer than s.MaxQueryBytes.
+func (s *Server) checkQueryLength(r *http.Request) error {
+	max := s.MaxQueryBytes
+	if max == 0 {
+		max = defaultMaxQueryBytes
+	}
+	if max > 0 && len(r.URL.RawQuery) > max {
+		return errorf(http.StatusRequestURITooLong,
+			"Query string exceeds %d bytes", max)
+	}
+	return nil
+}
+
+// defaultMaxQueryValues is used when Server.MaxQueryValues is zero.
+const defaultMaxQueryValues = 100
+
+// maxQueryValues returns the limit of values of repeated query parameters,
+// which is s.MaxQueryValues or its default. Non-positive values mean
+// no limit.
+func (s *Server) maxQueryValues() int {
+	if s.MaxQueryValues == 0 {
+		return defaultMaxQueryValues
+	}
+	return s.MaxQueryValues
+}
+
+// maxBodyBytes returns the body size limit of method m, which is
+// MethodInfo.MaxBodyBytes if set, and s.MaxBodyBytes otherwise.
+// Non-positive values mean no limit.
+func (s *Server) maxBodyBytes(m *ServiceMethod) int64 {
+	if m.info != nil && m.info.MaxBodyBytes != 0 {
+		return m.info.MaxBodyBytes
+	}
+	return s.MaxBodyBytes
+}
+
+// readBody reads the body of request r. If max is positive and the body is
+// longer than max bytes, it returns 413 APIError.
+//
+// Requests with Content-Length over max are rejected before reading
+// anything. The body is still limited while reading, in case there's
+// no Content-Length or it doesn't match the body.
+func readBody(r *http.Request, max int64) ([]byte, error) {
+	if max <= 0 {
+		return ioutil.ReadAll(r.Body)
+	}
+	if r.ContentLength > max {
+		return nil, errorf(http.StatusRequestEntityTooLarge,
+			"Request body exceeds %d bytes", max)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > max {
+		return nil, errorf(http.StatusRequestEntityTooLarge,
+			"Request body exceeds %d bytes", max)
+	}
+	return body, nil
+}
+
+// checkContentType returns 415 APIError if request r has a Content-Type
+// its body can't be decoded from: protobuf if reqType isn't a protobuf
+// message, or anything but JSON if reqType is a raw body, which is passed
+// to the method as is. Bodies of other requests are decoded as JSON
+// whatever their Content-Type, and requests without one are accepted.
+func checkContentType(r *http.Request, reqType reflect.Type) error {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return nil
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	switch {
+	case err == nil && mt == protobufContentType:
+		if isProtoMessage(reqType) {
+			return nil
+		}
+	case isRawBody(indirectType(reqType)):
+		if err == nil && mt == "application/json" {
+			return nil
+		}
+	default:
+		return nil
+	}
+	return errorf(http.StatusUnsupportedMediaType,
+		"Unsupported Content-Type %q, expected application/json", ct)
+}
+
+// bindQuery sets fields of struct v from query parameters q.
+//
+// Parameters are matched against field names the same way path templates
+// are (see fieldNames), so json tags are honored. Fields of anonymous
+// (embedded) structs are bound too. Time fields tagged with "timeformats"
+// accept parameters in those formats. A parameter which can't be parsed into
+// its field type results in a 400 APIError naming the parameter.
+//
+// All values of a repeated parameter, e.g. "?id=1&id=2", are bound to
+// a slice field, as long as there are at most max of them, or "maxItems"
+// of the field if it has one. More values result in a 400 APIError before
+// anything is allocated. Non-positive max means no limit.
+func bindQuery(v reflect.Value, q url.Values, max int) error {
+	if len(q) == 0 || v.Kind() != reflect.Struct {
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := bindQuery(v.Field(i), q, max); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := jsonFieldName(&field)
+		if name == "-" {
+			continue
+		}
+		values, ok := q[name]
+		if !ok || len(values) == 0 {
+			continue
+		}
+		if field.Type.Kind() == reflect.Slice && field.Type != typeOfBytes {
+			if err := bindRepeated(v.Field(i), &field, values, max); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := setQueryValue(v.Field(i), &field, values[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bindRepeated sets slice v of field to values of a repeated query
+// parameter, unless there are more than max values, or "maxItems" of
+// the field if it has one.
+func bindRepeated(v reflect.Value, field *reflect.StructField, values []string, max int) error {
+	if tag, err := parseTag(field.Tag); err == nil && tag.maxItems > 0 {
+		max = tag.maxItems
+	}
+	if max > 0 && len(values) > max {
+		name := jsonFieldName(field)
+		return withFieldViolation(name, NewBadRequestError("Parameter %q has %d values, at most %d allowed",
+			name, len(values), max))
+	}
+	els := reflect.MakeSlice(v.Type(), len(values), len(values))
+	for i, val := range values {
+		if err := setQueryValue(els.Index(i), field, val); err != nil {
+			return err
+		}
+	}
+	v.Set(els)
+	return nil
+}
+
+// setQueryValue parses value s of a query parameter of field and stores
+// it in v, the field or an element of it. It returns 400 APIError naming
+// the parameter if s can't be parsed.
+func setQueryValue(v reflect.Value, field *reflect.StructField, s string) error {
+	var err error
+	if formats := queryTimeFormats(field); formats != nil {
+		err = setTimeFromString(v, s, formats)
+	} else {
+		err = setFromString(v, s)
+	}
+	name := jsonFieldName(field)
+	if err != nil && isSecretField(field) {
+		return withFieldViolation(name, NewBadRequestError("Invalid value of parameter %q", name))
+	}
+	if err != nil {
+		return withFieldViolation(name, NewBadRequestError("Invalid value %q of parameter %q: %v", s, name, err))
+	}
+	return nil
+}
+
+// jsonFieldName returns a name of the field as it appears in JSON,
+// or "-" if the field is skipped by encoding/json.
+func jsonFieldName(field *reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		name = field.Name
+	}
+	return name
+}
+
+// setFromString parses s and stores the result in v.
+//
+// Only basic kinds, time.Time and types implementing json.Unmarshaler
+// are supported.
+func setFromString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setFromString(v.Elem(), s)
+	}
+
+	switch {
+	case v.Type() == typeOfTime:
+		t, err := parseTime(s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	case implements(v.Addr().Type(), typeOfJSONMarshaler):
+		return json.Unmarshal([]byte(strconv.Quote(s)), v.Addr().Interface())
+	}
+
+	switch k := v.Kind(); {
+	case k == reflect.String:
+		v.SetString(s)
+	case k == reflect.Bool:
+		b, err := parseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int <= k && k <= reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint <= k && k <= reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case k == reflect.Float32, k == reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// parseBool is a more forgiving version of strconv.ParseBool.
+// Along with "true" and "false" it accepts "1", "0", "yes", "no", "on"
+// and "off", all case-insensitive.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true", "1", "yes", "on":
+		return true, nil
+	case "false", "0", "no", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+// parseTime parses s as either RFC 3339 timestamp or a date-only value,
+// e.g. "2015-01-31".
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(dateOnlyLayout, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", s)
+	}
+	return t, nil
+}
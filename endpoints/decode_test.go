@@ -0,0 +1,269 @@
+package endpoints
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type QueryMsg struct {
+	Flag  bool      `json:"flag"`
+	PFlag *bool     `json:"pflag"`
+	Since time.Time `json:"since"`
+	Limit int       `json:"limit"`
+	Name  string
+	Skip  string `json:"-"`
+}
+
+func TestParseBool(t *testing.T) {
+	tts := []struct {
+		in   string
+		want bool
+		ok   bool
+	}{
+		{"true", true, true},
+		{"TRUE", true, true},
+		{"1", true, true},
+		{"Yes", true, true},
+		{"on", true, true},
+		{"false", false, true},
+		{"0", false, true},
+		{"NO", false, true},
+		{"Off", false, true},
+		{"", false, false},
+		{"y", false, false},
+		{"2", false, false},
+	}
+	for i, tt := range tts {
+		out, err := parseBool(tt.in)
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("%d: parseBool(%q) = %v; want %v", i, tt.in, err, tt.want)
+		case !tt.ok && err == nil:
+			t.Errorf("%d: parseBool(%q) = %v; want error", i, tt.in, out)
+		case out != tt.want:
+			t.Errorf("%d: parseBool(%q) = %v; want %v", i, tt.in, out, tt.want)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tts := []struct {
+		in   string
+		want time.Time
+		ok   bool
+	}{
+		{"2015-01-31T10:20:30Z", time.Date(2015, 1, 31, 10, 20, 30, 0, time.UTC), true},
+		{"2015-01-31", time.Date(2015, 1, 31, 0, 0, 0, 0, time.UTC), true},
+		{"2015-01-31 10:20", time.Time{}, false},
+		{"yesterday", time.Time{}, false},
+	}
+	for i, tt := range tts {
+		out, err := parseTime(tt.in)
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("%d: parseTime(%q) = %v; want %v", i, tt.in, err, tt.want)
+		case !tt.ok && err == nil:
+			t.Errorf("%d: parseTime(%q) = %v; want error", i, tt.in, out)
+		case !out.Equal(tt.want):
+			t.Errorf("%d: parseTime(%q) = %v; want %v", i, tt.in, out, tt.want)
+		}
+	}
+}
+
+func TestBindQuery(t *testing.T) {
+	yes := true
+	q := url.Values{
+		"flag":  {"yes"},
+		"pflag": {"1"},
+		"since": {"2015-01-31"},
+		"limit": {"10"},
+		"Name":  {"gopher"},
+		"Skip":  {"skipped"},
+	}
+	msg := &QueryMsg{}
+	if err := bindQuery(reflect.ValueOf(msg).Elem(), q, 0); err != nil {
+		t.Fatalf("bindQuery(%v) = %v", q, err)
+	}
+	want := &QueryMsg{
+		Flag:  true,
+		PFlag: &yes,
+		Since: time.Date(2015, 1, 31, 0, 0, 0, 0, time.UTC),
+		Limit: 10,
+		Name:  "gopher",
+	}
+	if !reflect.DeepEqual(msg, want) {
+		t.Errorf("bindQuery(%v) = %#v; want %#v", q, msg, want)
+	}
+}
+
+func TestBindQueryInvalid(t *testing.T) {
+	for _, q := range []url.Values{
+		{"flag": {"maybe"}},
+		{"since": {"tomorrow"}},
+		{"limit": {"ten"}},
+	} {
+		err := bindQuery(reflect.ValueOf(&QueryMsg{}).Elem(), q, 0)
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest {
+			t.Errorf("bindQuery(%v) = %v; want 400 APIError", q, err)
+		}
+	}
+}
+
+type RepeatedQueryMsg struct {
+	IDs   []int64   `json:"id"`
+	Tags  []*string `json:"tag" endpoints:"maxItems=3"`
+	Bytes []byte    `json:"bytes"`
+}
+
+func TestBindQueryRepeated(t *testing.T) {
+	a, b := "a", "b"
+	tts := []struct {
+		q    url.Values
+		max  int
+		want *RepeatedQueryMsg
+		err  string // error message, or "" for none
+	}{
+		{url.Values{"id": {"1", "2", "3"}}, 0, &RepeatedQueryMsg{IDs: []int64{1, 2, 3}}, ""},
+		{url.Values{"id": {"1", "2", "3"}}, 3, &RepeatedQueryMsg{IDs: []int64{1, 2, 3}}, ""},
+		{url.Values{"id": {"1", "2", "3"}}, 2, nil, `Parameter "id" has 3 values, at most 2 allowed`},
+		{url.Values{"id": {"1", "two"}}, 0, nil, `Invalid value "two" of parameter "id"`},
+		{url.Values{"tag": {"a", "b"}}, 1, &RepeatedQueryMsg{Tags: []*string{&a, &b}}, ""},
+		{url.Values{"tag": {"a", "b", "c", "d"}}, 10, nil, `Parameter "tag" has 4 values, at most 3 allowed`},
+	}
+	for i, tt := range tts {
+		msg := &RepeatedQueryMsg{}
+		err := bindQuery(reflect.ValueOf(msg).Elem(), tt.q, tt.max)
+		if tt.err != "" {
+			apiErr, ok := err.(*APIError)
+			if !ok || apiErr.Code != http.StatusBadRequest || !strings.HasPrefix(apiErr.Msg, tt.err) {
+				t.Errorf("%d: bindQuery(%v, %d) = %v; want 400 %q", i, tt.q, tt.max, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: bindQuery(%v, %d) = %v", i, tt.q, tt.max, err)
+			continue
+		}
+		if !reflect.DeepEqual(msg, tt.want) {
+			t.Errorf("%d: bindQuery(%v, %d) = %#v; want %#v", i, tt.q, tt.max, msg, tt.want)
+		}
+	}
+}
+
+func TestServerMaxQueryValues(t *testing.T) {
+	s := NewServer("")
+	if max := s.maxQueryValues(); max != defaultMaxQueryValues {
+		t.Errorf("maxQueryValues() = %d; want %d", max, defaultMaxQueryValues)
+	}
+	s.MaxQueryValues = -1
+	if max := s.maxQueryValues(); max > 0 {
+		t.Errorf("maxQueryValues() = %d; want no limit", max)
+	}
+}
+
+// countingReader counts bytes read from it.
+type countingReader struct {
+	r    io.Reader
+	read int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.read += n
+	return n, err
+}
+
+func TestReadBody(t *testing.T) {
+	tts := []struct {
+		body          string
+		contentLength int64
+		max           int64
+		ok            bool
+		wantRead      bool
+	}{
+		{"0123456789", 10, 0, true, true},
+		{"0123456789", 10, 10, true, true},
+		{"0123456789", 10, 9, false, false},
+		// chunked, without Content-Length
+		{"0123456789", -1, 10, true, true},
+		{"0123456789", -1, 9, false, true},
+		// Content-Length smaller than the body
+		{"0123456789", 5, 9, false, true},
+	}
+	for i, tt := range tts {
+		cr := &countingReader{r: strings.NewReader(tt.body)}
+		r := &http.Request{Body: ioutil.NopCloser(cr), ContentLength: tt.contentLength}
+		body, err := readBody(r, tt.max)
+		switch apiErr, _ := err.(*APIError); {
+		case tt.ok && (err != nil || string(body) != tt.body):
+			t.Errorf("%d: readBody() = %q, %v; want %q", i, body, err, tt.body)
+		case !tt.ok && (apiErr == nil || apiErr.Code != http.StatusRequestEntityTooLarge):
+			t.Errorf("%d: readBody() = %q, %v; want 413 APIError", i, body, err)
+		}
+		if read := cr.read > 0; read != tt.wantRead {
+			t.Errorf("%d: body read = %v; want %v", i, read, tt.wantRead)
+		}
+	}
+}
+
+func TestServerMaxBodyBytes(t *testing.T) {
+	s := &Server{MaxBodyBytes: 100}
+	tts := []struct {
+		info *MethodInfo
+		want int64
+	}{
+		{nil, 100},
+		{&MethodInfo{}, 100},
+		{&MethodInfo{MaxBodyBytes: 1 << 20}, 1 << 20},
+		{&MethodInfo{MaxBodyBytes: -1}, -1},
+	}
+	for i, tt := range tts {
+		if max := s.maxBodyBytes(&ServiceMethod{info: tt.info}); max != tt.want {
+			t.Errorf("%d: maxBodyBytes() = %d; want %d", i, max, tt.want)
+		}
+	}
+}
+
+func TestServerMaxQueryBytes(t *testing.T) {
+	long := "q=" + strings.Repeat("x", 8<<10)
+	tts := []struct {
+		max   int
+		query string
+		ok    bool
+	}{
+		{0, "q=short", true},
+		{0, long[:8<<10], true},
+		{0, long, false},
+		{10, "q=12345678", true},
+		{10, "q=123456789", false},
+		{-1, long, true},
+	}
+	for i, tt := range tts {
+		s := &Server{MaxQueryBytes: tt.max}
+		r := &http.Request{URL: &url.URL{Path: "/", RawQuery: tt.query}}
+		err := s.checkQueryLength(r)
+		switch apiErr, _ := err.(*APIError); {
+		case tt.ok && err != nil:
+			t.Errorf("%d: checkQueryLength() = %v; want nil", i, err)
+		case !tt.ok && (apiErr == nil || apiErr.Code != http.StatusRequestURITooLong):
+			t.Errorf("%d: checkQueryLength() = %v; want 414 APIError", i, err)
+		}
+	}
+
+	server := NewServer("")
+	server.MaxQueryBytes = 10
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/_ah/spi/ServerTestService.Void?q=123456789", strings.NewReader("{}"))
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusRequestURITooLong {
+		t.Errorf("ServeHTTP: w.Code = %d; want 414", w.Code)
+	}
+}
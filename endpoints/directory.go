@@ -0,0 +1,104 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// DirectoryList is a directory of APIs served by a Server, in the format
+// of Google APIs Discovery Service apis.list method.
+type DirectoryList struct {
+	Kind             string           `json:"kind"`
+	DiscoveryVersion string           `json:"discoveryVersion"`
+	Items            []*DirectoryItem `json:"items"`
+}
+
+// DirectoryItem is an API version listed in DirectoryList.
+type DirectoryItem struct {
+	Kind             string `json:"kind"`
+	ID               string `json:"id"`
+	Name             string `json:"name"`
+	Version          string `json:"version"`
+	Title            string `json:"title"`
+	Description      string `json:"description,omitempty"`
+	DiscoveryRestURL string `json:"discoveryRestUrl"`
+	DiscoveryLink    string `json:"discoveryLink"`
+	Preferred        bool   `json:"preferred"`
+}
+
+// Directory returns a directory of all APIs registered with s, one item
+// per API name and version, sorted by name. Services which are parts of
+// the same API version are listed once. Internal services are omitted.
+//
+// Discovery doc URLs of the items are relative to discoveryURL, e.g.
+// "https://my-app-id.appspot.com/_ah/api/discovery/v1/".
+func (s *Server) Directory(discoveryURL string) *DirectoryList {
+	dir := &DirectoryList{
+		Kind:             "discovery#directoryList",
+		DiscoveryVersion: "v1",
+		Items:            []*DirectoryItem{},
+	}
+	seen := make(map[string]*DirectoryItem)
+	for _, service := range s.services.apiServices() {
+		info := service.Info()
+		id := info.Name + ":" + info.Version
+		if item := seen[id]; item != nil {
+			item.Preferred = item.Preferred || info.Default
+			if item.Description == "" {
+				item.Description = info.Description
+			}
+			continue
+		}
+		link := "./apis/" + info.Name + "/" + info.Version + "/rest"
+		item := &DirectoryItem{
+			Kind:             "discovery#directoryItem",
+			ID:               id,
+			Name:             info.Name,
+			Version:          info.Version,
+			Title:            info.Name,
+			Description:      info.Description,
+			DiscoveryRestURL: discoveryURL + link[2:],
+			DiscoveryLink:    link,
+			Preferred:        info.Default,
+		}
+		seen[id] = item
+		dir.Items = append(dir.Items, item)
+	}
+	sort.Sort(byDirectoryID(dir.Items))
+	return dir
+}
+
+type byDirectoryID []*DirectoryItem
+
+func (a byDirectoryID) Len() int           { return len(a) }
+func (a byDirectoryID) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byDirectoryID) Less(i, j int) bool { return a[i].ID < a[j].ID }
+
+// DirectoryHandler returns a handler serving Directory(discoveryURL) to GET
+// requests. An empty discoveryURL defaults to the discovery service of the
+// request host, "https://<host>/_ah/api/discovery/v1/".
+//
+// The directory is built for each request, so it always lists the services
+// registered at the time. It can be fetched from any origin: responses
+// have Access-Control-Allow-Origin: * and CORS preflight requests are
+// allowed, regardless of s.CORS.
+func (s *Server) DirectoryHandler(discoveryURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPreflight(r) {
+			servePublicPreflight(w, r)
+			return
+		}
+		setPublicCORSHeaders(w)
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != "GET" {
+			s.writeError(w, r, errorf(http.StatusMethodNotAllowed, "GET method required, got %q", r.Method))
+			return
+		}
+		base := discoveryURL
+		if base == "" {
+			base = "https://" + r.Host + "/_ah/api/discovery/v1/"
+		}
+		json.NewEncoder(w).Encode(s.Directory(base))
+	})
+}
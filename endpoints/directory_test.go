@@ -0,0 +1,121 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestServerDirectory(t *testing.T) {
+	server := NewServer("")
+	if _, err := server.RegisterService(&BookService{}, "books", "v1", "Books", false); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	if _, err := server.RegisterService(&BulkService{}, "bulk", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	// Another part of bulk:v1 API.
+	if _, err := server.RegisterService(&PolicyService{}, "bulk", "v1", "Bulk ops", false); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	if _, err := server.services.register(&RawService{}, "internal", "v1", "", true, true); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+
+	const base = "https://example.com/_ah/api/discovery/v1/"
+	dir := server.Directory(base)
+	want := []*DirectoryItem{
+		{
+			Kind: "discovery#directoryItem", ID: "books:v1", Name: "books", Version: "v1",
+			Title: "books", Description: "Books",
+			DiscoveryRestURL: base + "apis/books/v1/rest", DiscoveryLink: "./apis/books/v1/rest",
+		},
+		{
+			Kind: "discovery#directoryItem", ID: "bulk:v1", Name: "bulk", Version: "v1",
+			Title: "bulk", Description: "Bulk ops",
+			DiscoveryRestURL: base + "apis/bulk/v1/rest", DiscoveryLink: "./apis/bulk/v1/rest",
+			Preferred: true,
+		},
+	}
+	if dir.Kind != "discovery#directoryList" || dir.DiscoveryVersion != "v1" {
+		t.Errorf("Directory() = %+v; want discovery#directoryList v1", dir)
+	}
+	if !reflect.DeepEqual(dir.Items, want) {
+		have, _ := json.Marshal(dir.Items)
+		wantJSON, _ := json.Marshal(want)
+		t.Errorf("Directory() items:\n%s\nwant:\n%s", have, wantJSON)
+	}
+
+	// Versions registered later are listed side by side.
+	if _, err := server.RegisterService(&ShapeService{}, "books", "v2", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/directory", nil)
+	r.Host = "my-app.appspot.com"
+	server.DirectoryHandler("").ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("w.Code = %d; want 200", w.Code)
+	}
+	var out DirectoryList
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", w.Body.String(), err)
+	}
+	var ids []string
+	for _, item := range out.Items {
+		ids = append(ids, item.ID)
+	}
+	if want := []string{"books:v1", "books:v2", "bulk:v1"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("directory IDs = %v; want %v", ids, want)
+	}
+	if len(out.Items) > 1 && out.Items[1].DiscoveryRestURL != "https://my-app.appspot.com/_ah/api/discovery/v1/apis/books/v2/rest" {
+		t.Errorf("DiscoveryRestURL = %q", out.Items[1].DiscoveryRestURL)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("POST", "/directory", nil)
+	server.DirectoryHandler("").ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: w.Code = %d; want 405", w.Code)
+	}
+}
+
+func TestDirectoryHandlerCORS(t *testing.T) {
+	server := NewServer("")
+	if _, err := server.RegisterService(&DummyService{}, "Dummy", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	server.CORS = &CORS{AllowedOrigins: []string{"https://app.example.com"}}
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/directory", nil)
+	r.Header.Set("Origin", "https://explorer.example.org")
+	server.DirectoryHandler("").ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET: w.Code = %d; want 200", w.Code)
+	}
+	if o := w.Header().Get("Access-Control-Allow-Origin"); o != "*" {
+		t.Errorf("GET: Access-Control-Allow-Origin = %q; want *", o)
+	}
+
+	w = httptest.NewRecorder()
+	r, _ = http.NewRequest("OPTIONS", "/directory", nil)
+	r.Header.Set("Origin", "https://explorer.example.org")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	r.Header.Set("Access-Control-Request-Headers", "X-Requested-With")
+	server.DirectoryHandler("").ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("preflight: w.Code = %d; want 204", w.Code)
+	}
+	for k, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "*",
+		"Access-Control-Allow-Methods": "GET",
+		"Access-Control-Allow-Headers": "X-Requested-With",
+	} {
+		if v := w.Header().Get(k); v != want {
+			t.Errorf("preflight: %s = %q; want %q", k, v, want)
+		}
+	}
+}
@@ -239,7 +239,32 @@ clients know what a service method data constraints are (on input):
 	- req, means "required".
 	- d, default value, cannot be used together with req.
 	- min and max constraints. Can be used only on int and uint (8/16/32/64 bits).
-	- desc, a field description. Cannot contain a "," (comma) for now.
+	- desc, a field description. It shows in discovery and JSON Schema
+	  documents. It can contain commas, e.g. `endpoints:"desc=Sort order,
+	  newest first,enum=asc|desc"`, unless what follows a comma looks like
+	  another option.
+	- pagesize, marks a page size field. Requests exceeding its max value
+	  are not rejected: the value is clamped to max before it reaches
+	  a service method.
+	- secret, marks a sensitive field, e.g. a password. Its value is
+	  redacted when requests and responses are logged, and left out of
+	  validation errors.
+	- urlsafe, makes a []byte field use URL-safe base64 alphabet instead
+	  of the standard one, e.g. `endpoints:"urlsafe"`. Padding is
+	  optional in requests. The field is still a "byte" string in discovery.
+	- format, a format string values must be in, either email or uri
+	  (an absolute URL), e.g. `endpoints:"format=email"`. Invalid values
+	  result in 400 Bad Request. The format appears in discovery.
+	- requiredif, makes a field required only when another field, named
+	  as in JSON, has a value, e.g. `endpoints:"requiredif=paymentMethod=card"`.
+	  An empty field then results in 400 Bad Request. Registering a service
+	  fails if the other field doesn't exist.
+	- timeformats, formats a time.Time field accepts in requests, tried in
+	  order, e.g. `endpoints:"timeformats=rfc3339|unixmillis"`. Formats
+	  are rfc3339 (the default), date, unix and unixmillis. A value matching
+	  none of them results in 400 Bad Request.
+	- timeformat, the format of a time.Time field in responses, e.g.
+	  `endpoints:"timeformat=unix"`. Defaults to rfc3339.
 
 Let's see an example:
 
@@ -273,6 +298,16 @@ a service method path template could then look like:
 
 Notice, the names are case-sensitive.
 
+The last segment of a path template can capture the rest of the path,
+however many segments it has, into a string field:
+
+	proxy/{rest=**}
+
+A request to "proxy/a/b%20c" sets the field to "a/b c": the captured
+remainder is URL-decoded by the backend. The frontend routes to such
+a method only when no more specific one matches, e.g. "proxy/{id}" or
+"proxy/status", so they can be registered alongside it.
+
 Naturally, you can combine json and endpoints tags to use a struct for both
 input and output:
 
@@ -0,0 +1,25 @@
+package endpoints
+
+import "net/http"
+
+// protectedHeaders are response headers managed by the server, which are
+// never echoed from requests.
+var protectedHeaders = map[string]bool{
+	"Content-Type":      true,
+	"Content-Length":    true,
+	"Content-Encoding":  true,
+	"Transfer-Encoding": true,
+}
+
+// echoHeaders copies headers listed in s.EchoHeaders from request r to
+// response w. Headers missing from r and protected headers are skipped.
+func (s *Server) echoHeaders(w http.ResponseWriter, r *http.Request) {
+	for _, name := range s.EchoHeaders {
+		name = http.CanonicalHeaderKey(name)
+		values, ok := r.Header[name]
+		if !ok || protectedHeaders[name] {
+			continue
+		}
+		w.Header()[name] = append([]string(nil), values...)
+	}
+}
@@ -0,0 +1,50 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+func TestServerEchoHeaders(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := createAPIServer()
+	server.EchoHeaders = []string{"x-request-id", "X-Cloud-Trace-Context", "X-Missing", "Content-Type"}
+
+	r, err := inst.NewRequest("POST", "/ServerTestService.Msg", strings.NewReader(`{"name": "x"}`))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	r.Header.Add("X-Request-Id", "a")
+	r.Header.Add("X-Request-Id", "b")
+	r.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b120001000/1;o=1")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("w.Code = %d; want %d", w.Code, http.StatusOK)
+	}
+	want := http.Header{
+		"X-Request-Id":          {"a", "b"},
+		"X-Cloud-Trace-Context": {"105445aa7843bc8bf206b120001000/1;o=1"},
+		"Content-Type":          {"application/json"},
+	}
+	for name, values := range want {
+		if out := w.Header()[name]; !reflect.DeepEqual(out, values) {
+			t.Errorf("%s = %v; want %v", name, out, values)
+		}
+	}
+	if _, ok := w.Header()["X-Missing"]; ok {
+		t.Errorf("X-Missing = %v; want no header", w.Header()["X-Missing"])
+	}
+}
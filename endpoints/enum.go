@@ -0,0 +1,39 @@
+package endpoints
+
+import (
+	"reflect"
+	"strings"
+)
+
+// checkEnum returns 400 APIError if string value v of field name is not one
+// of enum values. If fold is true, values are matched case-insensitively
+// and v is set to the matching value as it appears in enum.
+//
+// Empty strings and nil pointers are not checked, leaving it to "req".
+// The error doesn't include the value if secret is true.
+func checkEnum(name string, v reflect.Value, enum []string, fold, secret bool) error {
+	v = reflect.Indirect(v)
+	if !v.IsValid() || v.Kind() != reflect.String || v.Len() == 0 {
+		return nil
+	}
+	s := v.String()
+	for _, val := range enum {
+		if s == val {
+			return nil
+		}
+	}
+	if fold {
+		for _, val := range enum {
+			if strings.EqualFold(s, val) {
+				v.SetString(val)
+				return nil
+			}
+		}
+	}
+	if secret {
+		return NewBadRequestError("Value of field %q is not one of %s",
+			name, strings.Join(enum, ", "))
+	}
+	return NewBadRequestError("Value %q of field %q is not one of %s",
+		s, name, strings.Join(enum, ", "))
+}
@@ -0,0 +1,104 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Type URLs of error details of the google.rpc package.
+const (
+	badRequestType = "type.googleapis.com/google.rpc.BadRequest"
+	errorInfoType  = "type.googleapis.com/google.rpc.ErrorInfo"
+)
+
+// BadRequest is an error detail describing violations of fields of
+// a request, like google.rpc.BadRequest. Errors of fields violating
+// constraints of "endpoints" tags carry one.
+type BadRequest struct {
+	FieldViolations []*FieldViolation `json:"fieldViolations"`
+}
+
+// FieldViolation is a violation of a field in BadRequest.
+type FieldViolation struct {
+	// Field is the name of the field as it appears in JSON.
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+// MarshalJSON encodes b with its "@type".
+func (b *BadRequest) MarshalJSON() ([]byte, error) {
+	type badRequest BadRequest
+	return json.Marshal(&struct {
+		Type string `json:"@type"`
+		*badRequest
+	}{badRequestType, (*badRequest)(b)})
+}
+
+// errorInfo is the google.rpc.ErrorInfo detail of errors with a Reason
+// in ErrorFormatGoogle.
+type errorInfo struct {
+	Type   string `json:"@type"`
+	Reason string `json:"reason"`
+}
+
+// withFieldViolation adds a BadRequest detail naming field to err, if it
+// is a 400 APIError, so that clients can tell which field is invalid.
+// Other errors are returned as is.
+func withFieldViolation(field string, err error) error {
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.Code != http.StatusBadRequest {
+		return err
+	}
+	apiErr.Details = append(apiErr.Details, &BadRequest{
+		FieldViolations: []*FieldViolation{{Field: field, Description: apiErr.Msg}},
+	})
+	return apiErr
+}
+
+// googleErrors maps HTTP status codes to canonical codes of google.rpc.Code.
+var googleErrors = map[int]string{
+	http.StatusBadRequest:          "INVALID_ARGUMENT",
+	http.StatusUnauthorized:        "UNAUTHENTICATED",
+	http.StatusForbidden:           "PERMISSION_DENIED",
+	http.StatusNotFound:            "NOT_FOUND",
+	http.StatusConflict:            "ABORTED",
+	http.StatusPreconditionFailed:  "FAILED_PRECONDITION",
+	http.StatusTooManyRequests:     "RESOURCE_EXHAUSTED",
+	499:                            "CANCELLED",
+	http.StatusInternalServerError: "INTERNAL",
+	http.StatusNotImplemented:      "UNIMPLEMENTED",
+	http.StatusServiceUnavailable:  "UNAVAILABLE",
+	http.StatusGatewayTimeout:      "DEADLINE_EXCEEDED",
+}
+
+// googleError is an error response of ErrorFormatGoogle.
+type googleError struct {
+	Error *googleStatus `json:"error"`
+}
+
+// googleStatus is google.rpc.Status in the JSON shape of Google APIs.
+type googleStatus struct {
+	Code    int           `json:"code"`
+	Message string        `json:"message"`
+	Status  string        `json:"status"`
+	Details []interface{} `json:"details,omitempty"`
+}
+
+// newGoogleError returns errResp as an error of ErrorFormatGoogle. Its
+// reason, if any, is an ErrorInfo detail following details of the error.
+func newGoogleError(errResp *errorResponse) *googleError {
+	status, ok := googleErrors[errResp.Code]
+	if !ok {
+		status = "UNKNOWN"
+	}
+	details := errResp.Details
+	if errResp.Reason != "" {
+		details = append(details[:len(details):len(details)], &errorInfo{errorInfoType, errResp.Reason})
+	}
+	return &googleError{&googleStatus{
+		Code:    errResp.Code,
+		Message: errResp.Msg,
+		Status:  status,
+		Details: details,
+	}}
+}
@@ -0,0 +1,103 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// retryInfo is a custom error detail.
+type retryInfo struct {
+	Type       string `json:"@type"`
+	RetryDelay string `json:"retryDelay"`
+}
+
+func TestErrorBodyDetails(t *testing.T) {
+	errResp := newErrorResponse(&APIError{
+		Name:   "Bad Request",
+		Msg:    "Invalid name",
+		Code:   http.StatusBadRequest,
+		Reason: "badName",
+		Details: []interface{}{
+			&BadRequest{FieldViolations: []*FieldViolation{{Field: "name", Description: "Invalid name"}}},
+			&retryInfo{"type.googleapis.com/google.rpc.RetryInfo", "5s"},
+		},
+	})
+	badRequest := `{"@type":"type.googleapis.com/google.rpc.BadRequest",` +
+		`"fieldViolations":[{"field":"name","description":"Invalid name"}]}`
+	retry := `{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"5s"}`
+
+	tts := []struct {
+		format ErrorFormat
+		want   string
+	}{
+		{ErrorFormatSPI, `{"state":"APPLICATION_ERROR","error_name":"Bad Request",` +
+			`"error_message":"Invalid name","error_reason":"badName",` +
+			`"details":[` + badRequest + `,` + retry + `]}`},
+		{ErrorFormatGoogle, `{"error":{"code":400,"message":"Invalid name","status":"INVALID_ARGUMENT",` +
+			`"details":[` + badRequest + `,` + retry + `,` +
+			`{"@type":"type.googleapis.com/google.rpc.ErrorInfo","reason":"badName"}]}}`},
+	}
+	for _, tt := range tts {
+		s := &Server{ErrorFormat: tt.format}
+		body, ctype := s.errorBody(errResp)
+		out, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("%d: json.Marshal() = %v", tt.format, err)
+		}
+		if string(out) != tt.want || ctype != "application/json" {
+			t.Errorf("%d: errorBody() = %s, %q; want %s", tt.format, out, ctype, tt.want)
+		}
+	}
+	if len(errResp.Details) != 2 {
+		t.Errorf("errorBody() changed details of errResp to %v", errResp.Details)
+	}
+}
+
+func TestGoogleErrorStatus(t *testing.T) {
+	tts := []struct {
+		code int
+		want string
+	}{
+		{http.StatusNotFound, "NOT_FOUND"},
+		{http.StatusUnauthorized, "UNAUTHENTICATED"},
+		{http.StatusServiceUnavailable, "UNAVAILABLE"},
+		{http.StatusTeapot, "UNKNOWN"},
+	}
+	for _, tt := range tts {
+		g := newGoogleError(&errorResponse{Code: tt.code, Msg: "oops"})
+		if g.Error.Status != tt.want || g.Error.Code != tt.code || g.Error.Details != nil {
+			t.Errorf("newGoogleError(%d) = %+v; want status %s", tt.code, g.Error, tt.want)
+		}
+	}
+}
+
+func TestFieldViolations(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	errs := map[string]error{
+		"cardToken": validateRequest(c, reflect.ValueOf(&OrderMsg{PaymentMsg: PaymentMsg{Method: "card"}})),
+		"limit":     bindQuery(reflect.ValueOf(&QueryMsg{}).Elem(), url.Values{"limit": {"ten"}}, 0),
+		"id":        bindQuery(reflect.ValueOf(&RepeatedQueryMsg{}).Elem(), url.Values{"id": {"1", "2"}}, 1),
+	}
+	for field, err := range errs {
+		apiErr, ok := err.(*APIError)
+		if !ok || len(apiErr.Details) != 1 {
+			t.Errorf("%s: error = %#v; want APIError with one detail", field, err)
+			continue
+		}
+		want := &BadRequest{FieldViolations: []*FieldViolation{{Field: field, Description: apiErr.Msg}}}
+		if !reflect.DeepEqual(apiErr.Details[0], want) {
+			t.Errorf("%s: Details[0] = %#v; want %#v", field, apiErr.Details[0], want)
+		}
+	}
+
+	// Other errors are left alone.
+	if err := withFieldViolation("name", NewNotFoundError("Not here")); len(err.(*APIError).Details) != 0 {
+		t.Errorf("withFieldViolation(404) = %#v; want no details", err)
+	}
+}
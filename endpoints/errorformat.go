@@ -0,0 +1,120 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ErrorFormat tells the shape of error response bodies, see
+// Server.ErrorFormat.
+type ErrorFormat int
+
+const (
+	// ErrorFormatSPI is the Endpoints SPI error, e.g.
+	// {"state": "APPLICATION_ERROR", "error_name": "Not Found", ...},
+	// the default.
+	ErrorFormatSPI ErrorFormat = iota
+	// ErrorFormatJSONAPI is an error document of JSON:API, e.g.
+	// {"errors": [{"status": "404", "title": "Not Found", ...}]}, with
+	// Content-Type application/vnd.api+json. Each field violation of
+	// a BadRequest detail is an error object of its own, whose
+	// source.pointer points to the field.
+	ErrorFormatJSONAPI
+	// ErrorFormatGoogle is google.rpc.Status the way Google APIs respond
+	// with it, e.g. {"error": {"code": 400, "status": "INVALID_ARGUMENT",
+	// "message": "...", "details": [...]}}. The reason of an error is
+	// a google.rpc.ErrorInfo detail.
+	ErrorFormatGoogle
+)
+
+// jsonAPIMediaType is Content-Type of ErrorFormatJSONAPI errors.
+const jsonAPIMediaType = "application/vnd.api+json"
+
+// jsonAPIErrors is an error document of JSON:API.
+type jsonAPIErrors struct {
+	Errors []*jsonAPIError `json:"errors"`
+}
+
+// jsonAPIError is an error object of JSON:API. Its members are mapped from
+// errorResponse: id is the request ID, code is the reason, title is
+// the name and detail is the message, or the description of a field
+// violation, in which case source points to the field.
+type jsonAPIError struct {
+	ID     string         `json:"id,omitempty"`
+	Status string         `json:"status"`
+	Code   string         `json:"code,omitempty"`
+	Title  string         `json:"title,omitempty"`
+	Detail string         `json:"detail,omitempty"`
+	Source *jsonAPISource `json:"source,omitempty"`
+}
+
+// jsonAPISource is the source of a JSON:API error object.
+type jsonAPISource struct {
+	// Pointer is a JSON Pointer to the invalid field of the request.
+	Pointer string `json:"pointer"`
+}
+
+// newJSONAPIErrors returns errResp as an error document of JSON:API,
+// which has an error object per field violation of BadRequest details of
+// errResp, or a single one if there are none.
+func newJSONAPIErrors(errResp *errorResponse) *jsonAPIErrors {
+	newError := func(detail string) *jsonAPIError {
+		return &jsonAPIError{
+			ID:     errResp.RequestID,
+			Status: strconv.Itoa(errResp.Code),
+			Code:   errResp.Reason,
+			Title:  errResp.Name,
+			Detail: detail,
+		}
+	}
+	doc := &jsonAPIErrors{}
+	for _, d := range errResp.Details {
+		br, ok := d.(*BadRequest)
+		if !ok {
+			continue
+		}
+		for _, fv := range br.FieldViolations {
+			e := newError(fv.Description)
+			e.Source = &jsonAPISource{Pointer: jsonPointer(fv.Field)}
+			doc.Errors = append(doc.Errors, e)
+		}
+	}
+	if len(doc.Errors) == 0 {
+		doc.Errors = append(doc.Errors, newError(errResp.Msg))
+	}
+	return doc
+}
+
+// jsonPointer returns JSON Pointer to field, which is a path of a field
+// in a request as in FieldViolation, e.g. "items[0].name" points to
+// "/items/0/name".
+func jsonPointer(field string) string {
+	field = strings.Replace(field, "]", "", -1)
+	segs := strings.FieldsFunc(field, func(r rune) bool { return r == '.' || r == '[' })
+	for i, seg := range segs {
+		segs[i] = strings.Replace(strings.Replace(seg, "~", "~0", -1), "/", "~1", -1)
+	}
+	return "/" + strings.Join(segs, "/")
+}
+
+// errorBody returns the body of error response errResp in s.ErrorFormat
+// and its Content-Type.
+func (s *Server) errorBody(errResp *errorResponse) (interface{}, string) {
+	switch s.ErrorFormat {
+	case ErrorFormatJSONAPI:
+		return newJSONAPIErrors(errResp), jsonAPIMediaType
+	case ErrorFormatGoogle:
+		return newGoogleError(errResp), "application/json"
+	}
+	return errResp, "application/json"
+}
+
+// writeErrorResponse writes error response errResp in s.ErrorFormat.
+func (s *Server) writeErrorResponse(w http.ResponseWriter, errResp *errorResponse) {
+	body, ctype := s.errorBody(errResp)
+	w.Header().Set("Content-Type", ctype)
+	w.WriteHeader(errResp.Code)
+	json.NewEncoder(w).Encode(body)
+}
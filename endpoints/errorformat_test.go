@@ -0,0 +1,108 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+func TestServerErrorFormatJSONAPI(t *testing.T) {
+	server := createAPIServer()
+	server.ErrorFormat = ErrorFormatJSONAPI
+	server.ErrorRequestID = true
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		method, ctype string
+		code          int
+		out           string
+	}{
+		{"NotFound", "", http.StatusNotFound,
+			`{"errors":[{"id":"req-1","status":"404","title":"Not Found"}]}`},
+		{"Raw", "text/plain", http.StatusUnsupportedMediaType,
+			`{"errors":[{"id":"req-1","status":"415","title":"Unsupported Media Type",` +
+				`"detail":"Unsupported Content-Type \"text/plain\", expected application/json"}]}`},
+		{"Missing", "", http.StatusNotFound,
+			`{"errors":[{"id":"req-1","status":"404","title":"Not Found",` +
+				`"detail":"endpoints: can't find method \"Missing\" of service \"ServerTestService\""}]}`},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/ServerTestService."+tt.method, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.ctype != "" {
+			r.Header.Set("Content-Type", tt.ctype)
+		}
+		r.Header.Set(requestLogIDHeader, "req-1")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != jsonAPIMediaType {
+			t.Errorf("%d: Content-Type = %q; want %q", i, ct, jsonAPIMediaType)
+		}
+		if out := strings.TrimSpace(w.Body.String()); out != tt.out {
+			t.Errorf("%d: body = %s; want %s", i, out, tt.out)
+		}
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	errResp := newErrorResponse(&APIError{
+		Name:   "Bad Request",
+		Msg:    "Start must precede end",
+		Code:   http.StatusBadRequest,
+		Reason: "dateRange",
+	})
+
+	s := &Server{}
+	if body, ctype := s.errorBody(errResp); body != errResp || ctype != "application/json" {
+		t.Errorf("errorBody() = %#v, %q; want errResp as is", body, ctype)
+	}
+
+	s.ErrorFormat = ErrorFormatJSONAPI
+	body, ctype := s.errorBody(errResp)
+	doc, ok := body.(*jsonAPIErrors)
+	if !ok || len(doc.Errors) != 1 || ctype != jsonAPIMediaType {
+		t.Fatalf("errorBody() = %#v, %q; want a JSON:API error", body, ctype)
+	}
+	want := jsonAPIError{Status: "400", Code: "dateRange", Title: "Bad Request", Detail: "Start must precede end"}
+	if *doc.Errors[0] != want {
+		t.Errorf("errorBody() = %+v; want %+v", *doc.Errors[0], want)
+	}
+}
+
+func TestErrorBodyJSONAPIFieldViolations(t *testing.T) {
+	errResp := newErrorResponse(&APIError{
+		Name: "Bad Request",
+		Msg:  "Invalid request",
+		Code: http.StatusBadRequest,
+		Details: []interface{}{&BadRequest{FieldViolations: []*FieldViolation{
+			{Field: "slug", Description: "Slug is invalid"},
+			{Field: "items[1].a/b", Description: "Item is invalid"},
+		}}},
+	})
+	s := &Server{ErrorFormat: ErrorFormatJSONAPI}
+	body, _ := s.errorBody(errResp)
+	out, err := json.Marshal(body)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+	want := `{"errors":[` +
+		`{"status":"400","title":"Bad Request","detail":"Slug is invalid","source":{"pointer":"/slug"}},` +
+		`{"status":"400","title":"Bad Request","detail":"Item is invalid","source":{"pointer":"/items/1/a~1b"}}]}`
+	if string(out) != want {
+		t.Errorf("errorBody() = %s; want %s", out, want)
+	}
+}
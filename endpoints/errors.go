@@ -23,6 +23,9 @@ var (
 	NotFoundError = NewNotFoundError("")
 	// ConflictError is default error with http.StatusConflict (409)
 	ConflictError = NewConflictError("")
+	// PreconditionFailedError is default error with
+	// http.StatusPreconditionFailed (412)
+	PreconditionFailedError = NewPreconditionFailedError("")
 
 	// knownErrors is a list of all known errors.
 	knownErrors = [...]int{
@@ -32,6 +35,7 @@ var (
 		http.StatusForbidden,
 		http.StatusNotFound,
 		http.StatusConflict,
+		http.StatusPreconditionFailed,
 	}
 )
 
@@ -40,6 +44,21 @@ type APIError struct {
 	Name string
 	Msg  string
 	Code int
+
+	// Reason is an optional machine-readable error code, e.g. "dateRange".
+	// It is always included in error responses so that clients can localize
+	// messages themselves, and it makes Msg localizable with
+	// Server.Messages.
+	Reason string
+
+	// Details are typed payloads describing the error, included in error
+	// responses as "details", e.g. a *BadRequest. Custom ones should be
+	// structs encoded with "@type", like details of google.rpc.Status.
+	Details []interface{}
+
+	// challenge is WWW-Authenticate error of 401 errors of failed
+	// authentication, see newAuthError.
+	challenge *bearerChallenge
 }
 
 // APIError is an error
@@ -49,12 +68,12 @@ func (a *APIError) Error() string {
 
 // NewAPIError Create a new APIError for custom error
 func NewAPIError(name string, msg string, code int) error {
-	return &APIError{name, msg, code}
+	return &APIError{Name: name, Msg: msg, Code: code}
 }
 
 // errorf creates a new APIError given its status code, a format string and its arguments.
 func errorf(code int, format string, args ...interface{}) error {
-	return &APIError{http.StatusText(code), fmt.Sprintf(format, args...), code}
+	return &APIError{Name: http.StatusText(code), Msg: fmt.Sprintf(format, args...), Code: code}
 }
 
 // NewInternalServerError creates a new APIError with Internal Server Error status (500)
@@ -87,13 +106,26 @@ func NewConflictError(format string, args ...interface{}) error {
 	return errorf(http.StatusConflict, format, args...)
 }
 
+// NewPreconditionFailedError creates a new APIError with Precondition Failed
+// status (412)
+func NewPreconditionFailedError(format string, args ...interface{}) error {
+	return errorf(http.StatusPreconditionFailed, format, args...)
+}
+
 // errorResponse is SPI-compatible error response
 type errorResponse struct {
 	// Currently always "APPLICATION_ERROR"
-	State string `json:"state"`
-	Name  string `json:"error_name"`
-	Msg   string `json:"error_message,omitempty"`
-	Code  int    `json:"-"`
+	State  string `json:"state"`
+	Name   string `json:"error_name"`
+	Msg    string `json:"error_message,omitempty"`
+	Reason string `json:"error_reason,omitempty"`
+	Code   int    `json:"-"`
+
+	// Details are APIError.Details.
+	Details []interface{} `json:"details,omitempty"`
+
+	// RequestID is App Engine request ID, see Server.ErrorRequestID.
+	RequestID string `json:"request_id,omitempty"`
 }
 
 // Creates and initializes a new errorResponse.
@@ -103,22 +135,26 @@ type errorResponse struct {
 // is errorResponse.Msg.
 func newErrorResponse(err error) *errorResponse {
 	if e, ok := err.(*APIError); ok {
-		return &errorResponse{"APPLICATION_ERROR", e.Name, e.Msg, e.Code}
+		return &errorResponse{State: "APPLICATION_ERROR", Name: e.Name, Msg: e.Msg, Reason: e.Reason, Code: e.Code, Details: e.Details}
 	}
 	msg := err.Error()
 	for _, code := range knownErrors {
 		if name := http.StatusText(code); strings.HasPrefix(msg, name) {
-			return &errorResponse{"APPLICATION_ERROR", name, strings.Trim(msg[len(name):], " :"), code}
+			return &errorResponse{State: "APPLICATION_ERROR", Name: name, Msg: strings.Trim(msg[len(name):], " :"), Code: code}
 		}
 	}
 	//for compatibility, Before behavior, always return 400 HTTP Status Code.
 	// TODO(alex): where is 400 coming from?
-	return &errorResponse{"APPLICATION_ERROR", http.StatusText(http.StatusInternalServerError), msg, http.StatusBadRequest}
+	return &errorResponse{State: "APPLICATION_ERROR", Name: http.StatusText(http.StatusInternalServerError), Msg: msg, Code: http.StatusBadRequest}
 }
 
 // writeError writes SPI-compatible error response.
 func writeError(w http.ResponseWriter, err error) {
-	errResp := newErrorResponse(err)
+	writeErrorResponse(w, newErrorResponse(err))
+}
+
+// writeErrorResponse writes errResp as a response.
+func writeErrorResponse(w http.ResponseWriter, errResp *errorResponse) {
 	w.WriteHeader(errResp.Code)
 	json.NewEncoder(w).Encode(errResp)
 }
@@ -49,3 +49,18 @@ func TestAPIErrorResponse(t *testing.T) {
 			BadRequestError, res, want)
 	}
 }
+
+func TestAPIErrorReasonResponse(t *testing.T) {
+	err := &APIError{Name: "Bad Request", Msg: "start > end", Code: 400, Reason: "dateRange"}
+	res := newErrorResponse(err)
+	want := &errorResponse{
+		State:  "APPLICATION_ERROR",
+		Name:   "Bad Request",
+		Msg:    "start > end",
+		Reason: "dateRange",
+		Code:   400,
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("newErrorResponse(%#v) = %#v; want %#v", err, res, want)
+	}
+}
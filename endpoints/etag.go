@@ -0,0 +1,198 @@
+package endpoints
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// Precondition holds entity tags of conditional request headers.
+// Tags are kept as sent, including quotes and weak "W/" prefix.
+type Precondition struct {
+	// IfMatch holds tags of If-Match header, or "*".
+	IfMatch []string
+	// IfNoneMatch holds tags of If-None-Match header, or "*".
+	IfNoneMatch []string
+}
+
+// PreconditionFromContext returns entity tags of conditional headers of
+// the request of c, i.e. If-Match and If-None-Match.
+func PreconditionFromContext(c Context) *Precondition {
+	return parsePrecondition(c.HTTPRequest())
+}
+
+// parsePrecondition returns a Precondition of request r.
+func parsePrecondition(r *http.Request) *Precondition {
+	return &Precondition{
+		IfMatch:     parseETags(r.Header.Get("If-Match")),
+		IfNoneMatch: parseETags(r.Header.Get("If-None-Match")),
+	}
+}
+
+// Check returns 412 Precondition Failed APIError if a write to a resource
+// which current entity tag is etag must not proceed, according to p.
+// Pass an empty etag if the resource doesn't exist.
+//
+// If-Match tags are compared using strong comparison, so weak tags never
+// match, while If-None-Match tags are compared using weak comparison.
+// The content coding which ends tags of compressed responses, e.g.
+// "-gzip", is ignored.
+func (p *Precondition) Check(etag string) error {
+	if len(p.IfMatch) > 0 && !matchETag(p.IfMatch, etag, strongETagEqual) {
+		return NewPreconditionFailedError("If-Match precondition failed")
+	}
+	if len(p.IfNoneMatch) > 0 && matchETag(p.IfNoneMatch, etag, weakETagEqual) {
+		return NewPreconditionFailedError("If-None-Match precondition failed")
+	}
+	return nil
+}
+
+// matchETag returns true if etag of an existing resource matches any of
+// tags, which may be a wildcard, using equal to compare them.
+func matchETag(tags []string, etag string, equal func(a, b string) bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, tag := range tags {
+		if tag == "*" || equal(decodedETag(tag), etag) {
+			return true
+		}
+	}
+	return false
+}
+
+// strongETagEqual compares entity tags a and b using strong comparison.
+func strongETagEqual(a, b string) bool {
+	return a == b && !strings.HasPrefix(a, "W/")
+}
+
+// weakETagEqual compares entity tags a and b using weak comparison.
+func weakETagEqual(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// parseETags splits a value of If-Match or If-None-Match header h into
+// entity tags. Commas inside quoted tags don't split them.
+func parseETags(h string) []string {
+	var tags []string
+	quoted, start := false, 0
+	for i := 0; i <= len(h); i++ {
+		if i < len(h) && (h[i] != ',' || quoted) {
+			if h[i] == '"' {
+				quoted = !quoted
+			}
+			continue
+		}
+		if tag := strings.TrimSpace(h[start:i]); tag != "" {
+			tags = append(tags, tag)
+		}
+		start = i + 1
+	}
+	return tags
+}
+
+// ETagOf returns an entity tag of v, which is the same as the one sent in
+// ETag header when v is a response (see Server.ETags), unless
+// Server.ResponseTransformer changes its body. It can be used with
+// Precondition.Check to implement optimistic concurrency.
+func ETagOf(v interface{}) (string, error) {
+	body, err := encodeJSON(reflect.ValueOf(v))
+	if err != nil {
+		return "", err
+	}
+	return etagOf(body), nil
+}
+
+// etagOf returns an entity tag of an encoded response body.
+func etagOf(body []byte) string {
+	return fmt.Sprintf(`"%x"`, sha1.Sum(body))
+}
+
+// WeakETag returns weak version of entity tag etag, i.e. prefixed with
+// "W/". Weak tags are fine for validating cached responses, but never
+// match If-Match preconditions of writes.
+func WeakETag(etag string) string {
+	if etag == "" || IsWeakETag(etag) {
+		return etag
+	}
+	return "W/" + etag
+}
+
+// encodedETag returns etag of a response body compressed in content coding,
+// e.g. "<hash>-gzip" for "<hash>", so that caches keep the compressed and
+// uncompressed representations apart.
+func encodedETag(etag, coding string) string {
+	return strings.TrimSuffix(etag, `"`) + "-" + coding + `"`
+}
+
+// decodedETag returns tag without the content coding added by encodedETag
+// to tags computed by etagOf, or tag itself if it has none.
+func decodedETag(tag string) string {
+	weak := ""
+	if IsWeakETag(tag) {
+		weak, tag = "W/", tag[2:]
+	}
+	n := 1 + 2*sha1.Size
+	if len(tag) < n+3 || tag[0] != '"' || tag[n] != '-' || tag[len(tag)-1] != '"' ||
+		strings.Trim(tag[1:n], "0123456789abcdef") != "" {
+		return weak + tag
+	}
+	return weak + tag[:n] + `"`
+}
+
+// IsWeakETag returns true if etag is a weak entity tag.
+func IsWeakETag(etag string) bool {
+	return strings.HasPrefix(etag, "W/")
+}
+
+// CurrentETagger is implemented by requests of write methods which let
+// the server enforce conditional headers itself. CurrentETag returns
+// a strong entity tag of the current state of the resource the request
+// writes to, e.g. computed with ETagOf, or an empty string if there's no
+// such resource yet.
+//
+// If a request of a method other than GET implements CurrentETagger and
+// has If-Match or If-None-Match header, the server checks them with
+// Precondition.Check and responds with 412 Precondition Failed without
+// calling the service method if they fail. Otherwise the method can get
+// the tag with CurrentETag.
+type CurrentETagger interface {
+	CurrentETag(c Context) (string, error)
+}
+
+// currentETagKey is the context key of the current entity tag.
+type currentETagKey struct{}
+
+// CurrentETag returns the entity tag of the resource written by the
+// request of c, as returned by its CurrentETagger, and true if it was
+// computed when checking conditional headers.
+func CurrentETag(c Context) (string, bool) {
+	etag, ok := c.Value(currentETagKey{}).(string)
+	return etag, ok
+}
+
+// checkPrecondition enforces conditional headers of c request on request v
+// if it implements CurrentETagger. It returns c with the current entity
+// tag, or c itself if the tag wasn't needed.
+func checkPrecondition(c Context, v reflect.Value) (Context, error) {
+	etagger, ok := v.Interface().(CurrentETagger)
+	if !ok || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return c, nil
+	}
+	p := PreconditionFromContext(c)
+	if len(p.IfMatch) == 0 && len(p.IfNoneMatch) == 0 {
+		return c, nil
+	}
+	etag, err := etagger.CurrentETag(c)
+	if err != nil {
+		return c, err
+	}
+	if err := p.Check(etag); err != nil {
+		return c, err
+	}
+	return deriveContext(c, context.WithValue(c, currentETagKey{}, etag)), nil
+}
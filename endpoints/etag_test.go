@@ -0,0 +1,235 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+func TestParseETags(t *testing.T) {
+	tts := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"*", []string{"*"}},
+		{`"abc"`, []string{`"abc"`}},
+		{`"a", W/"b" ,"c,d"`, []string{`"a"`, `W/"b"`, `"c,d"`}},
+	}
+	for i, tt := range tts {
+		out := parseETags(tt.in)
+		if !reflect.DeepEqual(out, tt.want) {
+			t.Errorf("%d: parseETags(%q) = %#v; want %#v", i, tt.in, out, tt.want)
+		}
+	}
+}
+
+func TestPreconditionCheck(t *testing.T) {
+	hashTag := etagOf([]byte(`{"name":"a"}`))
+	tts := []struct {
+		ifMatch, ifNoneMatch, etag string
+		ok                         bool
+	}{
+		{"", "", `"a"`, true},
+		{"", "", "", true},
+		{`"a"`, "", `"a"`, true},
+		{`"b", "a"`, "", `"a"`, true},
+		{`"b"`, "", `"a"`, false},
+		{`W/"a"`, "", `W/"a"`, false},
+		{"*", "", `"a"`, true},
+		{"*", "", "", false},
+		{"", "*", "", true},
+		{"", "*", `"a"`, false},
+		{"", `W/"a"`, `"a"`, false},
+		{"", `"b"`, `"a"`, true},
+		// content codings of compressed responses are ignored
+		{encodedETag(hashTag, "gzip"), "", hashTag, true},
+		{WeakETag(encodedETag(hashTag, "gzip")), "", hashTag, false},
+		{"", encodedETag(hashTag, "br"), hashTag, false},
+		{encodedETag(hashTag, "gzip"), "", `"a"`, false},
+		// only in tags computed by the server
+		{`"v1-gzip"`, "", `"v1"`, false},
+	}
+	for i, tt := range tts {
+		r, _ := http.NewRequest("POST", "/", nil)
+		if tt.ifMatch != "" {
+			r.Header.Set("If-Match", tt.ifMatch)
+		}
+		if tt.ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", tt.ifNoneMatch)
+		}
+		err := parsePrecondition(r).Check(tt.etag)
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("%d: Check(%q) = %v; want nil", i, tt.etag, err)
+		case !tt.ok:
+			if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusPreconditionFailed {
+				t.Errorf("%d: Check(%q) = %v; want 412 APIError", i, tt.etag, err)
+			}
+		}
+	}
+}
+
+func TestServerETagRoundTrip(t *testing.T) {
+	server := createAPIServer()
+	server.ETags = true
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	r, err := inst.NewRequest("POST", "/ServerTestService.Msg", strings.NewReader(`{"name":"current"}`))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	etag := w.Header().Get("ETag")
+	if want, _ := ETagOf(&TestMsg{"current"}); etag != want {
+		t.Fatalf("ETag = %q; want %q", etag, want)
+	}
+
+	tts := []struct {
+		ifMatch string
+		code    int
+	}{
+		{etag, http.StatusOK},
+		{`"stale"`, http.StatusPreconditionFailed},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/ServerTestService.Update", strings.NewReader(`{"name":"new"}`))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		r.Header.Set("If-Match", tt.ifMatch)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: If-Match %s: w.Code = %d; want %d", i, tt.ifMatch, w.Code, tt.code)
+		}
+	}
+}
+
+func TestWeakETag(t *testing.T) {
+	tts := []struct {
+		in, want string
+	}{
+		{`"abc"`, `W/"abc"`},
+		{`W/"abc"`, `W/"abc"`},
+		{"", ""},
+	}
+	for _, tt := range tts {
+		if out := WeakETag(tt.in); out != tt.want {
+			t.Errorf("WeakETag(%q) = %q; want %q", tt.in, out, tt.want)
+		}
+	}
+	if !IsWeakETag(`W/"abc"`) || IsWeakETag(`"abc"`) {
+		t.Errorf("IsWeakETag() can't tell weak tags from strong ones")
+	}
+}
+
+// VersionedMsg is a request which knows the ETag of the resource it updates.
+type VersionedMsg struct {
+	Name string `json:"name"`
+}
+
+func (m *VersionedMsg) CurrentETag(c Context) (string, error) {
+	return `"v1"`, nil
+}
+
+type VersionedService struct{}
+
+func (s *VersionedService) Get(c Context) (*TestMsg, error) {
+	return &TestMsg{Name: "current"}, nil
+}
+
+func (s *VersionedService) Update(c Context, req *VersionedMsg) (*TestMsg, error) {
+	etag, ok := CurrentETag(c)
+	return &TestMsg{Name: fmt.Sprintf("%s %v", etag, ok)}, nil
+}
+
+func TestServerCurrentETagger(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	svc, err := server.RegisterService(&VersionedService{}, "versioned", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	svc.MethodByName("Update").Info().HTTPMethod = "PUT"
+
+	tts := []struct {
+		header, value string
+		code          int
+		out           string
+	}{
+		{"", "", http.StatusOK, `{"name":" false"}`},
+		{"If-Match", `"v1"`, http.StatusOK, `{"name":"\"v1\" true"}`},
+		{"If-Match", `W/"v1"`, http.StatusPreconditionFailed, ""},
+		{"If-Match", `"v0"`, http.StatusPreconditionFailed, ""},
+		{"If-None-Match", "*", http.StatusPreconditionFailed, ""},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/VersionedService.Update", strings.NewReader(`{"name":"new"}`))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s: w.Code = %d; want %d", i, tt.header, tt.value, w.Code, tt.code)
+		}
+		if out := strings.TrimSpace(w.Body.String()); tt.out != "" && out != tt.out {
+			t.Errorf("%d: body = %s; want %s", i, out, tt.out)
+		}
+	}
+}
+
+func TestServerWeakETags(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	server.ETags, server.WeakETags = true, true
+	svc, err := server.RegisterService(&VersionedService{}, "versioned", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	svc.MethodByName("Get").Info().HTTPMethod = "GET"
+	svc.MethodByName("Update").Info().HTTPMethod = "PUT"
+
+	for _, tt := range []struct {
+		method string
+		weak   bool
+	}{
+		{"Get", true},
+		{"Update", false},
+	} {
+		r, err := inst.NewRequest("POST", "/VersionedService."+tt.method, strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		etag := w.Header().Get("ETag")
+		if etag == "" || IsWeakETag(etag) != tt.weak {
+			t.Errorf("%s: ETag = %q; want weak = %v", tt.method, etag, tt.weak)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// updateMaskParam is the name of the request parameter with a field mask
+// of PATCH methods.
+const updateMaskParam = "updateMask"
+
+// FieldMask is a list of field paths, as they appear in JSON, with nested
+// fields separated by dots, e.g. "name" or "address.city".
+type FieldMask []string
+
+// Has returns true if m includes path, either directly or through one of
+// its parents, e.g. "address" includes "address.city".
+func (m FieldMask) Has(path string) bool {
+	for _, p := range m {
+		if p == path || strings.HasPrefix(path, p+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// updateMaskKey is the context key of FieldMask of a request.
+type updateMaskKey struct{}
+
+// UpdateMask returns the field mask of the request of PATCH method c is
+// of. It tells fields the client intends to change, including those set
+// to zero values, so the method can merge them into a stored value.
+//
+// The mask is taken from "updateMask" parameter with comma separated
+// paths. Without the parameter, it lists all fields present in the request
+// body. UpdateMask returns nil outside of PATCH methods.
+func UpdateMask(c Context) FieldMask {
+	m, _ := c.Value(updateMaskKey{}).(FieldMask)
+	return m
+}
+
+// nullFieldsKey is the context key of FieldMask of null fields of a request.
+type nullFieldsKey struct{}
+
+// NullFields returns paths of fields explicitly set to null in the request
+// body of PATCH method c is of, e.g. to clear them, as opposed to fields
+// which are omitted and must be left as they are. Both kinds of fields
+// are decoded as nil pointers. NullFields returns nil outside of PATCH
+// methods.
+//
+// In responses, nil pointer fields are encoded as null unless their json
+// tag has "omitempty" option, in which case they are omitted.
+func NullFields(c Context) FieldMask {
+	m, _ := c.Value(nullFieldsKey{}).(FieldMask)
+	return m
+}
+
+// withNullFields returns a copy of c with null fields m.
+func withNullFields(c Context, m FieldMask) Context {
+	return deriveContext(c, context.WithValue(c, nullFieldsKey{}, m))
+}
+
+// withUpdateMask returns a copy of c with field mask m.
+func withUpdateMask(c Context, m FieldMask) Context {
+	return deriveContext(c, context.WithValue(c, updateMaskKey{}, m))
+}
+
+// parseUpdateMask returns the field mask of a request of type t with JSON
+// body, from updateMask parameter in either query q or body, or from the
+// fields present in body if there's no parameter. It returns 400 APIError
+// if the parameter names a field t doesn't have.
+func parseUpdateMask(t reflect.Type, q map[string][]string, body []byte) (FieldMask, error) {
+	var fields map[string]interface{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, NewBadRequestError("Request body is not a JSON object: %v", err)
+		}
+	}
+
+	param := ""
+	if v := q[updateMaskParam]; len(v) > 0 {
+		param = v[0]
+	} else if v, ok := fields[updateMaskParam].(string); ok {
+		param = v
+	}
+	delete(fields, updateMaskParam)
+	if param == "" {
+		mask := FieldMask{}
+		collectPaths(&mask, "", t, fields)
+		sort.Strings(mask)
+		return mask, nil
+	}
+
+	var known map[string]*reflect.StructField
+	if t.Kind() == reflect.Struct {
+		known = fieldNames(t, true)
+	}
+	mask := FieldMask{}
+	for _, path := range strings.Split(param, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if !hasFieldPath(known, path) {
+			return nil, NewBadRequestError("Unknown field %q in %s", path, updateMaskParam)
+		}
+		mask = append(mask, path)
+	}
+	return mask, nil
+}
+
+// collectPaths appends to mask paths of fields present in JSON object
+// fields of struct type t, prefixed with prefix. Nested structs are
+// descended into, while other values, e.g. arrays and maps, are leaves.
+func collectPaths(mask *FieldMask, prefix string, t reflect.Type, fields map[string]interface{}) {
+	var known map[string]*reflect.StructField
+	if t.Kind() == reflect.Struct {
+		known = fieldNames(t, false)
+	}
+	for name, v := range fields {
+		path := prefix + name
+		nested, ok := v.(map[string]interface{})
+		if f := known[name]; ok && len(nested) > 0 && f != nil &&
+			indirectKind(f.Type) == reflect.Struct && !implements(f.Type, typeOfJSONMarshaler) {
+			collectPaths(mask, path+".", indirectType(f.Type), nested)
+			continue
+		}
+		*mask = append(*mask, path)
+	}
+}
+
+// parseNullFields returns paths of fields of JSON object body of a request
+// of type t which are null.
+func parseNullFields(t reflect.Type, body []byte) (FieldMask, error) {
+	var fields map[string]interface{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, NewBadRequestError("Request body is not a JSON object: %v", err)
+		}
+	}
+	nulls := FieldMask{}
+	collectNulls(&nulls, "", t, fields)
+	sort.Strings(nulls)
+	return nulls, nil
+}
+
+// collectNulls is the same as collectPaths but only appends paths of null
+// values.
+func collectNulls(mask *FieldMask, prefix string, t reflect.Type, fields map[string]interface{}) {
+	var known map[string]*reflect.StructField
+	if t.Kind() == reflect.Struct {
+		known = fieldNames(t, false)
+	}
+	for name, v := range fields {
+		path := prefix + name
+		if v == nil {
+			*mask = append(*mask, path)
+			continue
+		}
+		nested, ok := v.(map[string]interface{})
+		if f := known[name]; ok && f != nil &&
+			indirectKind(f.Type) == reflect.Struct && !implements(f.Type, typeOfJSONMarshaler) {
+			collectNulls(mask, path+".", indirectType(f.Type), nested)
+		}
+	}
+}
+
+// hasFieldPath returns true if path is one of the flattened field names
+// known, or a parent of one.
+func hasFieldPath(known map[string]*reflect.StructField, path string) bool {
+	if _, ok := known[path]; ok {
+		return true
+	}
+	for name := range known {
+		if strings.HasPrefix(name, path+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,200 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+type MaskAddress struct {
+	City   string `json:"city"`
+	Street string `json:"street"`
+}
+
+type MaskMsg struct {
+	Name    string            `json:"name"`
+	Age     int               `json:"age"`
+	Address *MaskAddress      `json:"address"`
+	Labels  map[string]string `json:"labels"`
+}
+
+type MaskService struct{}
+
+func (s *MaskService) Update(c Context, req *MaskMsg) (*TestMsg, error) {
+	return &TestMsg{Name: strings.Join(UpdateMask(c), ",")}, nil
+}
+
+func (s *MaskService) Clear(c Context, req *MaskMsg) (*TestMsg, error) {
+	return &TestMsg{Name: strings.Join(NullFields(c), ",")}, nil
+}
+
+func TestFieldMaskHas(t *testing.T) {
+	m := FieldMask{"name", "address"}
+	tts := []struct {
+		path string
+		want bool
+	}{
+		{"name", true},
+		{"address", true},
+		{"address.city", true},
+		{"age", false},
+		{"names", false},
+		{"addressee", false},
+	}
+	for _, tt := range tts {
+		if out := m.Has(tt.path); out != tt.want {
+			t.Errorf("%v.Has(%q) = %v; want %v", m, tt.path, out, tt.want)
+		}
+	}
+}
+
+func TestParseUpdateMask(t *testing.T) {
+	typ := reflect.TypeOf(MaskMsg{})
+	tts := []struct {
+		query, body string
+		want        FieldMask
+		ok          bool
+	}{
+		{"", `{"name": "", "age": 0}`, FieldMask{"age", "name"}, true},
+		{"", `{"address": {"city": "Paris"}, "labels": {"a": "b"}}`, FieldMask{"address.city", "labels"}, true},
+		{"", `{"address": {}}`, FieldMask{"address"}, true},
+		{"", ``, FieldMask{}, true},
+		{"", `{"unknown": 1}`, FieldMask{"unknown"}, true},
+		{"updateMask=name,address.city", `{"name": "x", "age": 1}`, FieldMask{"name", "address.city"}, true},
+		{"updateMask=address", `{}`, FieldMask{"address"}, true},
+		{"", `{"updateMask": "age", "name": "x"}`, FieldMask{"age"}, true},
+		{"updateMask=nick", `{}`, nil, false},
+		{"updateMask=address.zip", `{}`, nil, false},
+		{"", `[1, 2]`, nil, false},
+	}
+	for i, tt := range tts {
+		q, _ := url.ParseQuery(tt.query)
+		mask, err := parseUpdateMask(typ, q, []byte(tt.body))
+		switch {
+		case tt.ok && (err != nil || !reflect.DeepEqual(mask, tt.want)):
+			t.Errorf("%d: parseUpdateMask(%q, %q) = %v, %v; want %v", i, tt.query, tt.body, mask, err, tt.want)
+		case !tt.ok:
+			if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusBadRequest {
+				t.Errorf("%d: parseUpdateMask(%q, %q) = %v, %v; want 400 APIError", i, tt.query, tt.body, mask, err)
+			}
+		}
+	}
+}
+
+func TestServerUpdateMask(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	svc, err := server.RegisterService(&MaskService{}, "mask", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := svc.MethodByName("Update").Info()
+
+	tts := []struct {
+		httpMethod, query, body string
+		code                    int
+		want                    string
+	}{
+		{"PATCH", "", `{"name": "", "address": {"city": "Paris"}}`, http.StatusOK, "address.city,name"},
+		{"PATCH", "?updateMask=age", `{"name": "x"}`, http.StatusOK, "age"},
+		{"PATCH", "?updateMask=nick", `{}`, http.StatusBadRequest, ""},
+		{"PUT", "", `{"name": "x"}`, http.StatusOK, ""},
+	}
+	for i, tt := range tts {
+		info.HTTPMethod = tt.httpMethod
+		r, err := inst.NewRequest("POST", "/MaskService.Update"+tt.query, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+			continue
+		}
+		if tt.code != http.StatusOK {
+			continue
+		}
+		var resp TestMsg
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%d: json.Unmarshal(%q) = %v", i, w.Body, err)
+		}
+		if resp.Name != tt.want {
+			t.Errorf("%d: UpdateMask() = %q; want %q", i, resp.Name, tt.want)
+		}
+	}
+}
+
+func TestParseNullFields(t *testing.T) {
+	typ := reflect.TypeOf(MaskMsg{})
+	tts := []struct {
+		body string
+		want FieldMask
+	}{
+		{`{"name": "x"}`, FieldMask{}},
+		{`{"address": null, "age": null}`, FieldMask{"address", "age"}},
+		{`{"address": {"city": null, "street": "x"}}`, FieldMask{"address.city"}},
+		{`{"labels": {"a": null}}`, FieldMask{}},
+		{``, FieldMask{}},
+	}
+	for i, tt := range tts {
+		nulls, err := parseNullFields(typ, []byte(tt.body))
+		if err != nil || !reflect.DeepEqual(nulls, tt.want) {
+			t.Errorf("%d: parseNullFields(%q) = %v, %v; want %v", i, tt.body, nulls, err, tt.want)
+		}
+	}
+}
+
+func TestServerNullFields(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	svc, err := server.RegisterService(&MaskService{}, "mask", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := svc.MethodByName("Clear").Info()
+
+	tts := []struct {
+		httpMethod, body, want string
+	}{
+		{"PATCH", `{"name": "x", "address": null}`, "address"},
+		{"PATCH", `{"address": {"street": null}}`, "address.street"},
+		{"PUT", `{"address": null}`, ""},
+	}
+	for i, tt := range tts {
+		info.HTTPMethod = tt.httpMethod
+		r, err := inst.NewRequest("POST", "/MaskService.Clear", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Errorf("%d: w.Code = %d; want 200", i, w.Code)
+			continue
+		}
+		var resp TestMsg
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("%d: json.Unmarshal(%q) = %v", i, w.Body, err)
+		}
+		if resp.Name != tt.want {
+			t.Errorf("%d: NullFields() = %q; want %q", i, resp.Name, tt.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// Formats of string fields, see "format" field tag.
+const (
+	// FormatEmail is an email address without a display name, e.g.
+	// "dude@example.com".
+	FormatEmail = "email"
+	// FormatURI is an absolute URL, e.g. "https://example.com/a".
+	FormatURI = "uri"
+)
+
+// checkFormatName returns an error if f is not a known string format.
+func checkFormatName(f string) error {
+	switch f {
+	case FormatEmail, FormatURI:
+		return nil
+	}
+	return fmt.Errorf("Invalid format %q", f)
+}
+
+// checkFormat returns 400 APIError naming the field if string value v,
+// or a string v points to, is not in format f. Nil pointers and empty
+// strings aren't checked, leaving it to "req". The error doesn't include
+// the value if secret is true.
+func checkFormat(name string, v reflect.Value, f string, secret bool) error {
+	v = reflect.Indirect(v)
+	if !v.IsValid() || v.Kind() != reflect.String || v.Len() == 0 {
+		return nil
+	}
+	s := v.String()
+	var ok bool
+	switch f {
+	case FormatEmail:
+		ok = isEmail(s)
+	case FormatURI:
+		ok = isAbsoluteURL(s)
+	default:
+		return checkFormatName(f)
+	}
+	if !ok && secret {
+		return NewBadRequestError("Value of field %q is not a valid %s", name, f)
+	}
+	if !ok {
+		return NewBadRequestError("Value %q of field %q is not a valid %s", s, name, f)
+	}
+	return nil
+}
+
+// isEmail returns true if s is a bare email address, as in RFC 5322,
+// with a domain name of at least two labels.
+func isEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" || addr.Address != s {
+		return false
+	}
+	i := strings.LastIndex(s, "@")
+	return isDomainName(s[i+1:])
+}
+
+// isDomainName returns true if s is a fully qualified domain name, such as
+// "example.com", with labels of letters, digits and hyphens.
+func isDomainName(s string) bool {
+	labels := strings.Split(s, ".")
+	if len(s) > 253 || len(labels) < 2 {
+		return false
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return false
+		}
+		for _, r := range l {
+			if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isAbsoluteURL returns true if s is a URL with a scheme and a host.
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.IsAbs() && u.Host != ""
+}
@@ -0,0 +1,71 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RequiredHeader is a request header which a method requires, see
+// MethodInfo.RequiredHeaders.
+type RequiredHeader struct {
+	// Name is the header name, e.g. "X-Api-Client-Version".
+	Name string
+	// Pattern, if set, is a regular expression the value must match.
+	Pattern string
+	// Values, if set, are the allowed values.
+	Values []string
+}
+
+// checkRequiredHeaders returns 400 APIError naming the header if request r
+// lacks a header required by method m, or has a value which isn't allowed.
+func checkRequiredHeaders(r *http.Request, m *ServiceMethod) error {
+	if m.info == nil {
+		return nil
+	}
+	for _, h := range m.info.RequiredHeaders {
+		v := r.Header.Get(h.Name)
+		if v == "" {
+			return NewBadRequestError("Missing required header %s", h.Name)
+		}
+		if len(h.Values) > 0 && !contains(h.Values, v) {
+			return NewBadRequestError("Value %q of header %s is not one of %s",
+				v, h.Name, strings.Join(h.Values, ", "))
+		}
+		if h.Pattern == "" {
+			continue
+		}
+		re, err := compilePattern(h.Pattern)
+		if err != nil {
+			return err
+		}
+		if !re.MatchString(v) {
+			return NewBadRequestError("Value of header %s doesn't match pattern %q",
+				h.Name, h.Pattern)
+		}
+	}
+	return nil
+}
+
+// checkHeaderPatterns returns an error identifying the method and the
+// header if a pattern of a required header of a method of services is not
+// a valid regular expression.
+func checkHeaderPatterns(services []*RPCService) error {
+	for _, s := range services {
+		methods := s.Methods()
+		sort.Sort(byMethodName(methods))
+		for _, m := range methods {
+			for _, h := range m.Info().RequiredHeaders {
+				if h.Pattern == "" {
+					continue
+				}
+				if _, err := compilePattern(h.Pattern); err != nil {
+					return fmt.Errorf("%s.%s: invalid pattern of header %s: %v",
+						s.Name(), m.method.Name, h.Name, err)
+				}
+			}
+		}
+	}
+	return nil
+}
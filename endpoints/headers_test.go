@@ -0,0 +1,69 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+func TestServerRequiredHeaders(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	svc, err := server.RegisterService(&PolicyService{}, "policy", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := svc.MethodByName("Ping").Info()
+
+	tts := []struct {
+		required []RequiredHeader
+		headers  map[string]string
+		code     int
+		msg      string
+	}{
+		{nil, nil, http.StatusNoContent, ""},
+		{[]RequiredHeader{{Name: "X-Api-Client-Version"}}, nil,
+			http.StatusBadRequest, "Missing required header X-Api-Client-Version"},
+		{[]RequiredHeader{{Name: "X-Api-Client-Version"}}, map[string]string{"X-Api-Client-Version": "1.2"},
+			http.StatusNoContent, ""},
+		{[]RequiredHeader{{Name: "X-Api-Client-Version", Pattern: `^[2-9]\.\d+$`}}, map[string]string{"X-Api-Client-Version": "1.2"},
+			http.StatusBadRequest, "X-Api-Client-Version"},
+		{[]RequiredHeader{{Name: "X-Api-Client-Version", Pattern: `^[2-9]\.\d+$`}}, map[string]string{"X-Api-Client-Version": "2.0"},
+			http.StatusNoContent, ""},
+		{[]RequiredHeader{{Name: "X-Platform", Values: []string{"android", "ios"}}}, map[string]string{"X-Platform": "web"},
+			http.StatusBadRequest, "X-Platform"},
+		{[]RequiredHeader{{Name: "X-Platform", Values: []string{"android", "ios"}}}, map[string]string{"X-Platform": "ios"},
+			http.StatusNoContent, ""},
+	}
+	for i, tt := range tts {
+		info.RequiredHeaders = tt.required
+		r, err := inst.NewRequest("POST", "/PolicyService.Ping", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		for k, v := range tt.headers {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+		}
+		if tt.msg != "" && !strings.Contains(w.Body.String(), tt.msg) {
+			t.Errorf("%d: response = %s; want it to mention %q", i, w.Body, tt.msg)
+		}
+	}
+
+	info.RequiredHeaders = []RequiredHeader{{Name: "X-Api-Client-Version", Pattern: "["}}
+	if err := server.Validate(); err == nil || !strings.Contains(err.Error(), "PolicyService.Ping") {
+		t.Errorf("Validate() = %v; want invalid header pattern error", err)
+	}
+}
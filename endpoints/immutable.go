@@ -0,0 +1,115 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+)
+
+// immutableReason is the Reason of errors returned when a request changes
+// an immutable field.
+const immutableReason = "immutableField"
+
+// CurrentValuer is implemented by update requests with fields tagged as
+// "immutable". CurrentValue returns the stored value the request updates,
+// of the same type as the request, or nil if there's none yet.
+//
+// If a request implements CurrentValuer, the server rejects it with 400
+// Bad Request when it attempts to change an immutable field, before it is
+// validated by Validator and passed to a service method.
+type CurrentValuer interface {
+	CurrentValue(c Context) (interface{}, error)
+}
+
+// ImmutableFields returns names, as they appear in JSON, of the fields of
+// struct v, or of the struct v points to, tagged as "immutable".
+// Fields of anonymous (embedded) structs are included.
+func ImmutableFields(v interface{}) []string {
+	var names []string
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	forEachImmutable(reflect.Zero(t), reflect.Zero(t), func(name string, _, _ reflect.Value) {
+		names = append(names, name)
+	})
+	sort.Strings(names)
+	return names
+}
+
+// CheckImmutable returns 400 APIError naming the field if update changes
+// an immutable field of current. Both must be of the same struct type, or
+// pointers to it. Fields which are zero in either current or update are
+// not considered changed: the value is not set yet, or not updated.
+func CheckImmutable(current, update interface{}) error {
+	cv := reflect.Indirect(reflect.ValueOf(current))
+	uv := reflect.Indirect(reflect.ValueOf(update))
+	if !cv.IsValid() || !uv.IsValid() {
+		return nil
+	}
+	if cv.Type() != uv.Type() || cv.Kind() != reflect.Struct {
+		return fmt.Errorf("CheckImmutable: %v and %v are not the same struct type",
+			cv.Type(), uv.Type())
+	}
+	var changed []string
+	forEachImmutable(cv, uv, func(name string, c, u reflect.Value) {
+		if !c.IsZero() && !u.IsZero() && !reflect.DeepEqual(c.Interface(), u.Interface()) {
+			changed = append(changed, name)
+		}
+	})
+	if len(changed) == 0 {
+		return nil
+	}
+	sort.Strings(changed)
+	return &APIError{
+		Name:   http.StatusText(http.StatusBadRequest),
+		Msg:    fmt.Sprintf("Field %q can't be changed", changed[0]),
+		Code:   http.StatusBadRequest,
+		Reason: immutableReason,
+	}
+}
+
+// forEachImmutable calls fn with JSON name and values in both structs c
+// and u of each field tagged as "immutable".
+func forEachImmutable(c, u reflect.Value, fn func(name string, c, u reflect.Value)) {
+	t := c.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			forEachImmutable(c.Field(i), u.Field(i), fn)
+			continue
+		}
+		tag, err := parseTag(field.Tag)
+		if err != nil || !tag.immutable {
+			continue
+		}
+		if name := jsonFieldName(&field); name != "-" {
+			fn(name, c.Field(i), u.Field(i))
+		}
+	}
+}
+
+// checkCurrentValue calls CheckImmutable with the current value of request
+// v, if v implements CurrentValuer.
+func checkCurrentValue(c Context, v reflect.Value) error {
+	valuer, ok := v.Interface().(CurrentValuer)
+	if !ok || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return nil
+	}
+	current, err := valuer.CurrentValue(c)
+	if err != nil || current == nil {
+		return err
+	}
+	return CheckImmutable(current, v.Interface())
+}
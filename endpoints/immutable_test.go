@@ -0,0 +1,107 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type OwnedMsg struct {
+	Owner string `json:"owner" endpoints:"immutable"`
+}
+
+type AccountMsg struct {
+	OwnedMsg
+	ID    int64  `json:"id,string" endpoints:"req,immutable"`
+	Name  string `json:"name"`
+	Email string `json:"-" endpoints:"immutable"`
+
+	// current is returned by CurrentValue.
+	current *AccountMsg
+	err     error
+}
+
+func (m *AccountMsg) CurrentValue(c Context) (interface{}, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.current == nil {
+		return nil, nil
+	}
+	return m.current, nil
+}
+
+func TestImmutableFields(t *testing.T) {
+	want := []string{"id", "owner"}
+	for _, v := range []interface{}{AccountMsg{}, &AccountMsg{}} {
+		if out := ImmutableFields(v); !reflect.DeepEqual(out, want) {
+			t.Errorf("ImmutableFields(%T) = %v; want %v", v, out, want)
+		}
+	}
+	if out := ImmutableFields(&QueryMsg{}); out != nil {
+		t.Errorf("ImmutableFields(QueryMsg) = %v; want nil", out)
+	}
+}
+
+func TestCheckImmutable(t *testing.T) {
+	current := &AccountMsg{OwnedMsg{"alice"}, 1, "Alice", "", nil, nil}
+	tts := []struct {
+		update *AccountMsg
+		field  string
+	}{
+		{&AccountMsg{ID: 1, Name: "Bob"}, ""},
+		{&AccountMsg{OwnedMsg: OwnedMsg{"alice"}, ID: 1}, ""},
+		{&AccountMsg{Email: "bob@example.com"}, ""},
+		{&AccountMsg{ID: 2}, "id"},
+		{&AccountMsg{OwnedMsg: OwnedMsg{"bob"}}, "owner"},
+	}
+	for i, tt := range tts {
+		err := CheckImmutable(current, tt.update)
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%d: CheckImmutable() = %v; want nil", i, err)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest || apiErr.Reason != immutableReason {
+			t.Errorf("%d: CheckImmutable() = %v; want 400 APIError", i, err)
+			continue
+		}
+		if want := `Field "` + tt.field + `" can't be changed`; apiErr.Msg != want {
+			t.Errorf("%d: CheckImmutable() msg = %q; want %q", i, apiErr.Msg, want)
+		}
+	}
+
+	if err := CheckImmutable(current, &QueryMsg{}); err == nil {
+		t.Errorf("CheckImmutable(different types) = nil; want error")
+	}
+}
+
+func TestValidateRequestImmutable(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	loadErr := errors.New("datastore unavailable")
+	current := &AccountMsg{ID: 1}
+	tts := []struct {
+		in   *AccountMsg
+		want error
+	}{
+		{&AccountMsg{ID: 2}, nil},
+		{&AccountMsg{ID: 1, current: current}, nil},
+		{&AccountMsg{ID: 2, err: loadErr}, loadErr},
+	}
+	for i, tt := range tts {
+		if err := validateRequest(c, reflect.ValueOf(tt.in)); err != tt.want {
+			t.Errorf("%d: validateRequest() = %v; want %v", i, err, tt.want)
+		}
+	}
+
+	err := validateRequest(c, reflect.ValueOf(&AccountMsg{ID: 2, current: current}))
+	if apiErr, ok := err.(*APIError); !ok || apiErr.Reason != immutableReason {
+		t.Errorf("validateRequest() = %v; want immutable field error", err)
+	}
+}
@@ -0,0 +1,120 @@
+package endpoints
+
+import (
+	"google.golang.org/appengine/log"
+	"google.golang.org/appengine/user"
+)
+
+// impersonation is a user impersonated by an operator, see
+// Server.ImpersonationHeader.
+type impersonation struct {
+	operator *user.User
+	email    string
+}
+
+// user returns the impersonated user.
+func (imp *impersonation) user() *user.User {
+	return &user.User{Email: imp.email}
+}
+
+// impersonationKey is a context key of the *impersonation of a request.
+type impersonationKey struct{}
+
+// impersonationOf returns the impersonation of request context c, if any.
+func impersonationOf(c Context) *impersonation {
+	imp, _ := c.Value(impersonationKey{}).(*impersonation)
+	return imp
+}
+
+// Operator returns the user who made the request of c on behalf of the
+// current user, or nil if the request isn't impersonated.
+// See Server.ImpersonationHeader.
+func Operator(c Context) *user.User {
+	imp := impersonationOf(c)
+	if imp == nil {
+		return nil
+	}
+	op := *imp.operator
+	return &op
+}
+
+// impersonate checks whether the request of c, to method m called name,
+// asks to act as another user, and returns a Context which does if the
+// caller is allowed to.
+//
+// The caller is authenticated against the method's allowlist and must be
+// one of s.Impersonators. Others get 403 APIError, or 401 if they fail
+// authentication.
+func (s *Server) impersonate(c Context, name string, m *ServiceMethod) (Context, error) {
+	if s.ImpersonationHeader == "" {
+		return c, nil
+	}
+	email := c.HTTPRequest().Header.Get(s.ImpersonationHeader)
+	if email == "" {
+		return c, nil
+	}
+	al, err := s.allowlist(c, name, m)
+	if err != nil {
+		return nil, err
+	}
+	op, err := CurrentUser(c, al.Scopes, al.Audiences, al.ClientIds)
+	if err != nil {
+		if _, ok := err.(*APIError); ok {
+			return nil, err
+		}
+		return nil, newAuthError("Impersonation requires authentication", err)
+	}
+	if op.Email == "" || !contains(s.Impersonators, op.Email) {
+		log.Warningf(c, "%s is not allowed to impersonate %s", op.Email, email)
+		return nil, NewForbiddenError("Impersonation is not allowed")
+	}
+	log.Infof(c, "%s impersonates %s in %s", op.Email, email, name)
+	ic := &impersonatedContext{c, &impersonation{op, email}}
+	replaceContext(c, ic)
+	return ic, nil
+}
+
+// impersonatedContext is a Context of a request made by an operator on
+// behalf of another user.
+type impersonatedContext struct {
+	Context
+	imp *impersonation
+}
+
+// Value is a part of context.Context interface.
+func (c *impersonatedContext) Value(key interface{}) interface{} {
+	if key == (impersonationKey{}) {
+		return c.imp
+	}
+	return c.Context.Value(key)
+}
+
+// CurrentOAuthUser returns the impersonated user if the operator's token
+// is valid for the given scope.
+func (c *impersonatedContext) CurrentOAuthUser(scope string) (*user.User, error) {
+	if _, err := c.Context.CurrentOAuthUser(scope); err != nil {
+		return nil, err
+	}
+	return c.imp.user(), nil
+}
+
+// Namespace returns a replacement context that operates within the given namespace.
+func (c *impersonatedContext) Namespace(name string) (Context, error) {
+	return validatedNamespace(c, name)
+}
+
+// namespace is Namespace without NamespaceValidator.
+func (c *impersonatedContext) namespace(name string) (Context, error) {
+	nc, err := uncheckedNamespace(c.Context, name)
+	if err != nil {
+		return nil, err
+	}
+	return &impersonatedContext{nc, c.imp}, nil
+}
+
+func (c *impersonatedContext) validatedToken() *tokenState {
+	if h, ok := c.Context.(tokenHolder); ok {
+		return h.validatedToken()
+	}
+	return nil
+}
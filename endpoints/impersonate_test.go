@@ -0,0 +1,103 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+type SupportService struct{}
+
+func (s *SupportService) Whoami(c Context) (*TestMsg, error) {
+	u, err := CurrentMethodUser(c)
+	if err != nil {
+		return nil, err
+	}
+	name := u.Email
+	if op := Operator(c); op != nil {
+		name += " by " + op.Email
+	}
+	return &TestMsg{Name: name}, nil
+}
+
+func TestServerImpersonation(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	origParser, origCurrentUTC := jwtParser, currentUTC
+	defer func() {
+		jwtParser, currentUTC = origParser, origCurrentUTC
+	}()
+	jwtParser = func(Context, string, int64) (*signedJWT, error) {
+		token := jwtValidTokenObject
+		return &token, nil
+	}
+	currentUTC = func() time.Time { return jwtValidTokenTime }
+
+	logger := &recordingAccessLogger{}
+	server := NewServer("")
+	server.AccessLogger = logger
+	svc, err := server.RegisterService(&SupportService{}, "support", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := svc.MethodByName("Whoami").Info()
+	info.Scopes = []string{EmailScope}
+	info.Audiences = []string{"my-client-id"}
+	info.ClientIds = []string{"hello-android"}
+
+	tts := []struct {
+		header        string
+		impersonators []string
+		impersonate   string
+		token         bool
+		code          int
+		out           string
+		operator      string
+	}{
+		{"X-Impersonate", []string{"dude@gmail.com"}, "", true, http.StatusOK, `{"name":"dude@gmail.com"}`, ""},
+		{"X-Impersonate", []string{"dude@gmail.com"}, "customer@example.org", true, http.StatusOK,
+			`{"name":"customer@example.org by dude@gmail.com"}`, "dude@gmail.com"},
+		{"X-Impersonate", []string{"admin@example.org"}, "customer@example.org", true, http.StatusForbidden, "", ""},
+		{"X-Impersonate", nil, "customer@example.org", true, http.StatusForbidden, "", ""},
+		{"X-Impersonate", []string{"dude@gmail.com"}, "customer@example.org", false, http.StatusUnauthorized, "", ""},
+		{"", []string{"dude@gmail.com"}, "customer@example.org", true, http.StatusOK, `{"name":"dude@gmail.com"}`, ""},
+	}
+	for i, tt := range tts {
+		server.ImpersonationHeader, server.Impersonators = tt.header, tt.impersonators
+		r, err := inst.NewRequest("POST", "/SupportService.Whoami", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.token {
+			r.Header.Set("Authorization", "Bearer "+jwtValidTokenString)
+		}
+		if tt.impersonate != "" {
+			r.Header.Set("X-Impersonate", tt.impersonate)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+			continue
+		}
+		if out := strings.TrimSpace(w.Body.String()); tt.out != "" && out != tt.out {
+			t.Errorf("%d: response = %s; want %s", i, out, tt.out)
+		}
+		e := logger.entries[len(logger.entries)-1]
+		if e.Operator != tt.operator {
+			t.Errorf("%d: access log Operator = %q; want %q", i, e.Operator, tt.operator)
+		}
+		if tt.operator != "" && e.ImpersonatedUser != tt.impersonate {
+			t.Errorf("%d: access log ImpersonatedUser = %q; want %q", i, e.ImpersonatedUser, tt.impersonate)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package endpoints
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+)
+
+// JSONLines is a request type of methods which receive large batches as
+// newline-delimited JSON, one value per line. Instead of decoding the whole
+// body up front, the method decodes values one at a time with Next:
+//
+//	func (s *ItemService) Import(c endpoints.Context, lines *endpoints.JSONLines) (*ImportResult, error) {
+//		for {
+//			item := &Item{}
+//			if err := lines.Next(item); err == io.EOF {
+//				break
+//			} else if err != nil {
+//				return nil, err
+//			}
+//			// store item
+//		}
+//		...
+//	}
+//
+// Requests may have Content-Type of application/x-ndjson,
+// application/jsonl or application/json. Server.MaxBodyBytes and
+// MethodInfo.MaxBodyBytes still limit the size of the whole body, and
+// each line is limited to maxJSONLineBytes regardless of them.
+type JSONLines struct {
+	c         Context
+	r         *bufio.Reader
+	maxLine   int
+	useNumber bool
+	line      int
+	err       error
+}
+
+// maxJSONLineBytes limits the length of a single line of JSONLines, so that
+// a body without newlines isn't buffered whole.
+const maxJSONLineBytes = 1 << 20
+
+var typeOfJSONLines = reflect.TypeOf(JSONLines{})
+
+// newJSONLines returns JSONLines reading body of a request of c, which may
+// be up to max bytes long if max is positive. If useNumber is true, numbers
+// are decoded into interface{} values as json.Number.
+func newJSONLines(c Context, body io.Reader, max int64, useNumber bool) *JSONLines {
+	if max > 0 {
+		body = &maxBytesReader{r: body, n: max}
+	}
+	return &JSONLines{c: c, r: bufio.NewReader(body), maxLine: maxJSONLineBytes, useNumber: useNumber}
+}
+
+// Next decodes the next line into v, a pointer to an element, and validates
+// it the same way requests are validated. Blank lines are skipped.
+//
+// It returns io.EOF after the last line. A malformed or invalid line
+// results in 400 APIError naming the line, and a line longer than
+// maxJSONLineBytes in 413 APIError. Errors are returned from then on.
+func (l *JSONLines) Next(v interface{}) error {
+	if l.err != nil {
+		return l.err
+	}
+	for {
+		b, err := l.readLine()
+		if err != nil && err != io.EOF {
+			l.err = err
+			return err
+		}
+		b = bytes.TrimSpace(b)
+		if len(b) == 0 {
+			if err == io.EOF {
+				l.err = io.EOF
+				return io.EOF
+			}
+			l.line++
+			continue
+		}
+		l.line++
+		l.err = l.decode(b, reflect.ValueOf(v))
+		return l.err
+	}
+}
+
+// readLine reads the next line, including the newline, failing with 413
+// APIError if it's longer than l.maxLine.
+func (l *JSONLines) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		b, err := l.r.ReadSlice('\n')
+		if len(line)+len(b) > l.maxLine {
+			return nil, errorf(http.StatusRequestEntityTooLarge,
+				"Line %d exceeds %d bytes", l.line+1, l.maxLine)
+		}
+		line = append(line, b...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+// Line returns the number of lines read so far.
+func (l *JSONLines) Line() int {
+	return l.line
+}
+
+// decode decodes and validates the current line b into v.
+func (l *JSONLines) decode(b []byte, v reflect.Value) error {
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("JSONLines.Next: non-nil pointer expected, got %v", v.Type())
+	}
+	if err := decodeJSON(b, v, l.useNumber); err != nil {
+		return NewBadRequestError("Line %d: %v", l.line, err)
+	}
+	if err := validateRequest(l.c, v); err != nil {
+		if apiErr, ok := err.(*APIError); ok {
+			prefixed := *apiErr
+			prefixed.Msg = fmt.Sprintf("Line %d: %s", l.line, apiErr.Msg)
+			return &prefixed
+		}
+		return NewBadRequestError("Line %d: %v", l.line, err)
+	}
+	return nil
+}
+
+// checkJSONLinesType returns 415 APIError if request r has a Content-Type
+// other than newline-delimited JSON or JSON.
+func checkJSONLinesType(r *http.Request) error {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return nil
+	}
+	switch mt, _, _ := mime.ParseMediaType(ct); mt {
+	case "application/x-ndjson", "application/jsonl", "application/json":
+		return nil
+	}
+	return errorf(http.StatusUnsupportedMediaType,
+		"Unsupported Content-Type %q, expected application/x-ndjson", ct)
+}
+
+// maxBytesReader reads up to n bytes from r and fails with 413 APIError
+// if there are more.
+type maxBytesReader struct {
+	r io.Reader
+	n int64
+}
+
+func (m *maxBytesReader) Read(p []byte) (int, error) {
+	if m.n < 0 {
+		return 0, errorf(http.StatusRequestEntityTooLarge, "Request body is too large")
+	}
+	if int64(len(p)) > m.n+1 {
+		p = p[:m.n+1]
+	}
+	n, err := m.r.Read(p)
+	m.n -= int64(n)
+	if m.n < 0 {
+		return 0, errorf(http.StatusRequestEntityTooLarge, "Request body is too large")
+	}
+	return n, err
+}
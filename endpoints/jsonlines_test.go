@@ -0,0 +1,151 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+type ImportService struct{}
+
+func (s *ImportService) Import(c Context, lines *JSONLines) (*TestMsg, error) {
+	var names []string
+	for {
+		item := &BulkItem{}
+		if err := lines.Next(item); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		names = append(names, item.Name)
+	}
+	return &TestMsg{Name: fmt.Sprintf("%d: %s", len(names), strings.Join(names, ","))}, nil
+}
+
+func TestJSONLinesNext(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	tts := []struct {
+		body  string
+		names []string
+		err   string
+	}{
+		{"", nil, ""},
+		{`{"name":"a"}`, []string{"a"}, ""},
+		{"{\"name\":\"a\"}\n{\"name\":\"b\"}\n", []string{"a", "b"}, ""},
+		{"\n{\"name\":\"a\"}\r\n\n  {\"name\":\"b\"}", []string{"a", "b"}, ""},
+		{"{\"name\":\"a\"}\n{\"name\":\n{\"name\":\"c\"}", []string{"a"}, "Line 2: "},
+		{"{\"name\":\"a\"}\n\n{\"name\":\"B\"}", []string{"a"}, "Line 3: "},
+	}
+	for i, tt := range tts {
+		lines := newJSONLines(c, strings.NewReader(tt.body), 0, false)
+		var names []string
+		var err error
+		for {
+			item := &BulkItem{}
+			if err = lines.Next(item); err != nil {
+				break
+			}
+			names = append(names, item.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.names, ",") {
+			t.Errorf("%d: decoded %v; want %v", i, names, tt.names)
+		}
+		switch {
+		case tt.err == "" && err != io.EOF:
+			t.Errorf("%d: Next() = %v; want io.EOF", i, err)
+		case tt.err != "":
+			apiErr, ok := err.(*APIError)
+			if !ok || apiErr.Code != http.StatusBadRequest || !strings.HasPrefix(apiErr.Msg, tt.err) {
+				t.Errorf("%d: Next() = %v; want 400 APIError starting with %q", i, err, tt.err)
+			}
+			if again := lines.Next(&BulkItem{}); again != err {
+				t.Errorf("%d: Next() after error = %v; want %v", i, again, err)
+			}
+		}
+	}
+}
+
+func TestJSONLinesLimits(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	body := "{\"name\":\"a\"}\n{\"name\":\"" + strings.Repeat("b", 64) + "\"}\n"
+	lines := newJSONLines(c, strings.NewReader(body), 0, false)
+	lines.maxLine = 32
+	if err := lines.Next(&BulkItem{}); err != nil {
+		t.Fatalf("Next() = %v; want nil", err)
+	}
+	err := lines.Next(&BulkItem{})
+	if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusRequestEntityTooLarge ||
+		!strings.HasPrefix(apiErr.Msg, "Line 2 ") {
+		t.Errorf("Next() = %v; want 413 APIError of line 2", err)
+	}
+
+	for _, useNumber := range []bool{false, true} {
+		lines := newJSONLines(c, strings.NewReader(`{"attrs":{"ref":9007199254740993}}`), 0, useNumber)
+		msg := &PassthroughMsg{}
+		if err := lines.Next(msg); err != nil {
+			t.Fatalf("Next() = %v; want nil", err)
+		}
+		if _, ok := msg.Attrs["ref"].(json.Number); ok != useNumber {
+			t.Errorf("useNumber %v: ref = %#v", useNumber, msg.Attrs["ref"])
+		}
+	}
+}
+
+func TestServerJSONLines(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	svc, err := server.RegisterService(&ImportService{}, "import", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	svc.MethodByName("Import").Info().MaxBodyBytes = 64
+	if err := svc.APIDescriptor(&APIDescriptor{}, "localhost"); err != nil {
+		t.Errorf("APIDescriptor() = %v; want nil", err)
+	}
+
+	tts := []struct {
+		ctype, body string
+		code        int
+		out         string
+	}{
+		{"application/x-ndjson", "{\"name\":\"a\"}\n{\"name\":\"b\"}\n", http.StatusOK, `{"name":"2: a,b"}`},
+		{"", `{"name":"a"}`, http.StatusOK, `{"name":"1: a"}`},
+		{"application/x-ndjson", "{\"name\":\"a\"}\nnope\n", http.StatusBadRequest, ""},
+		{"application/x-ndjson", strings.Repeat("{\"name\":\"a\"}\n", 10), http.StatusRequestEntityTooLarge, ""},
+		{"text/csv", "a\nb\n", http.StatusUnsupportedMediaType, ""},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/ImportService.Import", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.ctype != "" {
+			r.Header.Set("Content-Type", tt.ctype)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+		}
+		if out := strings.TrimSpace(w.Body.String()); tt.out != "" && out != tt.out {
+			t.Errorf("%d: response = %s; want %s", i, out, tt.out)
+		}
+	}
+}
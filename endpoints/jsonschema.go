@@ -0,0 +1,122 @@
+package endpoints
+
+import "sort"
+
+// jsonSchemaDraft is the JSON Schema version of documents returned by
+// Server.JSONSchema.
+const jsonSchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema is a JSON Schema (draft-07) document or subschema.
+type JSONSchema struct {
+	Schema string `json:"$schema,omitempty"`
+	ID     string `json:"$id,omitempty"`
+	Ref    string `json:"$ref,omitempty"`
+
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	Type       string                 `json:"type,omitempty"`
+	Format     string                 `json:"format,omitempty"`
+	Properties map[string]*JSONSchema `json:"properties,omitempty"`
+	Required   []string               `json:"required,omitempty"`
+	Items      *JSONSchema            `json:"items,omitempty"`
+	OneOf      []*JSONSchema          `json:"oneOf,omitempty"`
+
+	Enum    []string    `json:"enum,omitempty"`
+	Pattern string      `json:"pattern,omitempty"`
+	Default interface{} `json:"default,omitempty"`
+	Minimum interface{} `json:"minimum,omitempty"`
+	Maximum interface{} `json:"maximum,omitempty"`
+
+	MinItems int `json:"minItems,omitempty"`
+	MaxItems int `json:"maxItems,omitempty"`
+}
+
+// JSONSchema returns JSON Schema documents of request and response types
+// of all registered services, keyed by schema name as it appears in the
+// API descriptor. It is meant to be called by build tools and validators.
+//
+// Each document has $id of baseURI + name + ".json", and references other
+// types by relative "Name.json" URIs, so the documents should be published
+// together under baseURI. Required fields, enums, patterns, numeric bounds
+// and array lengths are taken from the endpoints field tags.
+func (s *Server) JSONSchema(baseURI string) (map[string]*JSONSchema, error) {
+	docs := make(map[string]*JSONSchema)
+	for _, service := range s.services.apiServices() {
+		d := &APIDescriptor{}
+		if err := service.APIDescriptor(d, "localhost"); err != nil {
+			return nil, err
+		}
+		for name, sd := range d.Descriptor.Schemas {
+			doc := jsonSchemaFromDescriptor(sd)
+			doc.Schema = jsonSchemaDraft
+			doc.ID = baseURI + name + ".json"
+			docs[name] = doc
+		}
+	}
+	return docs, nil
+}
+
+// jsonSchemaFromDescriptor converts schema sd of the API descriptor
+// to JSON Schema.
+func jsonSchemaFromDescriptor(sd *APISchemaDescriptor) *JSONSchema {
+	js := &JSONSchema{Title: sd.ID, Description: sd.Desc}
+	switch {
+	case sd.ID == rawBodySchemaName:
+		// Any JSON value.
+		return js
+	case len(sd.OneOf) > 0:
+		js.OneOf = jsonSchemaRefs(sd.OneOf)
+		return js
+	case sd.Items != nil:
+		js.Type = "array"
+		js.Items = jsonSchemaFromProperty(sd.Items)
+		return js
+	}
+
+	js.Type = "object"
+	js.Properties = make(map[string]*JSONSchema, len(sd.Properties))
+	for name, prop := range sd.Properties {
+		js.Properties[name] = jsonSchemaFromProperty(prop)
+		if prop.Required {
+			js.Required = append(js.Required, name)
+		}
+	}
+	sort.Strings(js.Required)
+	return js
+}
+
+// jsonSchemaFromProperty converts schema property prop to JSON Schema.
+func jsonSchemaFromProperty(prop *APISchemaProperty) *JSONSchema {
+	js := &JSONSchema{Description: prop.Desc, Default: prop.Default}
+	switch {
+	case prop.Ref != "":
+		js.Ref = prop.Ref + ".json"
+		return js
+	case len(prop.OneOf) > 0:
+		js.OneOf = jsonSchemaRefs(prop.OneOf)
+		return js
+	case prop.Type == "any":
+		return js
+	}
+
+	js.Type, js.Format = prop.Type, prop.Format
+	js.Enum, js.Pattern = prop.enum, prop.Pattern
+	if prop.Type == "integer" || prop.Type == "number" {
+		js.Minimum, js.Maximum = prop.min, prop.max
+	}
+	if prop.Items != nil {
+		js.Items = jsonSchemaFromProperty(prop.Items)
+		js.MinItems, js.MaxItems = prop.minItems, prop.maxItems
+	}
+	return js
+}
+
+// jsonSchemaRefs converts schema references refs to JSON Schema.
+func jsonSchemaRefs(refs []*APISchemaRef) []*JSONSchema {
+	schemas := make([]*JSONSchema, len(refs))
+	for i, ref := range refs {
+		schemas[i] = &JSONSchema{Ref: ref.Ref + ".json"}
+	}
+	return schemas
+}
@@ -0,0 +1,91 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type JSItem struct {
+	ID      int64     `json:"id" endpoints:"req"`
+	Kind    string    `json:"kind" endpoints:"req,enum=book|film,desc=Item kind"`
+	Slug    string    `json:"slug" endpoints:"pattern=^[a-z-]+$"`
+	Rating  int       `json:"rating" endpoints:"min=1,max=5"`
+	Created time.Time `json:"created"`
+	Data    []byte    `json:"data"`
+}
+
+type JSList struct {
+	Items []*JSItem `json:"items" endpoints:"minItems=1,maxItems=50"`
+	Best  *JSItem   `json:"best"`
+}
+
+type JSService struct{}
+
+func (s *JSService) List(c Context, req *JSItem) (*JSList, error) {
+	return nil, nil
+}
+
+func TestServerJSONSchema(t *testing.T) {
+	server := NewServer("")
+	if _, err := server.RegisterService(&JSService{}, "js", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	docs, err := server.JSONSchema("https://example.com/schemas/")
+	if err != nil {
+		t.Fatalf("JSONSchema() = %v", err)
+	}
+	if len(docs) != 2 {
+		t.Errorf("len(JSONSchema()) = %d; want 2", len(docs))
+	}
+
+	tts := []struct {
+		name, want string
+	}{
+		{"JSItem", `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"$id": "https://example.com/schemas/JSItem.json",
+			"title": "JSItem",
+			"type": "object",
+			"properties": {
+				"created": {"type": "string", "format": "date-time"},
+				"data": {"type": "string", "format": "byte"},
+				"id": {"type": "string", "format": "int64"},
+				"kind": {"type": "string", "description": "Item kind", "enum": ["book", "film"]},
+				"rating": {"type": "integer", "format": "int32", "minimum": 1, "maximum": 5},
+				"slug": {"type": "string", "pattern": "^[a-z-]+$"}
+			},
+			"required": ["id", "kind"]
+		}`},
+		{"JSList", `{
+			"$schema": "http://json-schema.org/draft-07/schema#",
+			"$id": "https://example.com/schemas/JSList.json",
+			"title": "JSList",
+			"type": "object",
+			"properties": {
+				"best": {"$ref": "JSItem.json"},
+				"items": {"type": "array", "items": {"$ref": "JSItem.json"}, "minItems": 1, "maxItems": 50}
+			}
+		}`},
+	}
+	for _, tt := range tts {
+		doc, ok := docs[tt.name]
+		if !ok {
+			t.Errorf("JSONSchema(): missing %s", tt.name)
+			continue
+		}
+		out, err := json.Marshal(doc)
+		if err != nil {
+			t.Fatalf("json.Marshal(%s) = %v", tt.name, err)
+		}
+		var got, want interface{}
+		json.Unmarshal(out, &got)
+		if err := json.Unmarshal([]byte(tt.want), &want); err != nil {
+			t.Fatalf("%s: bad want: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("JSONSchema()[%s] =\n%s\nwant\n%s", tt.name, out, tt.want)
+		}
+	}
+}
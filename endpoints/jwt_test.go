@@ -1,7 +1,9 @@
 package endpoints
 
 import (
+	"encoding/json"
 	"errors"
+	"net/http"
 	"reflect"
 	"testing"
 	"time"
@@ -256,3 +258,132 @@ func TestCurrentIDTokenUser(t *testing.T) {
 		}
 	}
 }
+
+func TestSignedJWTAudiences(t *testing.T) {
+	tts := []struct {
+		in   string
+		want []string
+	}{
+		{`{"aud": "web-client"}`, []string{"web-client"}},
+		{`{"aud": ["web-client", "android-client"]}`, []string{"web-client", "android-client"}},
+		{`{"aud": []}`, nil},
+		{`{"aud": null}`, nil},
+		{`{}`, nil},
+	}
+	for i, tt := range tts {
+		var jwt signedJWT
+		if err := json.Unmarshal([]byte(tt.in), &jwt); err != nil {
+			t.Errorf("%d: json.Unmarshal(%s) = %v", i, tt.in, err)
+			continue
+		}
+		if aud := jwt.audiences(); !reflect.DeepEqual(aud, tt.want) {
+			t.Errorf("%d: audiences() of %s = %v; want %v", i, tt.in, aud, tt.want)
+		}
+	}
+	var jwt signedJWT
+	if err := json.Unmarshal([]byte(`{"aud": 1}`), &jwt); err == nil {
+		t.Errorf("json.Unmarshal(aud=1) = nil; want error")
+	}
+}
+
+func TestCurrentIDTokenUserAudiences(t *testing.T) {
+	jwtOrigParser := jwtParser
+	defer func() {
+		jwtParser = jwtOrigParser
+	}()
+
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	c := NewContext(r)
+
+	var currToken signedJWT
+	jwtParser = func(Context, string, int64) (*signedJWT, error) {
+		return &currToken, nil
+	}
+
+	azp := []string{"web-client"}
+	tts := []struct {
+		audiences []string
+		allowed   []string
+		code      int
+	}{
+		{[]string{"android-client", "web-client"}, nil, 0},
+		{[]string{"other", "android-client"}, []string{"android-client"}, 0},
+		{[]string{"other", "another"}, []string{"android-client"}, http.StatusForbidden},
+	}
+	for i, tt := range tts {
+		currToken = jwtValidTokenObject
+		currToken.Audience, currToken.Audiences = "", tt.audiences
+		currToken.ClientID = "web-client"
+
+		_, err := currentIDTokenUser(c, jwtValidTokenString, tt.allowed, azp, jwtValidTokenTime.Unix())
+		switch apiErr, _ := err.(*APIError); {
+		case tt.code == 0 && err != nil:
+			t.Errorf("%d: currentIDTokenUser(aud=%v) = %v; want nil", i, tt.audiences, err)
+		case tt.code != 0 && (apiErr == nil || apiErr.Code != tt.code):
+			t.Errorf("%d: currentIDTokenUser(aud=%v) = %v; want %d", i, tt.audiences, err, tt.code)
+		}
+	}
+}
+
+func TestCurrentIDTokenUserNonce(t *testing.T) {
+	origParser, origValidator := jwtParser, NonceValidator
+	defer func() {
+		jwtParser, NonceValidator = origParser, origValidator
+	}()
+
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	c := NewContext(r)
+
+	aud := []string{jwtValidTokenObject.Audience, jwtValidTokenObject.ClientID}
+	azp := []string{jwtValidTokenObject.ClientID}
+
+	var currToken signedJWT
+	jwtParser = func(Context, string, int64) (*signedJWT, error) {
+		return &currToken, nil
+	}
+	var validated []string
+	validator := func(c Context, nonce string) error {
+		validated = append(validated, nonce)
+		if nonce != "fresh" {
+			return errors.New("nonce reused")
+		}
+		return nil
+	}
+
+	tts := []struct {
+		nonce     string
+		validator func(Context, string) error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"", nil, 0, false},
+		{"reused", nil, 0, false},
+		{"", validator, 0, false},
+		{"fresh", validator, 1, false},
+		{"reused", validator, 1, true},
+	}
+	for i, tt := range tts {
+		currToken = jwtValidTokenObject
+		currToken.Nonce = tt.nonce
+		NonceValidator = tt.validator
+		validated = nil
+
+		user, err := currentIDTokenUser(c,
+			jwtValidTokenString, aud, azp, jwtValidTokenTime.Unix())
+		switch {
+		case tt.wantErr && err == nil:
+			t.Errorf("%d: currentIDTokenUser(nonce=%q) = %#v; want error", i, tt.nonce, user)
+		case tt.wantErr:
+			if apiErr, ok := err.(*APIError); !ok || apiErr.Code != 401 {
+				t.Errorf("%d: currentIDTokenUser(nonce=%q) = %v; want 401 APIError", i, tt.nonce, err)
+			}
+		case err != nil:
+			t.Errorf("%d: currentIDTokenUser(nonce=%q) = %v; want user", i, tt.nonce, err)
+		}
+		if len(validated) != tt.wantCalls {
+			t.Errorf("%d: NonceValidator called %d times; want %d", i, len(validated), tt.wantCalls)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package endpoints
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// kindField is the JSON name of the field identifying resource types.
+const kindField = "kind"
+
+var (
+	kindsMu sync.RWMutex
+	kinds   = make(map[reflect.Type]string)
+)
+
+// RegisterKind associates a struct type, given as a value or a pointer,
+// e.g. &Book{}, with a resource kind, e.g. "library#book".
+//
+// Responses then carry "kind" field with that value in JSON objects of
+// the type, both at the top level and wherever they are nested, e.g. in
+// items of a list response. A "kind" field the type has on its own takes
+// precedence. The API config describes the field with the kind as its
+// default value.
+func RegisterKind(v interface{}, kind string) error {
+	t := reflect.TypeOf(v)
+	if t == nil || indirectKind(t) != reflect.Struct {
+		return fmt.Errorf("RegisterKind: want a struct, got %v", t)
+	}
+	if kind == "" {
+		return fmt.Errorf("RegisterKind: empty kind of %v", t)
+	}
+	kindsMu.Lock()
+	kinds[indirectType(t)] = kind
+	kindsMu.Unlock()
+	// Cached results of hasKinds may be stale now.
+	taggedTypesMu.Lock()
+	taggedTypes = make(map[taggedTypesKey]bool)
+	taggedTypesMu.Unlock()
+	return nil
+}
+
+// kindOf returns the kind registered for struct type t, or an empty string.
+func kindOf(t reflect.Type) string {
+	kindsMu.RLock()
+	defer kindsMu.RUnlock()
+	return kinds[t]
+}
+
+// hasKinds returns true if values of type t can contain structs with
+// a registered kind.
+func hasKinds(t reflect.Type) bool {
+	kindsMu.RLock()
+	none := len(kinds) == 0
+	kindsMu.RUnlock()
+	return !none && (hasKind(t) || hasTaggedFields(t, isKindField))
+}
+
+// hasKind returns true if t is a struct type with a registered kind, or
+// a pointer, slice, array or map of one.
+func hasKind(t reflect.Type) bool {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			t = t.Elem()
+		default:
+			return kindOf(t) != ""
+		}
+	}
+}
+
+// isKindField is a fieldPredicate matching fields of types with
+// a registered kind, see hasKind.
+func isKindField(field *reflect.StructField, tag *endpointsTag) bool {
+	return hasKind(field.Type)
+}
+
+// addKinds sets "kind" field of JSON objects in data, which is a generic
+// unmarshaled JSON of a value of type t, which are of struct types with
+// a registered kind.
+func addKinds(t reflect.Type, data interface{}) {
+	walkJSONObjects(t, data, func(t reflect.Type, m map[string]interface{}) error {
+		if kind := kindOf(t); kind != "" {
+			if _, ok := m[kindField]; !ok {
+				m[kindField] = kind
+			}
+		}
+		return nil
+	})
+}
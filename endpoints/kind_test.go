@@ -0,0 +1,120 @@
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+)
+
+type KindBook struct {
+	Title string `json:"title"`
+}
+
+type KindBookList struct {
+	Pagination
+	Items []*KindBook `json:"items"`
+}
+
+type KindShelf struct {
+	Kind  string              `json:"kind"`
+	Books map[string]KindBook `json:"books"`
+}
+
+type KindService struct{}
+
+func (s *KindService) Get(c Context, r *KindBook) (*KindBookList, error) {
+	return &KindBookList{}, nil
+}
+
+// unregisterKinds removes kinds of types ts registered by a test.
+func unregisterKinds(ts ...interface{}) {
+	kindsMu.Lock()
+	defer kindsMu.Unlock()
+	for _, v := range ts {
+		delete(kinds, indirectType(reflect.TypeOf(v)))
+	}
+	taggedTypesMu.Lock()
+	taggedTypes = make(map[taggedTypesKey]bool)
+	taggedTypesMu.Unlock()
+}
+
+func TestRegisterKind(t *testing.T) {
+	if err := RegisterKind(42, "x#int"); err == nil {
+		t.Errorf("RegisterKind(42) = nil; want error")
+	}
+	if err := RegisterKind(&KindBook{}, ""); err == nil {
+		t.Errorf("RegisterKind with empty kind = nil; want error")
+	}
+}
+
+func TestEncodeJSONKinds(t *testing.T) {
+	list := &KindBookList{
+		Pagination: Pagination{NextPageToken: "next"},
+		Items:      []*KindBook{{Title: "a"}, nil},
+	}
+	shelf := &KindShelf{Kind: "custom#shelf", Books: map[string]KindBook{"x": {Title: "b"}}}
+
+	// No kinds registered, output is unchanged.
+	tts := []struct {
+		v    interface{}
+		want string
+	}{
+		{list, `{"nextPageToken":"next","items":[{"title":"a"},null]}`},
+		{shelf, `{"kind":"custom#shelf","books":{"x":{"title":"b"}}}`},
+	}
+	for i, tt := range tts {
+		b, err := encodeJSON(reflect.ValueOf(tt.v))
+		if err != nil || string(b) != tt.want {
+			t.Errorf("%d: encodeJSON() = %s, %v; want %s", i, b, err, tt.want)
+		}
+	}
+
+	defer unregisterKinds(&KindBook{}, &KindBookList{}, &KindShelf{})
+	if err := RegisterKind(&KindBook{}, "library#book"); err != nil {
+		t.Fatalf("RegisterKind: %v", err)
+	}
+	if err := RegisterKind(KindBookList{}, "library#bookList"); err != nil {
+		t.Fatalf("RegisterKind: %v", err)
+	}
+	if err := RegisterKind(&KindShelf{}, "library#shelf"); err != nil {
+		t.Fatalf("RegisterKind: %v", err)
+	}
+
+	tts = []struct {
+		v    interface{}
+		want string
+	}{
+		{list, `{"items":[{"kind":"library#book","title":"a"},null],"kind":"library#bookList","nextPageToken":"next"}`},
+		{shelf, `{"books":{"x":{"kind":"library#book","title":"b"}},"kind":"custom#shelf"}`},
+		{&KindBook{Title: "c"}, `{"kind":"library#book","title":"c"}`},
+		{&TestMsg{Name: "d"}, `{"name":"d"}`},
+	}
+	for i, tt := range tts {
+		b, err := encodeJSON(reflect.ValueOf(tt.v))
+		if err != nil || string(b) != tt.want {
+			t.Errorf("%d: encodeJSON() = %s, %v; want %s", i, b, err, tt.want)
+		}
+	}
+}
+
+func TestKindSchema(t *testing.T) {
+	defer unregisterKinds(&KindBook{})
+	if err := RegisterKind(&KindBook{}, "library#book"); err != nil {
+		t.Fatalf("RegisterKind: %v", err)
+	}
+	server := NewServer("")
+	s, err := server.RegisterService(&KindService{}, "kinds", "v1", "", true)
+	if err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+	d := &APIDescriptor{}
+	if err := s.APIDescriptor(d, "testhost:1234"); err != nil {
+		t.Fatalf("APIDescriptor() = %v", err)
+	}
+	prop := d.Descriptor.Schemas["KindBook"].Properties["kind"]
+	if prop == nil || prop.Type != "string" || prop.Default != "library#book" {
+		t.Errorf("KindBook.kind = %#v; want string defaulting to library#book", prop)
+	}
+	if prop := d.Descriptor.Schemas["KindBookList"].Properties["kind"]; prop != nil {
+		t.Errorf("KindBookList.kind = %#v; want none", prop)
+	}
+}
@@ -0,0 +1,117 @@
+package endpoints
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLanguage is used when none of the accepted languages has
+// a translation in Server.Messages.
+const defaultLanguage = "en"
+
+// writeError writes an error response to r, with the message localized
+// according to s.Messages, and transformed by s.ResponseTransformer if
+// s.TransformErrors is true. 401 responses get WWW-Authenticate header.
+// The body is in s.ErrorFormat.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	s.setChallenge(w, err)
+	err = s.localize(w, r, err)
+	if s.ResponseTransformer != nil && s.TransformErrors {
+		s.writeTransformedError(w, r, err)
+		return
+	}
+	s.writeErrorResponse(w, s.errorResponse(r, err))
+}
+
+// localize returns a copy of err with its message translated into the
+// language preferred by r, if err is an APIError with a Reason and
+// s.Messages has a translation. Otherwise err is returned as is.
+func (s *Server) localize(w http.ResponseWriter, r *http.Request, err error) error {
+	apiErr, ok := err.(*APIError)
+	if !ok || apiErr.Reason == "" || len(s.Messages) == 0 {
+		return err
+	}
+	langs := append(acceptedLanguages(r.Header.Get("Accept-Language")), defaultLanguage)
+	for _, lang := range langs {
+		tag, msg, ok := s.message(lang, apiErr.Reason)
+		if !ok {
+			continue
+		}
+		w.Header().Set("Content-Language", tag)
+		localized := *apiErr
+		localized.Msg = msg
+		return &localized
+	}
+	return err
+}
+
+// message looks up a message of reason in s.Messages for language tag lang,
+// falling back to its primary subtag, e.g. "fr" for "fr-CH". Tags are
+// matched case-insensitively. It returns the matched tag as it appears in
+// s.Messages.
+func (s *Server) message(lang, reason string) (string, string, bool) {
+	candidates := []string{lang}
+	if i := strings.Index(lang, "-"); i > 0 {
+		candidates = append(candidates, lang[:i])
+	}
+	for _, c := range candidates {
+		for tag, msgs := range s.Messages {
+			if !strings.EqualFold(tag, c) {
+				continue
+			}
+			if msg, ok := msgs[reason]; ok {
+				return tag, msg, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// acceptedLanguage is a language range of Accept-Language header with its
+// quality value.
+type acceptedLanguage struct {
+	tag string
+	q   float64
+}
+
+type byQuality []acceptedLanguage
+
+func (a byQuality) Len() int           { return len(a) }
+func (a byQuality) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byQuality) Less(i, j int) bool { return a[i].q > a[j].q }
+
+// acceptedLanguages parses Accept-Language header value h and returns
+// language tags in order of preference. The wildcard and tags with zero
+// or malformed quality are skipped.
+func acceptedLanguages(h string) []string {
+	var langs []acceptedLanguage
+	for _, part := range strings.Split(h, ",") {
+		params := strings.Split(part, ";")
+		tag := strings.TrimSpace(params[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		q := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if !strings.HasPrefix(p, "q=") {
+				continue
+			}
+			var err error
+			if q, err = strconv.ParseFloat(p[2:], 64); err != nil {
+				q = 0
+			}
+		}
+		if q > 0 {
+			langs = append(langs, acceptedLanguage{tag, q})
+		}
+	}
+	sort.Stable(byQuality(langs))
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+	return tags
+}
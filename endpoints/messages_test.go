@@ -0,0 +1,67 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestAcceptedLanguages(t *testing.T) {
+	tts := []struct {
+		in   string
+		want []string
+	}{
+		{"", []string{}},
+		{"fr", []string{"fr"}},
+		{"fr-CH, fr;q=0.9, en;q=0.8, *;q=0.5", []string{"fr-CH", "fr", "en"}},
+		{"en;q=0.5, de, pl;q=0.7", []string{"de", "pl", "en"}},
+		{"de;q=0, pl;q=x, es", []string{"es"}},
+	}
+	for i, tt := range tts {
+		out := acceptedLanguages(tt.in)
+		if !reflect.DeepEqual(out, tt.want) {
+			t.Errorf("%d: acceptedLanguages(%q) = %#v; want %#v", i, tt.in, out, tt.want)
+		}
+	}
+}
+
+func TestServerLocalize(t *testing.T) {
+	s := &Server{Messages: map[string]map[string]string{
+		"en":    {"dateRange": "Start must precede end"},
+		"fr":    {"dateRange": "Le début doit précéder la fin"},
+		"pt-BR": {"dateRange": "O início deve preceder o fim"},
+	}}
+	coded := &APIError{Name: "Bad Request", Msg: "start > end", Code: 400, Reason: "dateRange"}
+	unknown := &APIError{Name: "Bad Request", Msg: "unknown", Code: 400, Reason: "other"}
+
+	tts := []struct {
+		err            error
+		acceptLanguage string
+		wantMsg        string
+		wantLanguage   string
+	}{
+		{coded, "fr-CH, en;q=0.5", "Le début doit précéder la fin", "fr"},
+		{coded, "pt-br", "O início deve preceder o fim", "pt-BR"},
+		{coded, "de", "Start must precede end", "en"},
+		{coded, "", "Start must precede end", "en"},
+		{unknown, "fr", "unknown", ""},
+		{BadRequestError, "fr", "", ""},
+	}
+	for i, tt := range tts {
+		r, _ := http.NewRequest("POST", "/", nil)
+		r.Header.Set("Accept-Language", tt.acceptLanguage)
+		w := httptest.NewRecorder()
+		out := s.localize(w, r, tt.err).(*APIError)
+		if out.Msg != tt.wantMsg {
+			t.Errorf("%d: localize(%q) msg = %q; want %q", i, tt.acceptLanguage, out.Msg, tt.wantMsg)
+		}
+		if lang := w.Header().Get("Content-Language"); lang != tt.wantLanguage {
+			t.Errorf("%d: localize(%q) Content-Language = %q; want %q",
+				i, tt.acceptLanguage, lang, tt.wantLanguage)
+		}
+	}
+	if coded.Msg != "start > end" {
+		t.Errorf("localize modified original error: %#v", coded)
+	}
+}
@@ -0,0 +1,61 @@
+package endpoints
+
+import (
+	"net/http"
+	"time"
+)
+
+// MetricsCollector is notified of requests to service methods, e.g. to
+// export request metrics to a monitoring system. See PrometheusMetrics.
+type MetricsCollector interface {
+	// ObserveRequest is called after a request to method, e.g.
+	// "MyService.Get", is served with HTTP status within latency.
+	// It must be safe for concurrent use.
+	ObserveRequest(method string, status int, latency time.Duration)
+}
+
+// statusWriter records the status and size of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher, for streamed responses.
+func (w *statusWriter) Flush() {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// observeRequest notifies s.Metrics of a request to method which started
+// at start and was responded to through w.
+func (s *Server) observeRequest(method string, w *statusWriter, start time.Time) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	latency := time.Since(start)
+	for _, m := range s.Metrics {
+		m.ObserveRequest(method, status, latency)
+	}
+}
@@ -0,0 +1,58 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+type observedRequest struct {
+	method string
+	status int
+}
+
+type stubCollector struct {
+	mu       sync.Mutex
+	requests []observedRequest
+}
+
+func (c *stubCollector) ObserveRequest(method string, status int, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, observedRequest{method, status})
+}
+
+func TestServerMetrics(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	collector := &stubCollector{}
+	server := createAPIServer()
+	server.Metrics = []MetricsCollector{collector}
+
+	for _, method := range []string{"Msg", "Void", "Error", "Unknown"} {
+		r, err := inst.NewRequest("POST", "/ServerTestService."+method, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		server.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	want := []observedRequest{
+		{"ServerTestService.Msg", http.StatusOK},
+		{"ServerTestService.Void", http.StatusOK},
+		{"ServerTestService.Error", http.StatusBadRequest},
+	}
+	if !reflect.DeepEqual(collector.requests, want) {
+		t.Errorf("observed %v; want %v", collector.requests, want)
+	}
+}
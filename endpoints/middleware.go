@@ -0,0 +1,96 @@
+package endpoints
+
+// Middleware wraps calls of service methods, e.g. to audit them or to check
+// additional permissions. name is the called method in "Service.Method"
+// format.
+//
+// A middleware proceeds with the call by calling next, possibly with
+// a replaced Context, and should return its error. Returning an error
+// without calling next rejects the call: the error is sent to the client
+// the same way errors of service methods are.
+type Middleware func(c Context, name string, next func(Context) error) error
+
+// MethodMatcher selects service methods a middleware runs for.
+// name is in "Service.Method" format.
+type MethodMatcher func(name string, m *ServiceMethod) bool
+
+// MethodNames returns a MethodMatcher selecting methods by their names in
+// "Service.Method" format.
+func MethodNames(names ...string) MethodMatcher {
+	set := make(map[string]bool, len(names))
+	for _, name := range names {
+		set[name] = true
+	}
+	return func(name string, m *ServiceMethod) bool {
+		return set[name]
+	}
+}
+
+// MethodPaths returns a MethodMatcher selecting methods by their path
+// templates (see MethodInfo.Path).
+func MethodPaths(paths ...string) MethodMatcher {
+	set := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		set[p] = true
+	}
+	return func(name string, m *ServiceMethod) bool {
+		return m.info != nil && set[m.info.Path]
+	}
+}
+
+// scopedMiddleware is a middleware which runs only for methods selected
+// by match, or for all of them if match is nil.
+type scopedMiddleware struct {
+	match MethodMatcher
+	mw    Middleware
+}
+
+// Use adds mw to the middleware of all service methods.
+// Middleware runs in the order it was added.
+func (s *Server) Use(mw Middleware) {
+	s.UseFor(nil, mw)
+}
+
+// UseFor adds mw to the middleware of service methods selected by match,
+// e.g. MethodNames("Greetings.Delete"). Middleware runs in the order it was
+// added.
+//
+// match is evaluated once per method, when the method is first called,
+// so it should depend only on the method and not on a request.
+func (s *Server) UseFor(match MethodMatcher, mw Middleware) {
+	s.mwMu.Lock()
+	defer s.mwMu.Unlock()
+	s.middleware = append(s.middleware, scopedMiddleware{match, mw})
+	// Chains have to be matched again.
+	s.mwChains = nil
+}
+
+// middlewareFor returns middleware which runs for method m named name.
+func (s *Server) middlewareFor(name string, m *ServiceMethod) []Middleware {
+	s.mwMu.Lock()
+	defer s.mwMu.Unlock()
+	if chain, ok := s.mwChains[m]; ok {
+		return chain
+	}
+	var chain []Middleware
+	for _, sm := range s.middleware {
+		if sm.match == nil || sm.match(name, m) {
+			chain = append(chain, sm.mw)
+		}
+	}
+	if s.mwChains == nil {
+		s.mwChains = make(map[*ServiceMethod][]Middleware)
+	}
+	s.mwChains[m] = chain
+	return chain
+}
+
+// runMiddleware runs chain for a call of method name which ends with call.
+func runMiddleware(c Context, name string, chain []Middleware, call func(Context) error) error {
+	if len(chain) == 0 {
+		return call(c)
+	}
+	return chain[0](c, name, func(c Context) error {
+		return runMiddleware(c, name, chain[1:], call)
+	})
+}
@@ -0,0 +1,94 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+func TestMethodMatchers(t *testing.T) {
+	m := &ServiceMethod{info: &MethodInfo{Path: "greets/{id}"}}
+	tts := []struct {
+		match MethodMatcher
+		name  string
+		m     *ServiceMethod
+		want  bool
+	}{
+		{MethodNames("Greets.Get", "Greets.Delete"), "Greets.Delete", m, true},
+		{MethodNames("Greets.Get"), "Greets.Delete", m, false},
+		{MethodPaths("greets", "greets/{id}"), "Greets.Delete", m, true},
+		{MethodPaths("greets"), "Greets.Delete", m, false},
+		{MethodPaths("greets"), "Greets.Delete", &ServiceMethod{}, false},
+	}
+	for i, tt := range tts {
+		if out := tt.match(tt.name, tt.m); out != tt.want {
+			t.Errorf("%d: match(%q) = %v; want %v", i, tt.name, out, tt.want)
+		}
+	}
+}
+
+func TestServerMiddleware(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	var calls []string
+	server.Use(func(c Context, name string, next func(Context) error) error {
+		calls = append(calls, "global "+name)
+		return next(c)
+	})
+	matched := 0
+	server.UseFor(func(name string, m *ServiceMethod) bool {
+		matched++
+		return name == "ServerTestService.Msg"
+	}, func(c Context, name string, next func(Context) error) error {
+		calls = append(calls, "scoped "+name)
+		if c.HTTPRequest().Header.Get("X-Admin") == "" {
+			return ForbiddenError
+		}
+		return next(c)
+	})
+
+	tts := []struct {
+		method string
+		admin  bool
+		code   int
+		calls  []string
+	}{
+		{"Void", false, http.StatusOK, []string{"global ServerTestService.Void"}},
+		{"Msg", false, http.StatusForbidden,
+			[]string{"global ServerTestService.Msg", "scoped ServerTestService.Msg"}},
+		{"Msg", true, http.StatusOK,
+			[]string{"global ServerTestService.Msg", "scoped ServerTestService.Msg"}},
+	}
+	for i, tt := range tts {
+		calls = nil
+		path := "/ServerTestService." + tt.method
+		r, err := inst.NewRequest("POST", path, strings.NewReader(`{"name":"alex"}`))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.admin {
+			r.Header.Set("X-Admin", "1")
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: %s w.Code = %d; want %d", i, path, w.Code, tt.code)
+		}
+		if !reflect.DeepEqual(calls, tt.calls) {
+			t.Errorf("%d: %s middleware calls = %v; want %v", i, path, calls, tt.calls)
+		}
+	}
+	if matched != 2 {
+		t.Errorf("matcher called %d times; want 2", matched)
+	}
+}
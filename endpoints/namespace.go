@@ -0,0 +1,73 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"google.golang.org/appengine"
+)
+
+// appengineNamespace is a variable on purpose: it can be stubbed in tests.
+var appengineNamespace = appengine.Namespace
+
+// namespaceContext returns c operating within the namespace named by
+// s.NamespaceHeader of request r, normalized with s.NamespaceNormalizer
+// and then NamespaceValidator if set. c is returned as is if there's no
+// header.
+//
+// It returns 400 APIError if the normalizer or the validator fails, or
+// the namespace name is invalid.
+func (s *Server) namespaceContext(c Context, r *http.Request) (Context, error) {
+	if s.NamespaceHeader == "" {
+		return c, nil
+	}
+	ns := r.Header.Get(s.NamespaceHeader)
+	if ns == "" {
+		return c, nil
+	}
+	if s.NamespaceNormalizer != nil {
+		var err error
+		if ns, err = s.NamespaceNormalizer(ns); err != nil {
+			return nil, NewBadRequestError("Invalid %s header: %v", s.NamespaceHeader, err)
+		}
+	}
+	if NamespaceValidator != nil {
+		valid, err := NamespaceValidator(ns)
+		if err != nil {
+			return nil, NewBadRequestError("Invalid namespace %q: %v", ns, err)
+		}
+		ns = valid
+	}
+	nc, err := appengineNamespace(c, ns)
+	if err != nil {
+		return nil, NewBadRequestError("Invalid namespace %q: %v", ns, err)
+	}
+	return deriveContext(c, nc), nil
+}
+
+// namespacer is implemented by contexts of this package. Its namespace
+// method is the same as Context.Namespace but doesn't consult
+// NamespaceValidator, so that nested contexts validate a name only once.
+type namespacer interface {
+	namespace(name string) (Context, error)
+}
+
+// validatedNamespace returns c operating within namespace name, after
+// passing the name through NamespaceValidator if set.
+func validatedNamespace(c namespacer, name string) (Context, error) {
+	if NamespaceValidator != nil {
+		var err error
+		if name, err = NamespaceValidator(name); err != nil {
+			return nil, err
+		}
+	}
+	return c.namespace(name)
+}
+
+// uncheckedNamespace returns c operating within namespace name, without
+// validation if c is a context of this package.
+func uncheckedNamespace(c Context, name string) (Context, error) {
+	if nc, ok := c.(namespacer); ok {
+		return nc.namespace(name)
+	}
+	return c.Namespace(name)
+}
@@ -0,0 +1,75 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"appengine/aetest"
+)
+
+func TestServerNamespaceHeader(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	var namespaces []string
+	origNamespace := appengineNamespace
+	defer func() { appengineNamespace = origNamespace }()
+	appengineNamespace = func(c context.Context, ns string) (context.Context, error) {
+		if strings.Contains(ns, ":") {
+			return nil, errors.New("invalid characters")
+		}
+		namespaces = append(namespaces, ns)
+		return c, nil
+	}
+
+	normalizer := func(v string) (string, error) {
+		if !strings.HasPrefix(v, "tenant:") {
+			return "", errors.New("missing tenant prefix")
+		}
+		return strings.TrimPrefix(v, "tenant:"), nil
+	}
+
+	tts := []struct {
+		header, value string
+		normalizer    func(string) (string, error)
+		code          int
+		ns            string
+	}{
+		{"", "acme", nil, http.StatusOK, ""},
+		{"X-Tenant", "", nil, http.StatusOK, ""},
+		{"X-Tenant", "acme", nil, http.StatusOK, "acme"},
+		{"X-Tenant", "tenant:acme", nil, http.StatusBadRequest, ""},
+		{"X-Tenant", "tenant:acme", normalizer, http.StatusOK, "acme"},
+		{"X-Tenant", "acme", normalizer, http.StatusBadRequest, ""},
+	}
+	for i, tt := range tts {
+		namespaces = nil
+		server := createAPIServer()
+		server.NamespaceHeader = tt.header
+		server.NamespaceNormalizer = tt.normalizer
+
+		r, err := inst.NewRequest("POST", "/ServerTestService.Void", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		r.Header.Set("X-Tenant", tt.value)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		ns := strings.Join(namespaces, ",")
+		if ns != tt.ns {
+			t.Errorf("%d: namespace = %q; want %q", i, ns, tt.ns)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// OneOf describes a polymorphic type: an interface which values are decoded
+// from JSON objects into one of concrete types, chosen by a discriminator
+// field of the object.
+type OneOf struct {
+	// Discriminator is a JSON name of the field which selects a concrete
+	// type, e.g. "type".
+	Discriminator string
+	// Types maps discriminator values to zero values of concrete types,
+	// e.g. {"circle": &Circle{}, "square": &Square{}}.
+	Types map[string]interface{}
+}
+
+var (
+	oneOfsMu sync.RWMutex
+	oneOfs   = make(map[reflect.Type]*oneOf)
+)
+
+// oneOf is a registered OneOf.
+type oneOf struct {
+	discriminator string
+	types         map[string]reflect.Type
+}
+
+// RegisterOneOf registers a polymorphic interface type, given as a nil
+// pointer to it, e.g. (*Shape)(nil).
+//
+// Values of the interface can then be used as requests of service methods,
+// e.g. func(c Context, req *Shape) error, and as request struct fields.
+// They are decoded into the concrete type selected by o.Discriminator.
+// An unknown discriminator value results in 400 Bad Request.
+//
+// The API config describes such values as objects with "oneOf" list of
+// concrete type schemas.
+func RegisterOneOf(iface interface{}, o OneOf) error {
+	t := reflect.TypeOf(iface)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Interface {
+		return fmt.Errorf("RegisterOneOf: want a pointer to interface, got %v", t)
+	}
+	t = t.Elem()
+	if o.Discriminator == "" || len(o.Types) == 0 {
+		return fmt.Errorf("RegisterOneOf: %v needs a discriminator and types", t)
+	}
+	reg := &oneOf{o.Discriminator, make(map[string]reflect.Type, len(o.Types))}
+	for val, v := range o.Types {
+		vt := reflect.TypeOf(v)
+		if vt == nil || !vt.Implements(t) {
+			return fmt.Errorf("RegisterOneOf: %v of %q doesn't implement %v", vt, val, t)
+		}
+		if indirectKind(vt) != reflect.Struct {
+			return fmt.Errorf("RegisterOneOf: %v of %q is not a struct", vt, val)
+		}
+		reg.types[val] = vt
+	}
+
+	oneOfsMu.Lock()
+	defer oneOfsMu.Unlock()
+	oneOfs[t] = reg
+	return nil
+}
+
+// oneOfFor returns a OneOf registered for type t, or nil.
+func oneOfFor(t reflect.Type) *oneOf {
+	if t.Kind() != reflect.Interface {
+		return nil
+	}
+	oneOfsMu.RLock()
+	defer oneOfsMu.RUnlock()
+	return oneOfs[t]
+}
+
+// decode decodes JSON object b into a new value of the selected concrete
+// type.
+func (o *oneOf) decode(b []byte, useNumber bool) (reflect.Value, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return reflect.Value{}, err
+	}
+	var disc string
+	if raw, ok := fields[o.discriminator]; ok {
+		if err := json.Unmarshal(raw, &disc); err != nil {
+			return reflect.Value{}, NewBadRequestError("Invalid %s: %v", o.discriminator, err)
+		}
+	}
+	t, ok := o.types[disc]
+	if !ok {
+		return reflect.Value{}, NewBadRequestError("Unknown %s %q", o.discriminator, disc)
+	}
+	v := reflect.New(indirectType(t))
+	if err := decodeJSON(b, v, useNumber); err != nil {
+		return reflect.Value{}, err
+	}
+	if t.Kind() != reflect.Ptr {
+		return v.Elem(), nil
+	}
+	return v, nil
+}
+
+// schemaRefs returns references to schemas of o's concrete types, sorted
+// by their discriminator values, and adds the types to ensure.
+func (o *oneOf) schemaRefs(ensure map[string]reflect.Type) []*APISchemaRef {
+	vals := make([]string, 0, len(o.types))
+	for val := range o.types {
+		vals = append(vals, val)
+	}
+	sort.Strings(vals)
+	refs := make([]*APISchemaRef, len(vals))
+	for i, val := range vals {
+		t := indirectType(o.types[val])
+		ref := schemaNameForType(t)
+		ensure[ref] = t
+		refs[i] = &APISchemaRef{Ref: ref}
+	}
+	return refs
+}
+
+// decodeOneOf decodes body into v, a pointer to a registered OneOf
+// interface or to a struct with such fields.
+//
+// It returns false if there's nothing polymorphic about v.
+func decodeOneOf(body []byte, v reflect.Value, useNumber bool) (bool, error) {
+	t := v.Type().Elem()
+	if o := oneOfFor(t); o != nil {
+		if string(body) == "null" {
+			return true, nil
+		}
+		cv, err := o.decode(body, useNumber)
+		if err == nil {
+			v.Elem().Set(cv)
+		}
+		return true, err
+	}
+
+	fields := oneOfFields(t)
+	if len(fields) == 0 {
+		return false, nil
+	}
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return true, err
+	}
+	// Polymorphic fields are decoded separately since encoding/json can't
+	// decode into non-empty interfaces.
+	extracted := make(map[string]json.RawMessage, len(fields))
+	for name := range fields {
+		if raw, ok := m[name]; ok {
+			extracted[name] = raw
+			delete(m, name)
+		}
+	}
+	rest, err := json.Marshal(m)
+	if err != nil {
+		return true, err
+	}
+	if err := decodeTypedJSON(rest, v, useNumber); err != nil {
+		return true, err
+	}
+	for name, raw := range extracted {
+		if string(raw) == "null" {
+			continue
+		}
+		cv, err := oneOfFor(fields[name].Type).decode(raw, useNumber)
+		if err != nil {
+			return true, err
+		}
+		v.Elem().FieldByIndex(fields[name].Index).Set(cv)
+	}
+	return true, nil
+}
+
+// oneOfFields returns fields of type t, including those of embedded
+// structs, which are of registered OneOf types. They are keyed by JSON
+// names.
+func oneOfFields(t reflect.Type) map[string]reflect.StructField {
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	var fields map[string]reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for name, f := range oneOfFields(field.Type) {
+				f.Index = append([]int{i}, f.Index...)
+				if fields == nil {
+					fields = make(map[string]reflect.StructField)
+				}
+				fields[name] = f
+			}
+			continue
+		}
+		if oneOfFor(field.Type) == nil {
+			continue
+		}
+		if name := jsonFieldName(&field); name != "-" {
+			if fields == nil {
+				fields = make(map[string]reflect.StructField)
+			}
+			fields[name] = field
+		}
+	}
+	return fields
+}
@@ -0,0 +1,148 @@
+package endpoints
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+type Shape interface {
+	Area() float64
+}
+
+type Circle struct {
+	Type   string  `json:"type"`
+	Radius float64 `json:"radius"`
+}
+
+func (c *Circle) Area() float64 { return 3 * c.Radius * c.Radius }
+
+type Square struct {
+	Type string  `json:"type"`
+	Side float64 `json:"side"`
+}
+
+func (s Square) Area() float64 { return s.Side * s.Side }
+
+type DrawReq struct {
+	Color string `json:"color"`
+	Shape Shape  `json:"shape"`
+}
+
+type ShapeService struct{}
+
+func (s *ShapeService) Area(c Context, req *Shape) (*VoidMessage, error) {
+	return nil, nil
+}
+
+func (s *ShapeService) Draw(c Context, req *DrawReq) (*VoidMessage, error) {
+	return nil, nil
+}
+
+func registerShapes(t *testing.T) {
+	err := RegisterOneOf((*Shape)(nil), OneOf{
+		Discriminator: "type",
+		Types:         map[string]interface{}{"circle": &Circle{}, "square": Square{}},
+	})
+	if err != nil {
+		t.Fatalf("RegisterOneOf() = %v", err)
+	}
+}
+
+func TestRegisterOneOfInvalid(t *testing.T) {
+	tts := []struct {
+		iface interface{}
+		o     OneOf
+	}{
+		{Shape(nil), OneOf{"type", map[string]interface{}{"circle": &Circle{}}}},
+		{&Circle{}, OneOf{"type", map[string]interface{}{"circle": &Circle{}}}},
+		{(*Shape)(nil), OneOf{"", map[string]interface{}{"circle": &Circle{}}}},
+		{(*Shape)(nil), OneOf{"type", nil}},
+		{(*Shape)(nil), OneOf{"type", map[string]interface{}{"circle": Circle{}}}},
+		{(*Shape)(nil), OneOf{"type", map[string]interface{}{"nil": nil}}},
+	}
+	for i, tt := range tts {
+		if err := RegisterOneOf(tt.iface, tt.o); err == nil {
+			t.Errorf("%d: RegisterOneOf(%T, %v) = nil; want error", i, tt.iface, tt.o)
+		}
+	}
+}
+
+func TestDecodeOneOf(t *testing.T) {
+	registerShapes(t)
+
+	var shape Shape
+	tts := []struct {
+		in   string
+		v    interface{}
+		want interface{}
+		code int
+	}{
+		{`{"type":"circle","radius":2}`, &shape, &Circle{"circle", 2}, 0},
+		{`{"type":"square","side":3}`, &shape, Square{"square", 3}, 0},
+		{`null`, &shape, nil, 0},
+		{`{"type":"triangle"}`, &shape, nil, http.StatusBadRequest},
+		{`{"radius":2}`, &shape, nil, http.StatusBadRequest},
+		{`{"color":"red","shape":{"type":"circle","radius":1}}`, &DrawReq{},
+			&DrawReq{"red", &Circle{"circle", 1}}, 0},
+		{`{"color":"red","shape":null}`, &DrawReq{}, &DrawReq{Color: "red"}, 0},
+		{`{"color":"red"}`, &DrawReq{}, &DrawReq{Color: "red"}, 0},
+		{`{"shape":{"type":"hexagon"}}`, &DrawReq{}, nil, http.StatusBadRequest},
+	}
+	for i, tt := range tts {
+		shape = nil
+		v := reflect.ValueOf(tt.v)
+		err := decodeJSON([]byte(tt.in), v, false)
+		if tt.code != 0 {
+			if apiErr, ok := err.(*APIError); !ok || apiErr.Code != tt.code {
+				t.Errorf("%d: decodeJSON(%s) = %v; want %d APIError", i, tt.in, err, tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: decodeJSON(%s) = %v", i, tt.in, err)
+			continue
+		}
+		out := v.Elem().Interface()
+		if _, ok := tt.v.(*DrawReq); ok {
+			out = v.Interface()
+		}
+		if !reflect.DeepEqual(out, tt.want) {
+			t.Errorf("%d: decodeJSON(%s) = %#v; want %#v", i, tt.in, out, tt.want)
+		}
+	}
+}
+
+func TestOneOfSchema(t *testing.T) {
+	registerShapes(t)
+
+	server := NewServer("")
+	s, err := server.RegisterService(&ShapeService{}, "Shapes", "v1", "", true)
+	if err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+	d := &APIDescriptor{}
+	if err := s.APIDescriptor(d, "testhost:1234"); err != nil {
+		t.Fatalf("APIDescriptor() = %v", err)
+	}
+
+	want := []*APISchemaRef{{Ref: "Circle"}, {Ref: "Square"}}
+	if sd := d.Descriptor.Schemas["Shape"]; sd == nil || !reflect.DeepEqual(sd.OneOf, want) {
+		t.Errorf("Shape schema = %#v; want oneOf %v", sd, want)
+	}
+	sd := d.Descriptor.Schemas["DrawReq"]
+	if sd == nil || sd.Properties["shape"] == nil {
+		t.Fatalf("DrawReq schema = %#v; want shape property", sd)
+	}
+	if prop := sd.Properties["shape"]; prop.Type != "object" || !reflect.DeepEqual(prop.OneOf, want) {
+		t.Errorf("DrawReq.shape = %#v; want object with oneOf %v", prop, want)
+	}
+	for _, ref := range want {
+		if d.Descriptor.Schemas[ref.Ref] == nil {
+			t.Errorf("want schema %q", ref.Ref)
+		}
+	}
+	if meth := d.Methods["shapes.area"]; meth == nil || meth.HTTPMethod != "POST" {
+		t.Errorf("shapes.area = %#v; want POST method", meth)
+	}
+}
@@ -0,0 +1,197 @@
+package endpoints
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"google.golang.org/appengine/user"
+)
+
+var typeOfOperation = reflect.TypeOf((*Operation)(nil))
+
+// Operation is a handle of a long-running operation, following the Google
+// APIs Operation pattern. A method starting an operation, e.g. by adding
+// a task queue job, returns its Operation from StartOperation and the
+// client polls OperationsService.Get until the operation is done.
+//
+// Methods returning an Operation which is not done respond with
+// 202 Accepted instead of 200 OK.
+type Operation struct {
+	// Name identifies the operation.
+	Name string `json:"name"`
+	// Done is true when the operation has completed, with either Error or
+	// Response set.
+	Done     bool            `json:"done"`
+	Error    *OperationError `json:"error,omitempty"`
+	Response json.RawMessage `json:"response,omitempty"`
+
+	// Method which started the operation, in "Service.Method" format.
+	// Polling the operation requires the same auth as the method.
+	Method string `json:"-"`
+	// Owner is the email of the user who started the operation, if they
+	// were authenticated the way Method requires. Only the owner can poll
+	// the operation then.
+	Owner string `json:"-"`
+}
+
+// OperationError is a result of a failed operation.
+type OperationError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// OperationStore persists status of operations, e.g. in datastore.
+type OperationStore interface {
+	// Get returns an operation by its name, or nil if there's no such
+	// operation.
+	Get(c Context, name string) (*Operation, error)
+	// Put stores op, overwriting previous status of the operation.
+	Put(c Context, op *Operation) error
+}
+
+// StartOperation creates a new Operation of the method being served and
+// puts it into Server.Operations store. The method can then return it to
+// the client and update its status in the store once it completes.
+func StartOperation(c Context) (*Operation, error) {
+	mc, ok := c.Value(methodCallKey{}).(*methodCall)
+	if !ok {
+		return nil, errors.New("No method is being served in the current context.")
+	}
+	if mc.server.Operations == nil {
+		return nil, errors.New("Server.Operations store is not set.")
+	}
+	name, err := newOperationName()
+	if err != nil {
+		return nil, err
+	}
+	op := &Operation{Name: name, Method: mc.name}
+	u, err := mc.server.methodUser(c, mc.name, mc.method)
+	if _, ok := err.(*APIError); ok {
+		return nil, err
+	}
+	if err == nil && u != nil {
+		op.Owner = u.Email
+	}
+	if err := mc.server.Operations.Put(c, op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// newOperationName returns a random operation name.
+func newOperationName() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// responseStatus returns HTTP status code of a successful response v of
+// method m. It is 202 Accepted if v is an Operation which is not done yet,
+// unless m has explicit MethodInfo.StatusCode.
+func (m *ServiceMethod) responseStatus(v reflect.Value) int {
+	status := m.successStatus()
+	if m.info != nil && m.info.StatusCode != 0 {
+		return status
+	}
+	if status != http.StatusOK || !v.IsValid() || v.Type() != typeOfOperation || v.IsNil() {
+		return status
+	}
+	if !v.Interface().(*Operation).Done {
+		return http.StatusAccepted
+	}
+	return status
+}
+
+// GetOperationRequest is the request of OperationsService.Get.
+type GetOperationRequest struct {
+	Name string `json:"name" endpoints:"req"`
+}
+
+// OperationsService lets clients poll status of operations started with
+// StartOperation. Register it with Server.RegisterOperationsService.
+type OperationsService struct {
+	server *Server
+}
+
+// Get returns status of an operation. The client must be authorized the
+// same way as for the method which started the operation, and be its
+// owner, if any.
+func (s *OperationsService) Get(c Context, req *GetOperationRequest) (*Operation, error) {
+	if s.server.Operations == nil {
+		return nil, NewNotFoundError("Operation %q not found", req.Name)
+	}
+	op, err := s.server.Operations.Get(c, req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if op == nil {
+		return nil, NewNotFoundError("Operation %q not found", req.Name)
+	}
+	if err := s.authorize(c, op); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+// authorize returns an error unless the current user is allowed to call
+// the method which started op and, if op has an owner, is the owner.
+// Others get 404, the same as for operations which don't exist.
+func (s *OperationsService) authorize(c Context, op *Operation) error {
+	_, m, err := s.server.services.get(op.Method)
+	if err != nil {
+		return NewNotFoundError("Operation %q not found", op.Name)
+	}
+	u, err := s.server.methodUser(c, op.Method, m)
+	if err != nil {
+		if _, ok := err.(*APIError); ok {
+			return err
+		}
+		return newAuthError("", err)
+	}
+	if op.Owner != "" && (u == nil || u.Email != op.Owner) {
+		return NewNotFoundError("Operation %q not found", op.Name)
+	}
+	return nil
+}
+
+// methodUser returns the user of the request of c, authenticated against
+// the allowlist of method m called name, or with EmailScope if the
+// allowlist has no scopes and s.DefaultAuth applies to m. It returns nil
+// if m is open to anyone.
+func (s *Server) methodUser(c Context, name string, m *ServiceMethod) (*user.User, error) {
+	al, err := s.allowlist(c, name, m)
+	if err != nil {
+		return nil, err
+	}
+	defaultAuth := s.DefaultAuth == AuthRequired && m.info != nil && !m.info.Public
+	scopes := al.Scopes
+	if len(scopes) == 0 && defaultAuth {
+		scopes = []string{EmailScope}
+	}
+	if len(scopes) == 0 && len(al.Audiences) == 0 && len(al.ClientIds) == 0 {
+		return nil, nil
+	}
+	return CurrentUser(c, scopes, al.Audiences, al.ClientIds)
+}
+
+// RegisterOperationsService registers OperationsService as a part of API
+// name of version ver, serving "operations.get" method at GET
+// operations/{name}.
+func (s *Server) RegisterOperationsService(name, ver string) (*RPCService, error) {
+	srv, err := s.RegisterService(&OperationsService{s}, name, ver, "", false)
+	if err != nil {
+		return nil, err
+	}
+	info := srv.MethodByName("Get").Info()
+	info.Name, info.Path, info.HTTPMethod = "operations.get", "operations/{name}", "GET"
+	// Polling an operation which is not done yet is still 200 OK.
+	info.StatusCode = http.StatusOK
+	info.Desc = "Returns status of a long-running operation."
+	return srv, nil
+}
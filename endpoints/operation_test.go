@@ -0,0 +1,197 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+type memOperationStore map[string]*Operation
+
+func (s memOperationStore) Get(c Context, name string) (*Operation, error) {
+	return s[name], nil
+}
+
+func (s memOperationStore) Put(c Context, op *Operation) error {
+	s[op.Name] = op
+	return nil
+}
+
+type ExportService struct{}
+
+func (s *ExportService) Start(c Context) (*Operation, error) {
+	return StartOperation(c)
+}
+
+func (s *ExportService) Secret(c Context) (*Operation, error) {
+	return StartOperation(c)
+}
+
+func TestServerOperations(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	store := memOperationStore{}
+	server := NewServer("")
+	server.Operations = store
+	export, err := server.RegisterService(&ExportService{}, "export", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := export.MethodByName("Secret").Info()
+	info.Scopes, info.ClientIds = []string{EmailScope}, []string{"my-client-id"}
+	if _, err := server.RegisterOperationsService("export", "v1"); err != nil {
+		t.Fatalf("RegisterOperationsService: %v", err)
+	}
+
+	serve := func(method, body string) *httptest.ResponseRecorder {
+		r, err := inst.NewRequest("POST", "/"+method, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+	start := func(method string) *Operation {
+		w := serve(method, "{}")
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("%s: w.Code = %d; want %d", method, w.Code, http.StatusAccepted)
+		}
+		op := &Operation{}
+		if err := json.Unmarshal(w.Body.Bytes(), op); err != nil {
+			t.Fatalf("%s: json.Unmarshal(%s) = %v", method, w.Body, err)
+		}
+		if op.Name == "" || op.Done || store[op.Name] == nil || store[op.Name].Method != method {
+			t.Fatalf("%s: op = %+v, stored %+v", method, op, store[op.Name])
+		}
+		return op
+	}
+
+	op := start("ExportService.Start")
+	w := serve("OperationsService.Get", `{"name":"`+op.Name+`"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"done":false`) {
+		t.Errorf("Get(%s) = %d %s; want 200 not done", op.Name, w.Code, w.Body)
+	}
+
+	store[op.Name] = &Operation{Name: op.Name, Method: "ExportService.Start", Done: true,
+		Response: json.RawMessage(`{"url":"gs://bucket/export"}`)}
+	w = serve("OperationsService.Get", `{"name":"`+op.Name+`"}`)
+	want := `{"name":"` + op.Name + `","done":true,"response":{"url":"gs://bucket/export"}}`
+	if w.Code != http.StatusOK || strings.TrimSpace(w.Body.String()) != want {
+		t.Errorf("Get(%s) = %d %s; want 200 %s", op.Name, w.Code, w.Body, want)
+	}
+
+	if w := serve("OperationsService.Get", `{"name":"unknown"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Get(unknown) = %d; want %d", w.Code, http.StatusNotFound)
+	}
+
+	// Polling requires the same auth as the originating method.
+	op = start("ExportService.Secret")
+	if w := serve("OperationsService.Get", `{"name":"`+op.Name+`"}`); w.Code != http.StatusUnauthorized {
+		t.Errorf("Get(%s) = %d; want %d", op.Name, w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestServerOperationsOwner(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	origParser, origCurrentUTC := jwtParser, currentUTC
+	defer func() {
+		jwtParser, currentUTC = origParser, origCurrentUTC
+	}()
+	jwtParser = func(Context, string, int64) (*signedJWT, error) {
+		token := jwtValidTokenObject
+		return &token, nil
+	}
+	currentUTC = func() time.Time { return jwtValidTokenTime }
+
+	store := memOperationStore{}
+	server := NewServer("")
+	server.Operations = store
+	export, err := server.RegisterService(&ExportService{}, "export", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := export.MethodByName("Secret").Info()
+	info.Scopes = []string{EmailScope}
+	info.Audiences, info.ClientIds = []string{"my-client-id"}, []string{"hello-android"}
+	ops, err := server.RegisterOperationsService("export", "v1")
+	if err != nil {
+		t.Fatalf("RegisterOperationsService: %v", err)
+	}
+
+	serve := func(method, body string, token bool) *httptest.ResponseRecorder {
+		r, err := inst.NewRequest("POST", "/"+method, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		if token {
+			r.Header.Set("Authorization", "Bearer "+jwtValidTokenString)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	w := serve("ExportService.Secret", "{}", true)
+	op := &Operation{}
+	if err := json.Unmarshal(w.Body.Bytes(), op); err != nil {
+		t.Fatalf("json.Unmarshal(%s) = %v", w.Body, err)
+	}
+	if owner := store[op.Name].Owner; owner != jwtValidTokenObject.Email {
+		t.Errorf("Owner = %q; want %q", owner, jwtValidTokenObject.Email)
+	}
+	if w := serve("OperationsService.Get", `{"name":"`+op.Name+`"}`, true); w.Code != http.StatusOK {
+		t.Errorf("Get(%s) by owner = %d; want %d", op.Name, w.Code, http.StatusOK)
+	}
+
+	store["theirs"] = &Operation{Name: "theirs", Method: "ExportService.Secret", Owner: "other@example.org"}
+	if w := serve("OperationsService.Get", `{"name":"theirs"}`, true); w.Code != http.StatusNotFound {
+		t.Errorf("Get(theirs) = %d; want %d", w.Code, http.StatusNotFound)
+	}
+
+	// Methods without scopes require auth under DefaultAuth, even when
+	// their operations are polled through a public method.
+	server.DefaultAuth = AuthRequired
+	ops.MethodByName("Get").Info().Public = true
+	store["open"] = &Operation{Name: "open", Method: "ExportService.Start"}
+	if w := serve("OperationsService.Get", `{"name":"open"}`, false); w.Code != http.StatusUnauthorized {
+		t.Errorf("Get(open) = %d; want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestOperationsServiceAPIDescriptor(t *testing.T) {
+	server := NewServer("")
+	ops, err := server.RegisterOperationsService("export", "v1")
+	if err != nil {
+		t.Fatalf("RegisterOperationsService: %v", err)
+	}
+	d := &APIDescriptor{}
+	if err := ops.APIDescriptor(d, "testhost"); err != nil {
+		t.Fatalf("APIDescriptor() = %v", err)
+	}
+	m := d.Methods["export.operations.get"]
+	if m == nil || m.Path != "operations/{name}" || m.HTTPMethod != "GET" {
+		t.Errorf("export.operations.get = %+v; want GET operations/{name}", m)
+	}
+	sd, ok := d.Descriptor.Schemas["Operation"]
+	if !ok {
+		t.Fatalf("Schemas = %v; want Operation", d.Descriptor.Schemas)
+	}
+	if prop := sd.Properties["response"]; prop == nil || prop.Type != "any" {
+		t.Errorf("Operation.response = %+v; want any", prop)
+	}
+}
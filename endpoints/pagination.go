@@ -0,0 +1,275 @@
+package endpoints
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPageTokenParam is used when Server.PageTokenParam is empty.
+const defaultPageTokenParam = "pageToken"
+
+// pageTokenExpiredReason is the Reason of errors of page tokens of expired
+// snapshots.
+const pageTokenExpiredReason = "pageTokenExpired"
+
+// Pagination describes neighbour pages of a list response.
+//
+// Embed it in a response type and populate tokens of the next and previous
+// pages. When Server.PaginationLinks is enabled, the server responds with
+// RFC 5988 Link header built from them, in addition to the tokens in
+// the response body.
+//
+// A list response is usually made of Pagination and a page of items:
+//
+//	type BookList struct {
+//	    endpoints.Pagination
+//	    Items []*Book `json:"items"`
+//	}
+type Pagination struct {
+	NextPageToken string `json:"nextPageToken,omitempty" endpoints:"desc=Token of the next page to pass as pageToken"`
+	PrevPageToken string `json:"prevPageToken,omitempty" endpoints:"desc=Token of the previous page to pass as pageToken"`
+}
+
+// SetNextCursor sets NextPageToken to cursor signed with key, or clears it
+// if cursor is empty, i.e. there are no more pages.
+func (p *Pagination) SetNextCursor(key []byte, cursor string) {
+	p.NextPageToken = ""
+	if cursor != "" {
+		p.NextPageToken = SignPageToken(key, cursor)
+	}
+}
+
+// SetPrevCursor is the same as SetNextCursor for PrevPageToken.
+func (p *Pagination) SetPrevCursor(key []byte, cursor string) {
+	p.PrevPageToken = ""
+	if cursor != "" {
+		p.PrevPageToken = SignPageToken(key, cursor)
+	}
+}
+
+// SetNextSnapshotCursor is the same as SetNextCursor but the token also
+// carries snap, see Snapshot.
+func (p *Pagination) SetNextSnapshotCursor(key []byte, cursor string, snap Snapshot) {
+	p.NextPageToken = ""
+	if cursor != "" {
+		p.NextPageToken = SignSnapshotPageToken(key, cursor, snap)
+	}
+}
+
+// SetPrevSnapshotCursor is the same as SetNextSnapshotCursor for
+// PrevPageToken.
+func (p *Pagination) SetPrevSnapshotCursor(key []byte, cursor string, snap Snapshot) {
+	p.PrevPageToken = ""
+	if cursor != "" {
+		p.PrevPageToken = SignSnapshotPageToken(key, cursor, snap)
+	}
+}
+
+// Snapshot is a consistency point of a paginated listing, e.g. a read
+// timestamp or a signature of the query, which a list method picks for
+// the first page and gets back with tokens of the following pages, so that
+// they are served relative to the first one rather than skipping or
+// repeating items which changed in between.
+type Snapshot struct {
+	// Marker identifies the snapshot to the method, which alone
+	// interprets it.
+	Marker string
+	// Expires, if set, is when the snapshot can't be served anymore, e.g.
+	// when data versions it refers to are gone. Page tokens of an expired
+	// snapshot are rejected, telling the client to restart pagination.
+	// It has a precision of seconds.
+	Expires time.Time
+}
+
+// PageRequest is embedded in request types of list methods. Its PageToken
+// is documented in discovery as the page token of the method, matching
+// tokens of Pagination.
+type PageRequest struct {
+	PageToken string `json:"pageToken,omitempty" endpoints:"desc=Token of the page to return from nextPageToken of a previous response"`
+}
+
+// Cursor returns the cursor of PageToken signed with key, or an empty
+// string for the first page. It returns 400 APIError if the token
+// is invalid.
+func (p *PageRequest) Cursor(key []byte) (string, error) {
+	if p.PageToken == "" {
+		return "", nil
+	}
+	return VerifyPageToken(key, p.PageToken)
+}
+
+// SnapshotCursor is the same as Cursor for tokens carrying a snapshot,
+// which it returns along with the cursor. Snapshot is zero for the first
+// page and for tokens made without a snapshot.
+//
+// A token of an expired snapshot results in 400 APIError with reason
+// "pageTokenExpired".
+func (p *PageRequest) SnapshotCursor(key []byte) (string, Snapshot, error) {
+	if p.PageToken == "" {
+		return "", Snapshot{}, nil
+	}
+	return VerifySnapshotPageToken(key, p.PageToken)
+}
+
+// SignPageToken returns an opaque page token of cursor, signed with key
+// so that clients can't forge cursors, e.g. to skip access checks.
+func SignPageToken(key []byte, cursor string) string {
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString([]byte(cursor)) + "." + enc.EncodeToString(pageTokenMAC(key, cursor))
+}
+
+// VerifyPageToken returns the cursor of token created with SignPageToken
+// and the same key. It returns 400 APIError if the token is malformed
+// or its signature doesn't match.
+func VerifyPageToken(key []byte, token string) (string, error) {
+	enc := base64.RawURLEncoding
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return "", NewBadRequestError("Invalid page token")
+	}
+	cursor, err := enc.DecodeString(token[:i])
+	if err != nil {
+		return "", NewBadRequestError("Invalid page token")
+	}
+	mac, err := enc.DecodeString(token[i+1:])
+	if err != nil || !hmac.Equal(mac, pageTokenMAC(key, string(cursor))) {
+		return "", NewBadRequestError("Invalid page token")
+	}
+	return string(cursor), nil
+}
+
+// SignSnapshotPageToken is the same as SignPageToken, with the token also
+// carrying snap.
+func SignSnapshotPageToken(key []byte, cursor string, snap Snapshot) string {
+	enc := base64.RawURLEncoding
+	var expires int64
+	if !snap.Expires.IsZero() {
+		expires = snap.Expires.Unix()
+	}
+	payload := enc.EncodeToString([]byte(cursor)) + "." +
+		enc.EncodeToString([]byte(snap.Marker)) + "." +
+		strconv.FormatInt(expires, 10)
+	return payload + "." + enc.EncodeToString(pageTokenMAC(key, payload))
+}
+
+// VerifySnapshotPageToken returns the cursor and the snapshot of token
+// created with SignSnapshotPageToken and the same key. Tokens created with
+// SignPageToken are accepted too, with zero Snapshot.
+//
+// It returns 400 APIError if the token is malformed or its signature
+// doesn't match, and 400 APIError with reason "pageTokenExpired" if its
+// snapshot has expired.
+func VerifySnapshotPageToken(key []byte, token string) (string, Snapshot, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) == 2 {
+		cursor, err := VerifyPageToken(key, token)
+		return cursor, Snapshot{}, err
+	}
+	invalid := NewBadRequestError("Invalid page token")
+	if len(parts) != 4 {
+		return "", Snapshot{}, invalid
+	}
+	enc := base64.RawURLEncoding
+	payload := strings.Join(parts[:3], ".")
+	mac, err := enc.DecodeString(parts[3])
+	if err != nil || !hmac.Equal(mac, pageTokenMAC(key, payload)) {
+		return "", Snapshot{}, invalid
+	}
+	cursor, err := enc.DecodeString(parts[0])
+	if err != nil {
+		return "", Snapshot{}, invalid
+	}
+	marker, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return "", Snapshot{}, invalid
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", Snapshot{}, invalid
+	}
+	snap := Snapshot{Marker: string(marker)}
+	if expires != 0 {
+		snap.Expires = time.Unix(expires, 0).UTC()
+		if !currentUTC().Before(snap.Expires) {
+			return "", Snapshot{}, &APIError{
+				Name:   http.StatusText(http.StatusBadRequest),
+				Msg:    "Page token has expired, restart from the first page",
+				Code:   http.StatusBadRequest,
+				Reason: pageTokenExpiredReason,
+			}
+		}
+	}
+	return string(cursor), snap, nil
+}
+
+// pageTokenMAC returns HMAC-SHA256 of cursor with key.
+func pageTokenMAC(key []byte, cursor string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(cursor))
+	return h.Sum(nil)
+}
+
+// pagination returns p. It makes types embedding Pagination implement
+// paginated interface.
+func (p *Pagination) pagination() *Pagination {
+	return p
+}
+
+// paginated is implemented by response types embedding Pagination.
+type paginated interface {
+	pagination() *Pagination
+}
+
+// pageTokenParam returns the name of a query parameter with a page token.
+func (s *Server) pageTokenParam() string {
+	if s.PageTokenParam != "" {
+		return s.PageTokenParam
+	}
+	return defaultPageTokenParam
+}
+
+// setLinkHeader sets Link header of a response with links to the next and
+// previous pages if respValue embeds Pagination. The links are made of
+// r URL with page token query parameter param replaced.
+// Links of empty page tokens are omitted.
+func setLinkHeader(w http.ResponseWriter, r *http.Request, param string, respValue reflect.Value) {
+	if !respValue.IsValid() || respValue.IsNil() {
+		return
+	}
+	p, ok := respValue.Interface().(paginated)
+	if !ok {
+		return
+	}
+	page := p.pagination()
+	if page == nil {
+		// respValue embeds a nil *Pagination.
+		return
+	}
+	var links []string
+	if page.NextPageToken != "" {
+		links = append(links, pageLink(r, param, page.NextPageToken, "next"))
+	}
+	if page.PrevPageToken != "" {
+		links = append(links, pageLink(r, param, page.PrevPageToken, "prev"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// pageLink returns a single Link header value of relation rel to a page
+// identified by token.
+func pageLink(r *http.Request, param, token, rel string) string {
+	u := *r.URL
+	q := u.Query()
+	q.Set(param, token)
+	u.RawQuery = q.Encode()
+	return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+}
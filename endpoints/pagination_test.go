@@ -0,0 +1,189 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type PaginatedList struct {
+	Pagination
+	Items []string `json:"items"`
+}
+
+type PaginatedPtrList struct {
+	*Pagination
+	Items []string `json:"items"`
+}
+
+func TestSetLinkHeader(t *testing.T) {
+	tts := []struct {
+		url  string
+		resp interface{}
+		want string
+	}{
+		{"/items?pageToken=b&q=x",
+			&PaginatedList{Pagination: Pagination{NextPageToken: "c", PrevPageToken: "a"}},
+			`</items?pageToken=c&q=x>; rel="next", </items?pageToken=a&q=x>; rel="prev"`},
+		{"/items",
+			&PaginatedList{Pagination: Pagination{NextPageToken: "c"}},
+			`</items?pageToken=c>; rel="next"`},
+		{"/items?pageToken=b",
+			&PaginatedList{Pagination: Pagination{PrevPageToken: "a"}},
+			`</items?pageToken=a>; rel="prev"`},
+		{"/items", &PaginatedList{}, ""},
+		{"/items", (*PaginatedList)(nil), ""},
+		{"/items", &PaginatedPtrList{}, ""},
+		{"/items",
+			&PaginatedPtrList{Pagination: &Pagination{NextPageToken: "c"}},
+			`</items?pageToken=c>; rel="next"`},
+		{"/items", &TestMsg{}, ""},
+	}
+	for i, tt := range tts {
+		u, _ := url.Parse(tt.url)
+		r := &http.Request{URL: u}
+		w := httptest.NewRecorder()
+		setLinkHeader(w, r, "pageToken", reflect.ValueOf(tt.resp))
+		if out := w.Header().Get("Link"); out != tt.want {
+			t.Errorf("%d: Link = %q; want %q", i, out, tt.want)
+		}
+	}
+}
+
+func TestPageToken(t *testing.T) {
+	key := []byte("secret")
+	token := SignPageToken(key, "cursor:42")
+	if strings.Contains(token, "cursor") {
+		t.Errorf("SignPageToken = %q; want an opaque token", token)
+	}
+	if cursor, err := VerifyPageToken(key, token); err != nil || cursor != "cursor:42" {
+		t.Errorf("VerifyPageToken(%q) = %q, %v; want %q, nil", token, cursor, err, "cursor:42")
+	}
+
+	forged := SignPageToken([]byte("other"), "cursor:42")
+	for _, bad := range []string{"", "cursor:42", forged, "!!." + token[strings.IndexByte(token, '.')+1:]} {
+		_, err := VerifyPageToken(key, bad)
+		if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusBadRequest {
+			t.Errorf("VerifyPageToken(%q) = %v; want 400 APIError", bad, err)
+		}
+	}
+}
+
+func TestPaginationCursors(t *testing.T) {
+	key := []byte("secret")
+	list := &PaginatedList{}
+	list.SetNextCursor(key, "next")
+	list.SetPrevCursor(key, "")
+
+	req := &PageRequest{PageToken: list.NextPageToken}
+	if cursor, err := req.Cursor(key); err != nil || cursor != "next" {
+		t.Errorf("Cursor() = %q, %v; want %q, nil", cursor, err, "next")
+	}
+	if list.PrevPageToken != "" {
+		t.Errorf("PrevPageToken = %q; want empty", list.PrevPageToken)
+	}
+	if cursor, err := (&PageRequest{}).Cursor(key); err != nil || cursor != "" {
+		t.Errorf("first page Cursor() = %q, %v; want empty", cursor, err)
+	}
+}
+
+func TestSnapshotPageToken(t *testing.T) {
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	now := time.Date(2016, 1, 31, 12, 0, 0, 0, time.UTC)
+	currentUTC = func() time.Time { return now }
+
+	key := []byte("secret")
+	snap := Snapshot{Marker: "read@1454241600", Expires: now.Add(10 * time.Minute)}
+	list := &PaginatedList{}
+	list.SetNextSnapshotCursor(key, "cursor:42", snap)
+	list.SetPrevSnapshotCursor(key, "", snap)
+	if list.PrevPageToken != "" {
+		t.Errorf("PrevPageToken = %q; want empty", list.PrevPageToken)
+	}
+	token := list.NextPageToken
+	if strings.Contains(token, "cursor") || strings.Contains(token, "read") {
+		t.Errorf("SignSnapshotPageToken = %q; want an opaque token", token)
+	}
+
+	req := &PageRequest{PageToken: token}
+	cursor, got, err := req.SnapshotCursor(key)
+	if err != nil || cursor != "cursor:42" || got != snap {
+		t.Errorf("SnapshotCursor() = %q, %+v, %v; want %q, %+v, nil", cursor, got, err, "cursor:42", snap)
+	}
+	if cursor, got, err := (&PageRequest{}).SnapshotCursor(key); err != nil || cursor != "" || got != (Snapshot{}) {
+		t.Errorf("first page SnapshotCursor() = %q, %+v, %v; want empty", cursor, got, err)
+	}
+	plain := &PageRequest{PageToken: SignPageToken(key, "cursor:7")}
+	if cursor, got, err := plain.SnapshotCursor(key); err != nil || cursor != "cursor:7" || got != (Snapshot{}) {
+		t.Errorf("SnapshotCursor() of plain token = %q, %+v, %v; want %q", cursor, got, err, "cursor:7")
+	}
+	forever := SignSnapshotPageToken(key, "c", Snapshot{Marker: "m"})
+	if _, got, err := VerifySnapshotPageToken(key, forever); err != nil || !got.Expires.IsZero() {
+		t.Errorf("VerifySnapshotPageToken(%q) = %+v, %v; want no expiry", forever, got, err)
+	}
+	if _, err := VerifyPageToken(key, token); err == nil {
+		t.Errorf("VerifyPageToken(%q) = nil; want error", token)
+	}
+
+	forged := SignSnapshotPageToken([]byte("other"), "cursor:42", snap)
+	parts := strings.Split(token, ".")
+	tampered := strings.Join([]string{parts[0], parts[1], "0", parts[3]}, ".")
+	for _, bad := range []string{"a.b.c", forged, tampered} {
+		_, _, err := VerifySnapshotPageToken(key, bad)
+		if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusBadRequest || apiErr.Reason != "" {
+			t.Errorf("VerifySnapshotPageToken(%q) = %v; want 400 APIError", bad, err)
+		}
+	}
+
+	now = now.Add(10 * time.Minute)
+	_, _, err = req.SnapshotCursor(key)
+	if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusBadRequest || apiErr.Reason != "pageTokenExpired" {
+		t.Errorf("SnapshotCursor() of expired snapshot = %v; want 400 APIError pageTokenExpired", err)
+	}
+}
+
+type BookListReq struct {
+	PageRequest
+	Limit int `json:"limit" endpoints:"pagesize,max=100"`
+}
+
+type BookService struct{}
+
+func (s *BookService) List(c Context, r *BookListReq) (*PaginatedList, error) {
+	return &PaginatedList{}, nil
+}
+
+func TestPaginationDescriptor(t *testing.T) {
+	server := NewServer("")
+	s, err := server.RegisterService(&BookService{}, "Books", "v1", "", true)
+	if err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+	m := s.MethodByName("List").Info()
+	m.HTTPMethod = "GET"
+	d := &APIDescriptor{}
+	if err := s.APIDescriptor(d, "testhost:1234"); err != nil {
+		t.Fatalf("APIDescriptor() = %v", err)
+	}
+
+	meth := d.Methods["books.list"]
+	if meth == nil {
+		t.Fatalf("want APIMethod books.list")
+	}
+	param := meth.Request.Params["pageToken"]
+	if param == nil || param.Type != "string" || param.Desc == "" {
+		t.Errorf("pageToken param = %#v; want a described string", param)
+	}
+	schema := d.Descriptor.Schemas["PaginatedList"]
+	if schema == nil {
+		t.Fatalf("want PaginatedList schema")
+	}
+	if prop := schema.Properties["nextPageToken"]; prop == nil || !strings.Contains(prop.Desc, "pageToken") {
+		t.Errorf("nextPageToken = %#v; want described as pageToken", prop)
+	}
+}
@@ -0,0 +1,98 @@
+package endpoints
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+)
+
+// patterns caches regexps of "pattern" field tags, compiled when services
+// are registered.
+var patterns = struct {
+	sync.Mutex
+	m map[string]*regexp.Regexp
+}{m: make(map[string]*regexp.Regexp)}
+
+// compilePattern returns compiled regexp expr, caching it.
+func compilePattern(expr string) (*regexp.Regexp, error) {
+	patterns.Lock()
+	defer patterns.Unlock()
+	if re, ok := patterns.m[expr]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	patterns.m[expr] = re
+	return re, nil
+}
+
+// compilePatterns compiles regexps of "pattern" tags of fields of struct
+// t, of its anonymous (embedded) structs and of structs nested in its
+// fields, the same fields validateTags enforces them on, or of elements
+// of slice t. It returns an error naming the field if a regexp is invalid
+// or the field isn't a string.
+func compilePatterns(t reflect.Type) error {
+	if t.Kind() == reflect.Slice && !isRawBody(t) {
+		t = indirectType(indirectType(t))
+	}
+	return compileStructPatterns(t, make(map[reflect.Type]bool))
+}
+
+// compileStructPatterns is compilePatterns for struct t. Structs in seen
+// were compiled already.
+func compileStructPatterns(t reflect.Type, seen map[reflect.Type]bool) error {
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := compileStructPatterns(field.Type, seen); err != nil {
+				return err
+			}
+			continue
+		}
+		if nested := nestedStruct(field.Type); nested != nil {
+			if err := compileStructPatterns(nested, seen); err != nil {
+				return err
+			}
+		}
+		tag, err := parseTag(field.Tag)
+		if err != nil || tag.pattern == "" {
+			continue
+		}
+		if indirectKind(field.Type) != reflect.String || field.Type.Kind() == reflect.Slice {
+			return fmt.Errorf("pattern of non-string field %s.%s", t.Name(), field.Name)
+		}
+		if _, err := compilePattern(tag.pattern); err != nil {
+			return fmt.Errorf("invalid pattern of field %s.%s: %v", t.Name(), field.Name, err)
+		}
+	}
+	return nil
+}
+
+// checkPattern returns 400 APIError naming the field if string value v,
+// or a string v points to, doesn't match regexp expr. Nil pointers and
+// empty strings aren't checked.
+func checkPattern(name string, v reflect.Value, expr string) error {
+	v = reflect.Indirect(v)
+	if !v.IsValid() || v.Kind() != reflect.String || v.Len() == 0 {
+		return nil
+	}
+	re, err := compilePattern(expr)
+	if err != nil {
+		return err
+	}
+	if !re.MatchString(v.String()) {
+		return NewBadRequestError("Value of field %q doesn't match pattern %q", name, expr)
+	}
+	return nil
+}
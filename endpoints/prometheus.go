@@ -0,0 +1,175 @@
+package endpoints
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/appengine"
+)
+
+// DefaultLatencyBuckets are upper bounds, in seconds, of latency histogram
+// buckets of PrometheusMetrics.
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// PrometheusMetrics is a MetricsCollector which accumulates request
+// counts, error counts and latencies of service methods in memory, and
+// serves them in Prometheus text exposition format:
+//
+//	metrics := endpoints.NewPrometheusMetrics()
+//	server.Metrics = append(server.Metrics, metrics)
+//	http.Handle("/admin/metrics", metrics)
+//
+// Metrics are per instance. Only app admins can fetch them, since method
+// names and statuses might tell more than the API descriptor does.
+type PrometheusMetrics struct {
+	// Buckets are upper bounds of latency histogram buckets in seconds,
+	// in increasing order. Defaults to DefaultLatencyBuckets. They're
+	// fixed when the first request is observed: changing them afterwards
+	// has no effect.
+	Buckets []float64
+
+	mu        sync.Mutex
+	bounds    []float64 // Buckets as of the first request
+	requests  map[methodStatus]uint64
+	latencies map[string]*latencyHistogram
+}
+
+// methodStatus labels request counts.
+type methodStatus struct {
+	method string
+	status int
+}
+
+// latencyHistogram is a latency histogram of a method.
+type latencyHistogram struct {
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheusMetrics returns a new PrometheusMetrics with default
+// buckets. The zero value is ready to use too.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{}
+}
+
+// init makes the maps of p and fixes its buckets, unless it's done
+// already. p.mu must be held.
+func (p *PrometheusMetrics) init() {
+	if p.requests != nil {
+		return
+	}
+	p.requests = make(map[methodStatus]uint64)
+	p.latencies = make(map[string]*latencyHistogram)
+	buckets := p.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	p.bounds = append([]float64(nil), buckets...)
+}
+
+// ObserveRequest implements MetricsCollector.
+func (p *PrometheusMetrics) ObserveRequest(method string, status int, latency time.Duration) {
+	secs := latency.Seconds()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.init()
+	buckets := p.bounds
+	p.requests[methodStatus{method, status}]++
+	h := p.latencies[method]
+	if h == nil {
+		h = &latencyHistogram{counts: make([]uint64, len(buckets))}
+		p.latencies[method] = h
+	}
+	if i := sort.SearchFloat64s(buckets, secs); i < len(buckets) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += secs
+}
+
+// ServeHTTP serves the metrics to GET requests of app admins.
+func (p *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, errorf(http.StatusMethodNotAllowed, "GET method required, got %q", r.Method))
+		return
+	}
+	if !isAdmin(appengine.NewContext(r)) {
+		w.Header().Set("Content-Type", "application/json")
+		writeError(w, NewForbiddenError("Admin required"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(p.exposition())
+}
+
+// exposition returns the metrics in Prometheus text format.
+func (p *PrometheusMetrics) exposition() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keys := make([]methodStatus, 0, len(p.requests))
+	for k := range p.requests {
+		keys = append(keys, k)
+	}
+	sort.Sort(byMethodStatus(keys))
+
+	var buf bytes.Buffer
+	buf.WriteString("# HELP endpoints_requests_total Requests to service methods.\n")
+	buf.WriteString("# TYPE endpoints_requests_total counter\n")
+	for _, k := range keys {
+		fmt.Fprintf(&buf, "endpoints_requests_total{method=%q,code=\"%d\"} %d\n",
+			k.method, k.status, p.requests[k])
+	}
+
+	buf.WriteString("# HELP endpoints_request_errors_total Requests to service methods which failed.\n")
+	buf.WriteString("# TYPE endpoints_request_errors_total counter\n")
+	for _, k := range keys {
+		if k.status >= http.StatusBadRequest {
+			fmt.Fprintf(&buf, "endpoints_request_errors_total{method=%q,code=\"%d\"} %d\n",
+				k.method, k.status, p.requests[k])
+		}
+	}
+
+	methods := make([]string, 0, len(p.latencies))
+	for m := range p.latencies {
+		methods = append(methods, m)
+	}
+	sort.Strings(methods)
+	buckets := p.bounds
+	buf.WriteString("# HELP endpoints_request_duration_seconds Latency of service methods.\n")
+	buf.WriteString("# TYPE endpoints_request_duration_seconds histogram\n")
+	for _, m := range methods {
+		h := p.latencies[m]
+		var cumulative uint64
+		for i, le := range buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(&buf, "endpoints_request_duration_seconds_bucket{method=%q,le=%q} %d\n",
+				m, strconv.FormatFloat(le, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&buf, "endpoints_request_duration_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", m, h.count)
+		fmt.Fprintf(&buf, "endpoints_request_duration_seconds_sum{method=%q} %s\n",
+			m, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(&buf, "endpoints_request_duration_seconds_count{method=%q} %d\n", m, h.count)
+	}
+	return buf.Bytes()
+}
+
+// byMethodStatus sorts request count labels by method, then status.
+type byMethodStatus []methodStatus
+
+func (s byMethodStatus) Len() int      { return len(s) }
+func (s byMethodStatus) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byMethodStatus) Less(i, j int) bool {
+	if s[i].method != s[j].method {
+		return s[i].method < s[j].method
+	}
+	return s[i].status < s[j].status
+}
@@ -0,0 +1,115 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"appengine/aetest"
+)
+
+func TestPrometheusMetricsExposition(t *testing.T) {
+	p := NewPrometheusMetrics()
+	p.Buckets = []float64{0.1, 1}
+	p.ObserveRequest("Svc.Get", 200, 50*time.Millisecond)
+	p.ObserveRequest("Svc.Get", 200, 500*time.Millisecond)
+	p.ObserveRequest("Svc.Get", 404, 2*time.Second)
+	p.ObserveRequest("Svc.Create", 200, 100*time.Millisecond)
+
+	want := `# HELP endpoints_requests_total Requests to service methods.
+# TYPE endpoints_requests_total counter
+endpoints_requests_total{method="Svc.Create",code="200"} 1
+endpoints_requests_total{method="Svc.Get",code="200"} 2
+endpoints_requests_total{method="Svc.Get",code="404"} 1
+# HELP endpoints_request_errors_total Requests to service methods which failed.
+# TYPE endpoints_request_errors_total counter
+endpoints_request_errors_total{method="Svc.Get",code="404"} 1
+# HELP endpoints_request_duration_seconds Latency of service methods.
+# TYPE endpoints_request_duration_seconds histogram
+endpoints_request_duration_seconds_bucket{method="Svc.Create",le="0.1"} 1
+endpoints_request_duration_seconds_bucket{method="Svc.Create",le="1"} 1
+endpoints_request_duration_seconds_bucket{method="Svc.Create",le="+Inf"} 1
+endpoints_request_duration_seconds_sum{method="Svc.Create"} 0.1
+endpoints_request_duration_seconds_count{method="Svc.Create"} 1
+endpoints_request_duration_seconds_bucket{method="Svc.Get",le="0.1"} 1
+endpoints_request_duration_seconds_bucket{method="Svc.Get",le="1"} 2
+endpoints_request_duration_seconds_bucket{method="Svc.Get",le="+Inf"} 3
+endpoints_request_duration_seconds_sum{method="Svc.Get"} 2.55
+endpoints_request_duration_seconds_count{method="Svc.Get"} 3
+`
+	if out := string(p.exposition()); out != want {
+		t.Errorf("exposition() =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestPrometheusMetricsZeroValue(t *testing.T) {
+	p := &PrometheusMetrics{Buckets: []float64{1}}
+	if out := string(p.exposition()); !strings.Contains(out, "endpoints_requests_total counter") {
+		t.Errorf("exposition() of no requests = %s", out)
+	}
+	p.ObserveRequest("Svc.Get", 200, 50*time.Millisecond)
+
+	// Buckets are fixed once requests are observed.
+	p.Buckets = []float64{0.1, 1, 10}
+	p.ObserveRequest("Svc.Get", 200, 5*time.Second)
+	p.ObserveRequest("Svc.List", 200, 5*time.Second)
+	out := string(p.exposition())
+	for _, want := range []string{
+		`endpoints_request_duration_seconds_bucket{method="Svc.Get",le="1"} 1`,
+		`endpoints_request_duration_seconds_count{method="Svc.Get"} 2`,
+		`endpoints_request_duration_seconds_bucket{method="Svc.List",le="1"} 0`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("exposition() =\n%s\nwant it to contain %s", out, want)
+		}
+	}
+	if strings.Contains(out, `le="10"`) {
+		t.Errorf("exposition() =\n%s\nwant buckets of the first request", out)
+	}
+}
+
+func TestPrometheusMetricsServeHTTP(t *testing.T) {
+	origIsAdmin := isAdmin
+	defer func() { isAdmin = origIsAdmin }()
+
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	p := NewPrometheusMetrics()
+	p.ObserveRequest("Svc.Get", 200, time.Millisecond)
+
+	tts := []struct {
+		method string
+		admin  bool
+		code   int
+	}{
+		{"POST", true, http.StatusMethodNotAllowed},
+		{"GET", false, http.StatusForbidden},
+		{"GET", true, http.StatusOK},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest(tt.method, "/admin/metrics", nil)
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		isAdmin = func(context.Context) bool { return tt.admin }
+
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		metrics := strings.Contains(w.Body.String(), "endpoints_requests_total")
+		if metrics != (tt.code == http.StatusOK) {
+			t.Errorf("%d: body = %q; want metrics = %v", i, w.Body, tt.code == http.StatusOK)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package endpoints
+
+import (
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// protobufContentType is a media type of protobuf encoded bodies.
+const protobufContentType = "application/x-protobuf"
+
+// typeOfProtoMessage is a reflect type of proto.Message.
+var typeOfProtoMessage = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// isProtoMessage returns true if values of type t, or pointers to them,
+// can be encoded as protobuf.
+func isProtoMessage(t reflect.Type) bool {
+	return t.Implements(typeOfProtoMessage) ||
+		(t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(typeOfProtoMessage))
+}
+
+// hasProtobufBody returns true if request r has a protobuf encoded body.
+func hasProtobufBody(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mt == protobufContentType
+}
+
+// acceptsProtobuf returns true if Accept header of request r lists protobuf
+// with non-zero quality.
+func acceptsProtobuf(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mt != protobufContentType {
+			continue
+		}
+		if q, ok := params["q"]; ok {
+			if n, err := strconv.ParseFloat(q, 64); err != nil || n <= 0 {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
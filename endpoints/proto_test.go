@@ -0,0 +1,110 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+// ProtoMsg is a hand-written protobuf message with a single string field:
+//
+//	message ProtoMsg { string name = 1; }
+type ProtoMsg struct {
+	Name string `json:"name"`
+}
+
+func (m *ProtoMsg) Reset()         { *m = ProtoMsg{} }
+func (m *ProtoMsg) String() string { return m.Name }
+func (m *ProtoMsg) ProtoMessage()  {}
+
+func (m *ProtoMsg) Marshal() ([]byte, error) {
+	if len(m.Name) > 127 {
+		return nil, errors.New("name too long")
+	}
+	return append([]byte{0x0a, byte(len(m.Name))}, m.Name...), nil
+}
+
+func (m *ProtoMsg) Unmarshal(b []byte) error {
+	if len(b) == 0 {
+		return nil
+	}
+	if len(b) < 2 || b[0] != 0x0a || int(b[1]) != len(b)-2 {
+		return errors.New("invalid ProtoMsg")
+	}
+	m.Name = string(b[2:])
+	return nil
+}
+
+func TestAcceptsProtobuf(t *testing.T) {
+	tts := []struct {
+		accept string
+		want   bool
+	}{
+		{"", false},
+		{"application/json", false},
+		{"application/x-protobuf", true},
+		{"application/json, application/x-protobuf;q=0.5", true},
+		{"application/x-protobuf;q=0, application/json", false},
+		{"*/*", false},
+	}
+	for i, tt := range tts {
+		r, _ := http.NewRequest("POST", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		if out := acceptsProtobuf(r); out != tt.want {
+			t.Errorf("%d: acceptsProtobuf(%q) = %v; want %v", i, tt.accept, out, tt.want)
+		}
+	}
+}
+
+func TestServerProtobuf(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	const (
+		pbType   = "application/x-protobuf"
+		jsonType = "application/json"
+	)
+	tts := []struct {
+		method, ctype, accept, in string
+		code                      int
+		outType, out              string
+	}{
+		{"Proto", pbType, pbType, "\x0a\x03abc", http.StatusOK, pbType, "\x0a\x03abc"},
+		{"Proto", pbType, "", "\x0a\x03abc", http.StatusOK, jsonType, `{"name":"abc"}` + "\n"},
+		{"Proto", "", pbType, `{"name":"abc"}`, http.StatusOK, pbType, "\x0a\x03abc"},
+		{"Proto", pbType, pbType, "\x0a\x05abc", http.StatusBadRequest, jsonType, ""},
+		{"Msg", "", pbType, `{"name":"abc"}`, http.StatusOK, jsonType, `{"name":"abc"}` + "\n"},
+		{"Msg", pbType, "", "\x0a\x03abc", http.StatusUnsupportedMediaType, jsonType, ""},
+	}
+	for i, tt := range tts {
+		path := "/ServerTestService." + tt.method
+		r, err := inst.NewRequest("POST", path, strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.ctype != "" {
+			r.Header.Set("Content-Type", tt.ctype)
+		}
+		r.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: %s w.Code = %d; want %d", i, path, w.Code, tt.code)
+		}
+		if ctype := w.Header().Get("Content-Type"); ctype != tt.outType {
+			t.Errorf("%d: %s Content-Type = %q; want %q", i, path, ctype, tt.outType)
+		}
+		if tt.out != "" && w.Body.String() != tt.out {
+			t.Errorf("%d: %s = %q; want %q", i, path, w.Body.String(), tt.out)
+		}
+	}
+}
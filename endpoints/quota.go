@@ -0,0 +1,125 @@
+package endpoints
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// quotaSweepInterval is how often expired quota windows are removed.
+const quotaSweepInterval = time.Minute
+
+// Quota limits how many requests a single client can make to a method
+// within a sliding time window.
+type Quota struct {
+	// Requests is a number of requests allowed within Window.
+	Requests int
+	// Window is a duration of the sliding window.
+	Window time.Duration
+}
+
+// quotaCounter counts requests of clients in memory, using two adjacent
+// fixed windows to approximate a sliding one. Its zero value is ready to use.
+type quotaCounter struct {
+	mu      sync.Mutex
+	windows map[string]*quotaWindow
+	swept   time.Time
+}
+
+// quotaWindow holds request counts of a single client and method.
+type quotaWindow struct {
+	size       time.Duration // size of the windows
+	start      time.Time     // start of the current window
+	prev, curr int           // counts of the previous and current windows
+}
+
+// allow records a request identified by key and returns true if it is
+// within quota q. Otherwise, it returns false and a duration after which
+// the client can retry.
+func (qc *quotaCounter) allow(key string, q Quota, now time.Time) (bool, time.Duration) {
+	qc.mu.Lock()
+	defer qc.mu.Unlock()
+
+	if qc.windows == nil {
+		qc.windows = make(map[string]*quotaWindow)
+	}
+	if now.Sub(qc.swept) >= quotaSweepInterval {
+		qc.sweep(now)
+	}
+	w, ok := qc.windows[key]
+	if !ok || w.size != q.Window {
+		w = &quotaWindow{size: q.Window, start: now}
+		qc.windows[key] = w
+	}
+
+	if elapsed := now.Sub(w.start); elapsed >= w.size {
+		if elapsed < 2*w.size {
+			w.prev = w.curr
+		} else {
+			w.prev = 0
+		}
+		w.curr = 0
+		w.start = w.start.Add(elapsed / w.size * w.size)
+	}
+
+	elapsed := now.Sub(w.start)
+	prevWeight := float64(w.size-elapsed) / float64(w.size)
+	if float64(w.prev)*prevWeight+float64(w.curr) >= float64(q.Requests) {
+		return false, w.size - elapsed
+	}
+	w.curr++
+	return true, 0
+}
+
+// sweep removes windows which have no effect at time now anymore.
+func (qc *quotaCounter) sweep(now time.Time) {
+	for key, w := range qc.windows {
+		if now.Sub(w.start) >= 2*w.size {
+			delete(qc.windows, key)
+		}
+	}
+	qc.swept = now
+}
+
+// checkQuota returns 429 APIError if the client making request r has
+// exceeded its quota of methodName calls, as configured in s.Quotas.
+// It also sets Retry-After header in such a case.
+func (s *Server) checkQuota(c Context, w http.ResponseWriter, r *http.Request, methodName string, m *ServiceMethod) error {
+	q, ok := s.Quotas[methodName]
+	if !ok || q.Requests <= 0 || q.Window <= 0 {
+		return nil
+	}
+	client := s.quotaClient(c, r, methodName, m)
+	ok, retry := s.quota.allow(methodName+" "+client, q, currentUTC())
+	if ok {
+		return nil
+	}
+	secs := int(math.Ceil(retry.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	return errorf(http.StatusTooManyRequests, "Quota of %s exceeded, retry in %ds", methodName, secs)
+}
+
+// quotaClient identifies a client making request r for quota purposes.
+//
+// A client is identified by its OAuth client ID if the request carries
+// a token valid for one of the method's allowed scopes and client IDs, and
+// by its IP address, as returned by ClientIP, otherwise.
+func (s *Server) quotaClient(c Context, r *http.Request, methodName string, m *ServiceMethod) string {
+	if getToken(r) == "" {
+		return "ip:" + ClientIP(c)
+	}
+	al, err := s.allowlist(c, methodName, m)
+	if err == nil && len(al.Scopes) > 0 && len(al.ClientIds) > 0 {
+		if scope, err := CurrentBearerTokenScope(c, al.Scopes, al.ClientIds); err == nil {
+			if id, err := c.CurrentOAuthClientID(scope); err == nil {
+				return "client:" + id
+			}
+		}
+	}
+	return "ip:" + ClientIP(c)
+}
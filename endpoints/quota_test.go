@@ -0,0 +1,104 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+func TestQuotaCounterAllow(t *testing.T) {
+	q := Quota{Requests: 2, Window: time.Minute}
+	start := time.Date(2015, 1, 31, 10, 0, 0, 0, time.UTC)
+	tts := []struct {
+		key   string
+		at    time.Duration
+		ok    bool
+		retry time.Duration
+	}{
+		{"a", 0, true, 0},
+		{"a", 10 * time.Second, true, 0},
+		{"a", 20 * time.Second, false, 40 * time.Second},
+		{"b", 20 * time.Second, true, 0},
+		// 2 requests of the previous window weigh 2*45/60 = 1.5
+		{"a", 75 * time.Second, true, 0},
+		{"a", 80 * time.Second, false, 40 * time.Second},
+		// previous window's weight 1*15/60 + 1 = 1.25
+		{"a", 165 * time.Second, true, 0},
+		// windows older than one size are forgotten
+		{"a", 5 * time.Minute, true, 0},
+		{"a", 5 * time.Minute, true, 0},
+		{"a", 5 * time.Minute, false, time.Minute},
+	}
+	qc := &quotaCounter{}
+	for i, tt := range tts {
+		ok, retry := qc.allow(tt.key, q, start.Add(tt.at))
+		if ok != tt.ok || retry != tt.retry {
+			t.Errorf("%d: allow(%q) at %s = %v, %s; want %v, %s",
+				i, tt.key, tt.at, ok, retry, tt.ok, tt.retry)
+		}
+	}
+}
+
+func TestQuotaCounterSweep(t *testing.T) {
+	q := Quota{Requests: 1, Window: time.Second}
+	now := time.Date(2015, 1, 31, 10, 0, 0, 0, time.UTC)
+	qc := &quotaCounter{}
+	qc.allow("a", q, now)
+	qc.allow("b", q, now.Add(quotaSweepInterval))
+	if _, exists := qc.windows["a"]; exists {
+		t.Errorf("qc.windows[%q] exists; want swept", "a")
+	}
+	if _, exists := qc.windows["b"]; !exists {
+		t.Errorf("qc.windows[%q] doesn't exist", "b")
+	}
+}
+
+func TestServerQuota(t *testing.T) {
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	now := time.Date(2015, 1, 31, 10, 0, 0, 0, time.UTC)
+	currentUTC = func() time.Time { return now }
+
+	server := createAPIServer()
+	server.Quotas = map[string]Quota{
+		"ServerTestService.Msg": {Requests: 1, Window: 30 * time.Second},
+	}
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		method, addr string
+		code         int
+		retryAfter   string
+	}{
+		{"Msg", "10.0.0.1:1234", http.StatusOK, ""},
+		{"Msg", "10.0.0.1:4321", http.StatusTooManyRequests, "30"},
+		{"Msg", "10.0.0.2:1234", http.StatusOK, ""},
+		{"Void", "10.0.0.1:1234", http.StatusOK, ""},
+		{"Void", "10.0.0.1:1234", http.StatusOK, ""},
+	}
+	for i, tt := range tts {
+		path := "/ServerTestService." + tt.method
+		r, err := inst.NewRequest("POST", path, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		r.RemoteAddr = tt.addr
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: %s w.Code = %d; want %d", i, path, w.Code, tt.code)
+		}
+		if ra := w.Header().Get("Retry-After"); ra != tt.retryAfter {
+			t.Errorf("%d: %s Retry-After = %q; want %q", i, path, ra, tt.retryAfter)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package endpoints
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ByteRange is a range of bytes of a content, requested with Range header.
+type ByteRange struct {
+	Start  int64
+	Length int64
+}
+
+// contentRange returns Content-Range header value of r within content
+// of size bytes.
+func (r *ByteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses Range header value h of a request for a content of
+// size bytes. It returns nil if the whole content should be served, which
+// is the case when h is empty, malformed or asks for several ranges.
+//
+// It returns 416 APIError if the range is not satisfiable, i.e. starts
+// past the end of the content. Ranges ending past the end are truncated.
+func ParseRange(h string, size int64) (*ByteRange, error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(h, prefix) || strings.Contains(h, ",") {
+		return nil, nil
+	}
+	spec := strings.TrimSpace(h[len(prefix):])
+	i := strings.IndexByte(spec, '-')
+	if i < 0 {
+		return nil, nil
+	}
+	first, last := strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+
+	if first == "" {
+		// Suffix range, e.g. "-500" for the last 500 bytes.
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n < 0 {
+			return nil, nil
+		}
+		if n == 0 || size == 0 {
+			return nil, errRangeNotSatisfiable(h, size)
+		}
+		if n > size {
+			n = size
+		}
+		return &ByteRange{size - n, n}, nil
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, nil
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return nil, nil
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return nil, errRangeNotSatisfiable(h, size)
+	}
+	return &ByteRange{start, end - start + 1}, nil
+}
+
+// errRangeNotSatisfiable returns 416 APIError of Range header value h.
+func errRangeNotSatisfiable(h string, size int64) error {
+	return errorf(http.StatusRequestedRangeNotSatisfiable,
+		"Range %q is not satisfiable for %d bytes", h, size)
+}
+
+// RangeDownload is a Responder which serves a file of known size, honoring
+// Range requests so that clients can resume interrupted downloads.
+//
+// A satisfiable range results in 206 Partial Content with Content-Range
+// header, an unsatisfiable one in 416 Requested Range Not Satisfiable.
+// Other requests get the whole file.
+type RangeDownload struct {
+	// ContentType is a MIME type of the file.
+	// Defaults to "application/octet-stream".
+	ContentType string
+	// Filename, if not empty, makes browsers save the file under this name.
+	Filename string
+	// Range is Range header of the request, i.e.
+	// c.HTTPRequest().Header.Get("Range").
+	Range string
+	// Size is the length of the file in bytes.
+	Size int64
+	// Content reads the file.
+	Content io.ReaderAt `json:"-"`
+}
+
+// WriteResponse is RangeDownload's implementation of Responder interface.
+func (d *RangeDownload) WriteResponse(w http.ResponseWriter) error {
+	h := w.Header()
+	h.Set("Accept-Ranges", "bytes")
+	br, err := ParseRange(d.Range, d.Size)
+	if err != nil {
+		h.Set("Content-Range", fmt.Sprintf("bytes */%d", d.Size))
+		return err
+	}
+
+	ct := d.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	h.Set("Content-Type", ct)
+	if d.Filename != "" {
+		h.Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": d.Filename}))
+	}
+
+	status := http.StatusOK
+	if br == nil {
+		br = &ByteRange{0, d.Size}
+	} else {
+		status = http.StatusPartialContent
+		h.Set("Content-Range", br.contentRange(d.Size))
+	}
+	h.Set("Content-Length", strconv.FormatInt(br.Length, 10))
+	w.WriteHeader(status)
+	if br.Length == 0 || d.Content == nil {
+		return nil
+	}
+	_, err = io.Copy(w, io.NewSectionReader(d.Content, br.Start, br.Length))
+	return err
+}
@@ -0,0 +1,80 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tts := []struct {
+		h    string
+		size int64
+		want *ByteRange
+		code int
+	}{
+		{"", 100, nil, 0},
+		{"bytes=0-9", 100, &ByteRange{0, 10}, 0},
+		{"bytes=90-", 100, &ByteRange{90, 10}, 0},
+		{"bytes=90-200", 100, &ByteRange{90, 10}, 0},
+		{"bytes=-10", 100, &ByteRange{90, 10}, 0},
+		{"bytes=-200", 100, &ByteRange{0, 100}, 0},
+		{"bytes=100-", 100, nil, http.StatusRequestedRangeNotSatisfiable},
+		{"bytes=-0", 100, nil, http.StatusRequestedRangeNotSatisfiable},
+		{"bytes=0-", 0, nil, http.StatusRequestedRangeNotSatisfiable},
+		{"bytes=0-9,20-29", 100, nil, 0},
+		{"bytes=9-0", 100, nil, 0},
+		{"bytes=x-9", 100, nil, 0},
+		{"items=0-9", 100, nil, 0},
+	}
+	for i, tt := range tts {
+		br, err := ParseRange(tt.h, tt.size)
+		if tt.code != 0 {
+			if apiErr, ok := err.(*APIError); !ok || apiErr.Code != tt.code {
+				t.Errorf("%d: ParseRange(%q, %d) = %v; want %d APIError", i, tt.h, tt.size, err, tt.code)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(br, tt.want) {
+			t.Errorf("%d: ParseRange(%q, %d) = %+v, %v; want %+v", i, tt.h, tt.size, br, err, tt.want)
+		}
+	}
+}
+
+func TestRangeDownload(t *testing.T) {
+	const content = "0123456789"
+	tts := []struct {
+		rng, body, contentRange string
+		code                    int
+	}{
+		{"", content, "", http.StatusOK},
+		{"bytes=2-4", "234", "bytes 2-4/10", http.StatusPartialContent},
+		{"bytes=-3", "789", "bytes 7-9/10", http.StatusPartialContent},
+		{"bytes=10-", "", "bytes */10", http.StatusRequestedRangeNotSatisfiable},
+	}
+	for i, tt := range tts {
+		d := &RangeDownload{
+			Filename: "digits.txt",
+			Range:    tt.rng,
+			Size:     int64(len(content)),
+			Content:  strings.NewReader(content),
+		}
+		w := httptest.NewRecorder()
+		NewServer("").writeResponder(nil, w, nil, d)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		if h := w.Header().Get("Content-Range"); h != tt.contentRange {
+			t.Errorf("%d: Content-Range = %q; want %q", i, h, tt.contentRange)
+		}
+		if h := w.Header().Get("Accept-Ranges"); h != "bytes" {
+			t.Errorf("%d: Accept-Ranges = %q; want bytes", i, h)
+		}
+		if tt.code != http.StatusRequestedRangeNotSatisfiable && w.Body.String() != tt.body {
+			t.Errorf("%d: body = %q; want %q", i, w.Body, tt.body)
+		}
+	}
+}
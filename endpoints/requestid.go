@@ -0,0 +1,30 @@
+package endpoints
+
+import "net/http"
+
+// requestLogIDHeader is set by App Engine front end to the ID of
+// the request in App Engine logs.
+const requestLogIDHeader = "X-Appengine-Request-Log-Id"
+
+// AppEngineRequestID returns the ID App Engine assigned to the request of
+// c, which identifies it in App Engine logs, or an empty string when not
+// running on App Engine. See also Server.ErrorRequestID.
+func AppEngineRequestID(c Context) string {
+	return appEngineRequestID(c.HTTPRequest())
+}
+
+// appEngineRequestID returns App Engine request log ID of request r,
+// or an empty string if r didn't come through App Engine front end.
+func appEngineRequestID(r *http.Request) string {
+	return r.Header.Get(requestLogIDHeader)
+}
+
+// errorResponse returns an error response of err to request r, with
+// App Engine request ID if s.ErrorRequestID is true.
+func (s *Server) errorResponse(r *http.Request, err error) *errorResponse {
+	errResp := newErrorResponse(err)
+	if s.ErrorRequestID {
+		errResp.RequestID = appEngineRequestID(r)
+	}
+	return errResp
+}
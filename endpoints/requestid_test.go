@@ -0,0 +1,70 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+type RequestIDService struct{}
+
+func (s *RequestIDService) Get(c Context) (*TestMsg, error) {
+	return &TestMsg{Name: AppEngineRequestID(c)}, nil
+}
+
+func TestServerRequestID(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	logger := &recordingAccessLogger{}
+	server := NewServer("")
+	server.AccessLogger = logger
+	if _, err := server.RegisterService(&RequestIDService{}, "rid", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+
+	tts := []struct {
+		path, id string
+		errorID  bool
+		want     string
+	}{
+		{"/RequestIDService.Get", "5f1e0aa4", false, "5f1e0aa4"},
+		{"/RequestIDService.Get", "", true, ""},
+		{"/RequestIDService.Nope", "5f1e0aa4", true, "5f1e0aa4"},
+		{"/RequestIDService.Nope", "5f1e0aa4", false, ""},
+		{"/RequestIDService.Nope", "", true, ""},
+	}
+	for i, tt := range tts {
+		server.ErrorRequestID = tt.errorID
+		logger.entries = nil
+		r, err := inst.NewRequest("POST", tt.path, strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.id != "" {
+			r.Header.Set("X-AppEngine-Request-Log-Id", tt.id)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		var out struct {
+			Name      string `json:"name"`
+			RequestID string `json:"request_id"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("%d: json.Unmarshal(%s) = %v", i, w.Body, err)
+		}
+		if got := out.Name + out.RequestID; got != tt.want {
+			t.Errorf("%d: request ID = %q; want %q (%s)", i, got, tt.want, w.Body)
+		}
+		if len(logger.entries) != 1 || logger.entries[0].RequestID != tt.id {
+			t.Errorf("%d: access log entries = %+v; want RequestID %q", i, logger.entries, tt.id)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+)
+
+// requiredIfReason is the Reason of errors returned when a request lacks
+// a field required by a "requiredif" tag.
+const requiredIfReason = "requiredField"
+
+// requiredIfIndex returns the index of a field of struct t, or of its
+// anonymous (embedded) structs, named name in JSON, for
+// reflect.Value.FieldByIndex.
+func requiredIfIndex(t reflect.Type, name string) ([]int, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if idx, ok := requiredIfIndex(field.Type, name); ok {
+				return append([]int{i}, idx...), true
+			}
+			continue
+		}
+		if jsonFieldName(&field) == name {
+			return []int{i}, true
+		}
+	}
+	return nil, false
+}
+
+// checkRequiredIf returns an error naming the field if a "requiredif" tag
+// of a field of struct t, of its anonymous (embedded) structs or of
+// structs nested in its fields, or of elements of slice t, references
+// a field which doesn't exist. Like validateTags, the referenced field is
+// looked up in the struct the tagged field belongs to.
+func checkRequiredIf(t reflect.Type) error {
+	if t.Kind() == reflect.Slice && !isRawBody(t) {
+		t = indirectType(indirectType(t))
+	}
+	return checkStructRequiredIf(t, make(map[reflect.Type]bool))
+}
+
+// checkStructRequiredIf is checkRequiredIf for struct t. Structs in seen
+// were checked already.
+func checkStructRequiredIf(t reflect.Type, seen map[reflect.Type]bool) error {
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := checkStructRequiredIf(field.Type, seen); err != nil {
+				return err
+			}
+			continue
+		}
+		if nested := nestedStruct(field.Type); nested != nil {
+			if err := checkStructRequiredIf(nested, seen); err != nil {
+				return err
+			}
+		}
+		tag, err := parseTag(field.Tag)
+		if err != nil || tag.requiredIf == "" {
+			continue
+		}
+		if _, ok := requiredIfIndex(t, tag.requiredIf); !ok {
+			return fmt.Errorf("requiredif of field %s.%s references unknown field %q",
+				t.Name(), field.Name, tag.requiredIf)
+		}
+	}
+	return nil
+}
+
+// checkRequiredIfField returns 400 APIError naming the field if value v
+// of field name is empty while field ref of struct sv has value want.
+func checkRequiredIfField(name string, v, sv reflect.Value, ref, want string) error {
+	if !isEmptyValue(v) {
+		return nil
+	}
+	idx, ok := requiredIfIndex(sv.Type(), ref)
+	if !ok || !hasValue(sv.FieldByIndex(idx), want) {
+		return nil
+	}
+	return &APIError{
+		Name:   http.StatusText(http.StatusBadRequest),
+		Msg:    fmt.Sprintf("Field %q is required when %q is %q", name, ref, want),
+		Code:   http.StatusBadRequest,
+		Reason: requiredIfReason,
+	}
+}
+
+// hasValue returns true if v, or the value v points to, formats as want.
+// Nil pointers have no value.
+func hasValue(v reflect.Value, want string) bool {
+	v = reflect.Indirect(v)
+	return v.IsValid() && fmt.Sprint(v.Interface()) == want
+}
+
+// isEmptyValue returns true if v is a nil pointer or interface, an empty
+// string, slice or map, or a zero number or bool, the same values
+// encoding/json omits with "omitempty".
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,94 @@
+package endpoints
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type PaymentMsg struct {
+	Method    string `json:"paymentMethod"`
+	CardToken string `json:"cardToken" endpoints:"requiredif=paymentMethod=card"`
+	Gift      *bool  `json:"gift,omitempty"`
+	Note      string `json:"note" endpoints:"requiredif=gift=true"`
+}
+
+type OrderMsg struct {
+	PaymentMsg
+	Items []string `json:"items"`
+}
+
+type PaymentService struct{}
+
+func (s *PaymentService) Pay(r *http.Request, req *OrderMsg) error {
+	return nil
+}
+
+type BadRequiredIfMsg struct {
+	CardToken string `endpoints:"requiredif=paymentMethod=card"`
+}
+
+type BadRequiredIfService struct{}
+
+func (s *BadRequiredIfService) Pay(r *http.Request, req *BadRequiredIfMsg) error {
+	return nil
+}
+
+type BadNestedRequiredIfMsg struct {
+	Payments []BadRequiredIfMsg `json:"payments"`
+}
+
+type BadNestedRequiredIfService struct{}
+
+func (s *BadNestedRequiredIfService) Pay(r *http.Request, req *BadNestedRequiredIfMsg) error {
+	return nil
+}
+
+func TestValidateRequestRequiredIf(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	yes, no := true, false
+	tts := []struct {
+		in   *OrderMsg
+		want string // error message, or "" for none
+	}{
+		{&OrderMsg{}, ""},
+		{&OrderMsg{PaymentMsg: PaymentMsg{Method: "cash"}}, ""},
+		{&OrderMsg{PaymentMsg: PaymentMsg{Method: "card", CardToken: "tok"}}, ""},
+		{&OrderMsg{PaymentMsg: PaymentMsg{Method: "card"}}, `Field "cardToken" is required when "paymentMethod" is "card"`},
+		{&OrderMsg{PaymentMsg: PaymentMsg{Gift: &no}}, ""},
+		{&OrderMsg{PaymentMsg: PaymentMsg{Gift: &yes, Note: "Enjoy"}}, ""},
+		{&OrderMsg{PaymentMsg: PaymentMsg{Gift: &yes}}, `Field "note" is required when "gift" is "true"`},
+	}
+	for i, tt := range tts {
+		err := validateRequest(c, reflect.ValueOf(tt.in))
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%d: validateRequest(%#v) = %v; want nil", i, tt.in, err)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest || apiErr.Msg != tt.want || apiErr.Reason != requiredIfReason {
+			t.Errorf("%d: validateRequest(%#v) = %#v; want 400 %q", i, tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestRegisterServiceRequiredIf(t *testing.T) {
+	server := NewServer("")
+	if _, err := server.RegisterService(&PaymentService{}, "Payments", "v1", "", true); err != nil {
+		t.Errorf("RegisterService(PaymentService) = %v; want nil", err)
+	}
+	_, err := server.RegisterService(&BadRequiredIfService{}, "Bad", "v1", "", true)
+	if err == nil || !strings.Contains(err.Error(), `BadRequiredIfMsg.CardToken references unknown field "paymentMethod"`) {
+		t.Errorf("RegisterService(BadRequiredIfService) = %v; want unknown field error", err)
+	}
+	_, err = server.RegisterService(&BadNestedRequiredIfService{}, "BadNested", "v1", "", true)
+	if err == nil || !strings.Contains(err.Error(), `BadRequiredIfMsg.CardToken references unknown field "paymentMethod"`) {
+		t.Errorf("RegisterService(BadNestedRequiredIfService) = %v; want unknown field error", err)
+	}
+}
@@ -0,0 +1,187 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"google.golang.org/appengine/log"
+)
+
+// ResponseCheck tells whether responses are checked against their JSON
+// Schema, see Server.ResponseCheck.
+type ResponseCheck int
+
+const (
+	// ResponseCheckOff sends responses unchecked.
+	ResponseCheckOff ResponseCheck = iota
+	// ResponseCheckLog logs responses which violate their schema.
+	ResponseCheckLog
+	// ResponseCheckFail logs responses which violate their schema and
+	// responds with 500 Internal Server Error instead.
+	ResponseCheckFail
+)
+
+// checkResponse checks JSON body of response value respValue against its
+// schema according to s.ResponseCheck. It returns 500 APIError if body
+// violates the schema and violations fail.
+func (s *Server) checkResponse(r *http.Request, respValue reflect.Value, body []byte) error {
+	if s.ResponseCheck == ResponseCheckOff {
+		return nil
+	}
+	err := checkResponseSchema(respValue.Type(), body)
+	if err == nil {
+		return nil
+	}
+	c := NewContext(r)
+	log.Errorf(c, "Response violates its schema: %v", err)
+	if s.ResponseCheck == ResponseCheckFail {
+		return NewInternalServerError("Response violates its schema: %v", err)
+	}
+	return nil
+}
+
+// checkResponseSchema returns an error describing the first violation of
+// the JSON Schema of response type t, as returned by Server.JSONSchema, by
+// JSON body of a value of t. Schemas are generated on every call since
+// checks are meant for debugging.
+func checkResponseSchema(t reflect.Type, body []byte) error {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	name := schemaNameForType(t)
+	schemas := make(map[string]*APISchemaDescriptor)
+	if err := addSchemaFromType(schemas, name, t); err != nil {
+		return err
+	}
+	docs := make(map[string]*JSONSchema, len(schemas))
+	for n, sd := range schemas {
+		docs[n] = jsonSchemaFromDescriptor(sd)
+	}
+	data, err := unmarshalGeneric(body)
+	if err != nil {
+		return err
+	}
+	return checkJSONSchema(docs, docs[name], data, "response")
+}
+
+// checkJSONSchema returns an error naming path of value v, decoded from
+// JSON with numbers as json.Number, if v violates schema js. docs are
+// schemas js may refer to, by name.
+//
+// Since int64 fields are described as strings of format int64 but encoded
+// as numbers, integer numbers are accepted for such strings.
+func checkJSONSchema(docs map[string]*JSONSchema, js *JSONSchema, v interface{}, path string) error {
+	if js == nil {
+		return nil
+	}
+	if js.Ref != "" {
+		return checkJSONSchema(docs, docs[strings.TrimSuffix(js.Ref, ".json")], v, path)
+	}
+	if len(js.OneOf) > 0 {
+		for _, one := range js.OneOf {
+			if checkJSONSchema(docs, one, v, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s matches none of its types", path)
+	}
+	if v == nil {
+		return nil
+	}
+
+	switch js.Type {
+	case "object":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an object", path)
+		}
+		for _, name := range js.Required {
+			if val, ok := m[name]; !ok || val == nil {
+				return fmt.Errorf("%s.%s is required", path, name)
+			}
+		}
+		names := make([]string, 0, len(js.Properties))
+		for name := range js.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if err := checkJSONSchema(docs, js.Properties[name], m[name], path+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s is not an array", path)
+		}
+		if len(items) < js.MinItems || js.MaxItems > 0 && len(items) > js.MaxItems {
+			return fmt.Errorf("%s has %d items, want %d to %d", path, len(items), js.MinItems, js.MaxItems)
+		}
+		for i, item := range items {
+			if err := checkJSONSchema(docs, js.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		if n, ok := v.(json.Number); ok && (js.Format == "int64" || js.Format == "uint64") {
+			if _, err := n.Int64(); err == nil || js.Format == "uint64" {
+				return nil
+			}
+		}
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s is not a string", path)
+		}
+		if len(js.Enum) > 0 && s != "" && !contains(js.Enum, s) {
+			return fmt.Errorf("%s %q is not one of %s", path, s, strings.Join(js.Enum, ", "))
+		}
+		if js.Pattern != "" && s != "" {
+			re, err := compilePattern(js.Pattern)
+			if err != nil {
+				return err
+			}
+			if !re.MatchString(s) {
+				return fmt.Errorf("%s %q doesn't match pattern %q", path, s, js.Pattern)
+			}
+		}
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s is not a number", path)
+		}
+		f, err := n.Float64()
+		if err != nil || js.Type == "integer" && f != float64(int64(f)) {
+			return fmt.Errorf("%s is not an integer", path)
+		}
+		if min, ok := toFloat(js.Minimum); ok && f < min {
+			return fmt.Errorf("%s %v is less than %v", path, n, js.Minimum)
+		}
+		if max, ok := toFloat(js.Maximum); ok && f > max {
+			return fmt.Errorf("%s %v is greater than %v", path, n, js.Maximum)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s is not a boolean", path)
+		}
+	}
+	return nil
+}
+
+// toFloat converts numeric v to float64.
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
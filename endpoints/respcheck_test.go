@@ -0,0 +1,89 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+type RespCheckService struct{}
+
+func (s *RespCheckService) Get(c Context, req *TestMsg) (*JSList, error) {
+	if req.Name == "bad" {
+		return &JSList{Items: []*JSItem{{ID: 1, Kind: "music"}}}, nil
+	}
+	return &JSList{Items: []*JSItem{{ID: 1, Kind: "book", Rating: 3}}}, nil
+}
+
+func TestCheckResponseSchema(t *testing.T) {
+	tts := []struct {
+		body string
+		err  string
+	}{
+		{`{}`, ""},
+		{`{"items":[{"id":1,"kind":"book"}]}`, ""},
+		{`{"items":[{"id":"12345678901234567890","kind":"film","slug":"a-b","rating":5}]}`, ""},
+		{`{"best":null,"items":null}`, ""},
+		{`[]`, "response is not an object"},
+		{`{"items":[]}`, "response.items has 0 items"},
+		{`{"items":{}}`, "response.items is not an array"},
+		{`{"items":[{"kind":"book"}]}`, "response.items[0].id is required"},
+		{`{"best":{"id":1,"kind":null}}`, "response.best.kind is required"},
+		{`{"best":{"id":1,"kind":"music"}}`, `response.best.kind "music" is not one of book, film`},
+		{`{"best":{"id":1,"kind":"book","slug":"A"}}`, `response.best.slug "A" doesn't match`},
+		{`{"best":{"id":1,"kind":"book","rating":6}}`, "response.best.rating 6 is greater than 5"},
+		{`{"best":{"id":1,"kind":"book","rating":1.5}}`, "response.best.rating is not an integer"},
+		{`{"best":{"id":true,"kind":"book"}}`, "response.best.id is not a string"},
+	}
+	typ := reflect.TypeOf(&JSList{})
+	for i, tt := range tts {
+		err := checkResponseSchema(typ, []byte(tt.body))
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%d: checkResponseSchema(%s) = %v; want nil", i, tt.body, err)
+		case tt.err != "" && (err == nil || !strings.HasPrefix(err.Error(), tt.err)):
+			t.Errorf("%d: checkResponseSchema(%s) = %v; want %q...", i, tt.body, err, tt.err)
+		}
+	}
+}
+
+func TestServerResponseCheck(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	if _, err := server.RegisterService(&RespCheckService{}, "check", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+
+	tts := []struct {
+		check ResponseCheck
+		name  string
+		code  int
+	}{
+		{ResponseCheckOff, "bad", http.StatusOK},
+		{ResponseCheckLog, "bad", http.StatusOK},
+		{ResponseCheckFail, "good", http.StatusOK},
+		{ResponseCheckFail, "bad", http.StatusInternalServerError},
+	}
+	for i, tt := range tts {
+		server.ResponseCheck = tt.check
+		body := strings.NewReader(`{"name":"` + tt.name + `"}`)
+		r, err := inst.NewRequest("POST", "/RespCheckService.Get", body)
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+		}
+	}
+}
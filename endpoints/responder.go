@@ -0,0 +1,161 @@
+package endpoints
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+
+	"google.golang.org/appengine/log"
+)
+
+// streamFlushSize is a number of bytes written by a Responder after which
+// the response is flushed to the client.
+const streamFlushSize = 32 << 10
+
+// typeOfResponder is a reflect type of Responder.
+var typeOfResponder = reflect.TypeOf((*Responder)(nil)).Elem()
+
+// Responder is implemented by response types which write their own HTTP
+// response instead of being encoded as JSON, e.g. file downloads.
+//
+// Responders are not described in the API config and the server skips its
+// default response headers, including Content-Type, for them. The response
+// is flushed periodically, so large streams don't need to be buffered.
+type Responder interface {
+	// WriteResponse writes the whole response to w.
+	// An error returned before anything is written to w is sent to the
+	// client the same way errors of service methods are. Later errors are
+	// only logged since the response is already underway.
+	WriteResponse(w http.ResponseWriter) error
+}
+
+// Download is a Responder which streams a file to the client, e.g. a CSV
+// generated on the fly.
+type Download struct {
+	// ContentType is a MIME type of the file.
+	// Defaults to "application/octet-stream".
+	ContentType string
+	// Filename, if not empty, makes browsers save the file under this name.
+	Filename string
+	// Body writes the file content to w.
+	Body func(w io.Writer) error `json:"-"`
+}
+
+// WriteResponse is Download's implementation of Responder interface.
+func (d *Download) WriteResponse(w http.ResponseWriter) error {
+	ct := d.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", ct)
+	if d.Filename != "" {
+		w.Header().Set("Content-Disposition",
+			mime.FormatMediaType("attachment", map[string]string{"filename": d.Filename}))
+	}
+	if d.Body == nil {
+		w.WriteHeader(http.StatusOK)
+		return nil
+	}
+	return d.Body(w)
+}
+
+// Redirect is a Responder which redirects the client to another URL, e.g.
+// of a short link. Since it's also an error, methods can return it either
+// as their response or as their error, whatever their response type is:
+//
+//	return nil, &endpoints.Redirect{URL: link.Target}
+//
+// Requests are still authenticated and validated before the method is
+// called, so only methods which get that far can redirect.
+type Redirect struct {
+	// URL is the redirect target, set as Location header.
+	URL string
+	// Status is one of 301, 302, 303, 307 or 308. Defaults to 302 Found.
+	Status int
+}
+
+// Error is Redirect's implementation of error interface.
+func (rd *Redirect) Error() string {
+	return fmt.Sprintf("redirect %d to %s", rd.status(), rd.URL)
+}
+
+// status returns rd.Status or its default.
+func (rd *Redirect) status() int {
+	if rd.Status == 0 {
+		return http.StatusFound
+	}
+	return rd.Status
+}
+
+// WriteResponse is Redirect's implementation of Responder interface.
+func (rd *Redirect) WriteResponse(w http.ResponseWriter) error {
+	switch status := rd.status(); status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		w.Header().Set("Location", rd.URL)
+		w.WriteHeader(status)
+		return nil
+	}
+	return NewInternalServerError("Invalid redirect status %d", rd.Status)
+}
+
+// asResponder returns respValue as a Responder, if it is a non-nil one.
+func asResponder(respValue reflect.Value) (Responder, bool) {
+	if !respValue.IsValid() || respValue.IsNil() || !respValue.Type().Implements(typeOfResponder) {
+		return nil, false
+	}
+	return respValue.Interface().(Responder), true
+}
+
+// writeResponder lets rs write the response to r, periodically flushing
+// it. An error before anything is written is written in s.ErrorFormat.
+func (s *Server) writeResponder(c Context, w http.ResponseWriter, r *http.Request, rs Responder) {
+	w.Header().Del("Content-Type")
+	sw := &streamWriter{ResponseWriter: w}
+	err := rs.WriteResponse(sw)
+	if err != nil && !sw.started {
+		w.Header().Del("Content-Disposition")
+		w.Header().Del("Cache-Control")
+		s.writeErrorResponse(w, s.errorResponse(r, err))
+		return
+	}
+	if err != nil {
+		log.Errorf(c, "Error while streaming response: %v", err)
+	}
+	sw.flush()
+}
+
+// streamWriter is a http.ResponseWriter which flushes the underlying writer
+// every streamFlushSize bytes, if it supports flushing.
+type streamWriter struct {
+	http.ResponseWriter
+	started   bool // whether anything has been written
+	unflushed int  // number of bytes written since the last flush
+}
+
+// WriteHeader is streamWriter's implementation of http.ResponseWriter.
+func (sw *streamWriter) WriteHeader(code int) {
+	sw.started = true
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// Write is streamWriter's implementation of http.ResponseWriter.
+func (sw *streamWriter) Write(b []byte) (int, error) {
+	sw.started = true
+	n, err := sw.ResponseWriter.Write(b)
+	sw.unflushed += n
+	if sw.unflushed >= streamFlushSize {
+		sw.flush()
+	}
+	return n, err
+}
+
+// flush flushes the underlying writer if it supports flushing.
+func (sw *streamWriter) flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	sw.unflushed = 0
+}
@@ -0,0 +1,97 @@
+package endpoints
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+func TestStreamWriterFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	sw := &streamWriter{ResponseWriter: w}
+	if sw.started {
+		t.Fatalf("sw.started = true before writing")
+	}
+
+	sw.Write(bytes.Repeat([]byte("x"), streamFlushSize-1))
+	if !sw.started {
+		t.Errorf("sw.started = false after writing")
+	}
+	if w.Flushed {
+		t.Errorf("w.Flushed = true after writing %d bytes", streamFlushSize-1)
+	}
+
+	sw.Write([]byte("x"))
+	if !w.Flushed {
+		t.Errorf("w.Flushed = false after writing %d bytes", streamFlushSize)
+	}
+	if sw.unflushed != 0 {
+		t.Errorf("sw.unflushed = %d; want 0", sw.unflushed)
+	}
+}
+
+type LinkReq struct {
+	Code   string `json:"code" endpoints:"pattern=^[a-z]+$"`
+	Status int    `json:"status"`
+}
+
+type LinkService struct{}
+
+func (s *LinkService) Follow(c Context, req *LinkReq) (*TestMsg, error) {
+	if req.Code == "none" {
+		return &TestMsg{Name: "no link"}, nil
+	}
+	return nil, &Redirect{URL: "https://example.org/" + req.Code, Status: req.Status}
+}
+
+func (s *LinkService) Resolve(c Context, req *LinkReq) (*Redirect, error) {
+	return &Redirect{URL: "https://example.org/" + req.Code, Status: req.Status}, nil
+}
+
+func TestServerRedirect(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	if _, err := server.RegisterService(&LinkService{}, "links", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+
+	tts := []struct {
+		method, body string
+		code         int
+		location     string
+	}{
+		{"Follow", `{"code":"abc"}`, http.StatusFound, "https://example.org/abc"},
+		{"Follow", `{"code":"abc","status":301}`, http.StatusMovedPermanently, "https://example.org/abc"},
+		{"Follow", `{"code":"none"}`, http.StatusOK, ""},
+		{"Follow", `{"code":"A!"}`, http.StatusBadRequest, ""},
+		{"Follow", `{"code":"abc","status":200}`, http.StatusInternalServerError, ""},
+		{"Resolve", `{"code":"abc","status":307}`, http.StatusTemporaryRedirect, "https://example.org/abc"},
+		{"Resolve", `{"code":"abc","status":303}`, http.StatusSeeOther, "https://example.org/abc"},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/LinkService."+tt.method, strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+		}
+		if loc := w.Header().Get("Location"); loc != tt.location {
+			t.Errorf("%d: Location = %q; want %q", i, loc, tt.location)
+		}
+		if tt.location != "" && (w.Body.Len() != 0 || w.Header().Get("Content-Type") != "") {
+			t.Errorf("%d: redirect has body %q of type %q; want none", i, w.Body, w.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"math/rand"
+	"reflect"
+
+	"google.golang.org/appengine/log"
+)
+
+const (
+	// defaultSampleLogSize is used when Server.LogSampleMaxBytes is zero.
+	defaultSampleLogSize = 4096
+	// redactedValue replaces values of fields tagged with "secret".
+	redactedValue = "[REDACTED]"
+)
+
+// randFloat64 returns a pseudo-random number in [0.0,1.0).
+// This is a variable on purpose to be able to stub during testing.
+var randFloat64 = rand.Float64
+
+// sampled returns true if a request should have its request and response
+// logged, according to s.LogSampleRate.
+func (s *Server) sampled() bool {
+	return s.LogSampleRate > 0 && randFloat64() < s.LogSampleRate
+}
+
+// logSample logs v, which is either a request or a response, as JSON with
+// values of secret fields redacted. The output is truncated to
+// s.LogSampleMaxBytes.
+func (s *Server) logSample(c Context, kind, methodName string, v reflect.Value) {
+	if !v.IsValid() {
+		return
+	}
+	b, err := redactedJSON(v)
+	if err != nil {
+		log.Warningf(c, "Can't log %s of %s: %v", kind, methodName, err)
+		return
+	}
+	max := s.LogSampleMaxBytes
+	if max <= 0 {
+		max = defaultSampleLogSize
+	}
+	if len(b) > max {
+		b = append(b[:max], "..."...)
+	}
+	log.Infof(c, "Sampled %s of %s: %s", kind, methodName, b)
+}
+
+// redactedJSON marshals v into JSON, replacing values of fields tagged
+// with "secret" with a placeholder.
+func redactedJSON(v reflect.Value) ([]byte, error) {
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	data, err := unmarshalGeneric(b)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(walkJSON(v.Type(), data, redactField))
+}
+
+// redactField is a jsonFieldFunc replacing values of secret fields.
+func redactField(field *reflect.StructField, tag *endpointsTag, val interface{}) (interface{}, bool) {
+	if tag.secret {
+		return redactedValue, false
+	}
+	return val, true
+}
+
+// isSecretField returns true if field is tagged with "secret".
+func isSecretField(field *reflect.StructField) bool {
+	tag, err := parseTag(field.Tag)
+	return err == nil && tag.secret
+}
+
+// redactedBody returns JSON body of a request of type t with values of
+// secret fields redacted, for logging. A body which can't be parsed is
+// replaced entirely if t has secret fields.
+func redactedBody(t reflect.Type, body []byte) []byte {
+	if !hasSecrets(t) {
+		return body
+	}
+	data, err := unmarshalGeneric(body)
+	if err != nil {
+		return []byte(redactedValue)
+	}
+	b, err := json.Marshal(walkJSON(t, data, redactField))
+	if err != nil {
+		return []byte(redactedValue)
+	}
+	return b
+}
+
+// hasSecrets returns true if values of type t can contain fields tagged
+// with "secret".
+func hasSecrets(t reflect.Type) bool {
+	return hasTaggedFields(t, isSecretTag)
+}
+
+// isSecretTag is a fieldPredicate matching fields tagged with "secret".
+func isSecretTag(field *reflect.StructField, tag *endpointsTag) bool {
+	return tag.secret
+}
@@ -0,0 +1,108 @@
+package endpoints
+
+import (
+	"reflect"
+	"testing"
+)
+
+type SecretInner struct {
+	Token string `json:"token" endpoints:"secret"`
+	Note  string `json:"note"`
+}
+
+type SecretMsg struct {
+	SecretInner
+	User     string         `json:"user"`
+	Password string         `json:"password" endpoints:"secret"`
+	Inner    *SecretInner   `json:"inner"`
+	Items    []*SecretInner `json:"items"`
+	Skipped  string         `json:"-" endpoints:"secret"`
+}
+
+func TestRedactedJSON(t *testing.T) {
+	msg := &SecretMsg{
+		SecretInner: SecretInner{"embedded-token", "embedded"},
+		User:        "gopher",
+		Password:    "pa$$word",
+		Inner:       &SecretInner{"inner-token", "inner"},
+		Items:       []*SecretInner{{"item-token", "item"}},
+	}
+	out, err := redactedJSON(reflect.ValueOf(msg))
+	if err != nil {
+		t.Fatalf("redactedJSON(%#v) = %v", msg, err)
+	}
+	const want = `{"inner":{"note":"inner","token":"[REDACTED]"},` +
+		`"items":[{"note":"item","token":"[REDACTED]"}],` +
+		`"note":"embedded","password":"[REDACTED]","token":"[REDACTED]","user":"gopher"}`
+	if string(out) != want {
+		t.Errorf("redactedJSON(%#v) = %s; want %s", msg, out, want)
+	}
+}
+
+type SecretCreds struct {
+	Key string `json:"key" endpoints:"secret"`
+}
+
+type SecretEmbedMsg struct {
+	*SecretCreds
+	Named       SecretInner `json:"named"`
+	SecretInner `json:"tagged"`
+}
+
+func TestRedactedJSONEmbedded(t *testing.T) {
+	msg := &SecretEmbedMsg{
+		SecretCreds: &SecretCreds{"api-key"},
+		Named:       SecretInner{"named-token", "named"},
+		SecretInner: SecretInner{"tagged-token", "tagged"},
+	}
+	out, err := redactedJSON(reflect.ValueOf(msg))
+	if err != nil {
+		t.Fatalf("redactedJSON(%#v) = %v", msg, err)
+	}
+	const want = `{"key":"[REDACTED]","named":{"note":"named","token":"[REDACTED]"},` +
+		`"tagged":{"note":"tagged","token":"[REDACTED]"}}`
+	if string(out) != want {
+		t.Errorf("redactedJSON(%#v) = %s; want %s", msg, out, want)
+	}
+}
+
+func TestServerSampled(t *testing.T) {
+	origRand := randFloat64
+	defer func() { randFloat64 = origRand }()
+	randFloat64 = func() float64 { return 0.5 }
+
+	tts := []struct {
+		rate float64
+		want bool
+	}{
+		{0, false},
+		{0.1, false},
+		{0.5, false},
+		{0.6, true},
+		{1, true},
+	}
+	for i, tt := range tts {
+		s := &Server{LogSampleRate: tt.rate}
+		if out := s.sampled(); out != tt.want {
+			t.Errorf("%d: sampled() with rate %v = %v; want %v", i, tt.rate, out, tt.want)
+		}
+	}
+}
+
+func TestRedactedBody(t *testing.T) {
+	tts := []struct {
+		typ  reflect.Type
+		in   string
+		want string
+	}{
+		{reflect.TypeOf(&SecretMsg{}), `{"user":"gopher","password":"pa$$word"}`,
+			`{"password":"[REDACTED]","user":"gopher"}`},
+		{reflect.TypeOf(&SecretMsg{}), `{"password":"pa$$`, `[REDACTED]`},
+		{reflect.TypeOf(&TestMsg{}), `{"name":"gopher"`, `{"name":"gopher"`},
+	}
+	for i, tt := range tts {
+		if out := redactedBody(tt.typ, []byte(tt.in)); string(out) != tt.want {
+			t.Errorf("%d: redactedBody(%v, %s) = %s; want %s", i, tt.typ, tt.in, out, tt.want)
+		}
+	}
+}
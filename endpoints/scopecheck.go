@@ -0,0 +1,96 @@
+package endpoints
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ScopeCheck tells whether Server.Validate checks scopes of methods, see
+// Server.ScopeCheck.
+type ScopeCheck int
+
+const (
+	// ScopeCheckOff leaves scopes unchecked.
+	ScopeCheckOff ScopeCheck = iota
+	// ScopeCheckLog logs a warning for each malformed scope.
+	ScopeCheckLog
+	// ScopeCheckFail makes Validate fail if any scope is malformed.
+	ScopeCheckFail
+)
+
+// googleScopePrefix starts URLs of Google OAuth 2.0 scopes.
+const googleScopePrefix = "https://www.googleapis.com/auth/"
+
+// googleShortScopes are Google OAuth 2.0 scopes which aren't URLs.
+var googleShortScopes = []string{"openid", "email", "profile"}
+
+// checkScopes returns an error listing malformed scopes of methods of
+// services if s.ScopeCheck is ScopeCheckFail, or logs them if it's
+// ScopeCheckLog.
+func (s *Server) checkScopes(services []*RPCService) error {
+	if s.ScopeCheck == ScopeCheckOff {
+		return nil
+	}
+	var problems []string
+	for _, srv := range services {
+		methods := srv.Methods()
+		sort.Sort(byMethodName(methods))
+		for _, m := range methods {
+			for _, scope := range m.Info().Scopes {
+				problem, err := s.scopeProblem(scope)
+				if err != nil {
+					return err
+				}
+				if problem != "" {
+					problems = append(problems, fmt.Sprintf("%s.%s: scope %q %s",
+						srv.Name(), m.method.Name, scope, problem))
+				}
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if s.ScopeCheck == ScopeCheckFail {
+		return errors.New("endpoints: malformed scopes: " + strings.Join(problems, "; "))
+	}
+	for _, p := range problems {
+		log.Printf("endpoints: malformed scope: %s", p)
+	}
+	return nil
+}
+
+// scopeProblem describes what's wrong with scope, or returns an empty
+// string if it's a Google scope or matches one of s.CustomScopes.
+// It returns an error if a pattern of s.CustomScopes is invalid.
+func (s *Server) scopeProblem(scope string) (string, error) {
+	for _, expr := range s.CustomScopes {
+		re, err := compilePattern(expr)
+		if err != nil {
+			return "", fmt.Errorf("endpoints: invalid pattern of custom scopes: %v", err)
+		}
+		if re.MatchString(scope) {
+			return "", nil
+		}
+	}
+	switch {
+	case scope == "":
+		return "is empty", nil
+	case strings.TrimSpace(scope) != scope:
+		return "has leading or trailing whitespace", nil
+	case strings.ContainsAny(scope, " \t\r\n"):
+		return "contains whitespace", nil
+	case contains(googleShortScopes, scope):
+		return "", nil
+	case strings.HasPrefix(scope, googleScopePrefix) && len(scope) > len(googleScopePrefix):
+		return "", nil
+	case strings.HasPrefix(scope, "http://www.googleapis.com/auth/"):
+		return "must use https", nil
+	case strings.HasPrefix(scope, "https://googleapis.com/auth/"):
+		return "is missing \"www.\" in its host", nil
+	}
+	return "is neither a Google scope URL nor matches Server.CustomScopes", nil
+}
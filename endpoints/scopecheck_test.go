@@ -0,0 +1,77 @@
+package endpoints
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScopeProblem(t *testing.T) {
+	s := &Server{CustomScopes: []string{`^https://api\.example\.com/auth/\w+$`}}
+	tts := []struct {
+		scope string
+		want  string // substring of the problem, or "" for none
+	}{
+		{EmailScope, ""},
+		{"https://www.googleapis.com/auth/devstorage.read_only", ""},
+		{"email", ""},
+		{"openid", ""},
+		{"https://api.example.com/auth/things", ""},
+		{"", "is empty"},
+		{EmailScope + " ", "trailing whitespace"},
+		{EmailScope + " openid", "contains whitespace"},
+		{"https://googleapis.com/auth/userinfo.email", `missing "www."`},
+		{"http://www.googleapis.com/auth/userinfo.email", "https"},
+		{"https://www.googleapis.com/auth/", "neither"},
+		{"https://api.example.com/auth/", "neither"},
+		{"userinfo.email", "neither"},
+	}
+	for _, tt := range tts {
+		problem, err := s.scopeProblem(tt.scope)
+		if err != nil {
+			t.Fatalf("scopeProblem(%q) = %v", tt.scope, err)
+		}
+		if tt.want == "" && problem != "" || !strings.Contains(problem, tt.want) {
+			t.Errorf("scopeProblem(%q) = %q; want %q", tt.scope, problem, tt.want)
+		}
+	}
+
+	s.CustomScopes = []string{"("}
+	if _, err := s.scopeProblem(EmailScope); err == nil {
+		t.Errorf("scopeProblem() = nil; want invalid pattern error")
+	}
+}
+
+func TestServerValidateScopes(t *testing.T) {
+	server := NewServer("")
+	dummy, err := server.RegisterService(&DummyService{}, "Dummy", "v1", "A service", true)
+	if err != nil {
+		t.Fatalf("error registering service: %s", err)
+	}
+	dummy.MethodByName("GetSub").Info().Scopes = []string{EmailScope, "https://googleapis.com/auth/plus.me"}
+	dummy.MethodByName("GetList").Info().Scopes = []string{EmailScope + "\n"}
+
+	if err := server.Validate(); err != nil {
+		t.Errorf("Validate() = %v; want nil with ScopeCheckOff", err)
+	}
+	server.ScopeCheck = ScopeCheckLog
+	if err := server.Validate(); err != nil {
+		t.Errorf("Validate() = %v; want nil with ScopeCheckLog", err)
+	}
+
+	server.ScopeCheck = ScopeCheckFail
+	err = server.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil; want malformed scopes error")
+	}
+	for _, want := range []string{
+		`DummyService.GetList: scope "https://www.googleapis.com/auth/userinfo.email\n" has leading or trailing whitespace`,
+		`DummyService.GetSub: scope "https://googleapis.com/auth/plus.me" is missing "www."`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() = %v; want it to contain %s", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), `scope "`+EmailScope+`" `) {
+		t.Errorf("Validate() = %v; want no error of %s", err, EmailScope)
+	}
+}
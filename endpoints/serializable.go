@@ -0,0 +1,87 @@
+package endpoints
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+)
+
+var typeOfTextMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// checkSerializable returns an error naming the type and field if request
+// or response type of method m has fields which can't be encoded as JSON,
+// so that they're found when the service is registered rather than when
+// the first response is encoded. Streamed requests and responses which
+// implement Responder aren't checked.
+func checkSerializable(m *ServiceMethod) error {
+	if m.ReqType != typeOfJSONLines {
+		if err := checkJSONType(m.ReqType, make(map[reflect.Type]bool)); err != nil {
+			return fmt.Errorf("request type %v: %v", m.ReqType, err)
+		}
+	}
+	if !reflect.PtrTo(m.RespType).Implements(typeOfResponder) {
+		if err := checkJSONType(m.RespType, make(map[reflect.Type]bool)); err != nil {
+			return fmt.Errorf("response type %v: %v", m.RespType, err)
+		}
+	}
+	return nil
+}
+
+// checkJSONType returns an error if values of type t can't be encoded as
+// JSON: channels, funcs, complex numbers, and maps with keys other than
+// strings, integers and encoding.TextMarshaler. Types which encode
+// themselves are accepted whatever their fields are.
+// Types in seen were checked already.
+func checkJSONType(t reflect.Type, seen map[reflect.Type]bool) error {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+	if marshalsItself(t) {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Chan, reflect.Func, reflect.Complex64, reflect.Complex128, reflect.UnsafePointer:
+		return fmt.Errorf("%v can't be encoded as JSON", t)
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return checkJSONType(t.Elem(), seen)
+	case reflect.Map:
+		switch k := t.Key(); {
+		case k.Kind() == reflect.String, reflect.Int <= k.Kind() && k.Kind() <= reflect.Uint64:
+		case k.Implements(typeOfTextMarshaler):
+		default:
+			return fmt.Errorf("%v can't be encoded as JSON: unsupported key type", t)
+		}
+		return checkJSONType(t.Elem(), seen)
+	case reflect.Struct:
+		return checkJSONFields(t, seen)
+	}
+	return nil
+}
+
+// checkJSONFields does the struct part of checkJSONType. Unexported fields
+// and those tagged with json:"-" are skipped, like encoding/json does.
+func checkJSONFields(t reflect.Type, seen map[reflect.Type]bool) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// consider only exported fields
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		// json:"-," names a field "-" rather than skipping it.
+		if field.Tag.Get("json") == "-" {
+			continue
+		}
+		if err := checkJSONType(field.Type, seen); err != nil {
+			return fmt.Errorf("field %s.%s: %v", t.Name(), field.Name, err)
+		}
+	}
+	return nil
+}
+
+// marshalsItself returns true if t or a pointer to t encodes itself, as
+// a jsonMarshaler or encoding.TextMarshaler.
+func marshalsItself(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+	return implements(pt, typeOfJSONMarshaler) || implements(pt, typeOfTextMarshaler)
+}
@@ -0,0 +1,127 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// opaque has no exported fields but encodes itself.
+type opaque struct {
+	secret string
+}
+
+func (o opaque) MarshalJSON() ([]byte, error) {
+	return json.Marshal(o.secret)
+}
+
+type celsius float64
+
+func (c celsius) MarshalText() ([]byte, error) {
+	return []byte("C"), nil
+}
+
+type TreeMsg struct {
+	Name     string
+	Children []*TreeMsg
+	Tags     map[string][]string
+	ByID     map[int64]*TreeMsg
+	Temps    map[celsius]string
+	Opaque   opaque
+	When     time.Time
+	Any      interface{}
+	Done     chan bool `json:"-"`
+	callback func()
+}
+
+type ChanMsg struct {
+	Name    string
+	Updates chan string
+}
+
+type NestedChanMsg struct {
+	Items []map[string]*ChanMsg
+}
+
+type FuncMsg struct {
+	OnDone func() `json:"onDone"`
+}
+
+type PrivateMsg struct {
+	name string
+}
+
+type WithPrivateMsg struct {
+	Name    string
+	Private *PrivateMsg
+}
+
+type LockedMsg struct {
+	Name string
+	mu   sync.Mutex
+}
+
+type ZonedMsg struct {
+	Name string
+	Loc  *time.Location
+}
+
+type StructKeyMsg struct {
+	ByPoint map[struct{ X, Y int }]string
+}
+
+type ComplexMsg struct {
+	Z complex128
+}
+
+type DashChanMsg struct {
+	Dash chan bool `json:"-,"`
+}
+
+type ChanService struct{}
+
+func (s *ChanService) Watch(r *http.Request, req *TestMsg) (*ChanMsg, error) {
+	return nil, nil
+}
+
+func TestCheckJSONType(t *testing.T) {
+	tts := []struct {
+		t    reflect.Type
+		want string // error substring, or "" for none
+	}{
+		{reflect.TypeOf(TreeMsg{}), ""},
+		{reflect.TypeOf(VoidMessage{}), ""},
+		{reflect.TypeOf([]*TestMsg{}), ""},
+		{reflect.TypeOf(ChanMsg{}), "field ChanMsg.Updates: chan string can't be encoded as JSON"},
+		{reflect.TypeOf(NestedChanMsg{}), "field NestedChanMsg.Items: field ChanMsg.Updates: chan string"},
+		{reflect.TypeOf(FuncMsg{}), "field FuncMsg.OnDone: func() can't be encoded as JSON"},
+		{reflect.TypeOf(WithPrivateMsg{}), ""},
+		{reflect.TypeOf(LockedMsg{}), ""},
+		{reflect.TypeOf(ZonedMsg{}), ""},
+		{reflect.TypeOf(StructKeyMsg{}), "unsupported key type"},
+		{reflect.TypeOf(ComplexMsg{}), "complex128 can't be encoded as JSON"},
+		{reflect.TypeOf(DashChanMsg{}), "field DashChanMsg.Dash: chan bool can't be encoded as JSON"},
+	}
+	for _, tt := range tts {
+		err := checkJSONType(tt.t, make(map[reflect.Type]bool))
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("checkJSONType(%v) = %v; want nil", tt.t, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("checkJSONType(%v) = %v; want error containing %q", tt.t, err, tt.want)
+		}
+	}
+}
+
+func TestRegisterServiceSerializable(t *testing.T) {
+	server := NewServer("")
+	_, err := server.RegisterService(&ChanService{}, "Chan", "v1", "", true)
+	want := "endpoints: ChanService.Watch: response type endpoints.ChanMsg: field ChanMsg.Updates: chan string can't be encoded as JSON"
+	if err == nil || err.Error() != want {
+		t.Errorf("RegisterService(ChanService) = %v; want %s", err, want)
+	}
+}
@@ -6,21 +6,262 @@
 package endpoints
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"reflect"
 	"strings"
+	"sync"
+	"time"
 
+	"golang.org/x/net/context"
 	"google.golang.org/appengine/log"
-	// Mainly for debug logging
-	"io/ioutil"
 )
 
 // Server serves registered RPC services using registered codecs.
 type Server struct {
 	root     string
 	services *serviceMap
+
+	// MaxBodyBytes limits the size of request bodies. Larger requests are
+	// rejected with 413 Request Entity Too Large. Zero value means no limit.
+	// Methods can override it with MethodInfo.MaxBodyBytes.
+	MaxBodyBytes int64
+	// MaxQueryBytes limits the length of query strings. Requests with longer
+	// ones are rejected with 414 URI Too Long before query parameters are
+	// parsed. Zero value means 8 KB, negative value means no limit.
+	MaxQueryBytes int
+	// MaxQueryValues limits the number of values of a repeated query
+	// parameter bound to a slice field, e.g. "?id=1&id=2". Requests with
+	// more are rejected with 400 Bad Request. Fields tagged with "maxItems"
+	// are limited by it instead, so that the limit matches the declared
+	// one. Zero value means 100, negative value means no limit.
+	MaxQueryValues int
+
+	// SlowRequestThreshold is a latency budget of service methods.
+	// When a method takes longer than that, a warning is logged.
+	// Zero value disables slow request logging.
+	SlowRequestThreshold time.Duration
+	// SlowRequestWarning makes slow requests also respond with a Warning
+	// header. It has no effect if SlowRequestThreshold is zero.
+	SlowRequestWarning bool
+
+	// ServerTiming makes responses include Server-Timing header with time
+	// spent in auth, request decoding and the service method, along with
+	// timings added with AddServerTiming.
+	ServerTiming bool
+
+	// EchoHeaders lists request headers, e.g. X-Cloud-Trace-Context, which
+	// are copied to responses when present, for debugging of proxies.
+	// Content-Type and other headers managed by the server are never copied.
+	EchoHeaders []string
+
+	// NamespaceHeader, if set, is the name of a request header with
+	// the namespace, e.g. a tenant ID, service methods operate within.
+	// Requests without the header use the default namespace.
+	NamespaceHeader string
+	// NamespaceNormalizer, if set, is applied to values of NamespaceHeader,
+	// e.g. to strip a prefix or sanitize them, before they are used as
+	// namespace names. An error results in 400 Bad Request.
+	NamespaceNormalizer func(string) (string, error)
+
+	// MaxRequestTimeout limits how long service methods can take.
+	// It is applied as a deadline of Context passed to a method and
+	// exceeding it results in 504 Gateway Timeout response.
+	// Zero value means no limit.
+	MaxRequestTimeout time.Duration
+	// TimeoutHeader is a name of a request header in which clients can
+	// request a shorter timeout, e.g. "X-Request-Timeout", as a number of
+	// seconds or a duration string. Malformed values are ignored.
+	// Clients can't exceed MaxRequestTimeout nor MethodInfo.Timeout.
+	TimeoutHeader string
+
+	// PaginationLinks enables Link headers with next and previous page URLs
+	// for response types embedding Pagination.
+	PaginationLinks bool
+	// PageTokenParam is a query parameter name of page tokens used in
+	// pagination links. Defaults to "pageToken".
+	PageTokenParam string
+
+	// MaxGoroutines and MaxHeapBytes are admission control thresholds.
+	// When a request arrives while the instance has more goroutines or
+	// allocated heap bytes, it is rejected with 503 Service Unavailable
+	// before it is decoded. Zero values disable the checks.
+	MaxGoroutines int
+	MaxHeapBytes  uint64
+	// AdmissionCheck, if set, is an additional admission control check.
+	// Returning false rejects a request the same way exceeding thresholds
+	// does.
+	AdmissionCheck func(stats *RuntimeStats) bool
+	// AdmissionRetryAfter is sent in Retry-After header of rejected
+	// requests, including those over MethodInfo.MaxConcurrent. Defaults to
+	// 5 seconds.
+	AdmissionRetryAfter time.Duration
+
+	// ResponseTransformer, if set, modifies JSON bodies of successful
+	// responses before they are written. ETag of a response, if enabled,
+	// is computed after the transformation, so it changes with the
+	// transformed body.
+	ResponseTransformer ResponseTransformer
+	// TransformErrors makes ResponseTransformer apply to error responses
+	// too.
+	TransformErrors bool
+	// ResponseCheck, if not ResponseCheckOff, checks JSON bodies of
+	// successful responses against the JSON Schema of their type, as
+	// returned by JSONSchema, and logs violations. It is meant for
+	// development, since schemas are generated for every response.
+	ResponseCheck ResponseCheck
+
+	// Compression lists content codings successful responses may be
+	// compressed with, in order of preference, e.g. "br", "gzip",
+	// "deflate". A response is compressed with the one its request accepts
+	// with the highest quality, if it has at least CompressMinBytes and
+	// no Content-Encoding yet. "gzip" and "deflate" are built in, others
+	// need RegisterEncoding. Empty disables compression.
+	Compression []string
+	// CompressMinBytes is the size of the smallest response body which is
+	// compressed. Defaults to 1024.
+	CompressMinBytes int
+
+	// ScopeCheck, if not ScopeCheckOff, makes Validate check that each
+	// scope of methods is a Google OAuth 2.0 scope, i.e. a URL starting
+	// with "https://www.googleapis.com/auth/" or one of "openid", "email"
+	// and "profile", or matches a regexp of CustomScopes, to catch typos
+	// which would make scopes never match those of tokens.
+	ScopeCheck ScopeCheck
+	// CustomScopes are regexps of scopes other than Google's which
+	// ScopeCheck accepts, e.g. `^https://api\.example\.com/auth/\w+$`.
+	CustomScopes []string
+
+	// TrailingSlash controls handling of request paths with trailing
+	// slashes. Defaults to TrailingSlashStrict.
+	TrailingSlash TrailingSlashPolicy
+
+	// AuthFailOpen makes CurrentUser return an anonymous user, with empty
+	// Email, instead of 503 Service Unavailable error when a token can't
+	// be validated because a validation backend is unavailable. It applies
+	// only to read-only (GET) methods, never to mutating ones.
+	AuthFailOpen bool
+
+	// UseNumber makes requests decode JSON numbers into interface{}
+	// values, e.g. of map[string]interface{} fields, as json.Number instead
+	// of float64, so that large integers, such as int64 IDs, keep their
+	// precision. Typed fields are decoded the same either way, and
+	// json.Number values are encoded in responses as they are.
+	UseNumber bool
+
+	// StrictAliases makes requests which have both the name of a field and
+	// one of its aliases (see "alias" field tag) fail with 400 Bad Request.
+	// By default the name wins and the alias is ignored.
+	StrictAliases bool
+
+	// Allowlists, if set, provides scopes, audiences and client IDs accepted
+	// by methods, see CurrentMethodUser. They are cached for AllowlistTTL,
+	// which defaults to 1 minute. Otherwise, MethodInfo values are used.
+	Allowlists   AllowlistProvider
+	AllowlistTTL time.Duration
+	allowlists   allowlistCache
+
+	// Operations stores status of long-running operations, see
+	// StartOperation.
+	Operations OperationStore
+
+	// ImpersonationHeader, if set, is a request header which names a user,
+	// by email, for the request to be made on behalf of, e.g. by support
+	// staff troubleshooting a customer's issue. CurrentUser and
+	// CurrentOAuthUser then return that user and Operator returns
+	// the real caller. Only callers listed in Impersonators may use it,
+	// authenticated against the method's scopes, audiences and client IDs.
+	// Others get 403 Forbidden.
+	ImpersonationHeader string
+	// Impersonators are emails of users allowed to impersonate others.
+	Impersonators []string
+
+	// AuthRealm, if set, is the realm of WWW-Authenticate header of
+	// 401 Unauthorized responses. The header also tells clients why
+	// authentication failed, as in RFC 6750.
+	AuthRealm string
+
+	// AccessLogger, if set, gets a record of every request once it's
+	// served, including failed ones.
+	AccessLogger AccessLogger
+	// ErrorRequestID makes error responses include "request_id" with
+	// the ID App Engine assigned to the request, so that clients can quote
+	// it to support. It is omitted when not running on App Engine.
+	ErrorRequestID bool
+	// ErrorFormat is the shape of error response bodies, including those
+	// of errors the server responds with itself, e.g. unknown methods or
+	// unsupported media types. The zero value is ErrorFormatSPI.
+	ErrorFormat ErrorFormat
+
+	// Metrics are notified of every request to a registered method.
+	Metrics []MetricsCollector
+	// Tracer, if set, starts a span of every request to a registered
+	// method, with child spans of authentication, decoding and the method
+	// call. Service methods can add their own with SpanFromContext.
+	Tracer Tracer
+
+	// DefaultAuth is the authentication policy of methods which don't
+	// declare scopes. Defaults to AuthOpen, which leaves authentication to
+	// the methods. Methods can opt out with MethodInfo.Public.
+	DefaultAuth AuthPolicy
+
+	// CORS, if set, enables Cross-Origin Resource Sharing. Methods can
+	// override it with MethodInfo.CORS.
+	CORS *CORS
+
+	// Quotas limits how many requests a single client can make to a method
+	// within a sliding window. Keys are method names in "Service.Method"
+	// format. Clients are identified by their OAuth client ID, if any, and
+	// by IP address otherwise. Requests over quota are rejected with
+	// 429 Too Many Requests. Counts are kept in memory of each instance.
+	Quotas map[string]Quota
+	quota  quotaCounter
+
+	// requests being served, drained by Shutdown
+	inflight inflightRequests
+	// identical calls of methods with MethodInfo.Coalesce set
+	coalescer coalescer
+	// responses of methods with MethodInfo.CacheByKey set
+	respCache responseCache
+	// calls of methods with MethodInfo.MaxConcurrent set
+	limiter concurrencyLimiter
+
+	// Messages is a catalog of localized error messages keyed by language
+	// tag, e.g. "fr" or "pt-BR", and then by APIError.Reason. Messages of
+	// errors with a Reason are picked according to the Accept-Language
+	// request header, falling back to "en" and then to the original message.
+	Messages map[string]map[string]string
+
+	// ETags makes successful responses with a body carry ETag header.
+	// Clients can send it back in If-Match header of a write request, which
+	// service methods check with PreconditionFromContext and ETagOf.
+	// ETags of compressed responses end with the content coding, e.g.
+	// "-gzip", which Precondition.Check ignores, see Compression.
+	ETags bool
+	// WeakETags makes ETags of GET responses weak. They validate cached
+	// responses, but can't be used in If-Match of writes, so clients have
+	// to use strong ETags of write responses instead.
+	WeakETags bool
+
+	// codecs added with RegisterCodec, by media type
+	codecsMu sync.RWMutex
+	codecs   map[string]Codec
+	// encoders added with RegisterEncoding, by content coding
+	encodersMu sync.RWMutex
+	encoders   map[string]Encoder
+
+	// middleware added with Use and UseFor, and its per-method chains
+	mwMu       sync.Mutex
+	middleware []scopedMiddleware
+	mwChains   map[*ServiceMethod][]Middleware
+
+	// LogSampleRate is a fraction of requests, between 0 and 1, which will
+	// have their decoded request and response logged. Values of fields
+	// tagged with "secret" are redacted. Zero value disables sampling.
+	LogSampleRate float64
+	// LogSampleMaxBytes caps the size of a sampled request or response log.
+	// Defaults to 4096.
+	LogSampleMaxBytes int
 }
 
 // NewServer returns a new RPC server.
@@ -54,6 +295,8 @@ func NewServer(root string) *Server {
 //    - The first argument is either *http.Request or Context.
 //    - Second argument (*arg) and *reply are exported or local.
 //    - First argument, *arg and *reply are all pointers.
+//    - *arg can be *json.RawMessage or *[]byte, in which case the request
+//      body is passed as is, without decoding.
 //    - First (or second, if method has 2 arguments) return value is of type error.
 //
 // All other methods are ignored.
@@ -74,6 +317,21 @@ func (s *Server) ServiceByName(serviceName string) *RPCService {
 	return s.services.serviceByName(serviceName)
 }
 
+// Validate returns an error if registered services are misconfigured,
+// e.g. two methods of the same API would be served at the same HTTP method
+// and path, a path template refers to a parameter which the method's
+// request struct has no field for, a pattern of a required header is
+// invalid, or a client ID contains a wildcard without a project number. Call it after registering all services and customizing their
+// methods' info, to fail at deploy time rather than on API config requests.
+//
+// Scopes of methods are checked according to s.ScopeCheck.
+func (s *Server) Validate() error {
+	if err := s.services.validate(); err != nil {
+		return err
+	}
+	return s.checkScopes(s.services.apiServices())
+}
+
 // HandleHTTP adds Server s to specified http.ServeMux.
 // If no mux is provided http.DefaultServeMux will be used.
 func (s *Server) HandleHTTP(mux *http.ServeMux) {
@@ -85,56 +343,242 @@ func (s *Server) HandleHTTP(mux *http.ServeMux) {
 
 // ServeHTTP is Server's implementation of http.Handler interface.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	c := NewContext(r)
-	defer func() {
-		destroyContext(c)
-	}()
-
 	// Always respond with JSON, even when an error occurs.
 	// Note: API server doesn't expect an encoding in Content-Type header.
 	w.Header().Set("Content-Type", "application/json")
+	s.echoHeaders(w, r)
+
+	if !s.inflight.enter() {
+		s.writeError(w, r, errorf(http.StatusServiceUnavailable, "Server is shutting down"))
+		return
+	}
+	defer s.inflight.leave()
+
+	var access *accessLog
+	if s.AccessLogger != nil {
+		access = newAccessLog(w)
+		w = access.w
+		defer s.logAccess(r, access)
+	}
+
+	if err := s.checkQueryLength(r); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	path, ok := s.routePath(w, r)
+	if !ok {
+		return
+	}
+
+	// OPTIONS requests never require authentication, so that browsers
+	// don't report CORS failures instead of auth errors.
+	if isPreflight(r) {
+		s.servePreflight(w, r, path)
+		return
+	}
+	if r.Method == "OPTIONS" {
+		s.serveOptions(w, r, path)
+		return
+	}
 
 	if r.Method != "POST" {
-		err := fmt.Errorf("rpc: POST method required, got %q", r.Method)
-		writeError(w, err)
+		s.serveMethodNotAllowed(w, r, path)
 		return
 	}
 
 	// methodName has "ServiceName.MethodName" format.
 	var methodName string
-	idx := strings.LastIndex(r.URL.Path, "/")
+	idx := strings.LastIndex(path, "/")
 	if idx < 0 {
-		writeError(w, fmt.Errorf("rpc: no method in path %q", r.URL.Path))
+		s.writeError(w, r, fmt.Errorf("rpc: no method in path %q", path))
 		return
 	}
-	methodName = r.URL.Path[idx+1:]
+	methodName = path[idx+1:]
+	if access != nil {
+		access.entry.Method = methodName
+	}
 
 	// Get service method specs
 	serviceSpec, methodSpec, err := s.services.get(methodName)
 	if err != nil {
-		writeError(w, err)
+		s.writeError(w, r, err)
 		return
 	}
+	var span Span = noopSpan{}
+	if len(s.Metrics) > 0 || s.Tracer != nil {
+		sw := &statusWriter{ResponseWriter: w}
+		w = sw
+		if len(s.Metrics) > 0 {
+			defer s.observeRequest(methodName, sw, time.Now())
+		}
+		if s.Tracer != nil {
+			span = s.startRequestSpan(r, methodName)
+			defer endRequestSpan(span, sw)
+		}
+	}
+	s.setCORSHeaders(w, r, methodSpec)
 
-	// Initialize RPC method request
-	reqValue := reflect.New(methodSpec.ReqType)
+	if err := s.admit(w); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	methodSpec.setDeprecationHeaders(w.Header())
+	if err := checkRequiredHeaders(r, methodSpec); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	// Context is created only now that the service is known because
+	// services can have their own ContextFactory.
+	c := newContext(r, serviceSpec.contextFactory())
+	defer func() {
+		destroyContext(c)
+	}()
+	if access != nil {
+		access.setToken(c)
+	}
+	nc, err := s.namespaceContext(c, r)
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	c = withSpan(withMethodCall(nc, &methodCall{s, methodName, methodSpec}), span)
+	if !methodSpec.available(c) {
+		s.writeError(w, r, errMethodNotFound(serviceSpec.Name(), methodSpec.method.Name))
+		return
+	}
+	if s.ServerTiming {
+		c, w = withServerTiming(c, w)
+	}
+	if s.AuthFailOpen && methodSpec.readOnly() {
+		c = withAuthFailOpen(c)
+	}
 
-	body, err := ioutil.ReadAll(r.Body)
+	if methodSpec.info != nil && methodSpec.info.LazyAuth {
+		c = withLazyAuth(c, func(c Context) error {
+			return s.authorize(c, methodName, methodSpec)
+		})
+	} else if err := s.authorize(c, methodName, methodSpec); err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+	ic, err := s.impersonate(c, methodName, methodSpec)
 	if err != nil {
-		writeError(w, err)
+		s.writeError(w, r, err)
 		return
 	}
-	log.Debugf(c, "SPI request body: %s", body)
+	c = ic
+	if access != nil {
+		access.imp = impersonationOf(c)
+	}
 
-	// if err := json.NewDecoder(r.Body).Decode(req.Interface()); err != nil {
-	// 	writeError(w, fmt.Errorf("Error while decoding JSON: %q", err))
-	// 	return
-	// }
-	if err := json.Unmarshal(body, reqValue.Interface()); err != nil {
-		writeError(w, err)
+	if err := s.checkQuota(c, w, r, methodName, methodSpec); err != nil {
+		s.writeError(w, r, err)
 		return
 	}
 
+	// Initialize RPC method request
+	decodeStart := time.Now()
+	decodeSpan := startSpan(c, "decode")
+	defer decodeSpan.End()
+	reqValue := reflect.New(methodSpec.ReqType)
+
+	customCodec := s.requestCodec(r) != nil
+	var body []byte
+	if methodSpec.ReqType == typeOfJSONLines {
+		// Streamed bodies are decoded and validated by the method.
+		if err := checkJSONLinesType(r); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		reqValue = reflect.ValueOf(newJSONLines(c, r.Body, s.maxBodyBytes(methodSpec), s.UseNumber))
+	} else {
+		if !customCodec {
+			if err := checkContentType(r, reqValue.Type()); err != nil {
+				s.writeError(w, r, err)
+				return
+			}
+		}
+		if body, err = readBody(r, s.maxBodyBytes(methodSpec)); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		log.Debugf(c, "SPI request body: %s", redactedBody(methodSpec.ReqType, body))
+		if !customCodec && !hasProtobufBody(r) {
+			if body, err = resolveAliases(methodSpec.ReqType, body, s.StrictAliases); err != nil {
+				s.writeError(w, r, err)
+				return
+			}
+		}
+
+		// if err := json.NewDecoder(r.Body).Decode(req.Interface()); err != nil {
+		// 	writeError(w, fmt.Errorf("Error while decoding JSON: %q", err))
+		// 	return
+		// }
+		if err := s.decodeBody(r, body, reqValue); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		if err := bindQuery(reqValue.Elem(), r.URL.Query(), s.maxQueryValues()); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		if err := bindWildcard(methodSpec, reqValue.Elem()); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		if err := validateRequest(c, reqValue); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+	}
+	if !methodSpec.readOnly() {
+		if c, err = checkPrecondition(c, reqValue); err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+	}
+	if methodSpec.partialUpdate() && !hasProtobufBody(r) && !customCodec && methodSpec.ReqType.Kind() == reflect.Struct {
+		mask, err := parseUpdateMask(methodSpec.ReqType, r.URL.Query(), body)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		nulls, err := parseNullFields(methodSpec.ReqType, body)
+		if err != nil {
+			s.writeError(w, r, err)
+			return
+		}
+		c = withNullFields(withUpdateMask(c, mask), nulls)
+	}
+	trackServerTiming(c, "decode", decodeStart)
+	decodeSpan.End()
+
+	if timeout := s.requestTimeout(methodSpec, r); timeout > 0 {
+		var cancel context.CancelFunc
+		c, cancel = withTimeout(c, timeout)
+		defer cancel()
+	}
+
+	// Fresh cached responses are served without taking a concurrency slot.
+	cacheKey, cacheable := s.cacheKey(r, methodName, methodSpec)
+	var cachedResp reflect.Value
+	var cacheHit bool
+	if cacheable {
+		cachedResp, cacheHit = s.respCache.get(cacheKey)
+	}
+	if !cacheHit {
+		release, err := s.limiter.acquire(c, methodSpec)
+		if err != nil {
+			s.setRetryAfter(w)
+			s.writeError(w, r, err)
+			return
+		}
+		defer release()
+	}
+
 	numIn, numOut := methodSpec.method.Type.NumIn(), methodSpec.method.Type.NumOut()
 	// Construct arguments for the method call
 	var httpReqOrCtx interface{} = r
@@ -152,27 +596,162 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		args = append(args, respValue)
 	}
 
-	// Invoke the service method
-	var errValue reflect.Value
-	res := methodSpec.method.Func.Call(args)
-	if numOut == 2 {
-		respValue = res[0]
-		errValue = res[1]
-	} else {
-		errValue = res[0]
+	sampled := s.sampled()
+	if sampled {
+		s.logSample(c, "request", methodName, reqValue)
+	}
+
+	// Invoke the service method through its middleware. Middleware runs
+	// for every request, while the method call itself may be shared with
+	// identical requests or served from the response cache.
+	call := func(c Context) error {
+		span := startSpan(c, "handler")
+		defer span.End()
+		c = withSpan(c, span)
+		invoke := func() (reflect.Value, error) {
+			if methodSpec.wantsContext {
+				args[1] = reflect.ValueOf(c)
+			}
+			res := methodSpec.method.Func.Call(args)
+			resp := respValue
+			if numOut == 2 {
+				resp = res[0]
+			}
+			err, _ := res[numOut-1].Interface().(error)
+			return resp, err
+		}
+		start := time.Now()
+		var err error
+		if cacheHit {
+			respValue = cachedResp
+		} else if cacheable {
+			respValue, err = s.callCached(cacheKey, methodSpec.cacheTTL(), invoke)
+		} else if key, ok := s.coalesceKey(r, methodName, methodSpec, reqValue); ok {
+			respValue, err = s.coalescer.do(key, invoke)
+		} else {
+			respValue, err = invoke()
+		}
+		d := time.Since(start)
+		AddServerTiming(c, "handler", d)
+		s.checkSlowRequest(c, w, methodName, d)
+		return err
+	}
+	err = runMiddleware(c, methodName, s.middlewareFor(methodName, methodSpec), call)
+
+	// Results of a method which ran out of time are likely incomplete.
+	if c.Err() == context.DeadlineExceeded {
+		s.writeError(w, r, errorf(http.StatusGatewayTimeout, "Request deadline exceeded"))
+		return
 	}
 
 	// Check if method returned an error
-	if err := errValue.Interface(); err != nil {
-		writeError(w, err.(error))
+	if rd, ok := err.(*Redirect); ok {
+		s.writeResponder(c, w, r, rd)
+		return
+	} else if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	if sampled {
+		s.logSample(c, "response", methodName, respValue)
+	}
+
+	if rs, ok := asResponder(respValue); ok {
+		if cc := methodSpec.cacheControl(); cc != "" {
+			w.Header().Set("Cache-Control", cc)
+		}
+		s.writeResponder(c, w, r, rs)
 		return
 	}
 
+	if s.PaginationLinks {
+		setLinkHeader(w, r, s.pageTokenParam(), respValue)
+	}
+
 	// Encode non-error response
-	if numIn == 4 || numOut == 2 {
-		if err := json.NewEncoder(w).Encode(respValue.Interface()); err != nil {
-			writeError(w, err)
+	weakETag := s.WeakETags && methodSpec.readOnly()
+	s.writeResponse(w, r, methodSpec.responseStatus(respValue), respValue, weakETag, methodSpec.cacheControl())
+}
+
+// writeResponse writes a successful response with the given status code.
+//
+// If respValue is invalid or a nil pointer, or status is 204 No Content,
+// the response has no body nor Content-Type. 200 OK becomes 204 No Content
+// in this case.
+//
+// The response is encoded as protobuf if r accepts it and respValue is
+// a protobuf message, and as JSON otherwise.
+//
+// JSON bodies are checked according to s.ResponseCheck and transformed by
+// s.ResponseTransformer, if any. If s.ETags is true, the response then has
+// ETag header computed from the body, which is weak if weakETag is true
+// and ends with the content coding if the body is compressed. Bodies are
+// compressed according to s.Compression.
+//
+// The response has Cache-Control header cacheControl, if not empty, unless
+// it fails to encode and an error is written instead.
+func (s *Server) writeResponse(w http.ResponseWriter, r *http.Request, status int, respValue reflect.Value, weakETag bool, cacheControl string) {
+	writeHeader := func(status int) {
+		if cacheControl != "" {
+			w.Header().Set("Cache-Control", cacheControl)
 		}
+		w.WriteHeader(status)
+	}
+	if status == http.StatusNoContent || !respValue.IsValid() || respValue.IsNil() {
+		if status == http.StatusOK {
+			status = http.StatusNoContent
+		}
+		w.Header().Del("Content-Type")
+		writeHeader(status)
+		return
+	}
+
+	body, ctype, err := s.encodeBody(r, respValue)
+	if err == nil && ctype == "application/json" {
+		err = s.checkResponse(r, respValue, body)
+	}
+	if err == nil && ctype == "application/json" {
+		body, err = s.transformResponse(r, status, body)
+	}
+	if err != nil {
+		s.writeErrorResponse(w, s.errorResponse(r, err))
+		return
+	}
+	var etag string
+	if s.ETags {
+		etag = etagOf(body)
+		if weakETag {
+			etag = WeakETag(etag)
+		}
+	}
+	w.Header().Set("Content-Type", ctype)
+	if ctype == "application/json" {
+		body = append(body, '\n')
+	}
+	body = s.compress(w, r, body)
+	if etag != "" {
+		// A compressed body isn't byte for byte the one the tag is of.
+		if coding := w.Header().Get("Content-Encoding"); coding != "" {
+			etag = encodedETag(etag, coding)
+		}
+		w.Header().Set("ETag", etag)
+	}
+	writeHeader(status)
+	w.Write(body)
+}
+
+// checkSlowRequest logs a warning and, if configured, adds a Warning header
+// to the response when service method call duration d exceeds
+// s.SlowRequestThreshold.
+func (s *Server) checkSlowRequest(c Context, w http.ResponseWriter, methodName string, d time.Duration) {
+	if s.SlowRequestThreshold <= 0 || d <= s.SlowRequestThreshold {
+		return
+	}
+	log.Warningf(c, "Slow request: %s took %s (threshold is %s)",
+		methodName, d, s.SlowRequestThreshold)
+	if s.SlowRequestWarning {
+		w.Header().Add("Warning", fmt.Sprintf(`199 - "Slow request: %s"`, d))
 	}
 }
 
@@ -1,6 +1,7 @@
 package endpoints
 
 import (
+	"encoding/json"
 	"errors"
 	"io"
 	"net/http"
@@ -8,6 +9,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"appengine/aetest"
 )
@@ -59,6 +61,58 @@ func (s *ServerTestService) Conflict(r *http.Request, req, resp *TestMsg) error
 	return ConflictError
 }
 
+func (s *ServerTestService) NilResponse(c Context, req *TestMsg) (*TestMsg, error) {
+	return nil, nil
+}
+
+func (s *ServerTestService) Deadline(c Context, req *TestMsg) (*TestMsg, error) {
+	if _, ok := c.Deadline(); !ok {
+		return &TestMsg{"no deadline"}, nil
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(time.Second):
+	}
+	return &TestMsg{"deadline"}, nil
+}
+
+func (s *ServerTestService) Download(c Context, req *TestMsg) (*Download, error) {
+	return &Download{
+		ContentType: "text/csv",
+		Filename:    "export.csv",
+		Body: func(w io.Writer) error {
+			if req.Name == "early" {
+				return NotFoundError
+			}
+			io.WriteString(w, "name\ngopher\n")
+			if req.Name == "late" {
+				return errors.New("export failed")
+			}
+			return nil
+		},
+	}, nil
+}
+
+func (s *ServerTestService) Raw(c Context, req *json.RawMessage) (*TestMsg, error) {
+	return &TestMsg{string(*req)}, nil
+}
+
+func (s *ServerTestService) Update(c Context, req *TestMsg) (*TestMsg, error) {
+	current := &TestMsg{"current"}
+	etag, err := ETagOf(current)
+	if err != nil {
+		return nil, err
+	}
+	if err := PreconditionFromContext(c).Check(etag); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (s *ServerTestService) Proto(c Context, req *ProtoMsg) (*ProtoMsg, error) {
+	return req, nil
+}
+
 // Service methods for args testing
 
 func (s *ServerTestService) MsgWithRequest(r *http.Request, req, resp *TestMsg) error {
@@ -154,7 +208,7 @@ func TestServerServeHTTP(t *testing.T) {
 
 		{"POST", "Error", `{}`, ``, http.StatusBadRequest},
 		{"POST", "Msg", ``, ``, http.StatusBadRequest},
-		{"POST", "DoesNotExist", `{}`, ``, http.StatusBadRequest},
+		{"POST", "DoesNotExist", `{}`, ``, http.StatusNotFound},
 
 		{"POST", "InternalServer", `{}`, ``, http.StatusInternalServerError},
 		{"POST", "BadRequest", `{}`, ``, http.StatusBadRequest},
@@ -163,10 +217,11 @@ func TestServerServeHTTP(t *testing.T) {
 		{"POST", "Unauthorized", `{}`, ``, http.StatusUnauthorized},
 		{"POST", "CustomAPIError", `{}`, ``, http.StatusMethodNotAllowed},
 
-		{"GET", "Void", `{}`, ``, http.StatusBadRequest},
-		{"PUT", "Void", `{}`, ``, http.StatusBadRequest},
-		{"HEAD", "Void", `{}`, ``, http.StatusBadRequest},
-		{"DELETE", "Void", `{}`, ``, http.StatusBadRequest},
+		{"GET", "Void", `{}`, ``, http.StatusMethodNotAllowed},
+		{"PUT", "Void", `{}`, ``, http.StatusMethodNotAllowed},
+		{"HEAD", "Void", `{}`, ``, http.StatusMethodNotAllowed},
+		{"DELETE", "Void", `{}`, ``, http.StatusMethodNotAllowed},
+		{"GET", "DoesNotExist", `{}`, ``, http.StatusNotFound},
 	}
 
 	for i, tt := range tts {
@@ -199,6 +254,13 @@ func TestServerServeHTTP(t *testing.T) {
 			t.Errorf("%d: %s %s w.Code = %d; want %d",
 				i, tt.httpVerb, path, w.Code, tt.code)
 		}
+		allow := ""
+		if tt.code == http.StatusMethodNotAllowed && tt.httpVerb != "POST" {
+			allow = "OPTIONS, POST"
+		}
+		if h := w.Header().Get("Allow"); h != allow {
+			t.Errorf("%d: %s %s Allow = %q; want %q", i, tt.httpVerb, path, h, allow)
+		}
 	}
 }
 
@@ -266,3 +328,538 @@ func TestServerRegisterService(t *testing.T) {
 		}
 	}
 }
+
+func TestServerServiceContextFactory(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	var called int
+	service := server.ServiceByName("ServerTestService")
+	service.SetContextFactory(func(r *http.Request) Context {
+		called++
+		return tokeninfoContextFactory(r)
+	})
+
+	r, err := inst.NewRequest("POST", "/ServerTestService.MsgWithContext",
+		strings.NewReader(`{"name":"factory"}`))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("w.Code = %d; want %d", w.Code, http.StatusOK)
+	}
+	if called != 1 {
+		t.Errorf("service context factory called %d times; want 1", called)
+	}
+
+	service.SetContextFactory(nil)
+	if f := service.contextFactory(); reflect.ValueOf(f).Pointer() != reflect.ValueOf(ContextFactory).Pointer() {
+		t.Errorf("contextFactory() after reset is not the package ContextFactory")
+	}
+}
+
+func TestServerSlowRequest(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		threshold time.Duration
+		warning   bool
+		want      bool
+	}{
+		{0, true, false},
+		{time.Hour, true, false},
+		{time.Nanosecond, false, false},
+		{time.Nanosecond, true, true},
+	}
+	for i, tt := range tts {
+		server.SlowRequestThreshold = tt.threshold
+		server.SlowRequestWarning = tt.warning
+		r, err := inst.NewRequest("POST", "/ServerTestService.Void", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, http.StatusOK)
+		}
+		if has := w.Header().Get("Warning") != ""; has != tt.want {
+			t.Errorf("%d: Warning header = %q; want present = %v",
+				i, w.Header().Get("Warning"), tt.want)
+		}
+	}
+}
+
+func TestServerSuccessStatus(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	service := server.ServiceByName("ServerTestService")
+	tts := []struct {
+		srvMethod, in string
+		statusCode    int
+		code          int
+		out           string
+	}{
+		{"Msg", `{"name":"alex"}`, 0, http.StatusOK, `{"name":"alex"}`},
+		{"Msg", `{"name":"alex"}`, http.StatusCreated, http.StatusCreated, `{"name":"alex"}`},
+		{"Msg", `{"name":"alex"}`, http.StatusNoContent, http.StatusNoContent, ``},
+		{"MsgWithoutResponse", `{"name":"alex"}`, 0, http.StatusNoContent, ``},
+		{"MsgWithoutResponse", `{"name":"alex"}`, http.StatusAccepted, http.StatusAccepted, ``},
+		{"NilResponse", `{}`, 0, http.StatusNoContent, ``},
+		{"Void", `{}`, 0, http.StatusOK, `{}`},
+	}
+	for i, tt := range tts {
+		service.MethodByName(tt.srvMethod).info = &MethodInfo{StatusCode: tt.statusCode}
+		path := "/ServerTestService." + tt.srvMethod
+		r, err := inst.NewRequest("POST", path, strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: %s w.Code = %d; want %d", i, path, w.Code, tt.code)
+		}
+		if out := strings.TrimSpace(w.Body.String()); out != tt.out {
+			t.Errorf("%d: %s = %q; want %q", i, path, out, tt.out)
+		}
+		ctype := w.Header().Get("Content-Type")
+		if tt.out == "" && ctype != "" {
+			t.Errorf("%d: %s Content-Type = %q; want none", i, path, ctype)
+		}
+	}
+}
+
+func TestServerRequestTimeout(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		timeout time.Duration
+		code    int
+		out     string
+	}{
+		{0, http.StatusOK, `{"name":"no deadline"}`},
+		{10 * time.Millisecond, http.StatusGatewayTimeout, ``},
+	}
+	for i, tt := range tts {
+		server.MaxRequestTimeout = tt.timeout
+		r, err := inst.NewRequest("POST", "/ServerTestService.Deadline", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		if out := strings.TrimSpace(w.Body.String()); tt.code == http.StatusOK && out != tt.out {
+			t.Errorf("%d: response = %q; want %q", i, out, tt.out)
+		}
+		if c, exists := ctxs[r]; exists {
+			t.Errorf("%d: ctxs[%#v] = %#v; want nil", i, r, c)
+		}
+	}
+}
+
+func TestServerDownload(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		in          string
+		code        int
+		ctype, disp string
+		out         string
+	}{
+		{`{}`, http.StatusOK, "text/csv", `attachment; filename=export.csv`, "name\ngopher\n"},
+		{`{"name":"late"}`, http.StatusOK, "text/csv", `attachment; filename=export.csv`, "name\ngopher\n"},
+		{`{"name":"early"}`, http.StatusNotFound, "application/json", "", ""},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/ServerTestService.Download", strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		if ctype := w.Header().Get("Content-Type"); ctype != tt.ctype {
+			t.Errorf("%d: Content-Type = %q; want %q", i, ctype, tt.ctype)
+		}
+		if disp := w.Header().Get("Content-Disposition"); disp != tt.disp {
+			t.Errorf("%d: Content-Disposition = %q; want %q", i, disp, tt.disp)
+		}
+		if tt.out != "" && w.Body.String() != tt.out {
+			t.Errorf("%d: response = %q; want %q", i, w.Body.String(), tt.out)
+		}
+		if tt.code == http.StatusOK && !w.Flushed {
+			t.Errorf("%d: response was not flushed", i)
+		}
+	}
+}
+
+func TestServerDeprecation(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	sunset := time.Date(2016, 1, 31, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	service := server.ServiceByName("ServerTestService")
+	tts := []struct {
+		info            *MethodInfo
+		sunset, warning string
+	}{
+		{nil, "", ""},
+		{&MethodInfo{Name: "void"}, "", ""},
+		{&MethodInfo{Name: "void", Deprecated: true}, "",
+			`299 - "Method void is deprecated"`},
+		{&MethodInfo{Name: "void", Deprecated: true, SunsetDate: sunset},
+			"Sun, 31 Jan 2016 11:00:00 GMT",
+			`299 - "Method void is deprecated and will be retired on Sun, 31 Jan 2016 11:00:00 GMT"`},
+	}
+	for i, tt := range tts {
+		service.MethodByName("Void").info = tt.info
+		r, err := inst.NewRequest("POST", "/ServerTestService.Void", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if s := w.Header().Get("Sunset"); s != tt.sunset {
+			t.Errorf("%d: Sunset = %q; want %q", i, s, tt.sunset)
+		}
+		if warn := w.Header().Get("Warning"); warn != tt.warning {
+			t.Errorf("%d: Warning = %q; want %q", i, warn, tt.warning)
+		}
+	}
+}
+
+func TestServerAvailability(t *testing.T) {
+	server := createAPIServer()
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	beta := func(c Context) bool {
+		return c.HTTPRequest().Header.Get("X-Beta") == "on"
+	}
+	service := server.ServiceByName("ServerTestService")
+	tts := []struct {
+		info *MethodInfo
+		beta string
+		code int
+	}{
+		{nil, "", http.StatusOK},
+		{&MethodInfo{Name: "void"}, "", http.StatusOK},
+		{&MethodInfo{Name: "void", Availability: beta}, "on", http.StatusOK},
+		{&MethodInfo{Name: "void", Availability: beta}, "", http.StatusNotFound},
+	}
+	for i, tt := range tts {
+		service.MethodByName("Void").info = tt.info
+		r, err := inst.NewRequest("POST", "/ServerTestService.Void", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		r.Header.Set("X-Beta", tt.beta)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+		}
+		if tt.code == http.StatusNotFound && !strings.Contains(w.Body.String(), "can't find method") {
+			t.Errorf("%d: body = %s; want method not found error", i, w.Body)
+		}
+	}
+}
+
+func TestServerRequestBody(t *testing.T) {
+	server := createAPIServer()
+	server.MaxBodyBytes = 16
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		method, ctype, in string
+		code              int
+		out               string
+	}{
+		{"Raw", "", `{"any":[1,2]}`, http.StatusOK, `{"name":"{\"any\":[1,2]}"}`},
+		{"Raw", "application/json; charset=utf-8", `[]`, http.StatusOK, `{"name":"[]"}`},
+		{"Raw", "text/plain", `[]`, http.StatusUnsupportedMediaType, ""},
+		{"Raw", "", `{"any":[1,2,3,4,5]}`, http.StatusRequestEntityTooLarge, ""},
+		{"Msg", "", `{"name":"01234"}`, http.StatusOK, `{"name":"01234"}`},
+		{"Msg", "", `{"name":"012345"}`, http.StatusRequestEntityTooLarge, ""},
+	}
+	for i, tt := range tts {
+		path := "/ServerTestService." + tt.method
+		r, err := inst.NewRequest("POST", path, strings.NewReader(tt.in))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if tt.ctype != "" {
+			r.Header.Set("Content-Type", tt.ctype)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: %s w.Code = %d; want %d", i, path, w.Code, tt.code)
+		}
+		if out := strings.TrimSpace(w.Body.String()); tt.out != "" && out != tt.out {
+			t.Errorf("%d: %s = %q; want %q", i, path, out, tt.out)
+		}
+	}
+}
+
+func TestServerValidate(t *testing.T) {
+	server := NewServer("")
+	dummy, err := server.RegisterService(&DummyService{}, "Dummy", "v1", "A service", true)
+	if err != nil {
+		t.Fatalf("error registering service: %s", err)
+	}
+	other, err := server.RegisterService(&ServerTestService{}, "Dummy", "v1", "Another service", true)
+	if err != nil {
+		t.Fatalf("error registering service: %s", err)
+	}
+	if err := server.Validate(); err != nil {
+		t.Fatalf("Validate() = %v; want nil", err)
+	}
+
+	info := dummy.MethodByName("GetSub").Info()
+	info.HTTPMethod, info.Path = "GET", "things/{simple}"
+	info = other.MethodByName("Msg").Info()
+	info.HTTPMethod, info.Path = "POST", "things/{name}"
+	if err := server.Validate(); err != nil {
+		t.Fatalf("Validate() = %v; want nil for methods differing by verb", err)
+	}
+
+	info.HTTPMethod = "GET"
+	err = server.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil; want duplicate path error")
+	}
+	for _, s := range []string{"DummyService.GetSub", "ServerTestService.Msg"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Validate() = %q; want it to mention %s", err, s)
+		}
+	}
+
+	other.Info().Version = "v2"
+	if err := server.Validate(); err != nil {
+		t.Errorf("Validate() = %v; want nil for different API versions", err)
+	}
+}
+
+func TestServerValidateClientIDPatterns(t *testing.T) {
+	server := NewServer("")
+	dummy, err := server.RegisterService(&DummyService{}, "Dummy", "v1", "A service", true)
+	if err != nil {
+		t.Fatalf("error registering service: %s", err)
+	}
+	info := dummy.MethodByName("GetSub").Info()
+	tts := []struct {
+		clientIDs []string
+		valid     bool
+	}{
+		{[]string{"123-abc.apps.googleusercontent.com"}, true},
+		{[]string{"123-*.apps.googleusercontent.com"}, true},
+		{[]string{"*.apps.googleusercontent.com"}, false},
+		{[]string{"123-abc.apps.googleusercontent.com", "abc-*.apps.googleusercontent.com"}, false},
+		{[]string{"123-*.com"}, false},
+	}
+	for i, tt := range tts {
+		info.ClientIds = tt.clientIDs
+		err := server.Validate()
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("%d: Validate() = %v with client IDs %v; want valid = %v", i, err, tt.clientIDs, tt.valid)
+		}
+		if err != nil && !strings.Contains(err.Error(), "DummyService.GetSub") {
+			t.Errorf("%d: Validate() = %q; want it to mention DummyService.GetSub", i, err)
+		}
+	}
+}
+
+func TestServerValidatePathParams(t *testing.T) {
+	server := NewServer("")
+	dummy, err := server.RegisterService(&DummyService{}, "Dummy", "v1", "A service", true)
+	if err != nil {
+		t.Fatalf("error registering service: %s", err)
+	}
+	if err := server.Validate(); err != nil {
+		t.Fatalf("Validate() = %v; want nil for default paths", err)
+	}
+
+	info := dummy.MethodByName("GetSub").Info()
+	tts := []struct {
+		path string
+		want string // substring of the error, or "" for none
+	}{
+		{"things/{simple}", ""},
+		{"things/{msg.str}", ""},
+		{"things/{simple}/more", ""},
+		{"things/{userId}", `path parameter "userId" has no field in endpoints.DummySubMsg`},
+		{"things/{simple}/{Simple}", `path parameter "Simple"`},
+		{"things/{msg}", `path parameter "msg" has no field`},
+		{"things/{simple", "Invalid path template"},
+		{"things/{simple=**}", ""},
+		{"things/{simple=*}", "Invalid path template"},
+		{"things/{simple=**}/more", "must be the last segment"},
+		{"things/x{simple=**}", "must be a whole segment"},
+		{"things/{msg.str=**}", "must be a top-level string field"},
+	}
+	for _, tt := range tts {
+		info.Path = tt.path
+		err := server.Validate()
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%s: Validate() = %v; want nil", tt.path, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%s: Validate() = %v; want error containing %q", tt.path, err, tt.want)
+		case err != nil && !strings.Contains(err.Error(), "DummyService.GetSub"):
+			t.Errorf("%s: Validate() = %v; want it to mention DummyService.GetSub", tt.path, err)
+		}
+	}
+}
+
+func TestServerArrayRequest(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	if _, err := server.RegisterService(&BulkService{}, "Bulk", "v1", "", true); err != nil {
+		t.Fatalf("error registering service: %v", err)
+	}
+
+	tts := []struct {
+		body string
+		code int
+		out  string
+	}{
+		{`[{"name": "a"}, {"name": "b"}]`, http.StatusOK, `{"name":"created 2"}`},
+		{`[]`, http.StatusOK, `{"name":"created 0"}`},
+		{`[{"name": "a"}, {"name": "B"}]`, http.StatusBadRequest, ""},
+		{`{"name": "a"}`, http.StatusBadRequest, ""},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/BulkService.Create", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d (%s)", i, w.Code, tt.code, w.Body)
+		}
+		if out := strings.TrimSpace(w.Body.String()); tt.out != "" && out != tt.out {
+			t.Errorf("%d: body = %q; want %q", i, out, tt.out)
+		}
+	}
+
+	r, err := inst.NewRequest("POST", "/BulkService.Create", strings.NewReader(`[{"name": "a"}, {"name": "B"}]`))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if !strings.Contains(w.Body.String(), "Item 1: ") {
+		t.Errorf("body = %q; want error naming item 1", w.Body)
+	}
+}
+
+func TestServerCacheControl(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	svc, err := server.RegisterService(&BulkService{}, "bulk", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	info := svc.MethodByName("Create").Info()
+
+	tts := []struct {
+		httpMethod, cacheControl, body string
+		want                           string
+	}{
+		{"GET", "", `[]`, ""},
+		{"GET", "private, max-age=60", `[]`, "private, max-age=60"},
+		{"POST", "", `[]`, "no-store"},
+		{"POST", "no-cache", `[]`, "no-cache"},
+		{"GET", "private, max-age=60", `[{"name": "B"}]`, ""},
+	}
+	for i, tt := range tts {
+		info.HTTPMethod, info.CacheControl = tt.httpMethod, tt.cacheControl
+		r, err := inst.NewRequest("POST", "/BulkService.Create", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		if h := w.Header().Get("Cache-Control"); h != tt.want {
+			t.Errorf("%d: Cache-Control = %q; want %q (%d %s)", i, h, tt.want, w.Code, w.Body)
+		}
+	}
+
+	// Responses which fail to be written are errors, never cached.
+	info.HTTPMethod, info.CacheControl = "GET", "private, max-age=60"
+	server.ResponseTransformer = func(r *http.Request, status int, body []byte) ([]byte, error) {
+		return nil, errors.New("transform failed")
+	}
+	r, err := inst.NewRequest("POST", "/BulkService.Create", strings.NewReader(`[]`))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if h := w.Header().Get("Cache-Control"); w.Code == http.StatusOK || h != "" {
+		t.Errorf("failed response: Cache-Control = %q; want none (%d %s)", h, w.Code, w.Body)
+	}
+}
@@ -0,0 +1,114 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// serverTimingKey is the context key of *serverTimings of a request.
+type serverTimingKey struct{}
+
+// serverTiming is a Server-Timing header entry.
+type serverTiming struct {
+	name string
+	dur  time.Duration
+}
+
+// serverTimings collects timings of a request.
+type serverTimings struct {
+	mu      sync.Mutex
+	entries []*serverTiming
+}
+
+// add adds d to the timing called name, creating one if needed.
+func (t *serverTimings) add(name string, d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, e := range t.entries {
+		if e.name == name {
+			e.dur += d
+			return
+		}
+	}
+	t.entries = append(t.entries, &serverTiming{name, d})
+}
+
+// header returns the value of Server-Timing header, or an empty string
+// if there are no timings.
+func (t *serverTimings) header() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parts := make([]string, len(t.entries))
+	for i, e := range t.entries {
+		ms := float64(e.dur) / float64(time.Millisecond)
+		parts[i] = fmt.Sprintf("%s;dur=%.3f", e.name, ms)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// withServerTiming returns a copy of c which collects timings, and
+// a writer which adds them to the response headers of w when the response
+// is written.
+func withServerTiming(c Context, w http.ResponseWriter) (Context, http.ResponseWriter) {
+	t := &serverTimings{}
+	c = deriveContext(c, context.WithValue(c, serverTimingKey{}, t))
+	return c, &serverTimingWriter{ResponseWriter: w, timings: t}
+}
+
+// AddServerTiming adds duration d to the Server-Timing entry called name
+// of the request of c, e.g. to expose time spent in datastore calls.
+// Durations of entries with the same name are summed. It does nothing
+// unless Server.ServerTiming is enabled.
+//
+// name must be a valid HTTP token, e.g. "datastore" or "cache-miss".
+func AddServerTiming(c Context, name string, d time.Duration) {
+	if t, ok := c.Value(serverTimingKey{}).(*serverTimings); ok {
+		t.add(name, d)
+	}
+}
+
+// trackServerTiming adds time elapsed since start to the Server-Timing
+// entry called name. It's meant to be deferred.
+func trackServerTiming(c Context, name string, start time.Time) {
+	AddServerTiming(c, name, time.Since(start))
+}
+
+// serverTimingWriter sets Server-Timing header before a response is
+// written.
+type serverTimingWriter struct {
+	http.ResponseWriter
+	timings     *serverTimings
+	wroteHeader bool
+}
+
+func (w *serverTimingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if h := w.timings.header(); h != "" {
+			w.Header().Set("Server-Timing", h)
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *serverTimingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher, for streamed responses.
+func (w *serverTimingWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
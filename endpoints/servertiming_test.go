@@ -0,0 +1,74 @@
+package endpoints
+
+import (
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"appengine/aetest"
+)
+
+type TimingService struct{}
+
+func (s *TimingService) Fetch(c Context) error {
+	AddServerTiming(c, "datastore", 2*time.Millisecond)
+	AddServerTiming(c, "datastore", 3*time.Millisecond)
+	CurrentUser(c, []string{EmailScope}, nil, []string{"client-id"})
+	return nil
+}
+
+func TestServerTimingsHeader(t *testing.T) {
+	st := &serverTimings{}
+	if h := st.header(); h != "" {
+		t.Errorf("header() = %q; want empty", h)
+	}
+	st.add("db", 1500*time.Microsecond)
+	st.add("cache", time.Millisecond)
+	st.add("db", 500*time.Microsecond)
+	if h, want := st.header(), "db;dur=2.000, cache;dur=1.000"; h != want {
+		t.Errorf("header() = %q; want %q", h, want)
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	if _, err := server.RegisterService(&TimingService{}, "timing", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+
+	for _, enabled := range []bool{false, true} {
+		server.ServerTiming = enabled
+		r, err := inst.NewRequest("POST", "/TimingService.Fetch", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		h := w.Header().Get("Server-Timing")
+		if !enabled {
+			if h != "" {
+				t.Errorf("Server-Timing = %q; want none", h)
+			}
+			continue
+		}
+		if !regexp.MustCompile(`^decode;dur=[0-9.]+, datastore;dur=5\.000, auth;dur=[0-9.]+, handler;dur=[0-9.]+$`).MatchString(h) {
+			t.Errorf("Server-Timing = %q; want decode, datastore, auth and handler", h)
+		}
+	}
+}
+
+func TestAddServerTimingDisabled(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	// Must not panic.
+	AddServerTiming(NewContext(r), "datastore", time.Second)
+}
@@ -10,8 +10,10 @@ import (
 	"log"
 	"net/http"
 	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -40,6 +42,9 @@ type RPCService struct {
 
 	internal bool
 	info     *ServiceInfo
+
+	// creates contexts for this service's requests, if not nil
+	ctxFactory func(*http.Request) Context
 }
 
 // Name returns service method name
@@ -53,6 +58,24 @@ func (s *RPCService) Info() *ServiceInfo {
 	return s.info
 }
 
+// SetContextFactory makes requests to this service use factory instead of
+// the package ContextFactory, e.g. to validate auth differently from other
+// services registered with the same Server.
+//
+// Passing nil reverts to the package ContextFactory.
+func (s *RPCService) SetContextFactory(factory func(*http.Request) Context) {
+	s.ctxFactory = factory
+}
+
+// contextFactory returns a factory suitable for creating contexts of this
+// service requests.
+func (s *RPCService) contextFactory() func(*http.Request) Context {
+	if s.ctxFactory != nil {
+		return s.ctxFactory
+	}
+	return ContextFactory
+}
+
 // Methods returns a slice of all service's registered methods
 func (s *RPCService) Methods() []*ServiceMethod {
 	items := make([]*ServiceMethod, 0, len(s.methods))
@@ -94,6 +117,82 @@ func (m *ServiceMethod) Info() *MethodInfo {
 	return m.info
 }
 
+// readOnly returns true if m is a GET method.
+func (m *ServiceMethod) readOnly() bool {
+	return m.info != nil && m.info.HTTPMethod == "GET"
+}
+
+// partialUpdate returns true if m is a PATCH method.
+func (m *ServiceMethod) partialUpdate() bool {
+	return m.info != nil && m.info.HTTPMethod == "PATCH"
+}
+
+// cacheControl returns Cache-Control header value of successful responses
+// of m: MethodInfo.CacheControl, if set, "no-store" for mutating methods,
+// or an empty string.
+func (m *ServiceMethod) cacheControl() string {
+	switch {
+	case m.info == nil:
+		return ""
+	case m.info.CacheControl != "":
+		return m.info.CacheControl
+	case !m.readOnly():
+		return "no-store"
+	}
+	return ""
+}
+
+// cacheTTL returns how long responses of m cached by key are fresh:
+// max-age of its Cache-Control, if any, or MethodInfo.CacheTTL. Responses
+// which may not be stored are not cached.
+func (m *ServiceMethod) cacheTTL() time.Duration {
+	cc := m.cacheControl()
+	switch {
+	case m.info == nil, strings.Contains(cc, "no-store"):
+		return 0
+	case maxAgePattern.MatchString(cc):
+		return time.Duration(getMaxAge(cc)) * time.Second
+	}
+	return m.info.CacheTTL
+}
+
+// successStatus returns HTTP status code of successful responses.
+//
+// It is MethodInfo.StatusCode, if set, 204 No Content if the method has no
+// response and 200 OK otherwise.
+func (m *ServiceMethod) successStatus() int {
+	if m.info != nil && m.info.StatusCode != 0 {
+		return m.info.StatusCode
+	}
+	mtype := m.method.Type
+	if mtype.NumIn() < 4 && mtype.NumOut() < 2 {
+		return http.StatusNoContent
+	}
+	return http.StatusOK
+}
+
+// available returns false if m is unavailable to the request of c,
+// see MethodInfo.Availability.
+func (m *ServiceMethod) available(c Context) bool {
+	return m.info == nil || m.info.Availability == nil || m.info.Availability(c)
+}
+
+// setDeprecationHeaders adds Warning and Sunset headers to responses of
+// deprecated methods.
+func (m *ServiceMethod) setDeprecationHeaders(h http.Header) {
+	info := m.info
+	if info == nil || (!info.Deprecated && info.SunsetDate.IsZero()) {
+		return
+	}
+	msg := fmt.Sprintf("Method %s is deprecated", info.Name)
+	if !info.SunsetDate.IsZero() {
+		sunset := info.SunsetDate.UTC().Format(http.TimeFormat)
+		h.Set("Sunset", sunset)
+		msg += " and will be retired on " + sunset
+	}
+	h.Add("Warning", fmt.Sprintf("299 - %q", msg))
+}
+
 // MethodInfo is what's used to construct Endpoints API config
 type MethodInfo struct {
 	// name can also contain resource, e.g. "greets.list"
@@ -102,8 +201,93 @@ type MethodInfo struct {
 	HTTPMethod string
 	Scopes     []string
 	Audiences  []string
-	ClientIds  []string
-	Desc       string
+	// ClientIds may contain wildcard patterns like
+	// "123456789-*.apps.googleusercontent.com", see
+	// CurrentBearerTokenScope.
+	ClientIds []string
+	Desc      string
+
+	// Public exempts the method from Server.DefaultAuth, so it's open
+	// even if the server requires authentication by default.
+	Public bool
+	// LazyAuth defers the Server.DefaultAuth check until the method first
+	// asks for the user, e.g. with CurrentUser or CurrentOAuthUser, so that
+	// code paths which don't need the user skip token validation. The result
+	// is cached for the rest of the request.
+	LazyAuth bool
+
+	// RequiredHeaders are request headers the method requires, e.g. to gate
+	// old client versions. Requests missing any of them, or with a value
+	// which isn't allowed, are rejected with 400 Bad Request naming the
+	// header before the method is called.
+	RequiredHeaders []RequiredHeader
+
+	// Availability, if set, tells whether the method is available to
+	// a request, e.g. to ship it dark behind a feature flag for some client
+	// IDs only. It is called once the context is created; if it returns
+	// false, the request fails with 404 Not Found as if the method wasn't
+	// registered. The API config, and hence the discovery doc, still lists
+	// the method since it is fetched by the API server rather than by
+	// clients.
+	Availability func(c Context) bool
+
+	// StatusCode is HTTP status of successful responses, e.g. 201 Created.
+	// Defaults to 200 OK, or 204 No Content if the method has no response.
+	// 204 responses never have a body, even if the method returns one.
+	StatusCode int
+
+	// CacheControl is Cache-Control header of successful responses, e.g.
+	// "private, max-age=60". It defaults to "no-store" for methods other
+	// than GET, and to no header for GET methods.
+	CacheControl string
+
+	// Coalesce makes concurrent identical requests of a GET method share
+	// a single call, e.g. to spare an expensive read when many clients ask
+	// for the same thing at once. All of them get its response or error.
+	// Requests are identical if they have the same parameters, token and
+	// namespace. Methods returning a Responder are never coalesced.
+	Coalesce bool
+
+	// CacheByKey makes requests of a GET method with the same
+	// X-Cache-Key header, token and namespace share a single call, like
+	// Coalesce, and its response, which is cached by the instance for
+	// max-age of CacheControl, or CacheTTL if it has none. It lets clients
+	// group requests which differ in ways that don't matter to them.
+	// Requests without the header are served as usual. Errors are never
+	// cached, nor are responses of methods returning a Responder.
+	CacheByKey bool
+	// CacheTTL is how long responses cached by CacheByKey are fresh if
+	// CacheControl has no max-age. Zero only shares calls in flight.
+	CacheTTL time.Duration
+
+	// MaxConcurrent, if positive, caps how many calls of the method run at
+	// once, e.g. to keep expensive image processing from exhausting
+	// the instance. Up to MaxQueued more requests wait for a slot, until
+	// their deadline or cancellation. Others are rejected with 503 Service
+	// Unavailable and Retry-After header, see Server.AdmissionRetryAfter.
+	// Requests take a slot only once authenticated and decoded.
+	MaxConcurrent int
+	MaxQueued     int
+
+	// MaxBodyBytes overrides Server.MaxBodyBytes for the method, e.g. to
+	// allow large uploads. Negative value means no limit.
+	MaxBodyBytes int64
+
+	// CORS overrides Server.CORS for the method. Set CORS.Disabled to turn
+	// CORS off for the method only.
+	CORS *CORS
+
+	// Timeout limits how long the method can take, see
+	// Server.MaxRequestTimeout. Zero value means no method-specific limit.
+	Timeout time.Duration
+
+	// Deprecated makes the method's responses carry a Warning header
+	// telling clients to migrate off the method.
+	Deprecated bool
+	// SunsetDate, if set, is when the method is going to be retired.
+	// It is sent in a Sunset header (RFC 8594) along with the deprecation
+	// warning, even if Deprecated is false.
+	SunsetDate time.Time
 }
 
 // ----------------------------------------------------------------------------
@@ -156,9 +340,19 @@ func (m *serviceMap) register(srv interface{}, name, ver, desc string, isDefault
 	for i := 0; i < s.rcvrType.NumMethod(); i++ {
 		method := s.rcvrType.Method(i)
 		srvMethod := newServiceMethod(&method, internal)
-		if srvMethod != nil {
-			s.methods[method.Name] = srvMethod
+		if srvMethod == nil {
+			continue
+		}
+		if err := compilePatterns(srvMethod.ReqType); err != nil {
+			return nil, fmt.Errorf("endpoints: %s.%s: %v", s.name, method.Name, err)
+		}
+		if err := checkRequiredIf(srvMethod.ReqType); err != nil {
+			return nil, fmt.Errorf("endpoints: %s.%s: %v", s.name, method.Name, err)
 		}
+		if err := checkSerializable(srvMethod); err != nil {
+			return nil, fmt.Errorf("endpoints: %s.%s: %v", s.name, method.Name, err)
+		}
+		s.methods[method.Name] = srvMethod
 	}
 	if len(s.methods) == 0 {
 		return nil, fmt.Errorf(
@@ -247,7 +441,11 @@ func newServiceMethod(m *reflect.Method, internal bool) *ServiceMethod {
 
 		params := requiredParamNames(method.ReqType)
 		numParam := len(params)
-		if method.ReqType.Kind() == reflect.Struct {
+		switch k := method.ReqType.Kind(); {
+		case k == reflect.Interface, k == reflect.Slice:
+			// Arrays, including raw bodies, and OneOf requests.
+			method.info.HTTPMethod = "POST"
+		case k == reflect.Struct:
 			switch {
 			default:
 				method.info.HTTPMethod = "POST"
@@ -307,13 +505,18 @@ func (m *serviceMap) get(method string) (*RPCService, *ServiceMethod, error) {
 	}
 	ServiceMethod := service.methods[parts[1]]
 	if ServiceMethod == nil {
-		err := fmt.Errorf(
-			"endpoints: can't find method %q of service %q", parts[1], parts[0])
-		return nil, nil, err
+		return nil, nil, errMethodNotFound(parts[0], parts[1])
 	}
 	return service, ServiceMethod, nil
 }
 
+// errMethodNotFound returns 404 APIError of a request for an unknown
+// method of service.
+func errMethodNotFound(service, method string) error {
+	return NewNotFoundError(
+		"endpoints: can't find method %q of service %q", method, service)
+}
+
 // serviceByName returns a registered service or nil if there's no service
 // registered by that name.
 func (m *serviceMap) serviceByName(serviceName string) *RPCService {
@@ -322,6 +525,59 @@ func (m *serviceMap) serviceByName(serviceName string) *RPCService {
 	return m.services[serviceName]
 }
 
+// validate returns an error if two methods of the same API, i.e. services
+// with the same name and version, would match the same HTTP method and
+// path. Internal services are not checked.
+func (m *serviceMap) validate() error {
+	apis := make(map[string][]*RPCService)
+	for _, s := range m.apiServices() {
+		key := s.info.Name + "/" + s.info.Version
+		apis[key] = append(apis[key], s)
+	}
+
+	keys := make([]string, 0, len(apis))
+	for k := range apis {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := checkDuplicatePaths(apis[k]); err != nil {
+			return fmt.Errorf("endpoints: API %s: %v", k, err)
+		}
+		if err := checkPathParams(apis[k]); err != nil {
+			return fmt.Errorf("endpoints: API %s: %v", k, err)
+		}
+		if err := checkHeaderPatterns(apis[k]); err != nil {
+			return fmt.Errorf("endpoints: API %s: %v", k, err)
+		}
+		if err := checkClientIDPatterns(apis[k]); err != nil {
+			return fmt.Errorf("endpoints: API %s: %v", k, err)
+		}
+	}
+	return nil
+}
+
+// apiServices returns registered services, except internal ones, sorted
+// by name.
+func (m *serviceMap) apiServices() []*RPCService {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	services := make([]*RPCService, 0, len(m.services))
+	for _, s := range m.services {
+		if !s.internal {
+			services = append(services, s)
+		}
+	}
+	sort.Sort(byServiceName(services))
+	return services
+}
+
+type byServiceName []*RPCService
+
+func (a byServiceName) Len() int           { return len(a) }
+func (a byServiceName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+func (a byServiceName) Less(i, j int) bool { return a[i].name < a[j].name }
+
 // isExported returns true of a string is an exported (upper case) name.
 func isExported(name string) bool {
 	rune, _ := utf8.DecodeRuneInString(name)
@@ -0,0 +1,70 @@
+package endpoints
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// inflightRequests tracks requests being served, so that a server can
+// drain them on shutdown.
+type inflightRequests struct {
+	mu       sync.Mutex
+	active   int
+	draining bool
+	drained  chan struct{} // closed when draining and active is 0
+}
+
+// enter registers a new request. It returns false if the server is
+// shutting down and the request must be rejected.
+func (t *inflightRequests) enter() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.draining {
+		return false
+	}
+	t.active++
+	return true
+}
+
+// leave unregisters a request registered with enter.
+func (t *inflightRequests) leave() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active--
+	if t.draining && t.active == 0 {
+		close(t.drained)
+	}
+}
+
+// drain stops accepting requests and returns a channel closed once all
+// the active ones finish.
+func (t *inflightRequests) drain() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.draining {
+		t.draining = true
+		t.drained = make(chan struct{})
+		if t.active == 0 {
+			close(t.drained)
+		}
+	}
+	return t.drained
+}
+
+// Shutdown stops s from accepting new requests, which are rejected with
+// 503 Service Unavailable from then on, and waits for requests in flight
+// to complete. If c is done first, Shutdown returns its error while
+// the requests keep running.
+//
+// Shutdown is meant for deployments which manage the lifecycle of
+// instances themselves, e.g. along with http.Server.Shutdown. It is safe
+// to call concurrently and more than once.
+func (s *Server) Shutdown(c context.Context) error {
+	select {
+	case <-s.inflight.drain():
+		return nil
+	case <-c.Done():
+		return c.Err()
+	}
+}
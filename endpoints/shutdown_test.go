@@ -0,0 +1,89 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"appengine/aetest"
+)
+
+type SlowService struct {
+	started, release chan struct{}
+}
+
+func (s *SlowService) Wait(c Context) error {
+	s.started <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func TestServerShutdown(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	svc := &SlowService{make(chan struct{}), make(chan struct{})}
+	server := NewServer("")
+	if _, err := server.RegisterService(svc, "slow", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	newRequest := func() *http.Request {
+		r, err := inst.NewRequest("POST", "/SlowService.Wait", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("failed to create req: %v", err)
+		}
+		return r
+	}
+
+	inflight := httptest.NewRecorder()
+	served := make(chan struct{})
+	go func() {
+		server.ServeHTTP(inflight, newRequest())
+		close(served)
+	}()
+	<-svc.started
+
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(c); err != context.DeadlineExceeded {
+		t.Errorf("Shutdown() with in-flight request = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, newRequest())
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("request after Shutdown: w.Code = %d; want 503", w.Code)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = server.Shutdown(context.Background())
+		}(i)
+	}
+	close(svc.release)
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("%d: Shutdown() = %v; want nil", i, err)
+		}
+	}
+	<-served
+	if inflight.Code != http.StatusNoContent {
+		t.Errorf("in-flight request: w.Code = %d; want 204", inflight.Code)
+	}
+	if err := server.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown() after drain = %v; want nil", err)
+	}
+}
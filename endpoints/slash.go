@@ -0,0 +1,49 @@
+package endpoints
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TrailingSlashPolicy controls how Server handles request paths ending
+// with a slash, e.g. "/_ah/spi/Service.Method/".
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashStrict routes paths as they are, so a trailing slash
+	// results in an unknown method error. This is the default.
+	TrailingSlashStrict TrailingSlashPolicy = iota
+	// TrailingSlashRedirect responds to GET and HEAD requests with
+	// 301 Moved Permanently to the path without trailing slashes. Other
+	// requests are routed as with TrailingSlashStrict.
+	TrailingSlashRedirect
+	// TrailingSlashLenient routes paths with trailing slashes the same
+	// as paths without them.
+	TrailingSlashLenient
+)
+
+// routePath returns the path of request r to route by, according to
+// s.TrailingSlash. If it redirected the request instead, it returns false.
+func (s *Server) routePath(w http.ResponseWriter, r *http.Request) (string, bool) {
+	path := r.URL.Path
+	trimmed := strings.TrimRight(path, "/")
+	if trimmed == path || trimmed == "" {
+		return path, true
+	}
+	switch s.TrailingSlash {
+	case TrailingSlashLenient:
+		return trimmed, true
+	case TrailingSlashRedirect:
+		if r.Method != "GET" && r.Method != "HEAD" {
+			return path, true
+		}
+		if r.URL.RawQuery != "" {
+			trimmed += "?" + r.URL.RawQuery
+		}
+		w.Header().Del("Content-Type")
+		w.Header().Set("Location", trimmed)
+		w.WriteHeader(http.StatusMovedPermanently)
+		return "", false
+	}
+	return path, true
+}
@@ -0,0 +1,56 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+func TestServerTrailingSlash(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	tts := []struct {
+		policy   TrailingSlashPolicy
+		method   string
+		path     string
+		code     int
+		location string
+	}{
+		{TrailingSlashStrict, "POST", "/ServerTestService.Msg", http.StatusOK, ""},
+		{TrailingSlashStrict, "POST", "/ServerTestService.Msg/", http.StatusBadRequest, ""},
+		{TrailingSlashStrict, "GET", "/ServerTestService.Msg/", http.StatusBadRequest, ""},
+		{TrailingSlashLenient, "POST", "/ServerTestService.Msg/", http.StatusOK, ""},
+		{TrailingSlashLenient, "POST", "/ServerTestService.Msg//", http.StatusOK, ""},
+		{TrailingSlashRedirect, "POST", "/ServerTestService.Msg/", http.StatusBadRequest, ""},
+		{TrailingSlashRedirect, "POST", "/ServerTestService.Msg", http.StatusOK, ""},
+		{TrailingSlashRedirect, "GET", "/ServerTestService.Msg/", http.StatusMovedPermanently,
+			"/ServerTestService.Msg"},
+		{TrailingSlashRedirect, "HEAD", "/ServerTestService.Msg/?a=1&b=2", http.StatusMovedPermanently,
+			"/ServerTestService.Msg?a=1&b=2"},
+	}
+	for i, tt := range tts {
+		server := createAPIServer()
+		server.TrailingSlash = tt.policy
+
+		r, err := inst.NewRequest(tt.method, tt.path, strings.NewReader(`{"name":"slash"}`))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: %s %s: w.Code = %d; want %d", i, tt.method, tt.path, w.Code, tt.code)
+		}
+		if loc := w.Header().Get("Location"); loc != tt.location {
+			t.Errorf("%d: %s %s: Location = %q; want %q", i, tt.method, tt.path, loc, tt.location)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of time.Time fields, see "timeformats" and "timeformat" field
+// tags.
+const (
+	// TimeFormatRFC3339 is an RFC 3339 timestamp, e.g.
+	// "2015-01-31T12:00:00Z", the default.
+	TimeFormatRFC3339 = "rfc3339"
+	// TimeFormatDate is a date-only value, e.g. "2015-01-31".
+	TimeFormatDate = "date"
+	// TimeFormatUnix is a number of seconds since Unix epoch.
+	TimeFormatUnix = "unix"
+	// TimeFormatUnixMillis is a number of milliseconds since Unix epoch.
+	TimeFormatUnixMillis = "unixmillis"
+)
+
+// checkTimeFormat returns an error if f is not a known time format.
+func checkTimeFormat(f string) error {
+	switch f {
+	case TimeFormatRFC3339, TimeFormatDate, TimeFormatUnix, TimeFormatUnixMillis:
+		return nil
+	}
+	return fmt.Errorf("Invalid time format %q", f)
+}
+
+// parseTimeFormats parses s as a time in one of formats, trying each in
+// order.
+func parseTimeFormats(s string, formats []string) (time.Time, error) {
+	for _, f := range formats {
+		var (
+			t   time.Time
+			err error
+		)
+		switch f {
+		case TimeFormatRFC3339:
+			t, err = time.Parse(time.RFC3339, s)
+		case TimeFormatDate:
+			t, err = time.Parse(dateOnlyLayout, s)
+		case TimeFormatUnix, TimeFormatUnixMillis:
+			t, err = parseUnixTime(s, f == TimeFormatUnixMillis)
+		default:
+			err = checkTimeFormat(f)
+		}
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected one of %s",
+		s, strings.Join(formats, ", "))
+}
+
+// Unix times are limited to years 1 to 9999, those RFC 3339 can represent.
+var (
+	minUnixTime = time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	maxUnixTime = time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC).Unix()
+)
+
+// parseUnixTime parses s as seconds, or milliseconds if millis is true,
+// since the Unix epoch. It returns an error if the time is out of range.
+func parseUnixTime(s string, millis bool) (time.Time, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec, nsec := n, int64(0)
+	if millis {
+		sec, nsec = n/1000, n%1000*int64(time.Millisecond)
+	}
+	if sec < minUnixTime || sec > maxUnixTime {
+		return time.Time{}, fmt.Errorf("time %s out of range", s)
+	}
+	return time.Unix(sec, nsec).UTC(), nil
+}
+
+// queryTimeFormats returns formats of time field tagged with "timeformats",
+// or nil.
+func queryTimeFormats(field *reflect.StructField) []string {
+	if !isTimeField(field) {
+		return nil
+	}
+	tag, err := parseTag(field.Tag)
+	if err != nil {
+		return nil
+	}
+	return tag.timeFormats
+}
+
+// setTimeFromString parses s as a time in one of formats and stores it in
+// v, a time.Time or *time.Time.
+func setTimeFromString(v reflect.Value, s string, formats []string) error {
+	t, err := parseTimeFormats(s, formats)
+	if err != nil {
+		return err
+	}
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(typeOfTime))
+		v = v.Elem()
+	}
+	v.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// formatTime formats t in format f, returning a JSON string or number.
+func formatTime(t time.Time, f string) interface{} {
+	switch f {
+	case TimeFormatDate:
+		return t.Format(dateOnlyLayout)
+	case TimeFormatUnix:
+		return json.Number(strconv.FormatInt(t.Unix(), 10))
+	case TimeFormatUnixMillis:
+		return json.Number(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10))
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// isTimeField returns true if field is a time.Time or *time.Time.
+func isTimeField(field *reflect.StructField) bool {
+	return field.Type == typeOfTime ||
+		field.Type.Kind() == reflect.Ptr && field.Type.Elem() == typeOfTime
+}
+
+// timeFormatProp returns discovery type and format of time fields
+// formatted as f in responses.
+func timeFormatProp(f string) (string, string) {
+	switch f {
+	case TimeFormatDate:
+		return "string", "date"
+	case TimeFormatUnix, TimeFormatUnixMillis:
+		return "string", "int64"
+	}
+	return "string", "date-time"
+}
+
+// normalizeTimes returns generic JSON data of a request of type t with
+// values of time fields tagged with "timeformats" converted to RFC 3339,
+// which is what time.Time decodes from. A value matching none of the
+// formats results in 400 APIError naming the field, and the value unless
+// the field is tagged with "secret".
+func normalizeTimes(t reflect.Type, data interface{}) (interface{}, error) {
+	var err error
+	data = walkJSON(t, data, func(field *reflect.StructField, tag *endpointsTag, val interface{}) (interface{}, bool) {
+		if len(tag.timeFormats) == 0 || !isTimeField(field) || val == nil {
+			return val, true
+		}
+		s := fmt.Sprint(val)
+		parsed, perr := parseTimeFormats(s, tag.timeFormats)
+		if perr != nil {
+			if err == nil && tag.secret {
+				err = NewBadRequestError("Invalid value of field %q, expected one of %s",
+					jsonFieldName(field), strings.Join(tag.timeFormats, ", "))
+			} else if err == nil {
+				err = NewBadRequestError("Invalid value of field %q: %v",
+					jsonFieldName(field), perr)
+			}
+			return val, false
+		}
+		return parsed.Format(time.RFC3339Nano), false
+	})
+	return data, err
+}
+
+// formatTimesField is a jsonFieldFunc formatting values of time fields
+// tagged with "timeformat" in their format.
+func formatTimesField(field *reflect.StructField, tag *endpointsTag, val interface{}) (interface{}, bool) {
+	s, ok := val.(string)
+	if !ok || tag.timeFormat == "" || !isTimeField(field) {
+		return val, true
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return val, false
+	}
+	return formatTime(t, tag.timeFormat), false
+}
+
+// hasTimeFormats returns true if values of type t can contain time fields
+// tagged with "timeformats" or "timeformat".
+func hasTimeFormats(t reflect.Type) bool {
+	return hasTaggedFields(t, isTimeFormatsField)
+}
+
+// isTimeFormatsField is a fieldPredicate matching time fields tagged with
+// "timeformats" or "timeformat".
+func isTimeFormatsField(field *reflect.StructField, tag *endpointsTag) bool {
+	return isTimeField(field) && (len(tag.timeFormats) > 0 || tag.timeFormat != "")
+}
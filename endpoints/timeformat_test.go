@@ -0,0 +1,112 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type TimesMsg struct {
+	Created time.Time  `json:"created" endpoints:"timeformats=rfc3339|unixmillis,timeformat=unixmillis"`
+	Due     *time.Time `json:"due" endpoints:"timeformats=date|unix,timeformat=date"`
+	Plain   time.Time  `json:"plain"`
+}
+
+func TestHasTimeFormats(t *testing.T) {
+	tts := []struct {
+		v    interface{}
+		want bool
+	}{
+		{&TimesMsg{}, true},
+		{[]*TimesMsg{}, true},
+		{&TestMsg{}, false},
+		{&JSItem{}, false},
+	}
+	for i, tt := range tts {
+		typ := reflect.TypeOf(tt.v)
+		if out := hasTimeFormats(typ); out != tt.want {
+			t.Errorf("%d: hasTimeFormats(%v) = %v; want %v", i, typ, out, tt.want)
+		}
+	}
+}
+
+func TestDecodeJSONTimeFormats(t *testing.T) {
+	created := time.Date(2015, 1, 31, 12, 30, 0, 0, time.UTC)
+	due := time.Date(2015, 2, 1, 0, 0, 0, 0, time.UTC)
+	tts := []struct {
+		in      string
+		created time.Time
+		due     *time.Time
+		code    int
+	}{
+		{`{"created":"2015-01-31T12:30:00Z"}`, created, nil, 0},
+		{`{"created":1422707400000}`, created, nil, 0},
+		{`{"created":"1422707400000"}`, created, nil, 0},
+		{`{"due":"2015-02-01"}`, time.Time{}, &due, 0},
+		{`{"due":1422748800}`, time.Time{}, &due, 0},
+		{`{"due":null}`, time.Time{}, nil, 0},
+		{`{"created":"2015-01-31"}`, time.Time{}, nil, http.StatusBadRequest},
+		{`{"due":"2015-02-01T00:00:00Z"}`, time.Time{}, nil, http.StatusBadRequest},
+		{`{"created":"9223372036854775807"}`, time.Time{}, nil, http.StatusBadRequest},
+		{`{"created":"-9223372036854775808"}`, time.Time{}, nil, http.StatusBadRequest},
+		{`{"due":"9223372036854775807"}`, time.Time{}, nil, http.StatusBadRequest},
+		{`{"due":"253402300800"}`, time.Time{}, nil, http.StatusBadRequest},
+	}
+	for i, tt := range tts {
+		msg := &TimesMsg{}
+		err := decodeJSON([]byte(tt.in), reflect.ValueOf(msg), false)
+		if tt.code != 0 {
+			if apiErr, ok := err.(*APIError); !ok || apiErr.Code != tt.code {
+				t.Errorf("%d: decodeJSON(%s) = %v; want %d APIError", i, tt.in, err, tt.code)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%d: decodeJSON(%s) = %v", i, tt.in, err)
+			continue
+		}
+		if !msg.Created.Equal(tt.created) {
+			t.Errorf("%d: Created = %v; want %v", i, msg.Created, tt.created)
+		}
+		if (msg.Due == nil) != (tt.due == nil) || msg.Due != nil && !msg.Due.Equal(*tt.due) {
+			t.Errorf("%d: Due = %v; want %v", i, msg.Due, tt.due)
+		}
+	}
+}
+
+func TestEncodeJSONTimeFormat(t *testing.T) {
+	ts := time.Date(2015, 1, 31, 12, 30, 0, 0, time.UTC)
+	msg := &TimesMsg{Created: ts, Due: &ts, Plain: ts}
+	out, err := encodeJSON(reflect.ValueOf(msg))
+	if err != nil {
+		t.Fatalf("encodeJSON(%#v) = %v", msg, err)
+	}
+	const want = `{"created":1422707400000,"due":"2015-01-31","plain":"2015-01-31T12:30:00Z"}`
+	if string(out) != want {
+		t.Errorf("encodeJSON(%#v) = %s; want %s", msg, out, want)
+	}
+}
+
+func TestBindQueryTimeFormats(t *testing.T) {
+	msg := &TimesMsg{}
+	q := url.Values{"created": {"1422707400000"}, "due": {"2015-02-01"}}
+	if err := bindQuery(reflect.ValueOf(msg).Elem(), q, 0); err != nil {
+		t.Fatalf("bindQuery(%v) = %v", q, err)
+	}
+	if want := time.Unix(1422707400, 0); !msg.Created.Equal(want) {
+		t.Errorf("Created = %v; want %v", msg.Created, want)
+	}
+	if want := time.Date(2015, 2, 1, 0, 0, 0, 0, time.UTC); msg.Due == nil || !msg.Due.Equal(want) {
+		t.Errorf("Due = %v; want %v", msg.Due, want)
+	}
+
+	for _, created := range []string{"yesterday", "9223372036854775807"} {
+		q = url.Values{"created": {created}}
+		err := bindQuery(reflect.ValueOf(&TimesMsg{}).Elem(), q, 0)
+		if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusBadRequest {
+			t.Errorf("bindQuery(%v) = %v; want 400 APIError", q, err)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package endpoints
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// requestTimeout returns a timeout of method m handling request r,
+// or zero if there's no timeout.
+//
+// It is the smallest of s.MaxRequestTimeout, MethodInfo.Timeout of m
+// and a timeout requested by the client in s.TimeoutHeader. The latter can
+// only tighten server-configured timeouts, never loosen them.
+func (s *Server) requestTimeout(m *ServiceMethod, r *http.Request) time.Duration {
+	timeout := s.MaxRequestTimeout
+	if m.info != nil {
+		timeout = minTimeout(timeout, m.info.Timeout)
+	}
+	if s.TimeoutHeader != "" {
+		if d, ok := parseTimeout(r.Header.Get(s.TimeoutHeader)); ok {
+			timeout = minTimeout(timeout, d)
+		}
+	}
+	return timeout
+}
+
+// minTimeout returns the smallest of a and b, treating non-positive
+// values as no timeout.
+func minTimeout(a, b time.Duration) time.Duration {
+	switch {
+	case b <= 0:
+		return a
+	case a <= 0 || b < a:
+		return b
+	}
+	return a
+}
+
+// parseTimeout parses a timeout header value, which is either a number of
+// seconds, e.g. "2.5", or a duration string, e.g. "2500ms".
+// The second return value is false if s is malformed or not positive.
+func parseTimeout(s string) (time.Duration, bool) {
+	if s == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		d := time.Duration(secs * float64(time.Second))
+		return d, d > 0
+	}
+	d, err := time.ParseDuration(s)
+	return d, err == nil && d > 0
+}
+
+// withTimeout returns a Context derived from c which is canceled after
+// timeout d.
+func withTimeout(c Context, d time.Duration) (Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(c, d)
+	return deriveContext(c, ctx), cancel
+}
+
+// WithBudget returns a Context derived from c, e.g. for outbound calls
+// with urlfetch, with a deadline fraction of the time left until
+// the deadline of c, so that the calls leave time to handle their results.
+// Fractions above 1 are treated as 1. If c has no deadline, the returned
+// Context has none either and is only canceled along with c or by cancel.
+//
+// Unlike contexts the server derives, the returned Context doesn't replace
+// c as the context of the request, so call cancel once the calls are done.
+func WithBudget(c Context, fraction float64) (Context, context.CancelFunc) {
+	deadline, ok := c.Deadline()
+	if !ok {
+		ctx, cancel := context.WithCancel(c)
+		return &derivedContext{c, ctx}, cancel
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	budget := time.Duration(float64(deadline.Sub(time.Now())) * fraction)
+	ctx, cancel := context.WithTimeout(c, budget)
+	return &derivedContext{c, ctx}, cancel
+}
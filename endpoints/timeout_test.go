@@ -0,0 +1,104 @@
+package endpoints
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tts := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"2", 2 * time.Second, true},
+		{"2.5", 2500 * time.Millisecond, true},
+		{"500ms", 500 * time.Millisecond, true},
+		{"1m", time.Minute, true},
+		{"", 0, false},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"soon", 0, false},
+	}
+	for i, tt := range tts {
+		out, ok := parseTimeout(tt.in)
+		if ok != tt.ok || (ok && out != tt.want) {
+			t.Errorf("%d: parseTimeout(%q) = %v, %v; want %v, %v",
+				i, tt.in, out, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	const header = "X-Request-Timeout"
+	tts := []struct {
+		max, method time.Duration
+		header      string
+		want        time.Duration
+	}{
+		{0, 0, "", 0},
+		{0, 0, "5", 5 * time.Second},
+		{10 * time.Second, 0, "", 10 * time.Second},
+		{10 * time.Second, 0, "5", 5 * time.Second},
+		{10 * time.Second, 0, "20", 10 * time.Second},
+		{10 * time.Second, 0, "invalid", 10 * time.Second},
+		{10 * time.Second, 2 * time.Second, "5", 2 * time.Second},
+		{10 * time.Second, 20 * time.Second, "", 10 * time.Second},
+		{0, 2 * time.Second, "1", time.Second},
+	}
+	for i, tt := range tts {
+		s := &Server{MaxRequestTimeout: tt.max, TimeoutHeader: header}
+		m := &ServiceMethod{info: &MethodInfo{Timeout: tt.method}}
+		r := &http.Request{Header: make(http.Header)}
+		if tt.header != "" {
+			r.Header.Set(header, tt.header)
+		}
+		if out := s.requestTimeout(m, r); out != tt.want {
+			t.Errorf("%d: requestTimeout() = %v; want %v", i, out, tt.want)
+		}
+	}
+}
+
+func TestWithBudget(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := newContext(r, cachingContextFactory)
+
+	bc, cancel := WithBudget(c, 0.5)
+	if _, ok := bc.Deadline(); ok {
+		t.Errorf("WithBudget() of a context without deadline has a deadline")
+	}
+	cancel()
+	if bc.Err() != context.Canceled || c.Err() != nil {
+		t.Errorf("after cancel, Err() = %v, parent %v; want %v, nil", bc.Err(), c.Err(), context.Canceled)
+	}
+
+	tc, tcancel := withTimeout(c, 10*time.Second)
+	defer tcancel()
+	parent, _ := tc.Deadline()
+	for _, tt := range []struct {
+		fraction float64
+		want     time.Duration
+	}{
+		{0.5, 5 * time.Second},
+		{0.1, time.Second},
+		{2, 10 * time.Second},
+	} {
+		start := time.Now()
+		bc, cancel := WithBudget(tc, tt.fraction)
+		deadline, ok := bc.Deadline()
+		cancel()
+		if got := deadline.Sub(start); !ok || deadline.After(parent) || got < tt.want-time.Second || got > tt.want {
+			t.Errorf("WithBudget(%v) deadline = %v from now, %t; want about %v", tt.fraction, got, ok, tt.want)
+		}
+		if bc.HTTPRequest() != r {
+			t.Errorf("WithBudget(%v).HTTPRequest() = %v; want %v", tt.fraction, bc.HTTPRequest(), r)
+		}
+	}
+	if NewContext(r) != tc {
+		t.Errorf("NewContext() = %v; want the request context unchanged by WithBudget", NewContext(r))
+	}
+}
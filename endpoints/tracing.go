@@ -0,0 +1,155 @@
+package endpoints
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+// TraceContextHeader is the request header carrying the trace context of
+// the caller, e.g. "105445aa7843bc8bf206b12000100000/1;o=1".
+const TraceContextHeader = "X-Cloud-Trace-Context"
+
+// TraceContext identifies a span of a distributed trace, as propagated in
+// TraceContextHeader.
+type TraceContext struct {
+	// TraceID is the ID of the trace, 32 hex digits.
+	TraceID string
+	// SpanID is the ID of the caller's span, or zero if unknown.
+	SpanID uint64
+	// Sampled is true if the caller is tracing the request, "o=1".
+	Sampled bool
+}
+
+// Tracer starts spans of requests to service methods, e.g. to export
+// traces to Stackdriver through OpenCensus or OpenTelemetry. See
+// Server.Tracer.
+type Tracer interface {
+	// StartSpan starts the span of request r to method, e.g.
+	// "MyService.Get". parent is the trace context of the caller found in
+	// TraceContextHeader of r, or nil if there's none or it's malformed.
+	// It must be safe for concurrent use.
+	StartSpan(r *http.Request, method string, parent *TraceContext) Span
+}
+
+// Span is a span of a trace started by a Tracer.
+type Span interface {
+	// StartChild starts a span called name which is a child of the span.
+	StartChild(name string) Span
+	// SetAttribute sets attribute key of the span to value, which is
+	// a string, bool or int.
+	SetAttribute(key string, value interface{})
+	// End ends the span.
+	End()
+}
+
+// noopSpan is the Span of requests to a Server without a Tracer.
+type noopSpan struct{}
+
+func (noopSpan) StartChild(string) Span           { return noopSpan{} }
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) End()                             {}
+
+// spanKey is the context key of the active Span of a request.
+type spanKey struct{}
+
+// SpanFromContext returns the active span of the request of c, so that
+// service methods can start their own spans as its children:
+//
+//	span := endpoints.SpanFromContext(c).StartChild("datastore")
+//	defer span.End()
+//
+// It returns a Span which does nothing unless Server.Tracer is set.
+func SpanFromContext(c Context) Span {
+	if span, ok := c.Value(spanKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+// withSpan returns a copy of c which carries span as the active span.
+// c is returned as is if span does nothing.
+func withSpan(c Context, span Span) Context {
+	if _, ok := span.(noopSpan); ok {
+		return c
+	}
+	return deriveContext(c, context.WithValue(c, spanKey{}, span))
+}
+
+// startSpan starts a span called name which is a child of the active span
+// of c. The returned span can be ended more than once, e.g. both when
+// a phase of a request completes and, deferred, when the request is
+// aborted during the phase; only the first End counts.
+func startSpan(c Context, name string) Span {
+	parent := SpanFromContext(c)
+	if _, ok := parent.(noopSpan); ok {
+		return parent
+	}
+	return &onceSpan{Span: parent.StartChild(name)}
+}
+
+// onceSpan is a Span which is ended at most once.
+type onceSpan struct {
+	Span
+	ended bool
+}
+
+func (s *onceSpan) End() {
+	if !s.ended {
+		s.ended = true
+		s.Span.End()
+	}
+}
+
+// startRequestSpan starts the span of request r to method with s.Tracer,
+// continuing the trace of the caller, if any.
+func (s *Server) startRequestSpan(r *http.Request, method string) Span {
+	parent, _ := parseTraceContext(r.Header.Get(TraceContextHeader))
+	span := s.Tracer.StartSpan(r, method, parent)
+	span.SetAttribute("endpoints.method", method)
+	return span
+}
+
+// endRequestSpan sets HTTP status of the response written through w as an
+// attribute of span of the request, and ends it.
+func endRequestSpan(span Span, w *statusWriter) {
+	status := w.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	span.SetAttribute("http.status_code", status)
+	span.End()
+}
+
+// parseTraceContext parses value h of TraceContextHeader, which is
+// "TRACE_ID/SPAN_ID;o=OPTIONS" with optional span ID and options.
+func parseTraceContext(h string) (*TraceContext, bool) {
+	if h == "" {
+		return nil, false
+	}
+	tc := &TraceContext{}
+	if i := strings.Index(h, ";"); i >= 0 {
+		tc.Sampled = h[i+1:] == "o=1"
+		h = h[:i]
+	}
+	if i := strings.Index(h, "/"); i >= 0 {
+		id, err := strconv.ParseUint(h[i+1:], 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		tc.SpanID = id
+		h = h[:i]
+	}
+	if len(h) != 32 {
+		return nil, false
+	}
+	for _, r := range h {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F') {
+			return nil, false
+		}
+	}
+	tc.TraceID = h
+	return tc, true
+}
@@ -0,0 +1,174 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"appengine/aetest"
+)
+
+// fakeTracer records spans it starts.
+type fakeTracer struct {
+	mu     sync.Mutex
+	spans  []*fakeSpan
+	parent *TraceContext
+}
+
+func (t *fakeTracer) StartSpan(r *http.Request, method string, parent *TraceContext) Span {
+	t.parent = parent
+	return t.start(method, "")
+}
+
+func (t *fakeTracer) start(name, parent string) *fakeSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &fakeSpan{tracer: t, name: name, parent: parent, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+type fakeSpan struct {
+	tracer       *fakeTracer
+	name, parent string
+	attrs        map[string]interface{}
+	ends         int
+}
+
+func (s *fakeSpan) StartChild(name string) Span {
+	return s.tracer.start(name, s.name)
+}
+
+func (s *fakeSpan) SetAttribute(key string, value interface{}) {
+	s.attrs[key] = value
+}
+
+func (s *fakeSpan) End() {
+	s.ends++
+}
+
+type TracedService struct{}
+
+func (s *TracedService) Get(c Context, req *TestMsg) (*TestMsg, error) {
+	span := SpanFromContext(c).StartChild("datastore")
+	defer span.End()
+	span.SetAttribute("kind", "Greeting")
+	return req, nil
+}
+
+func TestParseTraceContext(t *testing.T) {
+	tts := []struct {
+		in   string
+		want *TraceContext
+	}{
+		{"105445aa7843bc8bf206b12000100000/1;o=1", &TraceContext{"105445aa7843bc8bf206b12000100000", 1, true}},
+		{"105445AA7843BC8BF206B12000100000/42;o=0", &TraceContext{"105445AA7843BC8BF206B12000100000", 42, false}},
+		{"105445aa7843bc8bf206b12000100000", &TraceContext{"105445aa7843bc8bf206b12000100000", 0, false}},
+		{"", nil},
+		{"105445aa7843bc8bf206b120001000/1;o=1", nil},
+		{"105445aa7843bc8bf206b1200010000g/1", nil},
+		{"105445aa7843bc8bf206b12000100000/span", nil},
+	}
+	for _, tt := range tts {
+		tc, ok := parseTraceContext(tt.in)
+		if ok != (tt.want != nil) || !reflect.DeepEqual(tc, tt.want) {
+			t.Errorf("parseTraceContext(%q) = %+v, %t; want %+v", tt.in, tc, ok, tt.want)
+		}
+	}
+}
+
+func TestServerTracer(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	if _, err := server.RegisterService(&TracedService{}, "Traced", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	tracer := &fakeTracer{}
+	server.Tracer = tracer
+
+	r, err := inst.NewRequest("POST", "/TracedService.Get", strings.NewReader(`{"name":"gopher"}`))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	r.Header.Set(TraceContextHeader, "105445aa7843bc8bf206b12000100000/7;o=1")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("w.Code = %d; want 200 (%s)", w.Code, w.Body)
+	}
+
+	if want := (&TraceContext{"105445aa7843bc8bf206b12000100000", 7, true}); !reflect.DeepEqual(tracer.parent, want) {
+		t.Errorf("parent = %+v; want %+v", tracer.parent, want)
+	}
+	var got []string
+	for _, s := range tracer.spans {
+		got = append(got, s.parent+">"+s.name)
+		if s.ends != 1 {
+			t.Errorf("span %s ended %d times; want once", s.name, s.ends)
+		}
+	}
+	want := []string{
+		">TracedService.Get",
+		"TracedService.Get>auth",
+		"TracedService.Get>decode",
+		"TracedService.Get>handler",
+		"handler>datastore",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("spans = %v; want %v", got, want)
+	}
+	root := tracer.spans[0]
+	wantAttrs := map[string]interface{}{"endpoints.method": "TracedService.Get", "http.status_code": http.StatusOK}
+	if !reflect.DeepEqual(root.attrs, wantAttrs) {
+		t.Errorf("root span attributes = %v; want %v", root.attrs, wantAttrs)
+	}
+
+	// Failed requests end their spans too.
+	tracer.spans = nil
+	r, err = inst.NewRequest("POST", "/TracedService.Get", strings.NewReader(`{"name":`))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	w = httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("w.Code = %d; want 400", w.Code)
+	}
+	if tracer.parent != nil {
+		t.Errorf("parent = %+v; want nil", tracer.parent)
+	}
+	for _, s := range tracer.spans {
+		if s.ends != 1 {
+			t.Errorf("span %s of failed request ended %d times; want once", s.name, s.ends)
+		}
+	}
+	if status := tracer.spans[0].attrs["http.status_code"]; status != http.StatusBadRequest {
+		t.Errorf("http.status_code = %v; want 400", status)
+	}
+}
+
+func TestSpanFromContextWithoutTracer(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	span := SpanFromContext(c)
+	if _, ok := span.(noopSpan); !ok {
+		t.Errorf("SpanFromContext() = %#v; want noopSpan", span)
+	}
+	if sc := startSpan(c, "decode"); sc != span {
+		t.Errorf("startSpan() = %#v; want noopSpan", sc)
+	}
+	if wc := withSpan(c, span); wc != c {
+		t.Errorf("withSpan(noopSpan) = %v; want c unchanged", wc)
+	}
+	span.StartChild("child").End()
+}
@@ -0,0 +1,42 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ResponseTransformer modifies a JSON-encoded response body before it is
+// written, e.g. to add fields common to all responses. It receives
+// the request, status code of the response and its body, and returns
+// the body to write instead.
+//
+// An error returned by ResponseTransformer is written as the response
+// without being transformed.
+type ResponseTransformer func(r *http.Request, status int, body []byte) ([]byte, error)
+
+// transformResponse applies s.ResponseTransformer to JSON body of
+// a response with the status, if any.
+func (s *Server) transformResponse(r *http.Request, status int, body []byte) ([]byte, error) {
+	if s.ResponseTransformer == nil {
+		return body, nil
+	}
+	return s.ResponseTransformer(r, status, body)
+}
+
+// writeTransformedError writes err as a response to r, with its body in
+// s.ErrorFormat transformed by s.ResponseTransformer.
+func (s *Server) writeTransformedError(w http.ResponseWriter, r *http.Request, err error) {
+	errResp := s.errorResponse(r, err)
+	errBody, ctype := s.errorBody(errResp)
+	body, err := json.Marshal(errBody)
+	if err == nil {
+		body, err = s.transformResponse(r, errResp.Code, body)
+	}
+	if err != nil {
+		s.writeErrorResponse(w, s.errorResponse(r, err))
+		return
+	}
+	w.Header().Set("Content-Type", ctype)
+	w.WriteHeader(errResp.Code)
+	w.Write(append(body, '\n'))
+}
@@ -0,0 +1,98 @@
+package endpoints
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+func TestServerResponseTransformer(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	addVersion := func(r *http.Request, status int, body []byte) ([]byte, error) {
+		if !bytes.HasPrefix(body, []byte("{")) {
+			return nil, errors.New("not an object")
+		}
+		v := `{"apiVersion":"v1","status":` + strconv.Itoa(status)
+		if len(body) > 2 {
+			v += ","
+		}
+		return append([]byte(v), body[1:]...), nil
+	}
+	failing := func(r *http.Request, status int, body []byte) ([]byte, error) {
+		return nil, NewConflictError("transform failed")
+	}
+
+	tts := []struct {
+		method      string
+		transformer ResponseTransformer
+		errors      bool
+		code        int
+		body        string
+	}{
+		{"Msg", nil, false, http.StatusOK, `{"name":"Hello"}`},
+		{"Msg", addVersion, false, http.StatusOK, `{"apiVersion":"v1","status":200,"name":"Hello"}`},
+		{"Void", addVersion, false, http.StatusOK, `{"apiVersion":"v1","status":200}`},
+		{"Error", addVersion, false, http.StatusBadRequest, `{"state":"APPLICATION_ERROR","error_name":"Internal Server Error","error_message":"Dummy error"}`},
+		{"Error", addVersion, true, http.StatusBadRequest, `{"apiVersion":"v1","status":400,"state":"APPLICATION_ERROR","error_name":"Internal Server Error","error_message":"Dummy error"}`},
+		{"Msg", failing, false, http.StatusConflict, `{"state":"APPLICATION_ERROR","error_name":"Conflict","error_message":"transform failed"}`},
+	}
+	for i, tt := range tts {
+		server := createAPIServer()
+		server.ResponseTransformer = tt.transformer
+		server.TransformErrors = tt.errors
+
+		r, err := inst.NewRequest("POST", "/ServerTestService."+tt.method, strings.NewReader(`{"name":"Hello"}`))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code {
+			t.Errorf("%d: w.Code = %d; want %d", i, w.Code, tt.code)
+		}
+		if body := strings.TrimSpace(w.Body.String()); body != tt.body {
+			t.Errorf("%d: body = %s; want %s", i, body, tt.body)
+		}
+	}
+}
+
+func TestServerResponseTransformerETag(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	const transformed = `{"apiVersion":"v1","name":"Hello"}`
+	server := createAPIServer()
+	server.ETags = true
+	server.ResponseTransformer = func(r *http.Request, status int, body []byte) ([]byte, error) {
+		return []byte(transformed), nil
+	}
+
+	r, err := inst.NewRequest("POST", "/ServerTestService.Msg", strings.NewReader(`{"name":"Hello"}`))
+	if err != nil {
+		t.Fatalf("failed to create req: %v", err)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("w.Code = %d; want 200 (%s)", w.Code, w.Body)
+	}
+	if etag, want := w.Header().Get("ETag"), etagOf([]byte(transformed)); etag != want {
+		t.Errorf("ETag = %q; want %q of the transformed body", etag, want)
+	}
+}
@@ -0,0 +1,145 @@
+package endpoints
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// tsIdentifier matches property names which don't need quoting in
+// TypeScript.
+var tsIdentifier = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// TypeScript returns TypeScript definitions of request and response
+// schemas of all registered services, matching their JSON representation.
+// It is meant to be called by build tools generating typed API clients.
+//
+// Each struct schema becomes an interface with properties named as in JSON.
+// Properties not tagged as required are optional. 64-bit integers are
+// strings, as they are on the wire. Interfaces registered with
+// RegisterOneOf become union types.
+func (s *Server) TypeScript() (string, error) {
+	schemas := make(map[string]*APISchemaDescriptor)
+	for _, service := range s.services.apiServices() {
+		d := &APIDescriptor{}
+		if err := service.APIDescriptor(d, "localhost"); err != nil {
+			return "", err
+		}
+		for name, sd := range d.Descriptor.Schemas {
+			schemas[name] = sd
+		}
+	}
+
+	names := make([]string, 0, len(schemas))
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	for i, name := range names {
+		if i > 0 {
+			buf.WriteByte('\n')
+		}
+		writeTSSchema(&buf, schemas[name])
+	}
+	return buf.String(), nil
+}
+
+// writeTSSchema writes TypeScript definition of schema sd to buf.
+func writeTSSchema(buf *bytes.Buffer, sd *APISchemaDescriptor) {
+	writeTSDoc(buf, "", sd.Desc)
+	switch {
+	case sd.ID == rawBodySchemaName:
+		fmt.Fprintf(buf, "export type %s = any;\n", sd.ID)
+		return
+	case len(sd.OneOf) > 0:
+		fmt.Fprintf(buf, "export type %s = %s;\n", sd.ID, tsUnion(sd.OneOf))
+		return
+	case sd.Items != nil:
+		fmt.Fprintf(buf, "export type %s = %s;\n", sd.ID, tsType(&APISchemaProperty{Type: "array", Items: sd.Items}))
+		return
+	}
+
+	fmt.Fprintf(buf, "export interface %s {\n", sd.ID)
+	names := make([]string, 0, len(sd.Properties))
+	for name := range sd.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prop := sd.Properties[name]
+		writeTSDoc(buf, "  ", prop.Desc)
+		key := name
+		if !tsIdentifier.MatchString(key) {
+			key = fmt.Sprintf("%q", key)
+		}
+		if !prop.Required {
+			key += "?"
+		}
+		fmt.Fprintf(buf, "  %s: %s;\n", key, tsType(prop))
+	}
+	buf.WriteString("}\n")
+}
+
+// writeTSDoc writes desc as a doc comment indented with indent, if desc
+// is not empty.
+func writeTSDoc(buf *bytes.Buffer, indent, desc string) {
+	if desc == "" {
+		return
+	}
+	desc = strings.Replace(desc, "*/", "*\\/", -1)
+	fmt.Fprintf(buf, "%s/** %s */\n", indent, desc)
+}
+
+// tsType returns TypeScript type of schema property prop. Strings with
+// allowed values are unions of their literals, e.g. "asc" | "desc".
+func tsType(prop *APISchemaProperty) string {
+	switch {
+	case prop.Ref != "":
+		return prop.Ref
+	case len(prop.OneOf) > 0:
+		return tsUnion(prop.OneOf)
+	}
+	switch prop.Type {
+	case "string":
+		if len(prop.enum) > 0 {
+			return tsLiterals(prop.enum)
+		}
+		return "string"
+	case "integer", "number":
+		return "number"
+	case "boolean":
+		return "boolean"
+	case "array":
+		if prop.Items == nil {
+			return "any[]"
+		}
+		el := tsType(prop.Items)
+		if strings.Contains(el, " ") {
+			el = "(" + el + ")"
+		}
+		return el + "[]"
+	}
+	return "any"
+}
+
+// tsUnion returns TypeScript union type of schemas refs.
+func tsUnion(refs []*APISchemaRef) string {
+	names := make([]string, len(refs))
+	for i, ref := range refs {
+		names[i] = ref.Ref
+	}
+	return strings.Join(names, " | ")
+}
+
+// tsLiterals returns TypeScript union type of string literals vals.
+func tsLiterals(vals []string) string {
+	lits := make([]string, len(vals))
+	for i, val := range vals {
+		lits[i] = fmt.Sprintf("%q", val)
+	}
+	return strings.Join(lits, " | ")
+}
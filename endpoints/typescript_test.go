@@ -0,0 +1,129 @@
+package endpoints
+
+import "testing"
+
+type TSItem struct {
+	ID    int64    `json:"id" endpoints:"req"`
+	Name  string   `json:"name" endpoints:"desc=Display name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+	Dash  bool     `json:"is-dash"`
+}
+
+type TSList struct {
+	Items []*TSItem `json:"items"`
+	Next  *TSItem   `json:"next"`
+	Ratio float64   `json:"ratio"`
+}
+
+type TSSortReq struct {
+	Order string   `json:"order" endpoints:"enum=asc|desc"`
+	Sizes []string `json:"sizes" endpoints:"enum=S|M|L"`
+}
+
+type TSService struct{}
+
+func (s *TSService) List(c Context, req *TSItem) (*TSList, error) {
+	return nil, nil
+}
+
+func TestServerTypeScript(t *testing.T) {
+	server := NewServer("")
+	if _, err := server.RegisterService(&TSService{}, "ts", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	out, err := server.TypeScript()
+	if err != nil {
+		t.Fatalf("TypeScript() = %v", err)
+	}
+	want := `export interface TSItem {
+  count?: number;
+  id: string;
+  "is-dash"?: boolean;
+  /** Display name */
+  name?: string;
+  tags?: string[];
+}
+
+export interface TSList {
+  items?: TSItem[];
+  next?: TSItem;
+  ratio?: number;
+}
+`
+	if out != want {
+		t.Errorf("TypeScript() =\n%s\nwant\n%s", out, want)
+	}
+}
+
+type TSSortService struct{}
+
+func (s *TSSortService) List(c Context, req *TSSortReq) (*TSList, error) {
+	return nil, nil
+}
+
+func TestServerTypeScriptEnum(t *testing.T) {
+	server := NewServer("")
+	if _, err := server.RegisterService(&TSSortService{}, "ts", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	out, err := server.TypeScript()
+	if err != nil {
+		t.Fatalf("TypeScript() = %v", err)
+	}
+	want := `export interface TSItem {
+  count?: number;
+  id: string;
+  "is-dash"?: boolean;
+  /** Display name */
+  name?: string;
+  tags?: string[];
+}
+
+export interface TSList {
+  items?: TSItem[];
+  next?: TSItem;
+  ratio?: number;
+}
+
+export interface TSSortReq {
+  order?: "asc" | "desc";
+  sizes?: string[];
+}
+`
+	if out != want {
+		t.Errorf("TypeScript() =\n%s\nwant\n%s", out, want)
+	}
+}
+
+func TestServerTypeScriptOneOf(t *testing.T) {
+	registerShapes(t)
+	server := NewServer("")
+	if _, err := server.RegisterService(&ShapeService{}, "shapes", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	out, err := server.TypeScript()
+	if err != nil {
+		t.Fatalf("TypeScript() = %v", err)
+	}
+	want := `export interface Circle {
+  radius?: number;
+  type?: string;
+}
+
+export interface DrawReq {
+  color?: string;
+  shape?: Circle | Square;
+}
+
+export type Shape = Circle | Square;
+
+export interface Square {
+  side?: number;
+  type?: string;
+}
+`
+	if out != want {
+		t.Errorf("TypeScript() =\n%s\nwant\n%s", out, want)
+	}
+}
@@ -0,0 +1,228 @@
+package endpoints
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"google.golang.org/appengine/log"
+)
+
+// Validator is implemented by request types which have constraints field
+// tags can't express, e.g. a start date which must precede an end date.
+type Validator interface {
+	// Validate is called after a request is decoded and its field tags
+	// are enforced, before it is passed to a service method.
+	// An APIError is sent to the client as is, while any other error
+	// results in 400 Bad Request with the error's message.
+	Validate() error
+}
+
+// validateRequest enforces constraints declared with "endpoints" field tags
+// on a decoded request v, which is normally a pointer to a struct, checks
+// its immutable fields if it implements CurrentValuer, and then calls its
+// Validate method if it implements Validator.
+//
+// Each element of a slice request is validated this way, before the slice
+// itself is validated with Validator.
+//
+// Page size fields (tagged with "pagesize") exceeding their max value are
+// clamped to the max rather than rejected. String fields with "pattern"
+// must match it, those with "enum" must be one of its values, and those
+// with "format" must be in it, unless they're empty. Values of "enumfold"
+// fields are matched case-insensitively and replaced with the canonical
+// values. Slices must have as many elements as "minItems" and "maxItems"
+// allow. Fields with "requiredif" must not be empty when the field they
+// reference has the given value. Errors of fields tagged with "secret"
+// don't include their values. Errors of fields carry a BadRequest detail
+// naming the field.
+func validateRequest(c Context, v reflect.Value) error {
+	if el := reflect.Indirect(v); el.Kind() == reflect.Slice && !isRawBody(el.Type()) {
+		if err := validateElems(c, el); err != nil {
+			return err
+		}
+	} else {
+		if err := validateTags(c, v); err != nil {
+			return err
+		}
+		if err := checkCurrentValue(c, v); err != nil {
+			return err
+		}
+	}
+	validator, ok := v.Interface().(Validator)
+	if !ok || (v.Kind() == reflect.Ptr && v.IsNil()) {
+		return nil
+	}
+	if err := validator.Validate(); err != nil {
+		if _, ok := err.(*APIError); ok {
+			return err
+		}
+		return NewBadRequestError("%v", err)
+	}
+	return nil
+}
+
+// validateElems validates each element of slice v with validateRequest.
+// Messages of errors are prefixed with the index of the invalid element.
+func validateElems(c Context, v reflect.Value) error {
+	for i := 0; i < v.Len(); i++ {
+		el := v.Index(i)
+		if el.Kind() != reflect.Ptr {
+			el = el.Addr()
+		}
+		err := validateRequest(c, el)
+		if err == nil {
+			continue
+		}
+		if apiErr, ok := err.(*APIError); ok {
+			prefixed := *apiErr
+			prefixed.Msg = fmt.Sprintf("Item %d: %s", i, apiErr.Msg)
+			return &prefixed
+		}
+		return fmt.Errorf("Item %d: %v", i, err)
+	}
+	return nil
+}
+
+// validateTags does the tag part of validateRequest. Fields of structs
+// nested in v, directly, through pointers or as elements of slices, are
+// validated too, and named by their path in errors, e.g. "items[0].name".
+func validateTags(c Context, v reflect.Value) error {
+	return validateStructTags(c, "", v)
+}
+
+// validateStructTags is validateTags for struct v, or the struct v points
+// to, whose fields are named with prefix in errors.
+func validateStructTags(c Context, prefix string, v reflect.Value) error {
+	v = reflect.Indirect(v)
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := validateStructTags(c, prefix, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tag, err := parseTag(field.Tag)
+		if err != nil {
+			return err
+		}
+		name := prefix + jsonFieldName(&field)
+		if tag.pageSize {
+			clampPageSize(c, name, v.Field(i), tag.maxVal)
+		}
+		if tag.pattern != "" {
+			if err := checkPattern(name, v.Field(i), tag.pattern); err != nil {
+				return withFieldViolation(name, err)
+			}
+		}
+		if tag.format != "" {
+			if err := checkFormat(name, v.Field(i), tag.format, tag.secret); err != nil {
+				return withFieldViolation(name, err)
+			}
+		}
+		if tag.minItems > 0 || tag.maxItems > 0 {
+			if err := checkItems(name, v.Field(i), tag.minItems, tag.maxItems); err != nil {
+				return withFieldViolation(name, err)
+			}
+		}
+		if tag.requiredIf != "" {
+			if err := checkRequiredIfField(name, v.Field(i), v, tag.requiredIf, tag.requiredIfVal); err != nil {
+				return withFieldViolation(name, err)
+			}
+		}
+		if len(tag.enum) > 0 {
+			if err := checkEnum(name, v.Field(i), tag.enum, tag.enumFold, tag.secret); err != nil {
+				return withFieldViolation(name, err)
+			}
+		}
+		if nestedStruct(field.Type) != nil {
+			if err := validateNested(c, name, v.Field(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateNested validates structs in value v of field name, which is
+// a struct, a pointer to one, or a slice or array of either.
+func validateNested(c Context, name string, v reflect.Value) error {
+	v = reflect.Indirect(v)
+	switch v.Kind() {
+	case reflect.Struct:
+		return validateStructTags(c, name+".", v)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := validateNested(c, fmt.Sprintf("%s[%d]", name, i), v.Index(i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nestedStruct returns the struct type validateTags descends into for
+// a field of type t: a struct, a pointer to one, or a slice or array of
+// either. It returns nil for other types and for structs which encode
+// themselves as JSON, e.g. time.Time.
+func nestedStruct(t reflect.Type) reflect.Type {
+	if k := t.Kind(); (k == reflect.Slice || k == reflect.Array) && !isRawBody(t) {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || implements(reflect.PtrTo(t), typeOfJSONMarshaler) {
+		return nil
+	}
+	return t
+}
+
+// checkItems returns 400 APIError if slice v of field name has fewer than
+// min or more than max elements. Zero min or max is not checked.
+func checkItems(name string, v reflect.Value, min, max int) error {
+	v = reflect.Indirect(v)
+	if !v.IsValid() || v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil
+	}
+	switch n := v.Len(); {
+	case min > 0 && n < min:
+		return NewBadRequestError("Field %q has %d items, at least %d required", name, n, min)
+	case max > 0 && n > max:
+		return NewBadRequestError("Field %q has %d items, at most %d allowed", name, n, max)
+	}
+	return nil
+}
+
+// clampPageSize sets integer value v to max if it exceeds max.
+// Nothing is done if max is empty or v is not an integer.
+func clampPageSize(c Context, name string, v reflect.Value, max string) {
+	v = reflect.Indirect(v)
+	if max == "" || !v.IsValid() {
+		return
+	}
+	switch k := v.Kind(); {
+	case reflect.Int <= k && k <= reflect.Int64:
+		n, err := strconv.ParseInt(max, 0, 64)
+		if err == nil && v.Int() > n {
+			log.Warningf(c, "Page size %q clamped from %d to %d", name, v.Int(), n)
+			v.SetInt(n)
+		}
+	case reflect.Uint <= k && k <= reflect.Uint64:
+		n, err := strconv.ParseUint(max, 0, 64)
+		if err == nil && v.Uint() > n {
+			log.Warningf(c, "Page size %q clamped from %d to %d", name, v.Uint(), n)
+			v.SetUint(n)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package endpoints
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type PageSizeMsg struct {
+	Limit  int   `json:"limit" endpoints:"pagesize,max=100"`
+	PLimit *uint `json:"plimit" endpoints:"pagesize,max=10"`
+	NoMax  int   `json:"nomax" endpoints:"pagesize"`
+}
+
+type RangeMsg struct {
+	Start int `json:"start"`
+	End   int `json:"end" endpoints:"pagesize,max=100"`
+}
+
+func (m *RangeMsg) Validate() error {
+	switch {
+	case m.Start < 0:
+		return &APIError{Name: "Conflict", Msg: "negative start", Code: http.StatusConflict, Reason: "negativeStart"}
+	case m.Start > m.End:
+		return errors.New("start must precede end")
+	}
+	return nil
+}
+
+func TestValidateRequestPageSize(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	big, small := uint(1000), uint(5)
+	tts := []struct {
+		in, want *PageSizeMsg
+	}{
+		{&PageSizeMsg{Limit: 1000}, &PageSizeMsg{Limit: 100}},
+		{&PageSizeMsg{Limit: 100}, &PageSizeMsg{Limit: 100}},
+		{&PageSizeMsg{Limit: 10}, &PageSizeMsg{Limit: 10}},
+		{&PageSizeMsg{PLimit: &big}, &PageSizeMsg{PLimit: new(uint)}},
+		{&PageSizeMsg{PLimit: &small}, &PageSizeMsg{PLimit: &small}},
+		{&PageSizeMsg{NoMax: 1000}, &PageSizeMsg{NoMax: 1000}},
+	}
+	*tts[3].want.PLimit = 10
+
+	for i, tt := range tts {
+		if err := validateRequest(c, reflect.ValueOf(tt.in)); err != nil {
+			t.Errorf("%d: validateRequest(%#v) = %v", i, tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.in, tt.want) {
+			t.Errorf("%d: validateRequest() result = %#v; want %#v", i, tt.in, tt.want)
+		}
+	}
+}
+
+func TestValidateRequestValidator(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	tts := []struct {
+		in     *RangeMsg
+		code   int
+		reason string
+	}{
+		{&RangeMsg{Start: 1, End: 2}, 0, ""},
+		// End is clamped to 100 before Validate is called.
+		{&RangeMsg{Start: 150, End: 200}, http.StatusBadRequest, ""},
+		{&RangeMsg{Start: -1, End: 2}, http.StatusConflict, "negativeStart"},
+	}
+	for i, tt := range tts {
+		err := validateRequest(c, reflect.ValueOf(tt.in))
+		if tt.code == 0 {
+			if err != nil {
+				t.Errorf("%d: validateRequest(%#v) = %v; want nil", i, tt.in, err)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != tt.code || apiErr.Reason != tt.reason {
+			t.Errorf("%d: validateRequest(%#v) = %#v; want APIError code=%d, reason=%q",
+				i, tt.in, err, tt.code, tt.reason)
+		}
+	}
+}
+
+type SlugMsg struct {
+	Slug  string  `json:"slug" endpoints:"req,pattern=^[a-z0-9-]{1,10}$"`
+	Phone *string `json:"phone" endpoints:"pattern=^\\+[0-9]+$"`
+}
+
+type BadPatternMsg struct {
+	Slug string `endpoints:"pattern=[a-z"`
+}
+
+type BadPatternService struct{}
+
+func (s *BadPatternService) Create(c Context, req *BadPatternMsg) error {
+	return nil
+}
+
+func TestValidateRequestPattern(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	phone, badPhone := "+123", "123"
+	tts := []struct {
+		in    *SlugMsg
+		field string
+	}{
+		{&SlugMsg{Slug: "my-slug"}, ""},
+		{&SlugMsg{Slug: "", Phone: &phone}, ""},
+		{&SlugMsg{Slug: "My_Slug"}, "slug"},
+		{&SlugMsg{Slug: "much-too-long"}, "slug"},
+		{&SlugMsg{Slug: "ok", Phone: &badPhone}, "phone"},
+	}
+	for i, tt := range tts {
+		err := validateRequest(c, reflect.ValueOf(tt.in))
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%d: validateRequest(%#v) = %v; want nil", i, tt.in, err)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest || !strings.Contains(apiErr.Msg, `"`+tt.field+`"`) {
+			t.Errorf("%d: validateRequest(%#v) = %v; want 400 APIError naming %q", i, tt.in, err, tt.field)
+		}
+	}
+}
+
+func TestRegisterServiceInvalidPattern(t *testing.T) {
+	server := NewServer("")
+	_, err := server.RegisterService(&BadPatternService{}, "bad", "v1", "", true)
+	if err == nil || !strings.Contains(err.Error(), "BadPatternMsg.Slug") {
+		t.Errorf("RegisterService() = %v; want invalid pattern error", err)
+	}
+}
+
+type NestedMsg struct {
+	Sort   SortMsg     `json:"sort"`
+	Slug   *SlugMsg    `json:"slug"`
+	Sorts  []SortMsg   `json:"sorts"`
+	Slugs  []*SlugMsg  `json:"slugs"`
+	Tags   TagsMsg     `json:"tags"`
+	Levels []NestedMsg `json:"levels"`
+}
+
+type TagsMsg struct {
+	Tags []string `json:"tags" endpoints:"maxItems=1"`
+}
+
+type BadNestedPatternMsg struct {
+	Items []*BadPatternMsg `json:"items"`
+}
+
+type BadNestedPatternService struct{}
+
+func (s *BadNestedPatternService) Create(c Context, req *BadNestedPatternMsg) error {
+	return nil
+}
+
+func TestValidateRequestNested(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	tts := []struct {
+		in    *NestedMsg
+		field string
+	}{
+		{&NestedMsg{}, ""},
+		{&NestedMsg{Sort: SortMsg{Order: "ASC"}, Slug: &SlugMsg{Slug: "ok"}}, ""},
+		{&NestedMsg{Sort: SortMsg{Order: "up"}}, "sort.order"},
+		{&NestedMsg{Slug: &SlugMsg{Slug: "Not_OK"}}, "slug.slug"},
+		{&NestedMsg{Sorts: []SortMsg{{Order: "asc"}, {Order: "up"}}}, "sorts[1].order"},
+		{&NestedMsg{Slugs: []*SlugMsg{nil, {Slug: "Not_OK"}}}, "slugs[1].slug"},
+		{&NestedMsg{Tags: TagsMsg{Tags: []string{"a", "b"}}}, "tags.tags"},
+		{&NestedMsg{Levels: []NestedMsg{{Sort: SortMsg{Order: "up"}}}}, "levels[0].sort.order"},
+	}
+	for i, tt := range tts {
+		err := validateRequest(c, reflect.ValueOf(tt.in))
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%d: validateRequest(%#v) = %v; want nil", i, tt.in, err)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest || len(apiErr.Details) != 1 {
+			t.Errorf("%d: validateRequest(%#v) = %v; want 400 APIError with a detail", i, tt.in, err)
+			continue
+		}
+		br, ok := apiErr.Details[0].(*BadRequest)
+		if !ok || len(br.FieldViolations) != 1 || br.FieldViolations[0].Field != tt.field {
+			t.Errorf("%d: validateRequest(%#v) details = %#v; want violation of %q", i, tt.in, apiErr.Details, tt.field)
+		}
+	}
+
+	in := &NestedMsg{Sorts: []SortMsg{{Order: "ASC"}}}
+	if err := validateRequest(c, reflect.ValueOf(in)); err != nil || in.Sorts[0].Order != "asc" {
+		t.Errorf("validateRequest() = %v, order %q; want nil, %q", err, in.Sorts[0].Order, "asc")
+	}
+}
+
+func TestRegisterServiceInvalidNestedPattern(t *testing.T) {
+	server := NewServer("")
+	_, err := server.RegisterService(&BadNestedPatternService{}, "bad", "v1", "", true)
+	if err == nil || !strings.Contains(err.Error(), "BadPatternMsg.Slug") {
+		t.Errorf("RegisterService() = %v; want invalid pattern error", err)
+	}
+}
+
+type SortMsg struct {
+	Order  string  `json:"order" endpoints:"enum=asc|desc,enumfold"`
+	Format *string `json:"format" endpoints:"enum=json|XML"`
+}
+
+func TestValidateRequestEnum(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	xml, lowerXML := "XML", "xml"
+	tts := []struct {
+		in    *SortMsg
+		order string
+		field string
+	}{
+		{&SortMsg{Order: "asc"}, "asc", ""},
+		{&SortMsg{Order: "DESC"}, "desc", ""},
+		{&SortMsg{Order: "Asc", Format: &xml}, "asc", ""},
+		{&SortMsg{}, "", ""},
+		{&SortMsg{Order: "ascending"}, "", "order"},
+		{&SortMsg{Format: &lowerXML}, "", "format"},
+	}
+	for i, tt := range tts {
+		err := validateRequest(c, reflect.ValueOf(tt.in))
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%d: validateRequest(%#v) = %v; want nil", i, tt.in, err)
+			} else if tt.in.Order != tt.order {
+				t.Errorf("%d: Order = %q; want %q", i, tt.in.Order, tt.order)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest || !strings.Contains(apiErr.Msg, `"`+tt.field+`"`) {
+			t.Errorf("%d: validateRequest(%#v) = %v; want 400 APIError naming %q", i, tt.in, err, tt.field)
+		}
+	}
+}
+
+type ContactMsg struct {
+	Email   string  `json:"email" endpoints:"format=email"`
+	Website *string `json:"website" endpoints:"format=uri"`
+}
+
+func TestValidateRequestFormat(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	site, relative, noHost := "https://example.com/me", "/me", "https:example.com"
+	tts := []struct {
+		in    *ContactMsg
+		field string
+	}{
+		{&ContactMsg{}, ""},
+		{&ContactMsg{Email: "dude@example.com", Website: &site}, ""},
+		{&ContactMsg{Email: "first.last+tag@mail.example.co.uk"}, ""},
+		{&ContactMsg{Email: "dude"}, "email"},
+		{&ContactMsg{Email: "dude@localhost"}, "email"},
+		{&ContactMsg{Email: "dude@-example.com"}, "email"},
+		{&ContactMsg{Email: "Dude <dude@example.com>"}, "email"},
+		{&ContactMsg{Email: "dude@example..com"}, "email"},
+		{&ContactMsg{Website: &relative}, "website"},
+		{&ContactMsg{Website: &noHost}, "website"},
+	}
+	for i, tt := range tts {
+		err := validateRequest(c, reflect.ValueOf(tt.in))
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%d: validateRequest(%#v) = %v; want nil", i, tt.in, err)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest || !strings.Contains(apiErr.Msg, `"`+tt.field+`"`) {
+			t.Errorf("%d: validateRequest(%#v) = %v; want 400 APIError naming %q", i, tt.in, err, tt.field)
+		}
+	}
+
+	schemas := make(map[string]*APISchemaDescriptor)
+	if err := addSchemaFromType(schemas, "", reflect.TypeOf(ContactMsg{})); err != nil {
+		t.Fatalf("addSchemaFromType() = %v", err)
+	}
+	props := schemas["ContactMsg"].Properties
+	if f := props["email"].Format; f != "email" {
+		t.Errorf("email format = %q; want email", f)
+	}
+	if f := props["website"].Format; f != "uri" {
+		t.Errorf("website format = %q; want uri", f)
+	}
+}
+
+type BatchMsg struct {
+	IDs  []int64   `json:"ids" endpoints:"minItems=1,maxItems=3"`
+	Tags *[]string `json:"tags" endpoints:"maxItems=2"`
+}
+
+func TestValidateRequestItems(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	tags := []string{"a", "b", "c"}
+	tts := []struct {
+		in  *BatchMsg
+		msg string
+	}{
+		{&BatchMsg{IDs: []int64{1}}, ""},
+		{&BatchMsg{IDs: []int64{1, 2, 3}}, ""},
+		{&BatchMsg{}, `Field "ids" has 0 items, at least 1 required`},
+		{&BatchMsg{IDs: []int64{1, 2, 3, 4}}, `Field "ids" has 4 items, at most 3 allowed`},
+		{&BatchMsg{IDs: []int64{1}, Tags: &tags}, `Field "tags" has 3 items, at most 2 allowed`},
+	}
+	for i, tt := range tts {
+		err := validateRequest(c, reflect.ValueOf(tt.in))
+		if tt.msg == "" {
+			if err != nil {
+				t.Errorf("%d: validateRequest() = %v; want nil", i, err)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest || apiErr.Msg != tt.msg {
+			t.Errorf("%d: validateRequest() = %v; want 400 APIError %q", i, err, tt.msg)
+		}
+	}
+}
+
+func TestValidateRequestArray(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	tts := []struct {
+		in  interface{}
+		msg string
+	}{
+		{&BulkItems{{"a"}, {"b"}}, ""},
+		{&BulkItems{}, ""},
+		{&BulkItems{{"a"}, {"B"}}, "Item 1: "},
+		{&[]*RangeMsg{{Start: 1, End: 2}, nil, {Start: 3, End: 2}}, "Item 2: "},
+	}
+	for i, tt := range tts {
+		err := validateRequest(c, reflect.ValueOf(tt.in))
+		if tt.msg == "" {
+			if err != nil {
+				t.Errorf("%d: validateRequest() = %v; want nil", i, err)
+			}
+			continue
+		}
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest || !strings.HasPrefix(apiErr.Msg, tt.msg) {
+			t.Errorf("%d: validateRequest() = %v; want 400 APIError starting with %q", i, err, tt.msg)
+		}
+	}
+}
+
+type CredentialsMsg struct {
+	Kind    string    `json:"kind" endpoints:"enum=password|otp,secret"`
+	Email   string    `json:"email" endpoints:"format=email,secret"`
+	Expires time.Time `json:"expires" endpoints:"timeformats=unix,secret"`
+	Pin     int       `json:"pin" endpoints:"secret"`
+}
+
+func TestValidateRequestSecret(t *testing.T) {
+	r, _, closer := newTestRequest(t, "POST", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	for i, in := range []*CredentialsMsg{
+		{Kind: "hunter2"},
+		{Email: "hunter2"},
+	} {
+		err := validateRequest(c, reflect.ValueOf(in))
+		apiErr, ok := err.(*APIError)
+		if !ok || apiErr.Code != http.StatusBadRequest || strings.Contains(apiErr.Msg, "hunter2") {
+			t.Errorf("%d: validateRequest(%#v) = %v; want 400 APIError without the value", i, in, err)
+		}
+	}
+
+	data, err := unmarshalGeneric([]byte(`{"expires":"hunter2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = normalizeTimes(reflect.TypeOf(CredentialsMsg{}), data)
+	if apiErr, ok := err.(*APIError); !ok || strings.Contains(apiErr.Msg, "hunter2") || !strings.Contains(apiErr.Msg, `"expires"`) {
+		t.Errorf("normalizeTimes() = %v; want 400 APIError naming expires without the value", err)
+	}
+
+	q := url.Values{"pin": {"hunter2"}}
+	err = bindQuery(reflect.ValueOf(&CredentialsMsg{}).Elem(), q, 0)
+	if apiErr, ok := err.(*APIError); !ok || strings.Contains(apiErr.Msg, "hunter2") || !strings.Contains(apiErr.Msg, `"pin"`) {
+		t.Errorf("bindQuery(%v) = %v; want 400 APIError naming pin without the value", q, err)
+	}
+}
@@ -0,0 +1,43 @@
+package endpoints
+
+import "golang.org/x/net/context"
+
+// ContextKey is a key of a request-scoped value, e.g. an account resolved
+// by a middleware for service methods to use. Keys are compared by
+// identity, so values stored by different packages never collide, even if
+// their keys have the same name.
+//
+// Declare keys as package variables:
+//
+//	var AccountKey = endpoints.NewContextKey("account")
+type ContextKey struct {
+	name string
+}
+
+// NewContextKey returns a new key. name is only used for debugging.
+func NewContextKey(name string) *ContextKey {
+	return &ContextKey{name}
+}
+
+// String returns the name of k.
+func (k *ContextKey) String() string {
+	return "endpoints context key " + k.name
+}
+
+// WithValue returns a copy of c which carries val under key k. It should
+// be passed on, e.g. to the next function of a Middleware. The value lives
+// only as long as the request of c does.
+func (k *ContextKey) WithValue(c Context, val interface{}) Context {
+	return deriveContext(c, context.WithValue(c, k, val))
+}
+
+// Value returns the value stored under k in c, and whether there's
+// a non-nil one. Callers assert its type:
+//
+//	if v, ok := AccountKey.Value(c); ok {
+//	    account := v.(*Account)
+//	}
+func (k *ContextKey) Value(c Context) (interface{}, bool) {
+	val := c.Value(k)
+	return val, val != nil
+}
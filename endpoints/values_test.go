@@ -0,0 +1,73 @@
+package endpoints
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+var testAccountKey = NewContextKey("account")
+
+type ValueService struct{}
+
+func (s *ValueService) Whoami(c Context) (*TestMsg, error) {
+	v, _ := testAccountKey.Value(c)
+	name, _ := v.(string)
+	return &TestMsg{Name: name}, nil
+}
+
+func TestContextKey(t *testing.T) {
+	r, _, closer := newTestRequest(t, "GET", "/", nil)
+	defer closer()
+	c := cachingContextFactory(r)
+
+	other := NewContextKey("account")
+	if _, ok := testAccountKey.Value(c); ok {
+		t.Errorf("Value() of a fresh context = ok; want none")
+	}
+	vc := testAccountKey.WithValue(c, "alice")
+	if v, ok := testAccountKey.Value(vc); !ok || v != "alice" {
+		t.Errorf("Value() = %v, %v; want alice, true", v, ok)
+	}
+	if v, ok := other.Value(vc); ok {
+		t.Errorf("Value() of another key with the same name = %v; want none", v)
+	}
+}
+
+func TestServerContextKeyMiddleware(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	if _, err := server.RegisterService(&ValueService{}, "values", "v1", "", true); err != nil {
+		t.Fatalf("RegisterService: %v", err)
+	}
+	server.Use(func(c Context, name string, next func(Context) error) error {
+		account := c.HTTPRequest().Header.Get("X-Account")
+		if account == "" {
+			return next(c)
+		}
+		return next(testAccountKey.WithValue(c, account))
+	})
+
+	for i, account := range []string{"alice", "", "bob"} {
+		r, err := inst.NewRequest("POST", "/ValueService.Whoami", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		if account != "" {
+			r.Header.Set("X-Account", account)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		want := `{"name":"` + account + `"}`
+		if out := strings.TrimSpace(w.Body.String()); out != want {
+			t.Errorf("%d: response = %s; want %s", i, out, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package endpoints
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// WebhookSignatureHeader is a header of webhook requests carrying
+	// a signature created with SignWebhook.
+	WebhookSignatureHeader = "X-Signature"
+
+	// DefaultWebhookWindow is how far a webhook signature's timestamp may
+	// be from the current time when VerifyWebhook is passed no window.
+	DefaultWebhookWindow = 5 * time.Minute
+)
+
+// NewWebhookRequest returns a POST request of JSON body to url, e.g.
+// a callback URL registered by a client, signed with secret. Send it with
+// an http.Client, e.g. from urlfetch.Client(c).
+func NewWebhookRequest(url string, body []byte, secret []byte) (*http.Request, error) {
+	r, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set(WebhookSignatureHeader, SignWebhook(secret, currentUTC(), body))
+	return r, nil
+}
+
+// SignWebhook returns a signature of body sent at time t, e.g.
+// "t=1500000000,v1=5257a8...", a hex HMAC-SHA256 of the timestamp, a dot
+// and body with secret. Including the timestamp lets receivers reject
+// replayed requests.
+func SignWebhook(secret []byte, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(webhookMAC(secret, ts, body))
+}
+
+// VerifyWebhook returns the body of webhook request r after checking its
+// signature with secret, and leaves r.Body readable again. It returns 401
+// APIError if the signature is missing or doesn't match, or if it was
+// created more than window away from now. Zero window means
+// DefaultWebhookWindow.
+func VerifyWebhook(r *http.Request, secret []byte, window time.Duration) ([]byte, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	sig := r.Header.Get(WebhookSignatureHeader)
+	if err := VerifyWebhookSignature(secret, sig, body, window); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// VerifyWebhookSignature checks signature sig of body, created with
+// SignWebhook, like VerifyWebhook does.
+func VerifyWebhookSignature(secret []byte, sig string, body []byte, window time.Duration) error {
+	var ts string
+	var macs [][]byte
+	for _, part := range strings.Split(sig, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "t":
+			ts = kv[1]
+		case "v1":
+			if mac, err := hex.DecodeString(kv[1]); err == nil {
+				macs = append(macs, mac)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(macs) == 0 {
+		return NewUnauthorizedError("Missing or malformed webhook signature")
+	}
+
+	if window <= 0 {
+		window = DefaultWebhookWindow
+	}
+	if d := currentUTC().Sub(time.Unix(sec, 0)); d > window || d < -window {
+		return NewUnauthorizedError("Webhook signature timestamp is out of range")
+	}
+
+	want := webhookMAC(secret, ts, body)
+	for _, mac := range macs {
+		if hmac.Equal(mac, want) {
+			return nil
+		}
+	}
+	return NewUnauthorizedError("Invalid webhook signature")
+}
+
+// webhookMAC returns HMAC-SHA256 of timestamp ts and body with secret.
+func webhookMAC(secret []byte, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(ts))
+	h.Write([]byte{'.'})
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,81 @@
+package endpoints
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	origCurrentUTC := currentUTC
+	defer func() { currentUTC = origCurrentUTC }()
+	now := time.Unix(1500000000, 0).UTC()
+	currentUTC = func() time.Time { return now }
+
+	secret := []byte("secret")
+	body := []byte(`{"status":"done"}`)
+	sig := SignWebhook(secret, now, body)
+	if !strings.HasPrefix(sig, "t=1500000000,v1=") {
+		t.Fatalf("SignWebhook() = %q; want t=1500000000,v1=... prefix", sig)
+	}
+
+	tts := []struct {
+		secret string
+		sig    string
+		body   string
+		window time.Duration
+		ok     bool
+	}{
+		{"secret", sig, string(body), 0, true},
+		{"secret", "v1=0000, " + sig, string(body), 0, true},
+		{"other", sig, string(body), 0, false},
+		{"secret", sig, `{"status":"failed"}`, 0, false},
+		{"secret", "", string(body), 0, false},
+		{"secret", "t=1500000000", string(body), 0, false},
+		{"secret", SignWebhook(secret, now.Add(-4*time.Minute), body), string(body), 0, true},
+		{"secret", SignWebhook(secret, now.Add(-6*time.Minute), body), string(body), 0, false},
+		{"secret", SignWebhook(secret, now.Add(6*time.Minute), body), string(body), 0, false},
+		{"secret", SignWebhook(secret, now.Add(-6*time.Minute), body), string(body), 10 * time.Minute, true},
+	}
+	for i, tt := range tts {
+		err := VerifyWebhookSignature([]byte(tt.secret), tt.sig, []byte(tt.body), tt.window)
+		if tt.ok && err != nil {
+			t.Errorf("%d: VerifyWebhookSignature(%q) = %v; want nil", i, tt.sig, err)
+		}
+		if !tt.ok {
+			if apiErr, ok := err.(*APIError); !ok || apiErr.Code != http.StatusUnauthorized {
+				t.Errorf("%d: VerifyWebhookSignature(%q) = %v; want 401 APIError", i, tt.sig, err)
+			}
+		}
+	}
+}
+
+func TestWebhookRequest(t *testing.T) {
+	secret := []byte("secret")
+	body := []byte(`{"status":"done"}`)
+	r, err := NewWebhookRequest("https://example.org/callback", body, secret)
+	if err != nil {
+		t.Fatalf("NewWebhookRequest: %v", err)
+	}
+	if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("request = %s, %q; want POST application/json", r.Method, r.Header.Get("Content-Type"))
+	}
+
+	got, err := VerifyWebhook(r, secret, 0)
+	if err != nil {
+		t.Fatalf("VerifyWebhook: %v", err)
+	}
+	if string(got) != string(body) {
+		t.Errorf("VerifyWebhook() = %s; want %s", got, body)
+	}
+	if again, _ := ioutil.ReadAll(r.Body); string(again) != string(body) {
+		t.Errorf("r.Body after VerifyWebhook = %s; want %s", again, body)
+	}
+
+	r.Header.Del(WebhookSignatureHeader)
+	if _, err := VerifyWebhook(r, secret, 0); err == nil {
+		t.Errorf("VerifyWebhook() of unsigned request = nil; want error")
+	}
+}
@@ -0,0 +1,90 @@
+package endpoints
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+)
+
+// pathWildcard marks a path parameter capturing the rest of the path, as
+// in "proxy/{rest=**}".
+const pathWildcard = "**"
+
+// wildcardParam returns the name of the parameter capturing the rest of
+// path template path, or "" if there's none. It returns an error if such
+// a parameter is not the last segment of path.
+func wildcardParam(path string) (string, error) {
+	const suffix = "=" + pathWildcard + "}"
+	i := strings.Index(path, suffix)
+	if i < 0 {
+		return "", nil
+	}
+	if i != len(path)-len(suffix) {
+		return "", fmt.Errorf("wildcard path parameter must be the last segment of %q", path)
+	}
+	start := strings.LastIndex(path[:i], "{")
+	if start > 0 && path[start-1] != '/' {
+		return "", fmt.Errorf("wildcard path parameter must be a whole segment of %q", path)
+	}
+	return path[start+1 : i], nil
+}
+
+// pathKey returns path template path with parameter names left out, so
+// that templates matching the same paths have the same key. Wildcards are
+// kept apart since a more specific template takes precedence over them.
+func pathKey(path string) string {
+	return curlyBrackets.ReplaceAllStringFunc(path, func(p string) string {
+		if strings.HasSuffix(p, "="+pathWildcard+"}") {
+			return "{" + pathWildcard + "}"
+		}
+		return "{}"
+	})
+}
+
+// bindWildcard URL-decodes the value of the field of request v, a struct,
+// captured by the wildcard parameter of the path of method m, since the
+// rest of the path is passed as is. It returns 400 APIError if the value
+// isn't properly escaped.
+func bindWildcard(m *ServiceMethod, v reflect.Value) error {
+	if m.info == nil || v.Kind() != reflect.Struct {
+		return nil
+	}
+	name, err := wildcardParam(m.info.Path)
+	if err != nil || name == "" {
+		return nil
+	}
+	field := wildcardField(v, name)
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return nil
+	}
+	s, err := url.PathUnescape(field.String())
+	if err != nil {
+		return NewBadRequestError("Invalid value of path parameter %q: %v", name, err)
+	}
+	field.SetString(s)
+	return nil
+}
+
+// wildcardField returns the field of struct v, or of its embedded structs,
+// named name in JSON, or an invalid value if there's none.
+func wildcardField(v reflect.Value, name string) reflect.Value {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		// consider only exported fields
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if f := wildcardField(v.Field(i), name); f.IsValid() {
+				return f
+			}
+			continue
+		}
+		if jsonFieldName(&field) == name {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
@@ -0,0 +1,82 @@
+package endpoints
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"appengine/aetest"
+)
+
+type ProxyReq struct {
+	Rest string `json:"rest"`
+}
+
+type ProxyService struct{}
+
+func (s *ProxyService) Forward(c Context, req *ProxyReq) (*TestMsg, error) {
+	return &TestMsg{Name: req.Rest}, nil
+}
+
+func TestWildcardParam(t *testing.T) {
+	tts := []struct {
+		path, name string
+		err        bool
+	}{
+		{"proxy", "", false},
+		{"proxy/{id}", "", false},
+		{"proxy/{rest=**}", "rest", false},
+		{"{rest=**}", "rest", false},
+		{"proxy/{id}/{rest=**}", "rest", false},
+		{"proxy/{rest=**}/more", "", true},
+		{"proxy/x{rest=**}", "", true},
+	}
+	for _, tt := range tts {
+		name, err := wildcardParam(tt.path)
+		if name != tt.name || (err != nil) != tt.err {
+			t.Errorf("wildcardParam(%q) = %q, %v; want %q, error %t", tt.path, name, err, tt.name, tt.err)
+		}
+	}
+}
+
+func TestServerWildcardPath(t *testing.T) {
+	inst, err := aetest.NewInstance(nil)
+	if err != nil {
+		t.Fatalf("failed to create instance: %v", err)
+	}
+	defer inst.Close()
+
+	server := NewServer("")
+	s, err := server.RegisterService(&ProxyService{}, "Proxy", "v1", "", true)
+	if err != nil {
+		t.Fatalf("RegisterService() = %v", err)
+	}
+	info := s.MethodByName("Forward").Info()
+	info.HTTPMethod, info.Path = "POST", "proxy/{rest=**}"
+	if err := server.Validate(); err != nil {
+		t.Fatalf("Validate() = %v", err)
+	}
+
+	tts := []struct {
+		body string
+		code int
+		out  string
+	}{
+		{`{"rest": "a/b%20c/d%2Fe"}`, http.StatusOK, `{"name":"a/b c/d/e"}`},
+		{`{"rest": ""}`, http.StatusOK, `{"name":""}`},
+		{`{"rest": "100%"}`, http.StatusBadRequest, `parameter \"rest\"`},
+	}
+	for i, tt := range tts {
+		r, err := inst.NewRequest("POST", "/ProxyService.Forward", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatalf("%d: failed to create req: %v", i, err)
+		}
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+
+		if w.Code != tt.code || !strings.Contains(w.Body.String(), tt.out) {
+			t.Errorf("%d: ServeHTTP(%s) = %d %s; want %d containing %s", i, tt.body, w.Code, w.Body, tt.code, tt.out)
+		}
+	}
+}